@@ -79,27 +79,39 @@ alter sequence public.gym_machines_id_seq owned by public.gym_machines.id;
 
 create table public.clients
 (
-    id                integer generated always as identity
+    id                 integer generated always as identity
         constraint clients_pk
             primary key,
-    name              varchar(128),
-    cif               varchar(13),
-    dob               date,
-    trade_register_no varchar(16),
-    country_id        integer,
-    state_id          integer,
-    city              varchar(64),
-    street_name       varchar(64),
-    street_no         varchar(16),
-    building          varchar(16),
-    floor             varchar(8),
-    apartment         varchar(8),
-    created_on        date default now(),
-    updated_on        date default now(),
-    created_by        integer,
-    updated_by        integer
+    client_type        varchar(8) default 'person',
+    guardian_client_id integer,
+    name               varchar(128),
+    cif                varchar(13),
+    dob                date,
+    trade_register_no  varchar(16),
+    country_id         integer,
+    state_id           integer,
+    city               varchar(64),
+    street_name        varchar(64),
+    street_no          varchar(16),
+    building           varchar(16),
+    floor              varchar(8),
+    apartment          varchar(8),
+    phone              varchar(32),
+    email              varchar(128),
+    photo_key          varchar(256),
+    thumbnail_key      varchar(256),
+    created_on         date default now(),
+    updated_on         date default now(),
+    created_by         integer,
+    updated_by         integer
 );
 
+comment on column public.clients.client_type is 'person/company/guest (walk-ins and guests of members)';
+
+comment on column public.clients.cif is 'CNP for persons, CUI/CIF for companies';
+
+comment on column public.clients.photo_key is 'Blob store key of the client photo';
+
 alter table public.clients
     owner to gogymrest;
 
@@ -153,36 +165,70 @@ create index states_country_id_index
 
 create table public.memberships
 (
-    id        integer generated always as identity
+    id              integer generated always as identity
         constraint memberships_pk
             primary key,
-    name      varchar(128),
-    is_active boolean default false,
-    days_no   integer default 30,
-    level     integer default 0
+    name            varchar(128),
+    is_active       boolean default false,
+    days_no         integer default 30,
+    level           integer default 0,
+    plan_type       varchar(8) default 'time',
+    entries_no      integer,
+    guest_passes_no integer default 0
 );
 
+comment on column public.memberships.days_no is 'Validity in days (for entry plans, the period in which entries can be used)';
+
+comment on column public.memberships.plan_type is 'time/entries/hybrid/day';
+
+comment on column public.memberships.entries_no is 'Number of entries for entries/hybrid plans';
+
+comment on column public.memberships.guest_passes_no is 'Guests a member can bring during the membership';
+
 alter table public.memberships
     owner to gogymrest;
 
 create table public.client_memberships
 (
-    id            integer generated always as identity
+    id                      integer generated always as identity
         constraint client_memberships_pk
             primary key,
-    client_id     integer,
-    membership_id integer,
-    starting_from date,
-    ending_on     date,
-    status        varchar(8),
-    created_on    date default now(),
-    updated_on    date default now(),
-    created_by    integer,
-    updated_by    integer,
-    canceleted_on date
+    client_id               integer,
+    membership_id           integer,
+    starting_from           date,
+    ending_on               date,
+    status                  varchar(16),
+    created_on              date default now(),
+    updated_on              date default now(),
+    created_by              integer,
+    updated_by              integer,
+    canceleted_on           date,
+    corporate_allocation_id integer,
+    remaining_entries       integer,
+    remaining_guest_passes  integer default 0,
+    auto_renew              boolean default false,
+    renewal_gym_id          integer,
+    renewed_from_id         integer,
+    dunning_status          varchar(16)
 );
 
-comment on column public.client_memberships.status is 'active/inactive/freezed';
+comment on column public.client_memberships.remaining_entries is 'Entries left for entries/hybrid plans, null for time plans';
+
+comment on column public.client_memberships.remaining_guest_passes is 'Guest passes left on the membership';
+
+comment on column public.client_memberships.status is 'active/inactive/suspended/expired/canceled, changed after a plan change, transferred after a transfer';
+
+comment on column public.client_memberships.corporate_allocation_id is 'Set when the membership is paid by a corporate account';
+
+comment on column public.client_memberships.auto_renew is 'The next period is sold and invoiced automatically before ending_on';
+
+comment on column public.client_memberships.renewal_gym_id is 'Gym whose price list renewals are invoiced with, null for the default prices';
+
+comment on column public.client_memberships.renewed_from_id is 'Period this membership was automatically renewed from';
+
+comment on column public.client_memberships.canceleted_on is 'Date a cancellation takes effect';
+
+comment on column public.client_memberships.dunning_status is 'Renewal invoice state: unpaid/overdue/suspended/paid, null when not a renewal';
 
 alter table public.client_memberships
     owner to gogymrest;
@@ -193,18 +239,70 @@ create index client_memberships_client_id_index
 create index client_memberships_membership_id_index
     on public.client_memberships (membership_id);
 
+create index client_memberships_corporate_allocation_id_index
+    on public.client_memberships (corporate_allocation_id);
+
+create index client_memberships_renewed_from_id_index
+    on public.client_memberships (renewed_from_id);
+
 create table public.gyms
 (
-    id      integer generated always as identity
+    id                            integer generated always as identity
         constraint gyms_pk
             primary key,
-    name    varchar(128),
-    members integer
+    name                          varchar(128),
+    members                       integer,
+    min_age                       integer default 14,
+    consent_age                   integer default 18,
+    time_zone                     varchar(64) default 'Europe/Bucharest',
+    brand_color                   varchar(7) default '#1F4E79',
+    address                       varchar(256),
+    phone                         varchar(32),
+    email                         varchar(128),
+    website                       varchar(128),
+    logo_key                      varchar(256),
+    document_footer               varchar(512),
+    contract_terms                text,
+    cancellation_notice_days      integer default 30,
+    cancellation_fee              numeric(10, 2) default 0,
+    cancellation_fee_percent      numeric(5, 2) default 0,
+    cancellation_cooling_off_days integer default 14,
+    no_show_strikes               integer default 3,
+    no_show_window_days           integer default 30,
+    no_show_ban_days              integer default 7,
+    no_show_fee                   numeric(10, 2) default 0,
+    no_show_fee_vat_rate          numeric(5, 2) default 21
 );
 
 alter table public.gyms
     owner to gogymrest;
 
+comment on column public.gyms.min_age is 'Clients younger than this are not admitted';
+
+comment on column public.gyms.consent_age is 'Clients younger than this need a guardian consent';
+
+comment on column public.gyms.time_zone is 'IANA time zone used to evaluate membership time windows';
+
+comment on column public.gyms.brand_color is 'Accent color (#RRGGBB) of generated documents';
+
+comment on column public.gyms.logo_key is 'Blob store key of the logo printed on documents (JPEG)';
+
+comment on column public.gyms.contract_terms is 'Custom membership contract clauses (text/template), null for the default ones';
+
+comment on column public.gyms.cancellation_notice_days is 'Days between a cancellation request and the end of access';
+
+comment on column public.gyms.cancellation_fee is 'Fixed amount kept from the refund of a cancelled membership';
+
+comment on column public.gyms.cancellation_fee_percent is 'Percentage of the refundable amount kept on cancellation';
+
+comment on column public.gyms.cancellation_cooling_off_days is 'Days after the sale an unused membership is refunded in full, without notice or fee';
+
+comment on column public.gyms.no_show_strikes is 'No-shows within no_show_window_days that ban the client from booking, 0 for no bans';
+
+comment on column public.gyms.no_show_ban_days is 'Days a client cannot book classes or appointments after too many no-shows';
+
+comment on column public.gyms.no_show_fee is 'Amount invoiced for every no-show, VAT included; 0 for no fee';
+
 create table public.membership_gyms
 (
     id            integer generated always as identity
@@ -266,18 +364,27 @@ alter table public.machines
 
 create table public.client_passes
 (
-    id         integer generated always as identity
+    id                   integer generated always as identity
         constraint client_passes_pk
             primary key,
-    gym_id     integer,
-    client_id  integer,
-    created_on date default now(),
-    action     varchar(3),
-    created_by integer
+    gym_id               integer,
+    client_id            integer,
+    created_on           date default now(),
+    action               varchar(3),
+    created_by           integer,
+    client_membership_id integer,
+    host_client_id       integer,
+    class_session_id     integer
 );
 
 comment on column public.client_passes.action is 'IN/OUT';
 
+comment on column public.client_passes.client_membership_id is 'Membership used for the check-in (the host''s membership for guests)';
+
+comment on column public.client_passes.host_client_id is 'Member who brought the guest';
+
+comment on column public.client_passes.class_session_id is 'Group class the client checked in for';
+
 alter table public.client_passes
     owner to gogymrest;
 
@@ -287,6 +394,9 @@ create index client_passes_client_id_index
 create index client_passes_gym_id_index
     on public.client_passes (gym_id);
 
+create index client_passes_host_client_id_index
+    on public.client_passes (host_client_id);
+
 create table public.gym_reservations
 (
     id         integer generated always as identity
@@ -363,3 +473,1311 @@ create index user_clients_client_id_index
 create index user_clients_user_id_index
     on public.user_clients (user_id);
 
+
+create table public.membership_reminders
+(
+    id                   integer generated always as identity
+        constraint membership_reminders_pk
+            primary key,
+    client_membership_id integer,
+    client_id            integer,
+    days_before          integer,
+    ending_on            date,
+    created_on           date default now()
+);
+
+comment on table public.membership_reminders is 'Renewal reminders already emitted, one per membership and lead time';
+
+alter table public.membership_reminders
+    owner to gogymrest;
+
+create unique index membership_reminders_client_membership_id_days_before_uindex
+    on public.membership_reminders (client_membership_id, days_before);
+
+create index client_memberships_ending_on_index
+    on public.client_memberships (ending_on);
+
+create table public.client_contact_preferences
+(
+    id                integer generated always as identity
+        constraint client_contact_preferences_pk
+            primary key,
+    client_id         integer,
+    language          varchar(2) default 'ro',
+    preferred_channel varchar(8) default 'email',
+    email_opt_out     boolean    default false,
+    sms_opt_out       boolean    default false,
+    updated_on        date       default now(),
+    updated_by        integer
+);
+
+comment on column public.client_contact_preferences.preferred_channel is 'email/sms/none';
+
+alter table public.client_contact_preferences
+    owner to gogymrest;
+
+create unique index client_contact_preferences_client_id_uindex
+    on public.client_contact_preferences (client_id);
+
+create table public.notification_outbox
+(
+    id              integer generated always as identity
+        constraint notification_outbox_pk
+            primary key,
+    client_id       integer,
+    channel         varchar(8),
+    recipient       varchar(128),
+    template        varchar(64),
+    language        varchar(2),
+    subject         varchar(256),
+    body            text,
+    status          varchar(8) default 'pending',
+    attempts        integer    default 0,
+    last_error      text,
+    next_attempt_on timestamp  default now(),
+    created_on      timestamp  default now(),
+    sent_on         timestamp,
+    attachment_name varchar(64),
+    attachment_type varchar(64),
+    attachment      text
+);
+
+comment on column public.notification_outbox.status is 'pending/sending/sent/failed';
+
+comment on column public.notification_outbox.next_attempt_on is 'For sending rows, end of the lease after which they are marked failed, as they may have been sent';
+
+comment on column public.notification_outbox.attachment is 'Text file attached to emails, e.g. an iCalendar event';
+
+alter table public.notification_outbox
+    owner to gogymrest;
+
+create index notification_outbox_status_next_attempt_on_index
+    on public.notification_outbox (status, next_attempt_on);
+
+create index notification_outbox_client_id_index
+    on public.notification_outbox (client_id);
+
+create table public.client_emergency_contacts
+(
+    id           integer generated always as identity
+        constraint client_emergency_contacts_pk
+            primary key,
+    client_id    integer,
+    name         varchar(128),
+    relationship varchar(32),
+    phone        varchar(32),
+    created_on   date default now(),
+    created_by   integer
+);
+
+alter table public.client_emergency_contacts
+    owner to gogymrest;
+
+create index client_emergency_contacts_client_id_index
+    on public.client_emergency_contacts (client_id);
+
+create table public.client_guardian_consents
+(
+    id                 integer generated always as identity
+        constraint client_guardian_consents_pk
+            primary key,
+    client_id          integer,
+    guardian_client_id integer,
+    consent_date       date,
+    document_ref       varchar(64),
+    notes              varchar(256),
+    revoked_on         date,
+    revoked_by         integer,
+    created_on         date default now(),
+    created_by         integer
+);
+
+alter table public.client_guardian_consents
+    owner to gogymrest;
+
+create index client_guardian_consents_client_id_index
+    on public.client_guardian_consents (client_id);
+
+create table public.corporate_accounts
+(
+    id                integer generated always as identity
+        constraint corporate_accounts_pk
+            primary key,
+    company_client_id integer,
+    contact_name      varchar(128),
+    contact_email     varchar(128),
+    status            varchar(8) default 'active',
+    created_on        date default now(),
+    updated_on        date default now(),
+    created_by        integer,
+    updated_by        integer
+);
+
+comment on column public.corporate_accounts.status is 'active/closed';
+
+alter table public.corporate_accounts
+    owner to gogymrest;
+
+create unique index corporate_accounts_company_client_id_uindex
+    on public.corporate_accounts (company_client_id);
+
+create table public.corporate_employees
+(
+    id                   integer generated always as identity
+        constraint corporate_employees_pk
+            primary key,
+    corporate_account_id integer,
+    client_id            integer,
+    employee_no          varchar(32),
+    joined_on            date default now(),
+    left_on              date,
+    created_by           integer,
+    updated_by           integer
+);
+
+alter table public.corporate_employees
+    owner to gogymrest;
+
+create index corporate_employees_corporate_account_id_index
+    on public.corporate_employees (corporate_account_id);
+
+-- An employee is sponsored by at most one company at a time
+create unique index corporate_employees_active_client_id_uindex
+    on public.corporate_employees (client_id)
+    where left_on is null;
+
+create table public.corporate_allocations
+(
+    id                   integer generated always as identity
+        constraint corporate_allocations_pk
+            primary key,
+    corporate_account_id integer,
+    membership_id        integer,
+    seats                integer,
+    valid_from           date,
+    valid_to             date,
+    created_on           date default now(),
+    created_by           integer
+);
+
+comment on column public.corporate_allocations.seats is 'Maximum concurrent company-paid memberships';
+
+alter table public.corporate_allocations
+    owner to gogymrest;
+
+create index corporate_allocations_corporate_account_id_index
+    on public.corporate_allocations (corporate_account_id);
+
+create table public.membership_time_windows
+(
+    id            integer generated always as identity
+        constraint membership_time_windows_pk
+            primary key,
+    membership_id integer,
+    weekday       integer,
+    start_time    time,
+    end_time      time,
+    created_on    date default now(),
+    created_by    integer
+);
+
+comment on table public.membership_time_windows is 'Allowed entry windows; a membership without windows has no time restriction';
+
+comment on column public.membership_time_windows.weekday is 'ISO weekday, 1 = Monday ... 7 = Sunday';
+
+alter table public.membership_time_windows
+    owner to gogymrest;
+
+create index membership_time_windows_membership_id_index
+    on public.membership_time_windows (membership_id);
+
+create table public.membership_prices
+(
+    id            integer generated always as identity
+        constraint membership_prices_pk
+            primary key,
+    membership_id integer,
+    gym_id        integer,
+    price         numeric(10, 2),
+    vat_rate      numeric(5, 2) default 21,
+    currency      varchar(3) default 'RON',
+    valid_from    date default now(),
+    valid_to      date,
+    created_on    date default now(),
+    created_by    integer
+);
+
+comment on column public.membership_prices.gym_id is 'Gym-specific price; null for the default price of the membership';
+
+comment on column public.membership_prices.price is 'Gross price, VAT included';
+
+alter table public.membership_prices
+    owner to gogymrest;
+
+create index membership_prices_membership_id_index
+    on public.membership_prices (membership_id);
+
+create table public.invoice_series
+(
+    id         integer generated always as identity
+        constraint invoice_series_pk
+            primary key,
+    gym_id     integer,
+    code       varchar(8),
+    next_no    integer default 1,
+    created_on date default now()
+);
+
+comment on column public.invoice_series.gym_id is 'Series used by the gym; the series with a null gym is the default';
+
+alter table public.invoice_series
+    owner to gogymrest;
+
+create unique index invoice_series_code_uindex
+    on public.invoice_series (code);
+
+create table public.invoices
+(
+    id                  integer generated always as identity
+        constraint invoices_pk
+            primary key,
+    series_code         varchar(8),
+    number              integer,
+    client_id           integer,
+    gym_id              integer,
+    issue_date          date default now(),
+    due_date            date,
+    currency            varchar(3) default 'RON',
+    net_amount          numeric(10, 2) default 0,
+    vat_amount          numeric(10, 2) default 0,
+    total_amount        numeric(10, 2) default 0,
+    paid_amount         numeric(10, 2) default 0,
+    status              varchar(16) default 'unpaid',
+    created_on          date default now(),
+    created_by          integer,
+    invoice_type        varchar(16) default 'invoice',
+    credited_invoice_id integer
+);
+
+comment on column public.invoices.status is 'unpaid/partially_paid/paid/cancelled';
+
+comment on column public.invoices.invoice_type is 'invoice/credit_note; credit notes carry negative amounts';
+
+comment on column public.invoices.credited_invoice_id is 'Invoice a credit note reverses';
+
+alter table public.invoices
+    owner to gogymrest;
+
+create unique index invoices_series_code_number_uindex
+    on public.invoices (series_code, number);
+
+create index invoices_client_id_index
+    on public.invoices (client_id);
+
+create table public.invoice_lines
+(
+    id                   integer generated always as identity
+        constraint invoice_lines_pk
+            primary key,
+    invoice_id           integer,
+    client_membership_id integer,
+    description          varchar(256),
+    quantity             numeric(10, 2) default 1,
+    unit_price           numeric(10, 2),
+    vat_rate             numeric(5, 2),
+    net_amount           numeric(10, 2),
+    vat_amount           numeric(10, 2),
+    total_amount         numeric(10, 2)
+);
+
+comment on column public.invoice_lines.unit_price is 'Net unit price, VAT excluded';
+
+alter table public.invoice_lines
+    owner to gogymrest;
+
+create index invoice_lines_invoice_id_index
+    on public.invoice_lines (invoice_id);
+
+create index invoice_lines_client_membership_id_index
+    on public.invoice_lines (client_membership_id);
+
+create table public.payments
+(
+    id         integer generated always as identity
+        constraint payments_pk
+            primary key,
+    invoice_id integer,
+    amount     numeric(10, 2),
+    method     varchar(8),
+    paid_on    date default now(),
+    reference  varchar(64),
+    created_on date default now(),
+    created_by integer
+);
+
+comment on column public.payments.method is 'cash/card/transfer, or credit when settled by a credit note';
+
+comment on column public.payments.reference is 'Card slip or bank transfer reference';
+
+alter table public.payments
+    owner to gogymrest;
+
+create index payments_invoice_id_index
+    on public.payments (invoice_id);
+
+create table public.promo_codes
+(
+    id                  integer generated always as identity
+        constraint promo_codes_pk
+            primary key,
+    code                varchar(32),
+    description         varchar(256),
+    discount_type       varchar(8),
+    discount_value      numeric(10, 2),
+    membership_id       integer,
+    gym_id              integer,
+    valid_from          date default now(),
+    valid_to            date,
+    max_uses            integer,
+    max_uses_per_client integer default 1,
+    uses_count          integer default 0,
+    is_active           boolean default true,
+    created_on          date default now(),
+    created_by          integer
+);
+
+comment on column public.promo_codes.discount_type is 'percent/fixed';
+
+comment on column public.promo_codes.discount_value is 'Percentage, or fixed amount off the gross price in the invoice currency';
+
+comment on column public.promo_codes.membership_id is 'Plan the code applies to, null for every plan';
+
+comment on column public.promo_codes.gym_id is 'Gym the code is valid at, null for every gym';
+
+comment on column public.promo_codes.max_uses is 'Total redemptions allowed, null for no limit';
+
+comment on column public.promo_codes.max_uses_per_client is 'Redemptions allowed per client, null for no limit';
+
+alter table public.promo_codes
+    owner to gogymrest;
+
+create unique index promo_codes_code_uindex
+    on public.promo_codes (upper(code));
+
+create table public.promo_redemptions
+(
+    id                   integer generated always as identity
+        constraint promo_redemptions_pk
+            primary key,
+    promo_code_id        integer,
+    client_id            integer,
+    client_membership_id integer,
+    invoice_id           integer,
+    price                numeric(10, 2),
+    discount_amount      numeric(10, 2),
+    redeemed_on          date default now(),
+    created_by           integer
+);
+
+comment on column public.promo_redemptions.price is 'Gross price before the discount';
+
+alter table public.promo_redemptions
+    owner to gogymrest;
+
+create index promo_redemptions_promo_code_id_index
+    on public.promo_redemptions (promo_code_id);
+
+create index promo_redemptions_client_id_index
+    on public.promo_redemptions (client_id);
+
+create table public.client_referrals
+(
+    id                            integer generated always as identity
+        constraint client_referrals_pk
+            primary key,
+    referrer_client_id            integer,
+    referred_client_id            integer,
+    reward_days                   integer,
+    status                        varchar(16) default 'pending',
+    referred_on                   date default now(),
+    qualified_on                  date,
+    rewarded_on                   date,
+    rewarded_client_membership_id integer,
+    created_by                    integer
+);
+
+comment on column public.client_referrals.status is 'pending/earned/rewarded';
+
+comment on column public.client_referrals.reward_days is 'Free days appended to the referrer''s active membership';
+
+comment on column public.client_referrals.qualified_on is 'Day the referred client paid their first membership invoice';
+
+comment on column public.client_referrals.rewarded_client_membership_id is 'Membership of the referrer the free days were appended to';
+
+alter table public.client_referrals
+    owner to gogymrest;
+
+create unique index client_referrals_referred_client_id_uindex
+    on public.client_referrals (referred_client_id);
+
+create index client_referrals_referrer_client_id_index
+    on public.client_referrals (referrer_client_id);
+
+create table public.membership_cancellations
+(
+    id                   integer generated always as identity
+        constraint membership_cancellations_pk
+            primary key,
+    client_membership_id integer,
+    client_id            integer,
+    reason               varchar(256),
+    requested_on         date default now(),
+    effective_on         date,
+    used_days            integer,
+    total_days           integer,
+    cooling_off          boolean default false,
+    invoice_id           integer,
+    credit_note_id       integer,
+    currency             varchar(3),
+    refundable_amount    numeric(10, 2) default 0,
+    fee_amount           numeric(10, 2) default 0,
+    credit_amount        numeric(10, 2) default 0,
+    refund_amount        numeric(10, 2) default 0,
+    refund_method        varchar(8),
+    created_by           integer
+);
+
+comment on column public.membership_cancellations.refundable_amount is 'Invoiced amount of the unused part, before the fee';
+
+comment on column public.membership_cancellations.credit_amount is 'Amount of the credit note: refundable amount less the fee';
+
+comment on column public.membership_cancellations.refund_amount is 'Part of the credit paid back to the client; the rest settles the invoice balance';
+
+alter table public.membership_cancellations
+    owner to gogymrest;
+
+create unique index membership_cancellations_client_membership_id_uindex
+    on public.membership_cancellations (client_membership_id);
+
+create index membership_cancellations_client_id_index
+    on public.membership_cancellations (client_id);
+
+create table public.client_membership_changes
+(
+    id                       integer generated always as identity
+        constraint client_membership_changes_pk
+            primary key,
+    change_type              varchar(16),
+    client_membership_id     integer,
+    new_client_membership_id integer,
+    from_client_id           integer,
+    to_client_id             integer,
+    from_membership_id       integer,
+    to_membership_id         integer,
+    effective_on             date,
+    credit_amount            numeric(10, 2) default 0,
+    credit_note_id           integer,
+    invoice_id               integer,
+    refund_amount            numeric(10, 2) default 0,
+    refund_method            varchar(8),
+    reason                   varchar(256),
+    created_on               timestamp default now(),
+    created_by               integer
+);
+
+comment on column public.client_membership_changes.change_type is 'upgrade/downgrade/transfer';
+
+comment on column public.client_membership_changes.credit_amount is 'Value of the unused part of the previous plan, credited on a plan change';
+
+comment on column public.client_membership_changes.invoice_id is 'Invoice of the new plan';
+
+comment on column public.client_membership_changes.refund_amount is 'Part of the credit left after settling both invoices, paid back to the client';
+
+alter table public.client_membership_changes
+    owner to gogymrest;
+
+create index client_membership_changes_from_client_id_index
+    on public.client_membership_changes (from_client_id);
+
+create index client_membership_changes_to_client_id_index
+    on public.client_membership_changes (to_client_id);
+
+create table public.products
+(
+    id           integer generated always as identity
+        constraint products_pk
+            primary key,
+    sku          varchar(32),
+    name         varchar(128),
+    product_type varchar(8) default 'product',
+    price        numeric(10, 2),
+    vat_rate     numeric(5, 2) default 21,
+    currency     varchar(3) default 'RON',
+    is_active    boolean default true,
+    created_on   date default now(),
+    created_by   integer,
+    updated_on   date default now(),
+    updated_by   integer
+);
+
+comment on column public.products.product_type is 'product/service; only products are kept in stock';
+
+comment on column public.products.price is 'Gross price, VAT included';
+
+alter table public.products
+    owner to gogymrest;
+
+create unique index products_sku_uindex
+    on public.products (upper(sku));
+
+create table public.product_stock
+(
+    id            integer generated always as identity
+        constraint product_stock_pk
+            primary key,
+    gym_id        integer,
+    product_id    integer,
+    quantity      integer default 0,
+    reorder_level integer default 0,
+    updated_on    timestamp default now()
+);
+
+comment on column public.product_stock.reorder_level is 'Stock at or below this level is reported as low';
+
+alter table public.product_stock
+    owner to gogymrest;
+
+create unique index product_stock_gym_id_product_id_uindex
+    on public.product_stock (gym_id, product_id);
+
+create table public.stock_movements
+(
+    id             integer generated always as identity
+        constraint stock_movements_pk
+            primary key,
+    gym_id         integer,
+    product_id     integer,
+    movement_type  varchar(16),
+    quantity       integer,
+    quantity_after integer,
+    sale_id        integer,
+    note           varchar(256),
+    created_on     timestamp default now(),
+    created_by     integer
+);
+
+comment on column public.stock_movements.movement_type is 'receipt/sale/adjustment';
+
+comment on column public.stock_movements.quantity is 'Signed change of the stock: positive for receipts, negative for sales';
+
+alter table public.stock_movements
+    owner to gogymrest;
+
+create index stock_movements_gym_id_product_id_index
+    on public.stock_movements (gym_id, product_id);
+
+create table public.sales
+(
+    id             integer generated always as identity
+        constraint sales_pk
+            primary key,
+    gym_id         integer,
+    client_id      integer,
+    sold_on        timestamp default now(),
+    currency       varchar(3) default 'RON',
+    net_amount     numeric(10, 2) default 0,
+    vat_amount     numeric(10, 2) default 0,
+    total_amount   numeric(10, 2) default 0,
+    payment_method varchar(8),
+    created_by     integer
+);
+
+comment on column public.sales.client_id is 'Client the sale is attached to, null for anonymous sales';
+
+comment on column public.sales.payment_method is 'cash/card';
+
+alter table public.sales
+    owner to gogymrest;
+
+create index sales_gym_id_sold_on_index
+    on public.sales (gym_id, sold_on);
+
+create index sales_client_id_index
+    on public.sales (client_id);
+
+create table public.sale_lines
+(
+    id           integer generated always as identity
+        constraint sale_lines_pk
+            primary key,
+    sale_id      integer,
+    product_id   integer,
+    description  varchar(128),
+    quantity     integer,
+    unit_price   numeric(10, 2),
+    vat_rate     numeric(5, 2),
+    net_amount   numeric(10, 2),
+    vat_amount   numeric(10, 2),
+    total_amount numeric(10, 2)
+);
+
+comment on column public.sale_lines.unit_price is 'Gross unit price, VAT included';
+
+alter table public.sale_lines
+    owner to gogymrest;
+
+create index sale_lines_sale_id_index
+    on public.sale_lines (sale_id);
+
+create table public.lockers
+(
+    id         integer generated always as identity
+        constraint lockers_pk
+            primary key,
+    gym_id     integer,
+    code       varchar(16),
+    location   varchar(64),
+    is_active  boolean default true,
+    created_on date default now(),
+    created_by integer
+);
+
+comment on column public.lockers.code is 'Number or label on the locker, unique per gym';
+
+comment on column public.lockers.is_active is 'False while the locker is out of service';
+
+alter table public.lockers
+    owner to gogymrest;
+
+create unique index lockers_gym_id_code_uindex
+    on public.lockers (gym_id, upper(code));
+
+create table public.locker_assignments
+(
+    id              integer generated always as identity
+        constraint locker_assignments_pk
+            primary key,
+    locker_id       integer,
+    gym_id          integer,
+    client_id       integer,
+    assignment_type varchar(8),
+    client_pass_id  integer,
+    assigned_on     timestamp default now(),
+    valid_until     date,
+    note            varchar(256),
+    released_on     timestamp,
+    release_reason  varchar(16),
+    released_by     integer,
+    created_by      integer
+);
+
+comment on column public.locker_assignments.assignment_type is 'daily/rental; daily lockers are released at checkout';
+
+comment on column public.locker_assignments.client_pass_id is 'Check-in a daily locker was given for';
+
+comment on column public.locker_assignments.valid_until is 'Last day of use: the day of the visit, or the end of the rental';
+
+comment on column public.locker_assignments.release_reason is 'checkout/manual';
+
+alter table public.locker_assignments
+    owner to gogymrest;
+
+create unique index locker_assignments_locker_id_uindex
+    on public.locker_assignments (locker_id)
+    where released_on is null;
+
+create index locker_assignments_client_id_index
+    on public.locker_assignments (client_id);
+
+create table public.class_types
+(
+    id               integer generated always as identity
+        constraint class_types_pk
+            primary key,
+    name             varchar(64),
+    description      varchar(512),
+    duration_minutes integer default 60,
+    min_level        integer default 0,
+    is_active        boolean default true,
+    created_on       date default now(),
+    created_by       integer
+);
+
+comment on column public.class_types.min_level is 'Lowest membership level allowed to book the class';
+
+alter table public.class_types
+    owner to gogymrest;
+
+create table public.class_schedules
+(
+    id                integer generated always as identity
+        constraint class_schedules_pk
+            primary key,
+    gym_id            integer,
+    class_type_id     integer,
+    instructor_id     integer,
+    weekday           integer,
+    start_time        time,
+    duration_minutes  integer,
+    room              varchar(32),
+    capacity          integer,
+    waitlist_capacity integer default 10,
+    valid_from        date default now(),
+    valid_to          date,
+    is_active         boolean default true,
+    created_on        date default now(),
+    created_by        integer
+);
+
+comment on column public.class_schedules.instructor_id is 'User teaching the class, one of the gym''s users';
+
+comment on column public.class_schedules.weekday is 'ISO weekday, 1 = Monday';
+
+comment on column public.class_schedules.start_time is 'Local time of the gym';
+
+alter table public.class_schedules
+    owner to gogymrest;
+
+create index class_schedules_gym_id_index
+    on public.class_schedules (gym_id);
+
+create table public.class_sessions
+(
+    id                integer generated always as identity
+        constraint class_sessions_pk
+            primary key,
+    schedule_id       integer,
+    gym_id            integer,
+    class_type_id     integer,
+    instructor_id     integer,
+    starts_at         timestamp,
+    ends_at           timestamp,
+    room              varchar(32),
+    capacity          integer,
+    waitlist_capacity integer,
+    status            varchar(16) default 'scheduled',
+    cancel_reason     varchar(256),
+    sequence          integer default 0,
+    created_on        date default now()
+);
+
+comment on column public.class_sessions.starts_at is 'Local time of the gym';
+
+comment on column public.class_sessions.status is 'scheduled/cancelled';
+
+comment on column public.class_sessions.sequence is 'Raised on every change, so calendar apps update the event';
+
+alter table public.class_sessions
+    owner to gogymrest;
+
+create unique index class_sessions_schedule_id_starts_at_uindex
+    on public.class_sessions (schedule_id, starts_at);
+
+create index class_sessions_gym_id_starts_at_index
+    on public.class_sessions (gym_id, starts_at);
+
+create table public.class_bookings
+(
+    id                   integer generated always as identity
+        constraint class_bookings_pk
+            primary key,
+    session_id           integer,
+    client_id            integer,
+    client_membership_id integer,
+    status               varchar(16),
+    booked_on            timestamp default now(),
+    promoted_on          timestamp,
+    cancelled_on         timestamp,
+    checked_in_on        timestamp,
+    client_pass_id       integer,
+    created_by           integer
+);
+
+comment on column public.class_bookings.status is 'booked/waitlisted/attended/cancelled/no_show';
+
+comment on column public.class_bookings.client_membership_id is 'Membership that made the client eligible';
+
+comment on column public.class_bookings.promoted_on is 'When a waitlisted booking got a place';
+
+alter table public.class_bookings
+    owner to gogymrest;
+
+create unique index class_bookings_session_id_client_id_uindex
+    on public.class_bookings (session_id, client_id)
+    where status <> 'cancelled';
+
+create index class_bookings_client_id_index
+    on public.class_bookings (client_id);
+
+create table public.trainer_availability
+(
+    id         integer generated always as identity
+        constraint trainer_availability_pk
+            primary key,
+    trainer_id integer,
+    gym_id     integer,
+    weekday    integer,
+    start_time time,
+    end_time   time,
+    valid_from date default now(),
+    valid_to   date,
+    created_on date default now(),
+    created_by integer
+);
+
+comment on column public.trainer_availability.trainer_id is 'User working at the gym as a personal trainer';
+
+comment on column public.trainer_availability.weekday is 'ISO weekday, 1 = Monday';
+
+comment on column public.trainer_availability.start_time is 'Local time of the gym';
+
+alter table public.trainer_availability
+    owner to gogymrest;
+
+create index trainer_availability_trainer_id_index
+    on public.trainer_availability (trainer_id);
+
+create table public.trainer_time_off
+(
+    id         integer generated always as identity
+        constraint trainer_time_off_pk
+            primary key,
+    trainer_id integer,
+    starts_at  timestamp,
+    ends_at    timestamp,
+    reason     varchar(256),
+    created_on date default now(),
+    created_by integer
+);
+
+comment on table public.trainer_time_off is 'Leave and other exceptions to the weekly availability, at every gym';
+
+alter table public.trainer_time_off
+    owner to gogymrest;
+
+create index trainer_time_off_trainer_id_index
+    on public.trainer_time_off (trainer_id, starts_at);
+
+create table public.trainer_packages
+(
+    id              integer generated always as identity
+        constraint trainer_packages_pk
+            primary key,
+    name            varchar(64),
+    sessions_no     integer,
+    session_minutes integer default 60,
+    validity_days   integer,
+    price           numeric(10, 2),
+    currency        varchar(3) default 'RON',
+    is_active       boolean default true,
+    created_on      date default now(),
+    created_by      integer
+);
+
+comment on column public.trainer_packages.validity_days is 'Days from the purchase the sessions can be used in';
+
+comment on column public.trainer_packages.price is 'Gross price, VAT included';
+
+alter table public.trainer_packages
+    owner to gogymrest;
+
+create table public.client_trainer_packages
+(
+    id                 integer generated always as identity
+        constraint client_trainer_packages_pk
+            primary key,
+    client_id          integer,
+    trainer_package_id integer,
+    trainer_id         integer,
+    sessions_total     integer,
+    sessions_remaining integer,
+    session_minutes    integer,
+    price              numeric(10, 2),
+    currency           varchar(3),
+    purchased_on       date default now(),
+    valid_until        date,
+    created_by         integer
+);
+
+comment on column public.client_trainer_packages.trainer_id is 'Trainer the sessions are bought with; null for any trainer';
+
+comment on column public.client_trainer_packages.sessions_remaining is 'Sessions not booked yet; a cancelled appointment gives its session back';
+
+alter table public.client_trainer_packages
+    owner to gogymrest;
+
+create index client_trainer_packages_client_id_index
+    on public.client_trainer_packages (client_id);
+
+create table public.trainer_appointments
+(
+    id                        integer generated always as identity
+        constraint trainer_appointments_pk
+            primary key,
+    trainer_id                integer,
+    gym_id                    integer,
+    client_id                 integer,
+    client_trainer_package_id integer,
+    starts_at                 timestamp,
+    ends_at                   timestamp,
+    status                    varchar(16) default 'booked',
+    source                    varchar(8) default 'staff',
+    notes                     varchar(512),
+    cancel_reason             varchar(256),
+    cancelled_on              timestamp,
+    completed_on              timestamp,
+    sequence                  integer default 0,
+    created_on                timestamp default now(),
+    created_by                integer
+);
+
+comment on column public.trainer_appointments.starts_at is 'Local time of the gym';
+
+comment on column public.trainer_appointments.status is 'booked/completed/no_show/cancelled';
+
+comment on column public.trainer_appointments.source is 'staff/client: who asked for the appointment';
+
+comment on column public.trainer_appointments.sequence is 'Raised on every change, so calendar apps update the event';
+
+alter table public.trainer_appointments
+    owner to gogymrest;
+
+create index trainer_appointments_trainer_id_starts_at_index
+    on public.trainer_appointments (trainer_id, starts_at);
+
+create index trainer_appointments_client_id_index
+    on public.trainer_appointments (client_id);
+
+create table public.calendar_feeds
+(
+    id               integer generated always as identity
+        constraint calendar_feeds_pk
+            primary key,
+    token            varchar(64),
+    user_id          integer,
+    client_id        integer,
+    created_on       timestamp default now(),
+    created_by       integer,
+    revoked_on       timestamp,
+    last_accessed_on timestamp
+);
+
+comment on table public.calendar_feeds is 'Secret tokens of the iCalendar feeds of a user (classes taught, appointments) or a client';
+
+comment on column public.calendar_feeds.token is 'Random token in the feed URL; anyone with the URL can read the feed';
+
+alter table public.calendar_feeds
+    owner to gogymrest;
+
+create unique index calendar_feeds_token_uindex
+    on public.calendar_feeds (token);
+
+create table public.client_no_shows
+(
+    id                     integer generated always as identity
+        constraint client_no_shows_pk
+            primary key,
+    client_id              integer,
+    gym_id                 integer,
+    class_booking_id       integer,
+    trainer_appointment_id integer,
+    occurred_on            timestamp,
+    fee_amount             numeric(10, 2) default 0,
+    invoice_id             integer,
+    credit_note_id         integer,
+    waived_on              timestamp,
+    waived_by              integer,
+    waive_reason           varchar(256),
+    created_on             timestamp default now()
+);
+
+comment on table public.client_no_shows is 'Class bookings and trainer appointments the client did not come to';
+
+comment on column public.client_no_shows.occurred_on is 'Start of the class or appointment, local time of the gym';
+
+comment on column public.client_no_shows.invoice_id is 'Invoice of the no-show fee';
+
+comment on column public.client_no_shows.credit_note_id is 'Credit note reversing the fee invoice of a waived no-show';
+
+comment on column public.client_no_shows.waived_on is 'A waived no-show is no strike and its fee is reversed';
+
+alter table public.client_no_shows
+    owner to gogymrest;
+
+create index client_no_shows_client_id_gym_id_index
+    on public.client_no_shows (client_id, gym_id);
+
+create unique index client_no_shows_class_booking_id_uindex
+    on public.client_no_shows (class_booking_id);
+
+create unique index client_no_shows_trainer_appointment_id_uindex
+    on public.client_no_shows (trainer_appointment_id);
+
+create table public.client_booking_bans
+(
+    id         integer generated always as identity
+        constraint client_booking_bans_pk
+            primary key,
+    client_id  integer,
+    gym_id     integer,
+    no_show_id integer,
+    starts_on  date default now(),
+    ends_on    date,
+    reason     varchar(256),
+    lifted_on  timestamp,
+    lifted_by  integer,
+    created_on timestamp default now()
+);
+
+comment on table public.client_booking_bans is 'Periods a client cannot book classes or appointments at a gym';
+
+comment on column public.client_booking_bans.no_show_id is 'No-show that reached the strike limit';
+
+comment on column public.client_booking_bans.ends_on is 'Last day of the ban';
+
+alter table public.client_booking_bans
+    owner to gogymrest;
+
+create index client_booking_bans_client_id_gym_id_index
+    on public.client_booking_bans (client_id, gym_id);
+
+create table public.resources
+(
+    id            integer generated always as identity
+        constraint resources_pk
+            primary key,
+    gym_id        integer,
+    name          varchar(64),
+    resource_type varchar(16) default 'room',
+    description   varchar(512),
+    slot_minutes  integer default 60,
+    max_slots     integer default 2,
+    advance_days  integer default 14,
+    cancel_hours  integer default 24,
+    vat_rate      numeric(5, 2) default 21,
+    currency      varchar(3) default 'RON',
+    is_active     boolean default true,
+    created_on    date default now(),
+    created_by    integer
+);
+
+comment on table public.resources is 'Courts, rooms and equipment of a gym that clients book by the slot';
+
+comment on column public.resources.resource_type is 'court/room/equipment';
+
+comment on column public.resources.max_slots is 'Most consecutive slots one booking can take';
+
+comment on column public.resources.advance_days is 'Days ahead bookings open';
+
+comment on column public.resources.cancel_hours is 'Bookings cancelled at least this many hours before the start are not charged';
+
+alter table public.resources
+    owner to gogymrest;
+
+create index resources_gym_id_index
+    on public.resources (gym_id);
+
+create table public.resource_hours
+(
+    id          integer generated always as identity
+        constraint resource_hours_pk
+            primary key,
+    resource_id integer,
+    weekday     integer,
+    open_time   time,
+    close_time  time,
+    slot_price  numeric(10, 2) default 0
+);
+
+comment on column public.resource_hours.weekday is 'ISO day of week: 1 = Monday ... 7 = Sunday';
+
+comment on column public.resource_hours.open_time is 'Local time of the gym; slots start at open_time';
+
+comment on column public.resource_hours.slot_price is 'Price of a slot in these hours, VAT included';
+
+alter table public.resource_hours
+    owner to gogymrest;
+
+create index resource_hours_resource_id_index
+    on public.resource_hours (resource_id);
+
+create table public.resource_bookings
+(
+    id                integer generated always as identity
+        constraint resource_bookings_pk
+            primary key,
+    resource_id       integer,
+    gym_id            integer,
+    client_id         integer,
+    starts_at         timestamp,
+    ends_at           timestamp,
+    slots             integer,
+    price             numeric(10, 2) default 0,
+    currency          varchar(3),
+    invoice_id        integer,
+    credit_note_id    integer,
+    status            varchar(16) default 'booked',
+    notes             varchar(512),
+    cancel_reason     varchar(256),
+    cancelled_on      timestamp,
+    late_cancellation boolean default false,
+    created_on        timestamp default now(),
+    created_by        integer
+);
+
+comment on column public.resource_bookings.starts_at is 'Local time of the gym';
+
+comment on column public.resource_bookings.status is 'booked/cancelled';
+
+comment on column public.resource_bookings.credit_note_id is 'Credit note reversing the invoice of a booking cancelled in time';
+
+comment on column public.resource_bookings.late_cancellation is 'Cancelled inside the cancellation window, so still charged';
+
+alter table public.resource_bookings
+    owner to gogymrest;
+
+-- Two bookings can never hold the same resource at the same time, whatever the
+-- path they are written by
+alter table public.resource_bookings
+    add constraint resource_bookings_no_overlap
+        exclude using gist (resource_id with =, tsrange(starts_at, ends_at) with &&)
+        where (status = 'booked');
+
+create index resource_bookings_client_id_index
+    on public.resource_bookings (client_id);
+
+create table public.exercises
+(
+    id           integer generated always as identity
+        constraint exercises_pk
+            primary key,
+    name         varchar(128),
+    muscle_group varchar(32),
+    machine_id   integer,
+    instructions varchar(1024),
+    is_active    boolean default true,
+    created_on   date default now(),
+    created_by   integer,
+    updated_on   date default now(),
+    updated_by   integer
+);
+
+comment on table public.exercises is 'Exercise catalog shared by all gyms';
+
+comment on column public.exercises.machine_id is 'Machine the exercise is usually done on; null for free weights and bodyweight';
+
+alter table public.exercises
+    owner to gogymrest;
+
+create unique index exercises_name_uindex
+    on public.exercises (upper(name));
+
+create table public.workout_plans
+(
+    id         integer generated always as identity
+        constraint workout_plans_pk
+            primary key,
+    client_id  integer,
+    gym_id     integer,
+    trainer_id integer,
+    name       varchar(128),
+    goal       varchar(512),
+    starts_on  date,
+    ends_on    date,
+    status     varchar(16) default 'active',
+    created_on timestamp default now(),
+    created_by integer,
+    updated_on timestamp default now(),
+    updated_by integer
+);
+
+comment on column public.workout_plans.trainer_id is 'User who prepared the plan';
+
+comment on column public.workout_plans.status is 'active/archived';
+
+alter table public.workout_plans
+    owner to gogymrest;
+
+create index workout_plans_client_id_index
+    on public.workout_plans (client_id);
+
+create table public.workout_plan_exercises
+(
+    id            integer generated always as identity
+        constraint workout_plan_exercises_pk
+            primary key,
+    plan_id       integer,
+    day_no        integer default 1,
+    position      integer,
+    exercise_id   integer,
+    machine_id    integer,
+    sets          integer,
+    reps          integer,
+    target_weight numeric(6, 2),
+    rest_seconds  integer,
+    notes         varchar(256)
+);
+
+comment on column public.workout_plan_exercises.day_no is 'Workout of the plan the exercise belongs to: day 1, day 2...';
+
+comment on column public.workout_plan_exercises.machine_id is 'Target machine at the plan''s gym; null uses the machine of the exercise';
+
+comment on column public.workout_plan_exercises.target_weight is 'Kilograms';
+
+alter table public.workout_plan_exercises
+    owner to gogymrest;
+
+create index workout_plan_exercises_plan_id_index
+    on public.workout_plan_exercises (plan_id);
+
+create table public.workout_logs
+(
+    id               integer generated always as identity
+        constraint workout_logs_pk
+            primary key,
+    client_id        integer,
+    gym_id           integer,
+    plan_id          integer,
+    day_no           integer,
+    performed_on     date,
+    duration_minutes integer,
+    notes            varchar(512),
+    created_on       timestamp default now(),
+    created_by       integer
+);
+
+comment on table public.workout_logs is 'Completed workouts, logged by the client''s trainer or the front desk';
+
+comment on column public.workout_logs.day_no is 'Workout of the plan that was done, when the log follows a plan';
+
+alter table public.workout_logs
+    owner to gogymrest;
+
+create index workout_logs_client_id_index
+    on public.workout_logs (client_id, performed_on);
+
+create table public.workout_log_sets
+(
+    id               integer generated always as identity
+        constraint workout_log_sets_pk
+            primary key,
+    log_id           integer,
+    exercise_id      integer,
+    machine_id       integer,
+    set_no           integer,
+    reps             integer,
+    weight           numeric(6, 2),
+    duration_seconds integer,
+    notes            varchar(256)
+);
+
+comment on column public.workout_log_sets.weight is 'Kilograms';
+
+alter table public.workout_log_sets
+    owner to gogymrest;
+
+create index workout_log_sets_log_id_index
+    on public.workout_log_sets (log_id);
+
+create index workout_log_sets_exercise_id_index
+    on public.workout_log_sets (exercise_id);
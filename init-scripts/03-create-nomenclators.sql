@@ -153,9 +153,39 @@ INSERT INTO public.machines (id, name, created_on, updated_on, created_by, updat
 
 
 INSERT INTO public.memberships (name, is_active, days_no, level) VALUES ('Bronze', true, 30, 0);
-INSERT INTO public.memberships (name, is_active, days_no, level) VALUES ('Platinum', true, 30, 3);
+INSERT INTO public.memberships (name, is_active, days_no, level, guest_passes_no) VALUES ('Platinum', true, 30, 3, 4);
 INSERT INTO public.memberships (name, is_active, days_no, level) VALUES ('Silver', true, 30, 1);
-INSERT INTO public.memberships (name, is_active, days_no, level) VALUES ('Gold', true, 30, 2);
+INSERT INTO public.memberships (name, is_active, days_no, level, guest_passes_no) VALUES ('Gold', true, 30, 2, 2);
+INSERT INTO public.memberships (name, is_active, days_no, level, plan_type, entries_no) VALUES ('10 Visits', true, 365, 0, 'entries', 10);
+INSERT INTO public.memberships (name, is_active, days_no, level, plan_type, entries_no) VALUES ('12 Visits / 60 days', true, 60, 1, 'hybrid', 12);
+INSERT INTO public.memberships (name, is_active, days_no, level, plan_type) VALUES ('Day Pass', true, 0, 0, 'day');
+
+INSERT INTO public.membership_prices (membership_id, price) SELECT id, 150.00 FROM public.memberships WHERE name = 'Bronze';
+INSERT INTO public.membership_prices (membership_id, price) SELECT id, 200.00 FROM public.memberships WHERE name = 'Silver';
+INSERT INTO public.membership_prices (membership_id, price) SELECT id, 250.00 FROM public.memberships WHERE name = 'Gold';
+INSERT INTO public.membership_prices (membership_id, price) SELECT id, 350.00 FROM public.memberships WHERE name = 'Platinum';
+INSERT INTO public.membership_prices (membership_id, price) SELECT id, 300.00 FROM public.memberships WHERE name = '10 Visits';
+INSERT INTO public.membership_prices (membership_id, price) SELECT id, 320.00 FROM public.memberships WHERE name = '12 Visits / 60 days';
+INSERT INTO public.membership_prices (membership_id, price) SELECT id, 40.00 FROM public.memberships WHERE name = 'Day Pass';
+
+INSERT INTO public.invoice_series (code) VALUES ('GYM');
+
+INSERT INTO public.products (sku, name, product_type, price, vat_rate) VALUES ('WATER-500', 'Mineral Water 0.5L', 'product', 5.00, 9);
+INSERT INTO public.products (sku, name, product_type, price, vat_rate) VALUES ('ISO-500', 'Isotonic Drink 0.5L', 'product', 9.00, 9);
+INSERT INTO public.products (sku, name, product_type, price, vat_rate) VALUES ('BAR-PROT', 'Protein Bar', 'product', 12.00, 9);
+INSERT INTO public.products (sku, name, product_type, price, vat_rate) VALUES ('WHEY-1KG', 'Whey Protein 1kg', 'product', 160.00, 9);
+INSERT INTO public.products (sku, name, product_type, price, vat_rate) VALUES ('TOWEL', 'Towel Rental', 'service', 10.00, 21);
+
+INSERT INTO public.class_types (name, description, duration_minutes, min_level) VALUES ('Yoga', 'Hatha yoga for all levels', 60, 0);
+INSERT INTO public.class_types (name, description, duration_minutes, min_level) VALUES ('Spinning', 'Indoor cycling intervals', 45, 0);
+INSERT INTO public.class_types (name, description, duration_minutes, min_level) VALUES ('Pilates', 'Mat pilates and core strength', 50, 0);
+INSERT INTO public.class_types (name, description, duration_minutes, min_level) VALUES ('HIIT', 'High intensity interval training', 30, 1);
+INSERT INTO public.class_types (name, description, duration_minutes, min_level) VALUES ('Reformer Pilates', 'Small group reformer sessions', 50, 2);
+
+INSERT INTO public.trainer_packages (name, sessions_no, session_minutes, validity_days, price) VALUES ('Single PT Session', 1, 60, 30, 120.00);
+INSERT INTO public.trainer_packages (name, sessions_no, session_minutes, validity_days, price) VALUES ('5 PT Sessions', 5, 60, 60, 550.00);
+INSERT INTO public.trainer_packages (name, sessions_no, session_minutes, validity_days, price) VALUES ('10 PT Sessions', 10, 60, 120, 1000.00);
+INSERT INTO public.trainer_packages (name, sessions_no, session_minutes, validity_days, price) VALUES ('8 x 30 min Sessions', 8, 30, 60, 480.00);
 
 
 INSERT INTO public.states (name, iso_code, country_id) VALUES ('Alba', 'AB', 1);
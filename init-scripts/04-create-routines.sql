@@ -86,7 +86,7 @@ begin
     end if;
 
     -- Validate county code (digits 8-9)
-    if substring(p_cnp, 8, 2)::int not between 1 and 52 then
+    if substring(p_cnp, 8, 2)::int not between 1 and 52 and substring(p_cnp, 8, 2) != '70' then
         return 'ERROR - Invalid county code!';
     end if;
 
@@ -121,6 +121,70 @@ $$;
 
 alter function public.validate_cnp(varchar) owner to gogymrest;
 
+create function public.validate_cui(p_cui character varying) returns character varying
+    language plpgsql
+as
+$$
+declare
+    v_key     varchar := '753217532';
+    v_cui     varchar;
+    v_body    varchar;
+    v_sum     int := 0;
+    v_control int;
+    i         int;
+begin
+    -- Check if CUI is null or empty
+    if p_cui is null or trim(p_cui) = '' then
+        return 'ERROR - CUI cannot be null or empty!';
+    end if;
+
+    -- VAT payers are written with the RO prefix
+    v_cui := upper(replace(trim(p_cui), ' ', ''));
+    if left(v_cui, 2) = 'RO' then
+        v_cui := substring(v_cui from 3);
+    end if;
+
+    if v_cui !~ '^[0-9]{2,10}$' then
+        return 'ERROR - CUI must contain between 2 and 10 digits!';
+    end if;
+
+    -- Weight the digits (without the control digit) right-aligned against 753217532
+    v_body := lpad(left(v_cui, length(v_cui) - 1), 9, '0');
+    for i in 1..9 loop
+            v_sum := v_sum + substring(v_body, i, 1)::int * substring(v_key, i, 1)::int;
+        end loop;
+
+    v_control := (v_sum * 10) % 11;
+    if v_control = 10 then
+        v_control := 0;
+    end if;
+
+    if v_control != right(v_cui, 1)::int then
+        return 'ERROR - Invalid check digit!';
+    end if;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.validate_cui(varchar) owner to gogymrest;
+
+create function public.validate_trade_register_no(p_trade_register_no character varying) returns character varying
+    language plpgsql
+as
+$$
+begin
+    -- Format: J40/123/2020 (type letter, county code 01-52, order number, year)
+    if upper(trim(p_trade_register_no)) !~ '^[JFC](0[1-9]|[1-4][0-9]|5[0-2])/[0-9]{1,6}/(19|20)[0-9]{2}$' then
+        return 'ERROR - Trade register number must have the format J40/123/2020';
+    end if;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.validate_trade_register_no(varchar) owner to gogymrest;
+
 create function public.create_gym(p_name character varying, p_max_people integer, p_max_resevarions integer, p_user_id integer) returns character varying
     language plpgsql
 as
@@ -212,13 +276,14 @@ $$;
 
 alter function public.add_user_to_client(integer, integer) owner to gogymrest;
 
-create function public.create_client(p_user_id integer, p_name character varying, p_cif character varying, p_dob date, p_trade_register_no character varying, p_country_id integer, p_state_id integer, p_city character varying, p_street_name character varying, p_street_no character varying, p_building character varying DEFAULT NULL::character varying, p_floor character varying DEFAULT NULL::character varying, p_apartment character varying DEFAULT NULL::character varying) returns character varying
+create function public.create_client(p_user_id integer, p_name character varying, p_cif character varying, p_dob date, p_trade_register_no character varying, p_country_id integer, p_state_id integer, p_city character varying, p_street_name character varying, p_street_no character varying, p_building character varying DEFAULT NULL::character varying, p_floor character varying DEFAULT NULL::character varying, p_apartment character varying DEFAULT NULL::character varying, p_phone character varying DEFAULT NULL::character varying, p_email character varying DEFAULT NULL::character varying, p_client_type character varying DEFAULT 'person'::character varying) returns character varying
     language plpgsql
 as
 $$
 declare
     l_countor integer;
     L_id_client integer;
+    l_response varchar;
 begin
     -- Validate user_id
     if p_user_id is null or p_user_id <= 0 then
@@ -240,6 +305,11 @@ begin
         return 'ERROR - Client name cannot exceed 128 characters';
     end if;
 
+    -- Validate client type
+    if p_client_type is null or p_client_type not in ('person', 'company') then
+        return 'ERROR - Client type must be person or company';
+    end if;
+
     -- Validate CIF (Romanian fiscal code)
     if p_cif is null or length(trim(p_cif)) = 0 then
         return 'ERROR - CIF is required';
@@ -249,14 +319,27 @@ begin
         return 'ERROR - CIF cannot exceed 13 characters';
     end if;
 
+    -- Persons are identified by CNP, companies by CUI
+    if p_client_type = 'person' then
+        l_response := validate_cnp(p_cif);
+        if l_response <> 'OK' then
+            return 'CNP VALIDATION: ' || l_response;
+        end if;
+    else
+        l_response := validate_cui(p_cif);
+        if l_response <> 'OK' then
+            return 'CUI VALIDATION: ' || l_response;
+        end if;
+    end if;
+
     -- Check if CIF already exists (unique constraint)
     select count(*) into l_countor from clients where upper(cif) = upper(p_cif);
     if l_countor > 0 then
         return 'ERROR - CIF already exists';
     end if;
 
-    -- Validate date of birth
-    if p_dob is null then
+    -- Validate date of birth (required for persons only)
+    if p_dob is null and p_client_type = 'person' then
         return 'ERROR - Date of birth is required';
     end if;
 
@@ -270,8 +353,8 @@ begin
         return 'ERROR - Date of birth is not valid';
     end if;
 
-    -- Validate trade register number
-    if p_trade_register_no is null or length(trim(p_trade_register_no)) = 0 then
+    -- Validate trade register number (required for companies only)
+    if (p_trade_register_no is null or length(trim(p_trade_register_no)) = 0) and p_client_type = 'company' then
         return 'ERROR - Trade register number is required';
     end if;
 
@@ -279,6 +362,13 @@ begin
         return 'ERROR - Trade register number cannot exceed 16 characters';
     end if;
 
+    if p_trade_register_no is not null and length(trim(p_trade_register_no)) > 0 then
+        l_response := validate_trade_register_no(p_trade_register_no);
+        if l_response <> 'OK' then
+            return l_response;
+        end if;
+    end if;
+
     -- Validate country_id
     if p_country_id is null or p_country_id <= 0 then
         return 'ERROR - Valid country ID is required';
@@ -341,15 +431,25 @@ begin
         return 'ERROR - Apartment cannot exceed 8 characters';
     end if;
 
+    -- Validate contact details (optional)
+    if p_phone is not null and p_phone !~ '^\+?[0-9]{8,15}$' then
+        return 'ERROR - Phone must contain 8 to 15 digits';
+    end if;
+
+    if p_email is not null and length(p_email) > 128 then
+        return 'ERROR - Email cannot exceed 128 characters';
+    end if;
+
     -- Insert the client
     insert into clients(
-        name, cif, dob, trade_register_no, country_id, state_id,
-        city, street_name, street_no, building, floor, apartment,
+        client_type, name, cif, dob, trade_register_no, country_id, state_id,
+        city, street_name, street_no, building, floor, apartment, phone, email,
         created_on, updated_on, created_by, updated_by
     ) values (
-                 trim(p_name), upper(trim(p_cif)), p_dob, trim(p_trade_register_no),
+                 p_client_type, trim(p_name), upper(trim(p_cif)), p_dob, upper(trim(p_trade_register_no)),
                  p_country_id, p_state_id, trim(p_city), trim(p_street_name),
                  trim(p_street_no), trim(p_building), trim(p_floor), trim(p_apartment),
+                 trim(p_phone), lower(trim(p_email)),
                  now(), now(), p_user_id, p_user_id
              ) returning id into L_id_client;
 
@@ -363,7 +463,7 @@ exception
 end;
 $$;
 
-alter function public.create_client(integer, varchar, varchar, date, varchar, integer, integer, varchar, varchar, varchar, varchar, varchar, varchar) owner to gogymrest;
+alter function public.create_client(integer, varchar, varchar, date, varchar, integer, integer, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar, varchar) owner to gogymrest;
 
 create function public.add_membership_to_gym(p_membership_id integer, p_gym_id integer, p_user_id integer) returns character varying
     language plpgsql
@@ -422,6 +522,8 @@ declare
     l_record memberships%rowtype;
 
     l_contor integer;
+    l_gym record;
+    l_response varchar;
 begin
     if p_membership_id is null then
         return 'ERROR - Membership needs to be selected!';
@@ -431,6 +533,19 @@ begin
         return 'ERROR - Client needs to be selected!';
     end if;
 
+    -- Minors need a guardian and a consent for every gym the membership covers
+    l_response := check_client_age_rules(p_client_id, null);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    for l_gym in (select gym_id from membership_gyms where membership_id = p_membership_id) loop
+            l_response := check_client_age_rules(p_client_id, l_gym.gym_id);
+            if l_response <> 'OK' then
+                return l_response;
+            end if;
+        end loop;
+
     select count(*) into l_contor from client_memberships
     where client_id=p_client_id
       and p_valid_from between starting_from and ending_on
@@ -442,10 +557,19 @@ begin
             end if;
 
 
+            if l_record.plan_type in ('entries', 'hybrid') and coalesce(l_record.entries_no, 0) <= 0 then
+                return 'ERROR - Membership has no entries configured!';
+            end if;
+
+            -- Entry and hybrid plans start with their full number of entries, day passes end the same day
             insert into client_memberships(client_id, membership_id, starting_from, ending_on,
-                                           status, created_by, updated_by)
+                                           status, created_by, updated_by, remaining_entries,
+                                           remaining_guest_passes)
             values(p_client_id,p_membership_id,p_valid_from,
-                   p_valid_from+l_record.days_no,'active',p_user_id,p_user_id);
+                   case when l_record.plan_type = 'day' then p_valid_from else p_valid_from+l_record.days_no end,
+                   'active',p_user_id,p_user_id,
+                   case when l_record.plan_type in ('entries', 'hybrid') then l_record.entries_no end,
+                   coalesce(l_record.guest_passes_no, 0));
 
 
             return 'OK';
@@ -464,6 +588,7 @@ $$
 DECLARE
     l_contor INTEGER;
     cu record;
+    l_response VARCHAR;
 BEGIN
     IF p_client_id IS NULL THEN
         RETURN 'ERROR - Client needs to be selected!';
@@ -473,6 +598,11 @@ BEGIN
         RETURN 'ERROR - GYM needs to be selected!';
     END IF;
 
+    l_response := check_client_age_rules(p_client_id, p_gym_id);
+    IF l_response <> 'OK' THEN
+        RETURN l_response;
+    END IF;
+
     SELECT COUNT(*) INTO l_contor
     FROM client_memberships cm
              INNER JOIN membership_gyms mg ON mg.membership_id = cm.membership_id
@@ -510,6 +640,11 @@ $$
 DECLARE
     l_contor INTEGER;
     cu record;
+    l_response VARCHAR;
+    l_client_membership_id INTEGER;
+    l_remaining_entries INTEGER;
+    l_local_now TIMESTAMP;
+    l_windows VARCHAR;
 BEGIN
     IF p_client_id IS NULL THEN
         RETURN 'ERROR - Client needs to be selected!';
@@ -519,17 +654,81 @@ BEGIN
         RETURN 'ERROR - GYM needs to be selected!';
     END IF;
 
-    SELECT COUNT(*) INTO l_contor
+    l_response := check_client_age_rules(p_client_id, p_gym_id);
+    IF l_response <> 'OK' THEN
+        RETURN l_response;
+    END IF;
+
+    -- Dates and time windows are evaluated in the gym's local time
+    l_local_now := gym_local_time(p_gym_id);
+
+    -- Pick the membership to use: unlimited (time) plans first, then the entry plan ending soonest.
+    -- The row is locked so concurrent check-ins cannot spend the same entry twice.
+    SELECT cm.id, cm.remaining_entries
+    INTO l_client_membership_id, l_remaining_entries
     FROM client_memberships cm
              INNER JOIN membership_gyms mg ON mg.membership_id = cm.membership_id
              INNER JOIN memberships m ON m.id = cm.membership_id
     WHERE cm.client_id = p_client_id
       AND mg.gym_id = p_gym_id
-      AND now() BETWEEN cm.starting_from AND cm.ending_on
+      AND l_local_now::date BETWEEN cm.starting_from AND cm.ending_on
       AND cm.status = 'active'
-      AND m.is_active = true;
+      AND COALESCE(cm.dunning_status, '') <> 'suspended'
+      AND m.is_active = true
+      AND (cm.remaining_entries IS NULL OR cm.remaining_entries > 0)
+      AND membership_window_open(cm.membership_id, l_local_now)
+    ORDER BY cm.remaining_entries IS NOT NULL, cm.ending_on, cm.id
+    LIMIT 1
+    FOR UPDATE OF cm;
+
+    IF l_client_membership_id IS NULL THEN
+        SELECT COUNT(*) INTO l_contor
+        FROM client_memberships cm
+                 INNER JOIN membership_gyms mg ON mg.membership_id = cm.membership_id
+        WHERE cm.client_id = p_client_id
+          AND mg.gym_id = p_gym_id
+          AND l_local_now::date BETWEEN cm.starting_from AND cm.ending_on
+          AND cm.status = 'active'
+          AND cm.remaining_entries = 0;
+
+        IF l_contor > 0 THEN
+            RETURN 'ERROR - Access Denied! No entries left on membership!';
+        END IF;
+
+        -- The renewal was not paid within the grace period
+        SELECT COUNT(*) INTO l_contor
+        FROM client_memberships cm
+                 INNER JOIN membership_gyms mg ON mg.membership_id = cm.membership_id
+        WHERE cm.client_id = p_client_id
+          AND mg.gym_id = p_gym_id
+          AND l_local_now::date BETWEEN cm.starting_from AND cm.ending_on
+          AND cm.status = 'active'
+          AND cm.dunning_status = 'suspended';
+
+        IF l_contor > 0 THEN
+            RETURN 'ERROR - Access suspended! The membership renewal invoice is unpaid!';
+        END IF;
+
+        -- A valid membership exists but not for this time of day
+        SELECT string_agg(m.name || ' (' || describe_membership_windows(m.id) || ')', '; ')
+        INTO l_windows
+        FROM client_memberships cm
+                 INNER JOIN membership_gyms mg ON mg.membership_id = cm.membership_id
+                 INNER JOIN memberships m ON m.id = cm.membership_id
+        WHERE cm.client_id = p_client_id
+          AND mg.gym_id = p_gym_id
+          AND l_local_now::date BETWEEN cm.starting_from AND cm.ending_on
+          AND cm.status = 'active'
+          AND COALESCE(cm.dunning_status, '') <> 'suspended'
+          AND m.is_active = true
+          AND (cm.remaining_entries IS NULL OR cm.remaining_entries > 0)
+          AND NOT membership_window_open(cm.membership_id, l_local_now);
+
+        IF l_windows IS NOT NULL THEN
+            RETURN 'ERROR - Access Denied! Outside the allowed hours of ' || l_windows
+                       || '. Local time is ' || to_char(l_local_now, 'Dy HH24:MI') || '.';
+        END IF;
 
-    IF l_contor = 0 THEN
         RETURN 'ERROR - Access Denied!';
     END IF;
 
@@ -540,13 +739,27 @@ BEGIN
             END IF;
         END LOOP;
 
+    IF l_remaining_entries IS NOT NULL THEN
+        UPDATE client_memberships
+        SET remaining_entries = remaining_entries - 1,
+            updated_on = now(),
+            updated_by = p_user_id
+        WHERE id = l_client_membership_id
+          AND remaining_entries > 0;
+
+        GET DIAGNOSTICS l_contor = ROW_COUNT;
+        IF l_contor = 0 THEN
+            RETURN 'ERROR - Access Denied! No entries left on membership!';
+        END IF;
+    END IF;
+
     update gym_stats
     set current_people = current_people+1,
         current_combined = current_combined+1
     where gym_id =p_gym_id;
 
-    INSERT INTO client_passes (gym_id, client_id, action, created_by)
-    VALUES (p_gym_id, p_client_id, 'in',p_user_id);
+    INSERT INTO client_passes (gym_id, client_id, action, created_by, client_membership_id)
+    VALUES (p_gym_id, p_client_id, 'in',p_user_id, l_client_membership_id);
 
     RETURN 'OK';
 END;
@@ -559,7 +772,8 @@ create function public.do_client_check_out_gym(p_client_id integer, p_gym_id int
 as
 $$
 DECLARE
-    cu record;
+    l_pass_id   integer;
+    l_last_pass varchar;
 BEGIN
     IF p_client_id IS NULL THEN
         RETURN 'ERROR - Client needs to be selected!';
@@ -569,25 +783,3444 @@ BEGIN
         RETURN 'ERROR - GYM needs to be selected!';
     END IF;
 
-    FOR cu IN (SELECT * FROM client_passes WHERE gym_id = p_gym_id
-                                             and client_id= p_client_id
-                                             and action='in'
-                                             and trunc(created_on )= trunc(now()))
-        LOOP
-            update gym_stats
-            set current_people = current_people-1,
-                current_combined = current_combined-1
-            where gym_id =p_gym_id;
+    -- Only the client's latest pass counts: a check-in is checked out once
+    SELECT id, action INTO l_pass_id, l_last_pass
+    FROM client_passes
+    WHERE gym_id = p_gym_id
+      AND client_id = p_client_id
+      AND created_on = current_date
+    ORDER BY id DESC
+    LIMIT 1
+    FOR UPDATE;
+
+    IF l_pass_id IS NULL THEN
+        RETURN 'ERROR -  Client never checked in in this gym today!';
+    END IF;
 
-            INSERT INTO client_passes (gym_id, client_id, action, created_by)
-            VALUES (p_gym_id, p_client_id, 'in',p_user_id);
-            RETURN 'OK';
+    IF l_last_pass <> 'in' THEN
+        RETURN 'ERROR - Client is already checked out of this gym!';
+    END IF;
 
-        END LOOP;
+    update gym_stats
+    set current_people = current_people-1,
+        current_combined = current_combined-1
+    where gym_id =p_gym_id;
+
+    INSERT INTO client_passes (gym_id, client_id, action, created_by)
+    VALUES (p_gym_id, p_client_id, 'out',p_user_id);
+
+    -- Daily lockers are given back when the client leaves; rentals are kept
+    UPDATE locker_assignments
+    SET released_on = now(),
+        release_reason = 'checkout',
+        released_by = p_user_id
+    WHERE gym_id = p_gym_id
+      AND client_id = p_client_id
+      AND assignment_type = 'daily'
+      AND released_on IS NULL;
 
-    return 'ERROR -  Client never checked in in this gym today!';
+    RETURN 'OK';
 END;
 $$;
 
 alter function public.do_client_check_out_gym(integer, integer, integer) owner to gogymrest;
 
+
+create function public.expire_client_memberships() returns integer
+    language plpgsql
+as
+$$
+declare
+    l_count integer;
+begin
+    -- Time is up, or every entry of an entry plan has been used
+    -- Cancelled memberships that served their notice period end as cancelled
+    update client_memberships
+    set status     = case when canceleted_on is not null then 'canceled' else 'expired' end,
+        updated_on = now()
+    where status = 'active'
+      and (ending_on < current_date or remaining_entries = 0);
+
+    get diagnostics l_count = row_count;
+
+    return l_count;
+end;
+$$;
+
+alter function public.expire_client_memberships() owner to gogymrest;
+
+create function public.check_client_age_rules(p_client_id integer, p_gym_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_dob         date;
+    l_client_type varchar;
+    l_guardian_id integer;
+    l_age         integer;
+    l_min_age     integer := 0;
+    l_consent_age integer := 18;
+    l_contor      integer;
+begin
+    select dob, coalesce(client_type, 'person'), guardian_client_id
+    into l_dob, l_client_type, l_guardian_id
+    from clients
+    where id = p_client_id;
+
+    if not found then
+        return 'ERROR - Client not found!';
+    end if;
+
+    -- Companies and persons without a date of birth are not subject to age rules
+    if l_client_type <> 'person' or l_dob is null then
+        return 'OK';
+    end if;
+
+    if p_gym_id is not null then
+        select coalesce(min_age, 0), coalesce(consent_age, 18)
+        into l_min_age, l_consent_age
+        from gyms
+        where id = p_gym_id;
+
+        if not found then
+            l_min_age := 0;
+            l_consent_age := 18;
+        end if;
+    end if;
+
+    l_age := date_part('year', age(current_date, l_dob))::integer;
+
+    if l_age < l_min_age then
+        return 'ERROR - Client is under the minimum age of ' || l_min_age || ' for this gym!';
+    end if;
+
+    if l_age >= l_consent_age then
+        return 'OK';
+    end if;
+
+    if l_guardian_id is null then
+        return 'ERROR - Client is a minor and needs a linked guardian!';
+    end if;
+
+    select count(*) into l_contor
+    from client_guardian_consents
+    where client_id = p_client_id
+      and guardian_client_id = l_guardian_id
+      and revoked_on is null;
+
+    if l_contor = 0 then
+        return 'ERROR - Client is a minor and has no guardian consent on record!';
+    end if;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.check_client_age_rules(integer, integer) owner to gogymrest;
+
+create function public.set_client_guardian(p_client_id integer, p_guardian_client_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_guardian_type varchar;
+    l_guardian_dob  date;
+    l_current_id    integer;
+begin
+    if p_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    if p_guardian_client_id is null then
+        return 'ERROR - Guardian needs to be selected!';
+    end if;
+
+    if p_client_id = p_guardian_client_id then
+        return 'ERROR - A client cannot be their own guardian!';
+    end if;
+
+    select guardian_client_id into l_current_id from clients where id = p_client_id;
+    if not found then
+        return 'ERROR - Client not found!';
+    end if;
+
+    select coalesce(client_type, 'person'), dob
+    into l_guardian_type, l_guardian_dob
+    from clients
+    where id = p_guardian_client_id;
+
+    if not found then
+        return 'ERROR - Guardian not found!';
+    end if;
+
+    if l_guardian_type <> 'person' then
+        return 'ERROR - Guardian must be a person!';
+    end if;
+
+    if l_guardian_dob is null or date_part('year', age(current_date, l_guardian_dob)) < 18 then
+        return 'ERROR - Guardian must be an adult!';
+    end if;
+
+    -- Consents given by a previous guardian no longer apply
+    if l_current_id is distinct from p_guardian_client_id then
+        update client_guardian_consents
+        set revoked_on = current_date,
+            revoked_by = p_user_id
+        where client_id = p_client_id
+          and revoked_on is null;
+    end if;
+
+    update clients
+    set guardian_client_id = p_guardian_client_id,
+        updated_by = p_user_id,
+        updated_on = now()
+    where id = p_client_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.set_client_guardian(integer, integer, integer) owner to gogymrest;
+
+create function public.record_guardian_consent(p_client_id integer, p_consent_date date, p_document_ref character varying, p_notes character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_guardian_id integer;
+begin
+    if p_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    select guardian_client_id into l_guardian_id from clients where id = p_client_id;
+    if not found then
+        return 'ERROR - Client not found!';
+    end if;
+
+    if l_guardian_id is null then
+        return 'ERROR - Client has no linked guardian!';
+    end if;
+
+    if p_consent_date is null then
+        return 'ERROR - Consent date is required!';
+    end if;
+
+    if p_consent_date > current_date then
+        return 'ERROR - Consent date cannot be in the future!';
+    end if;
+
+    -- Keep a single active consent per client
+    update client_guardian_consents
+    set revoked_on = current_date,
+        revoked_by = p_user_id
+    where client_id = p_client_id
+      and revoked_on is null;
+
+    insert into client_guardian_consents(client_id, guardian_client_id, consent_date, document_ref, notes, created_by)
+    values (p_client_id, l_guardian_id, p_consent_date, trim(p_document_ref), trim(p_notes), p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.record_guardian_consent(integer, date, varchar, varchar, integer) owner to gogymrest;
+
+create function public.create_corporate_account(p_company_client_id integer, p_contact_name character varying, p_contact_email character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_client_type       varchar;
+    l_trade_register_no varchar;
+    l_contor            integer;
+begin
+    if p_company_client_id is null then
+        return 'ERROR - Company needs to be selected!';
+    end if;
+
+    select coalesce(client_type, 'person'), trade_register_no
+    into l_client_type, l_trade_register_no
+    from clients
+    where id = p_company_client_id;
+
+    if not found then
+        return 'ERROR - Company not found!';
+    end if;
+
+    if l_client_type <> 'company' or l_trade_register_no is null then
+        return 'ERROR - Corporate accounts can only be opened for company clients!';
+    end if;
+
+    select count(*) into l_contor from corporate_accounts where company_client_id = p_company_client_id;
+    if l_contor > 0 then
+        return 'ERROR - Company already has a corporate account!';
+    end if;
+
+    if length(p_contact_name) > 128 then
+        return 'ERROR - Contact name cannot exceed 128 characters';
+    end if;
+
+    if p_contact_email is not null and length(p_contact_email) > 128 then
+        return 'ERROR - Contact email cannot exceed 128 characters';
+    end if;
+
+    insert into corporate_accounts(company_client_id, contact_name, contact_email, status, created_by, updated_by)
+    values (p_company_client_id, trim(p_contact_name), lower(trim(p_contact_email)), 'active', p_user_id, p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.create_corporate_account(integer, varchar, varchar, integer) owner to gogymrest;
+
+create function public.add_corporate_employee(p_account_id integer, p_client_id integer, p_employee_no character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_status      varchar;
+    l_client_type varchar;
+    l_account_id  integer;
+begin
+    select status into l_status from corporate_accounts where id = p_account_id;
+    if not found then
+        return 'ERROR - Corporate account not found!';
+    end if;
+
+    if l_status <> 'active' then
+        return 'ERROR - Corporate account is not active!';
+    end if;
+
+    select coalesce(client_type, 'person') into l_client_type from clients where id = p_client_id;
+    if not found then
+        return 'ERROR - Client not found!';
+    end if;
+
+    if l_client_type <> 'person' then
+        return 'ERROR - Only persons can be added as employees!';
+    end if;
+
+    select corporate_account_id into l_account_id
+    from corporate_employees
+    where client_id = p_client_id
+      and left_on is null;
+
+    if l_account_id = p_account_id then
+        return 'ERROR - Client is already an employee of this company!';
+    end if;
+
+    if l_account_id is not null then
+        return 'ERROR - Client is already an employee of another company!';
+    end if;
+
+    insert into corporate_employees(corporate_account_id, client_id, employee_no, joined_on, created_by, updated_by)
+    values (p_account_id, p_client_id, trim(p_employee_no), current_date, p_user_id, p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.add_corporate_employee(integer, integer, varchar, integer) owner to gogymrest;
+
+create function public.remove_corporate_employee(p_account_id integer, p_client_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_employee_id integer;
+begin
+    select id into l_employee_id
+    from corporate_employees
+    where corporate_account_id = p_account_id
+      and client_id = p_client_id
+      and left_on is null;
+
+    if not found then
+        return 'ERROR - Client is not an employee of this company!';
+    end if;
+
+    update corporate_employees
+    set left_on = current_date,
+        updated_by = p_user_id
+    where id = l_employee_id;
+
+    -- Company-paid memberships end with the employment and free their seats
+    update client_memberships
+    set status = 'inactive',
+        canceleted_on = current_date,
+        updated_on = now(),
+        updated_by = p_user_id
+    where client_id = p_client_id
+      and status = 'active'
+      and corporate_allocation_id in (select id from corporate_allocations where corporate_account_id = p_account_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.remove_corporate_employee(integer, integer, integer) owner to gogymrest;
+
+create function public.create_corporate_allocation(p_account_id integer, p_membership_id integer, p_seats integer, p_valid_from date, p_valid_to date, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_status varchar;
+    l_contor integer;
+begin
+    select status into l_status from corporate_accounts where id = p_account_id;
+    if not found then
+        return 'ERROR - Corporate account not found!';
+    end if;
+
+    if l_status <> 'active' then
+        return 'ERROR - Corporate account is not active!';
+    end if;
+
+    select count(*) into l_contor from memberships where id = p_membership_id and is_active = true;
+    if l_contor = 0 then
+        return 'ERROR - Membership not found or inactive!';
+    end if;
+
+    if p_seats is null or p_seats <= 0 then
+        return 'ERROR - Seats must be greater than 0!';
+    end if;
+
+    if p_valid_from is null then
+        return 'ERROR - Valid from date is required!';
+    end if;
+
+    if p_valid_to is not null and p_valid_to < p_valid_from then
+        return 'ERROR - Valid to date cannot be before valid from date!';
+    end if;
+
+    insert into corporate_allocations(corporate_account_id, membership_id, seats, valid_from, valid_to, created_by)
+    values (p_account_id, p_membership_id, p_seats, p_valid_from, p_valid_to, p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.create_corporate_allocation(integer, integer, integer, date, date, integer) owner to gogymrest;
+
+create function public.assign_corporate_membership(p_allocation_id integer, p_client_id integer, p_valid_from date, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_allocation corporate_allocations%rowtype;
+    l_status     varchar;
+    l_contor     integer;
+    l_response   varchar;
+begin
+    -- Lock the allocation so concurrent assignments cannot exceed the seats
+    select * into l_allocation from corporate_allocations where id = p_allocation_id for update;
+    if not found then
+        return 'ERROR - Allocation not found!';
+    end if;
+
+    select status into l_status from corporate_accounts where id = l_allocation.corporate_account_id;
+    if l_status <> 'active' then
+        return 'ERROR - Corporate account is not active!';
+    end if;
+
+    select count(*) into l_contor
+    from corporate_employees
+    where corporate_account_id = l_allocation.corporate_account_id
+      and client_id = p_client_id
+      and left_on is null;
+
+    if l_contor = 0 then
+        return 'ERROR - Client is not an employee of this company!';
+    end if;
+
+    if p_valid_from < l_allocation.valid_from
+        or (l_allocation.valid_to is not null and p_valid_from > l_allocation.valid_to) then
+        return 'ERROR - Start date is outside the allocation period!';
+    end if;
+
+    select count(*) into l_contor
+    from client_memberships
+    where corporate_allocation_id = p_allocation_id
+      and status = 'active'
+      and ending_on >= current_date;
+
+    if l_contor >= l_allocation.seats then
+        return 'ERROR - All ' || l_allocation.seats || ' seats of this allocation are in use!';
+    end if;
+
+    l_response := add_client_membership(p_client_id, l_allocation.membership_id, p_valid_from, p_user_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    update client_memberships
+    set corporate_allocation_id = p_allocation_id
+    where id = (select max(id)
+                from client_memberships
+                where client_id = p_client_id
+                  and membership_id = l_allocation.membership_id
+                  and starting_from = p_valid_from);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.assign_corporate_membership(integer, integer, date, integer) owner to gogymrest;
+
+create function public.gym_local_time(p_gym_id integer) returns timestamp
+    language plpgsql
+    stable
+as
+$$
+declare
+    l_time_zone varchar;
+begin
+    select coalesce(time_zone, 'Europe/Bucharest') into l_time_zone from gyms where id = p_gym_id;
+    return now() at time zone coalesce(l_time_zone, 'Europe/Bucharest');
+end;
+$$;
+
+alter function public.gym_local_time(integer) owner to gogymrest;
+
+create function public.membership_window_open(p_membership_id integer, p_local_time timestamp) returns boolean
+    language sql
+    stable
+as
+$$
+    -- Memberships without windows are not time restricted
+    select not exists (select 1 from membership_time_windows where membership_id = p_membership_id)
+        or exists (select 1
+                   from membership_time_windows
+                   where membership_id = p_membership_id
+                     and weekday = extract(isodow from p_local_time)
+                     and p_local_time::time >= start_time
+                     and p_local_time::time < end_time);
+$$;
+
+alter function public.membership_window_open(integer, timestamp) owner to gogymrest;
+
+create function public.describe_membership_windows(p_membership_id integer) returns character varying
+    language sql
+    stable
+as
+$$
+    select string_agg((array ['Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat', 'Sun'])[weekday] || ' '
+                          || to_char(start_time, 'HH24:MI') || '-' || to_char(end_time, 'HH24:MI'),
+                      ', ' order by weekday, start_time)
+    from membership_time_windows
+    where membership_id = p_membership_id;
+$$;
+
+alter function public.describe_membership_windows(integer) owner to gogymrest;
+
+create function public.create_guest_client(p_name character varying, p_phone character varying, p_email character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_client_id integer;
+begin
+    -- Lightweight record for walk-ins and guests: no CIF, address or date of birth
+    if p_name is null or length(trim(p_name)) = 0 then
+        return 'ERROR - Guest name is required';
+    end if;
+
+    if length(trim(p_name)) > 128 then
+        return 'ERROR - Name cannot exceed 128 characters';
+    end if;
+
+    if p_phone is not null and p_phone !~ '^\+?[0-9]{8,15}$' then
+        return 'ERROR - Phone must contain 8 to 15 digits';
+    end if;
+
+    if p_email is not null and length(p_email) > 128 then
+        return 'ERROR - Email cannot exceed 128 characters';
+    end if;
+
+    insert into clients(client_type, name, phone, email, created_on, updated_on, created_by, updated_by)
+    values ('guest', trim(p_name), trim(p_phone), lower(trim(p_email)), now(), now(), p_user_id, p_user_id)
+    returning id into l_client_id;
+
+    insert into user_clients(user_id, client_id, created_on)
+    values (p_user_id, l_client_id, now());
+
+    return 'OK';
+end;
+$$;
+
+alter function public.create_guest_client(varchar, varchar, varchar, integer) owner to gogymrest;
+
+create function public.sell_day_pass(p_client_id integer, p_membership_id integer, p_gym_id integer, p_valid_on date, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_plan_type varchar;
+    l_contor    integer;
+begin
+    if p_gym_id is null then
+        return 'ERROR - GYM needs to be selected!';
+    end if;
+
+    select plan_type into l_plan_type
+    from memberships
+    where id = p_membership_id
+      and is_active = true;
+
+    if not found then
+        return 'ERROR - Membership not found!';
+    end if;
+
+    if coalesce(l_plan_type, 'time') <> 'day' then
+        return 'ERROR - Membership is not a day pass!';
+    end if;
+
+    select count(*) into l_contor
+    from membership_gyms
+    where membership_id = p_membership_id
+      and gym_id = p_gym_id;
+
+    if l_contor = 0 then
+        return 'ERROR - Day pass is not sold in this gym!';
+    end if;
+
+    return add_client_membership(p_client_id, p_membership_id, coalesce(p_valid_on, gym_local_time(p_gym_id)::date), p_user_id);
+end;
+$$;
+
+alter function public.sell_day_pass(integer, integer, integer, date, integer) owner to gogymrest;
+
+create function public.do_guest_check_in_gym(p_host_client_id integer, p_guest_client_id integer, p_gym_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    cu record;
+    l_response             varchar;
+    l_local_now            timestamp;
+    l_client_membership_id integer;
+    l_contor               integer;
+begin
+    if p_host_client_id is null then
+        return 'ERROR - Host member needs to be selected!';
+    end if;
+
+    if p_guest_client_id is null then
+        return 'ERROR - Guest needs to be selected!';
+    end if;
+
+    if p_gym_id is null then
+        return 'ERROR - GYM needs to be selected!';
+    end if;
+
+    if p_host_client_id = p_guest_client_id then
+        return 'ERROR - A member cannot be their own guest!';
+    end if;
+
+    l_response := check_client_age_rules(p_guest_client_id, p_gym_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    l_local_now := gym_local_time(p_gym_id);
+
+    -- The guest is admitted on a valid membership of the host that still has guest passes
+    select cm.id into l_client_membership_id
+    from client_memberships cm
+             inner join membership_gyms mg on mg.membership_id = cm.membership_id
+             inner join memberships m on m.id = cm.membership_id
+    where cm.client_id = p_host_client_id
+      and mg.gym_id = p_gym_id
+      and l_local_now::date between cm.starting_from and cm.ending_on
+      and cm.status = 'active'
+      and coalesce(cm.dunning_status, '') <> 'suspended'
+      and m.is_active = true
+      and cm.remaining_guest_passes > 0
+      and membership_window_open(cm.membership_id, l_local_now)
+    order by cm.ending_on, cm.id
+    limit 1
+    for update of cm;
+
+    if l_client_membership_id is null then
+        return 'ERROR - Access Denied! Host has no membership with guest passes left for this gym!';
+    end if;
+
+    select count(*) into l_contor
+    from client_passes
+    where client_id = p_guest_client_id
+      and gym_id = p_gym_id
+      and host_client_id is not null
+      and created_on = l_local_now::date;
+
+    if l_contor > 0 then
+        return 'ERROR - Guest has already been brought in today!';
+    end if;
+
+    for cu in (select * from gym_stats where gym_id = p_gym_id)
+        loop
+            if cu.current_combined + 1 > cu.max_people then
+                return 'ERROR - Currently there isn''t any space available!';
+            end if;
+        end loop;
+
+    update client_memberships
+    set remaining_guest_passes = remaining_guest_passes - 1,
+        updated_on = now(),
+        updated_by = p_user_id
+    where id = l_client_membership_id;
+
+    update gym_stats
+    set current_people = current_people+1,
+        current_combined = current_combined+1
+    where gym_id = p_gym_id;
+
+    insert into client_passes (gym_id, client_id, action, created_by, client_membership_id, host_client_id)
+    values (p_gym_id, p_guest_client_id, 'in', p_user_id, l_client_membership_id, p_host_client_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.do_guest_check_in_gym(integer, integer, integer, integer) owner to gogymrest;
+
+create function public.invoice_client_membership(p_client_membership_id integer, p_gym_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_cm         record;
+    l_price      membership_prices%rowtype;
+    l_series     invoice_series%rowtype;
+    l_invoice_id integer;
+    l_net        numeric(10, 2);
+    l_vat        numeric(10, 2);
+    l_contor     integer;
+begin
+    select cm.id, cm.client_id, cm.membership_id, cm.starting_from, cm.ending_on,
+           cm.corporate_allocation_id, m.name
+    into l_cm
+    from client_memberships cm
+             inner join memberships m on m.id = cm.membership_id
+    where cm.id = p_client_membership_id;
+
+    if not found then
+        return 'ERROR - Client membership not found!';
+    end if;
+
+    -- Company-paid memberships are billed to the company, not to the employee
+    if l_cm.corporate_allocation_id is not null then
+        return 'OK';
+    end if;
+
+    select count(*) into l_contor
+    from invoice_lines il
+             inner join invoices i on i.id = il.invoice_id
+    where il.client_membership_id = p_client_membership_id
+      and i.status <> 'cancelled';
+
+    if l_contor > 0 then
+        return 'ERROR - Membership is already invoiced!';
+    end if;
+
+    -- Gym price first, then the default price, as in effect on the sale date
+    select * into l_price
+    from membership_prices
+    where membership_id = l_cm.membership_id
+      and (gym_id = p_gym_id or gym_id is null)
+      and valid_from <= current_date
+      and (valid_to is null or valid_to >= current_date)
+    order by gym_id is null, valid_from desc
+    limit 1;
+
+    -- Memberships without a price are free and are not invoiced
+    if not found then
+        return 'OK';
+    end if;
+
+    select * into l_series
+    from invoice_series
+    where gym_id = p_gym_id or gym_id is null
+    order by gym_id is null
+    limit 1
+    for update;
+
+    if not found then
+        return 'ERROR - No invoice series configured!';
+    end if;
+
+    -- Prices are VAT inclusive
+    l_net := round(l_price.price * 100 / (100 + coalesce(l_price.vat_rate, 0)), 2);
+    l_vat := l_price.price - l_net;
+
+    insert into invoices(series_code, number, client_id, gym_id, issue_date, due_date, currency,
+                         net_amount, vat_amount, total_amount, paid_amount, status, created_by)
+    values (l_series.code, l_series.next_no, l_cm.client_id, p_gym_id, current_date,
+            greatest(current_date, l_cm.starting_from), l_price.currency,
+            l_net, l_vat, l_price.price, 0, 'unpaid', p_user_id)
+    returning id into l_invoice_id;
+
+    insert into invoice_lines(invoice_id, client_membership_id, description, quantity, unit_price,
+                              vat_rate, net_amount, vat_amount, total_amount)
+    values (l_invoice_id, p_client_membership_id,
+            l_cm.name || ' membership ' || to_char(l_cm.starting_from, 'YYYY-MM-DD') || ' - ' || to_char(l_cm.ending_on, 'YYYY-MM-DD'),
+            1, l_net, l_price.vat_rate, l_net, l_vat, l_price.price);
+
+    update invoice_series
+    set next_no = next_no + 1
+    where id = l_series.id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.invoice_client_membership(integer, integer, integer) owner to gogymrest;
+
+create function public.register_payment(p_invoice_id integer, p_amount numeric, p_method character varying, p_paid_on date, p_reference character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_invoice            invoices%rowtype;
+    l_balance            numeric(10, 2);
+    l_referrer_client_id integer;
+begin
+    if p_amount is null or p_amount <= 0 then
+        return 'ERROR - Payment amount must be positive!';
+    end if;
+
+    if p_method is null or p_method not in ('cash', 'card', 'transfer') then
+        return 'ERROR - Payment method must be cash, card or transfer!';
+    end if;
+
+    -- Locked so concurrent payments cannot overpay the invoice
+    select * into l_invoice
+    from invoices
+    where id = p_invoice_id
+    for update;
+
+    if not found then
+        return 'ERROR - Invoice not found!';
+    end if;
+
+    if l_invoice.status = 'cancelled' then
+        return 'ERROR - Invoice is cancelled!';
+    end if;
+
+    l_balance := l_invoice.total_amount - l_invoice.paid_amount;
+    if l_balance <= 0 then
+        return 'ERROR - Invoice is already paid!';
+    end if;
+
+    if p_amount > l_balance then
+        return 'ERROR - Payment of ' || p_amount || ' exceeds the balance of ' || l_balance || '!';
+    end if;
+
+    insert into payments(invoice_id, amount, method, paid_on, reference, created_by)
+    values (p_invoice_id, p_amount, p_method, coalesce(p_paid_on, current_date), p_reference, p_user_id);
+
+    update invoices
+    set paid_amount = paid_amount + p_amount,
+        status      = case when paid_amount + p_amount >= total_amount then 'paid' else 'partially_paid' end
+    where id = p_invoice_id;
+
+    if p_amount >= l_balance then
+        -- Paying a renewal in full ends its dunning and lifts a suspension
+        update client_memberships
+        set dunning_status = 'paid',
+            updated_on     = now(),
+            updated_by     = p_user_id
+        where id in (select client_membership_id from invoice_lines where invoice_id = p_invoice_id)
+          and dunning_status in ('unpaid', 'overdue', 'suspended');
+
+        -- A referred client paying for a membership earns the referrer their reward
+        update client_referrals
+        set status       = 'earned',
+            qualified_on = current_date
+        where referred_client_id = l_invoice.client_id
+          and status = 'pending'
+          and exists (select 1 from invoice_lines
+                      where invoice_id = p_invoice_id
+                        and client_membership_id is not null)
+        returning referrer_client_id into l_referrer_client_id;
+
+        if l_referrer_client_id is not null then
+            perform apply_referral_rewards(l_referrer_client_id);
+        end if;
+    end if;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.register_payment(integer, numeric, varchar, date, varchar, integer) owner to gogymrest;
+
+create function public.set_client_membership_auto_renew(p_client_membership_id integer, p_auto_renew boolean, p_gym_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_cm     record;
+    l_contor integer;
+begin
+    select cm.id, cm.membership_id, cm.status, cm.corporate_allocation_id, m.plan_type
+    into l_cm
+    from client_memberships cm
+             inner join memberships m on m.id = cm.membership_id
+    where cm.id = p_client_membership_id;
+
+    if not found then
+        return 'ERROR - Client membership not found!';
+    end if;
+
+    if p_auto_renew then
+        if l_cm.plan_type = 'day' then
+            return 'ERROR - Day passes cannot be renewed automatically!';
+        end if;
+
+        -- Company-paid memberships are renewed through a new seat allocation
+        if l_cm.corporate_allocation_id is not null then
+            return 'ERROR - Company-paid memberships cannot be renewed automatically!';
+        end if;
+
+        if l_cm.status <> 'active' then
+            return 'ERROR - Only active memberships can be renewed automatically!';
+        end if;
+
+        if p_gym_id is not null then
+            select count(*) into l_contor
+            from membership_gyms
+            where membership_id = l_cm.membership_id
+              and gym_id = p_gym_id;
+
+            if l_contor = 0 then
+                return 'ERROR - Membership is not offered at this gym!';
+            end if;
+        end if;
+    end if;
+
+    update client_memberships
+    set auto_renew     = p_auto_renew,
+        renewal_gym_id = case when p_auto_renew then p_gym_id else renewal_gym_id end,
+        updated_on     = now(),
+        updated_by     = p_user_id
+    where id = p_client_membership_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.set_client_membership_auto_renew(integer, boolean, integer, integer) owner to gogymrest;
+
+create function public.renew_client_membership(p_client_membership_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_cm       record;
+    l_new_id   integer;
+    l_contor   integer;
+    l_response varchar;
+begin
+    -- Locked so two scheduler runs cannot renew the same period twice
+    select cm.id, cm.client_id, cm.membership_id, cm.ending_on, cm.status, cm.auto_renew,
+           cm.renewal_gym_id, cm.dunning_status, m.is_active
+    into l_cm
+    from client_memberships cm
+             inner join memberships m on m.id = cm.membership_id
+    where cm.id = p_client_membership_id
+    for update of cm;
+
+    if not found then
+        return 'ERROR - Client membership not found!';
+    end if;
+
+    if not coalesce(l_cm.auto_renew, false) then
+        return 'ERROR - Membership is not set to renew automatically!';
+    end if;
+
+    if l_cm.status <> 'active' then
+        return 'ERROR - Only active memberships can be renewed!';
+    end if;
+
+    if coalesce(l_cm.dunning_status, '') in ('overdue', 'suspended') then
+        return 'ERROR - The previous renewal is unpaid!';
+    end if;
+
+    if not coalesce(l_cm.is_active, false) then
+        return 'ERROR - Membership plan is no longer active!';
+    end if;
+
+    select count(*) into l_contor
+    from client_memberships
+    where renewed_from_id = p_client_membership_id;
+
+    if l_contor > 0 then
+        return 'ERROR - Membership is already renewed!';
+    end if;
+
+    -- The next period starts the day after this one ends, with the usual overlap and age checks
+    l_response := add_client_membership(l_cm.client_id, l_cm.membership_id, l_cm.ending_on + 1, p_user_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    l_new_id := currval(pg_get_serial_sequence('client_memberships', 'id'));
+
+    update client_memberships
+    set auto_renew      = true,
+        renewal_gym_id  = l_cm.renewal_gym_id,
+        renewed_from_id = l_cm.id
+    where id = l_new_id;
+
+    l_response := invoice_client_membership(l_new_id, l_cm.renewal_gym_id, p_user_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    -- Renewals without a price are free and need no dunning
+    update client_memberships cm
+    set dunning_status = 'unpaid'
+    where cm.id = l_new_id
+      and exists (select 1
+                  from invoice_lines il
+                           inner join invoices i on i.id = il.invoice_id
+                  where il.client_membership_id = cm.id
+                    and i.status in ('unpaid', 'partially_paid'));
+
+    return 'OK';
+end;
+$$;
+
+alter function public.renew_client_membership(integer, integer) owner to gogymrest;
+
+create function public.apply_promo_code(p_client_membership_id integer, p_code character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_promo    promo_codes%rowtype;
+    l_cm       record;
+    l_invoice  invoices%rowtype;
+    l_line     invoice_lines%rowtype;
+    l_contor   integer;
+    l_discount numeric(10, 2);
+    l_total    numeric(10, 2);
+    l_net      numeric(10, 2);
+begin
+    if p_code is null or trim(p_code) = '' then
+        return 'ERROR - Promo code needs to be entered!';
+    end if;
+
+    -- Locked so concurrent sales cannot exceed the usage cap
+    select * into l_promo
+    from promo_codes
+    where upper(code) = upper(trim(p_code))
+    for update;
+
+    if not found then
+        return 'ERROR - Promo code not found!';
+    end if;
+
+    if not coalesce(l_promo.is_active, false) then
+        return 'ERROR - Promo code is no longer active!';
+    end if;
+
+    if current_date < l_promo.valid_from or current_date > l_promo.valid_to then
+        return 'ERROR - Promo code is valid from ' || l_promo.valid_from
+                   || coalesce(' to ' || l_promo.valid_to, '') || '!';
+    end if;
+
+    if l_promo.max_uses is not null and l_promo.uses_count >= l_promo.max_uses then
+        return 'ERROR - Promo code has reached its usage limit!';
+    end if;
+
+    select id, client_id, membership_id into l_cm
+    from client_memberships
+    where id = p_client_membership_id;
+
+    if not found then
+        return 'ERROR - Client membership not found!';
+    end if;
+
+    if l_promo.membership_id is not null and l_promo.membership_id <> l_cm.membership_id then
+        return 'ERROR - Promo code does not apply to this membership!';
+    end if;
+
+    select count(*) into l_contor
+    from promo_redemptions
+    where promo_code_id = l_promo.id
+      and client_id = l_cm.client_id;
+
+    if l_promo.max_uses_per_client is not null and l_contor >= l_promo.max_uses_per_client then
+        return 'ERROR - Client has already used this promo code!';
+    end if;
+
+    select i.* into l_invoice
+    from invoices i
+             inner join invoice_lines il on il.invoice_id = i.id
+    where il.client_membership_id = p_client_membership_id
+      and i.status <> 'cancelled'
+    order by i.id desc
+    limit 1
+    for update of i;
+
+    if not found then
+        return 'ERROR - Membership has no price to discount!';
+    end if;
+
+    if l_promo.gym_id is not null and l_invoice.gym_id is distinct from l_promo.gym_id then
+        return 'ERROR - Promo code is not valid at this gym!';
+    end if;
+
+    if l_invoice.paid_amount > 0 then
+        return 'ERROR - Invoice already has payments, the discount cannot be applied!';
+    end if;
+
+    select * into l_line
+    from invoice_lines
+    where invoice_id = l_invoice.id
+      and client_membership_id = p_client_membership_id
+    order by id
+    limit 1;
+
+    -- Discounts are taken off the gross price; the VAT is recomputed on what is left
+    if l_promo.discount_type = 'percent' then
+        l_discount := round(l_line.total_amount * l_promo.discount_value / 100, 2);
+    else
+        l_discount := least(l_promo.discount_value, l_line.total_amount);
+    end if;
+
+    l_total := l_line.total_amount - l_discount;
+    l_net := round(l_total * 100 / (100 + coalesce(l_line.vat_rate, 0)), 2);
+
+    update invoice_lines
+    set unit_price   = round(l_net / quantity, 2),
+        net_amount   = l_net,
+        vat_amount   = l_total - l_net,
+        total_amount = l_total,
+        description  = left(description || ' (promo ' || upper(l_promo.code) || ')', 256)
+    where id = l_line.id;
+
+    update invoices i
+    set net_amount   = t.net_amount,
+        vat_amount   = t.vat_amount,
+        total_amount = t.total_amount,
+        status       = case when t.total_amount <= 0 then 'paid' else i.status end
+    from (select sum(net_amount) as net_amount, sum(vat_amount) as vat_amount, sum(total_amount) as total_amount
+          from invoice_lines
+          where invoice_id = l_invoice.id) t
+    where i.id = l_invoice.id;
+
+    insert into promo_redemptions(promo_code_id, client_id, client_membership_id, invoice_id, price,
+                                  discount_amount, created_by)
+    values (l_promo.id, l_cm.client_id, p_client_membership_id, l_invoice.id, l_line.total_amount,
+            l_discount, p_user_id);
+
+    update promo_codes
+    set uses_count = uses_count + 1
+    where id = l_promo.id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.apply_promo_code(integer, varchar, integer) owner to gogymrest;
+
+create function public.set_client_referrer(p_client_id integer, p_referrer_client_id integer, p_reward_days integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_referral client_referrals%rowtype;
+    l_contor   integer;
+begin
+    if p_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    if p_referrer_client_id is null then
+        return 'ERROR - Referrer needs to be selected!';
+    end if;
+
+    if p_client_id = p_referrer_client_id then
+        return 'ERROR - A client cannot refer themselves!';
+    end if;
+
+    select count(*) into l_contor from clients where id = p_referrer_client_id;
+    if l_contor = 0 then
+        return 'ERROR - Referrer not found!';
+    end if;
+
+    select count(*) into l_contor
+    from client_referrals
+    where referrer_client_id = p_client_id
+      and referred_client_id = p_referrer_client_id;
+
+    if l_contor > 0 then
+        return 'ERROR - Clients cannot refer each other!';
+    end if;
+
+    select * into l_referral
+    from client_referrals
+    where referred_client_id = p_client_id
+    for update;
+
+    if l_referral.id is not null and l_referral.status <> 'pending' then
+        return 'ERROR - The referral reward was already earned and cannot be changed!';
+    end if;
+
+    -- Only new clients can be referred: the reward is earned on their first paid membership
+    select count(*) into l_contor
+    from invoices i
+    where i.client_id = p_client_id
+      and i.status = 'paid'
+      and exists (select 1 from invoice_lines il
+                  where il.invoice_id = i.id
+                    and il.client_membership_id is not null);
+
+    if l_contor > 0 then
+        return 'ERROR - Client has already paid for a membership and cannot be referred!';
+    end if;
+
+    if l_referral.id is not null then
+        update client_referrals
+        set referrer_client_id = p_referrer_client_id,
+            reward_days        = p_reward_days,
+            referred_on        = current_date,
+            created_by         = p_user_id
+        where id = l_referral.id;
+    else
+        insert into client_referrals(referrer_client_id, referred_client_id, reward_days, status, created_by)
+        values (p_referrer_client_id, p_client_id, p_reward_days, 'pending', p_user_id);
+    end if;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.set_client_referrer(integer, integer, integer, integer) owner to gogymrest;
+
+create function public.apply_referral_rewards(p_referrer_client_id integer) returns integer
+    language plpgsql
+as
+$$
+declare
+    l_referral             record;
+    l_client_membership_id integer;
+    l_count                integer := 0;
+begin
+    -- Earned rewards wait until the referrer has an active membership to extend
+    for l_referral in (select id, referrer_client_id, reward_days
+                       from client_referrals
+                       where status = 'earned'
+                         and (p_referrer_client_id is null or referrer_client_id = p_referrer_client_id)
+                       order by qualified_on, id
+                       for update) loop
+            l_client_membership_id := null;
+
+            select cm.id into l_client_membership_id
+            from client_memberships cm
+                     inner join memberships m on m.id = cm.membership_id
+            where cm.client_id = l_referral.referrer_client_id
+              and cm.status = 'active'
+              and cm.ending_on >= current_date
+              and cm.corporate_allocation_id is null
+              and cm.canceleted_on is null
+              and m.plan_type <> 'day'
+            order by cm.ending_on desc, cm.id desc
+            limit 1
+            for update of cm;
+
+            if l_client_membership_id is null then
+                continue;
+            end if;
+
+            update client_memberships
+            set ending_on  = ending_on + l_referral.reward_days,
+                updated_on = now()
+            where id = l_client_membership_id;
+
+            update client_referrals
+            set status                        = 'rewarded',
+                rewarded_on                   = current_date,
+                rewarded_client_membership_id = l_client_membership_id
+            where id = l_referral.id;
+
+            l_count := l_count + 1;
+        end loop;
+
+    return l_count;
+end;
+$$;
+
+alter function public.apply_referral_rewards(integer) owner to gogymrest;
+
+create function public.client_membership_unused_share(p_client_membership_id integer, p_from date) returns numeric
+    language plpgsql
+as
+$$
+declare
+    l_cm         record;
+    l_total_days integer;
+    l_used_days  integer;
+    l_share      numeric;
+begin
+    select cm.starting_from, cm.ending_on, cm.remaining_entries, m.plan_type, m.entries_no
+    into l_cm
+    from client_memberships cm
+             inner join memberships m on m.id = cm.membership_id
+    where cm.id = p_client_membership_id;
+
+    if not found then
+        return 0;
+    end if;
+
+    -- Days from p_from on are unused
+    l_total_days := l_cm.ending_on - l_cm.starting_from + 1;
+    l_used_days := least(greatest(p_from - l_cm.starting_from, 0), l_total_days);
+    l_share := (l_total_days - l_used_days)::numeric / l_total_days;
+
+    -- Entry plans count the entries left when fewer than the days left
+    if l_cm.plan_type in ('entries', 'hybrid') and coalesce(l_cm.entries_no, 0) > 0 then
+        l_share := least(l_share, coalesce(l_cm.remaining_entries, 0)::numeric / l_cm.entries_no);
+    end if;
+
+    return l_share;
+end;
+$$;
+
+alter function public.client_membership_unused_share(integer, date) owner to gogymrest;
+
+create function public.issue_credit_note(p_invoice_id integer, p_client_membership_id integer, p_amount numeric, p_user_id integer) returns integer
+    language plpgsql
+as
+$$
+declare
+    l_invoice        invoices%rowtype;
+    l_line           invoice_lines%rowtype;
+    l_series         invoice_series%rowtype;
+    l_credit_note_id integer;
+    l_net            numeric(10, 2);
+begin
+    select * into l_invoice
+    from invoices
+    where id = p_invoice_id
+    for update;
+
+    if not found then
+        return null;
+    end if;
+
+    select * into l_line
+    from invoice_lines
+    where invoice_id = p_invoice_id
+      and (p_client_membership_id is null or client_membership_id = p_client_membership_id)
+    order by id
+    limit 1;
+
+    -- Credit notes are numbered in the series of the invoice they reverse
+    select * into l_series
+    from invoice_series
+    where code = l_invoice.series_code
+    for update;
+
+    if not found then
+        return null;
+    end if;
+
+    l_net := round(p_amount * 100 / (100 + coalesce(l_line.vat_rate, 0)), 2);
+
+    insert into invoices(series_code, number, client_id, gym_id, issue_date, due_date, currency,
+                         net_amount, vat_amount, total_amount, paid_amount, status, created_by,
+                         invoice_type, credited_invoice_id)
+    values (l_series.code, l_series.next_no, l_invoice.client_id, l_invoice.gym_id, current_date, current_date,
+            l_invoice.currency, -l_net, l_net - p_amount, -p_amount, -p_amount, 'paid', p_user_id,
+            'credit_note', p_invoice_id)
+    returning id into l_credit_note_id;
+
+    insert into invoice_lines(invoice_id, description, quantity, unit_price,
+                              vat_rate, net_amount, vat_amount, total_amount)
+    values (l_credit_note_id, left('Storno ' || l_line.description, 100), -1, l_net,
+            l_line.vat_rate, -l_net, l_net - p_amount, -p_amount);
+
+    update invoice_series
+    set next_no = next_no + 1
+    where id = l_series.id;
+
+    return l_credit_note_id;
+end;
+$$;
+
+alter function public.issue_credit_note(integer, integer, numeric, integer) owner to gogymrest;
+
+create function public.settle_invoice_with_credit(p_invoice_id integer, p_amount numeric, p_credit_note_id integer, p_user_id integer) returns numeric
+    language plpgsql
+as
+$$
+declare
+    l_balance   numeric(10, 2);
+    l_applied   numeric(10, 2);
+    l_reference varchar;
+begin
+    select total_amount - paid_amount into l_balance
+    from invoices
+    where id = p_invoice_id
+      and status <> 'cancelled'
+    for update;
+
+    l_applied := least(coalesce(p_amount, 0), greatest(coalesce(l_balance, 0), 0));
+    if l_applied <= 0 then
+        return 0;
+    end if;
+
+    select series_code || '-' || lpad(number::text, 6, '0') into l_reference
+    from invoices
+    where id = p_credit_note_id;
+
+    insert into payments(invoice_id, amount, method, paid_on, reference, created_by)
+    values (p_invoice_id, l_applied, 'credit', current_date, l_reference, p_user_id);
+
+    update invoices
+    set paid_amount = paid_amount + l_applied,
+        status      = case when paid_amount + l_applied >= total_amount then 'paid' else 'partially_paid' end
+    where id = p_invoice_id;
+
+    return l_applied;
+end;
+$$;
+
+alter function public.settle_invoice_with_credit(integer, numeric, integer, integer) owner to gogymrest;
+
+create function public.quote_membership_cancellation(p_client_membership_id integer, p_requested_on date,
+                                                     out effective_on date, out used_days integer,
+                                                     out total_days integer, out cooling_off boolean,
+                                                     out invoice_id integer, out currency character varying,
+                                                     out refundable_amount numeric, out fee_amount numeric,
+                                                     out credit_amount numeric, out balance_offset numeric,
+                                                     out refund_amount numeric)
+    language plpgsql
+as
+$$
+#variable_conflict use_column
+declare
+    l_cm          record;
+    l_invoice     record;
+    l_notice_days integer;
+    l_fee         numeric(10, 2);
+    l_fee_percent numeric(5, 2);
+    l_cooling_off integer;
+    l_ratio       numeric;
+begin
+    select cm.id, cm.starting_from, cm.ending_on, cm.created_on, cm.renewal_gym_id
+    into l_cm
+    from client_memberships cm
+    where cm.id = p_client_membership_id;
+
+    if l_cm.id is null then
+        return;
+    end if;
+
+    select i.id, i.gym_id, i.currency, i.total_amount - i.paid_amount as balance, il.total_amount as line_total
+    into l_invoice
+    from invoice_lines il
+             inner join invoices i on i.id = il.invoice_id
+    where il.client_membership_id = p_client_membership_id
+      and i.status <> 'cancelled'
+      and i.invoice_type = 'invoice'
+    order by i.id desc
+    limit 1;
+
+    -- Policy of the gym that sold the membership, the defaults otherwise
+    select g.cancellation_notice_days, g.cancellation_fee, g.cancellation_fee_percent, g.cancellation_cooling_off_days
+    into l_notice_days, l_fee, l_fee_percent, l_cooling_off
+    from gyms g
+    where g.id = coalesce(l_invoice.gym_id, l_cm.renewal_gym_id);
+
+    l_notice_days := coalesce(l_notice_days, 30);
+    l_fee := coalesce(l_fee, 0);
+    l_fee_percent := coalesce(l_fee_percent, 0);
+    l_cooling_off := coalesce(l_cooling_off, 14);
+
+    total_days := l_cm.ending_on - l_cm.starting_from + 1;
+    cooling_off := l_cm.created_on >= current_date - l_cooling_off
+        and not exists (select 1 from client_passes cp
+                        where cp.client_membership_id = p_client_membership_id
+                          and cp.action = 'in');
+
+    if cooling_off then
+        -- A membership not used yet is refunded in full within the cooling-off period
+        effective_on := current_date;
+        used_days := 0;
+        l_ratio := 1;
+        l_fee := 0;
+        l_fee_percent := 0;
+    else
+        effective_on := least(greatest(coalesce(p_requested_on, current_date), current_date + l_notice_days),
+                              l_cm.ending_on + 1);
+        used_days := least(greatest(effective_on - l_cm.starting_from, 0), total_days);
+        l_ratio := client_membership_unused_share(p_client_membership_id, effective_on);
+    end if;
+
+    invoice_id := l_invoice.id;
+    currency := l_invoice.currency;
+    refundable_amount := coalesce(round(l_invoice.line_total * l_ratio, 2), 0);
+    fee_amount := least(round(l_fee + refundable_amount * l_fee_percent / 100, 2), refundable_amount);
+    credit_amount := refundable_amount - fee_amount;
+
+    -- The credit settles what is still owed on the invoice, the rest is paid back
+    balance_offset := least(credit_amount, greatest(coalesce(l_invoice.balance, 0), 0));
+    refund_amount := credit_amount - balance_offset;
+end;
+$$;
+
+alter function public.quote_membership_cancellation(integer, date) owner to gogymrest;
+
+create function public.refund_method_of(p_invoice_id integer, p_refund_method character varying) returns character varying
+    language plpgsql
+as
+$$
+begin
+    -- Refunds go back the way the client paid unless told otherwise
+    return coalesce(p_refund_method,
+                    (select method from payments
+                     where invoice_id = p_invoice_id
+                       and method <> 'credit'
+                     order by id desc
+                     limit 1),
+                    'transfer');
+end;
+$$;
+
+alter function public.refund_method_of(integer, varchar) owner to gogymrest;
+
+create function public.cancel_client_membership(p_client_membership_id integer, p_requested_on date, p_reason character varying, p_refund_method character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_cm             client_memberships%rowtype;
+    l_quote          record;
+    l_credit_note_id integer;
+    l_refund_method  varchar;
+begin
+    if p_reason is null or trim(p_reason) = '' then
+        return 'ERROR - Cancellation reason is required!';
+    end if;
+
+    if p_requested_on < current_date then
+        return 'ERROR - Cancellation cannot take effect in the past!';
+    end if;
+
+    select * into l_cm
+    from client_memberships
+    where id = p_client_membership_id
+    for update;
+
+    if not found then
+        return 'ERROR - Client membership not found!';
+    end if;
+
+    if l_cm.canceleted_on is not null then
+        return 'ERROR - Membership is already cancelled!';
+    end if;
+
+    if l_cm.status <> 'active' or l_cm.ending_on < current_date then
+        return 'ERROR - Only active memberships can be cancelled!';
+    end if;
+
+    -- A period the scheduler already renewed and invoiced has to be cancelled on its own first
+    if exists (select 1 from client_memberships
+               where renewed_from_id = p_client_membership_id
+                 and canceleted_on is null
+                 and status = 'active') then
+        return 'ERROR - Membership was already renewed, cancel the renewal period first!';
+    end if;
+
+    select * into l_quote
+    from quote_membership_cancellation(p_client_membership_id, p_requested_on);
+
+    if l_quote.refund_amount > 0 then
+        l_refund_method := refund_method_of(l_quote.invoice_id, p_refund_method);
+        if l_refund_method not in ('cash', 'card', 'transfer') then
+            return 'ERROR - Refund method must be cash, card or transfer!';
+        end if;
+    end if;
+
+    if l_quote.credit_amount > 0 then
+        l_credit_note_id := issue_credit_note(l_quote.invoice_id, p_client_membership_id, l_quote.credit_amount, p_user_id);
+        if l_credit_note_id is null then
+            return 'ERROR - Invoice series of the membership invoice not found!';
+        end if;
+
+        perform settle_invoice_with_credit(l_quote.invoice_id, l_quote.balance_offset, l_credit_note_id, p_user_id);
+    end if;
+
+    -- Access ends the day before the cancellation takes effect; the row is kept for history.
+    -- A period that has not started by then gives no access at all
+    update client_memberships
+    set canceleted_on  = l_quote.effective_on,
+        ending_on      = case when l_quote.effective_on > starting_from
+                              then least(ending_on, l_quote.effective_on - 1)
+                              else ending_on end,
+        status         = case when l_quote.effective_on <= current_date
+                                or l_quote.effective_on <= starting_from then 'canceled'
+                              else status end,
+        auto_renew     = false,
+        dunning_status = null,
+        updated_on     = now(),
+        updated_by     = p_user_id
+    where id = p_client_membership_id;
+
+    insert into membership_cancellations(client_membership_id, client_id, reason, requested_on, effective_on,
+                                         used_days, total_days, cooling_off, invoice_id, credit_note_id, currency,
+                                         refundable_amount, fee_amount, credit_amount, refund_amount,
+                                         refund_method, created_by)
+    values (p_client_membership_id, l_cm.client_id, trim(p_reason), current_date, l_quote.effective_on,
+            l_quote.used_days, l_quote.total_days, l_quote.cooling_off, l_quote.invoice_id, l_credit_note_id,
+            l_quote.currency, l_quote.refundable_amount, l_quote.fee_amount, l_quote.credit_amount,
+            l_quote.refund_amount, l_refund_method, p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.cancel_client_membership(integer, date, varchar, varchar, integer) owner to gogymrest;
+
+create function public.change_client_membership_plan(p_client_membership_id integer, p_membership_id integer, p_gym_id integer, p_change_type character varying, p_reason character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_cm             record;
+    l_new            memberships%rowtype;
+    l_invoice        record;
+    l_effective_on   date;
+    l_credit         numeric(10, 2) := 0;
+    l_applied        numeric(10, 2) := 0;
+    l_refund         numeric(10, 2) := 0;
+    l_refund_method  varchar;
+    l_credit_note_id integer;
+    l_new_cm_id      integer;
+    l_new_invoice_id integer;
+    l_response       varchar;
+begin
+    if p_change_type is null or p_change_type not in ('upgrade', 'downgrade') then
+        return 'ERROR - Plan change must be an upgrade or a downgrade!';
+    end if;
+
+    select cm.*, coalesce(m.level, 0) as level, m.plan_type
+    into l_cm
+    from client_memberships cm
+             inner join memberships m on m.id = cm.membership_id
+    where cm.id = p_client_membership_id
+    for update of cm;
+
+    if not found then
+        return 'ERROR - Client membership not found!';
+    end if;
+
+    if l_cm.canceleted_on is not null then
+        return 'ERROR - Membership is cancelled!';
+    end if;
+
+    if l_cm.status <> 'active' or l_cm.ending_on < current_date then
+        return 'ERROR - Only active memberships can change plan!';
+    end if;
+
+    if l_cm.corporate_allocation_id is not null then
+        return 'ERROR - Company-paid memberships cannot change plan!';
+    end if;
+
+    if l_cm.plan_type = 'day' then
+        return 'ERROR - Day passes cannot change plan!';
+    end if;
+
+    -- A period the scheduler already renewed and invoiced would stay on the old
+    -- plan and holder, so it has to be cancelled on its own first
+    if exists (select 1 from client_memberships
+               where renewed_from_id = p_client_membership_id
+                 and canceleted_on is null
+                 and status = 'active') then
+        return 'ERROR - Membership was already renewed, cancel the renewal period first!';
+    end if;
+
+    select * into l_new
+    from memberships
+    where id = p_membership_id
+      and is_active = true;
+
+    if not found then
+        return 'ERROR - Membership not found or inactive!';
+    end if;
+
+    if l_new.plan_type = 'day' then
+        return 'ERROR - A membership cannot be changed into a day pass!';
+    end if;
+
+    if p_change_type = 'upgrade' and coalesce(l_new.level, 0) <= l_cm.level then
+        return 'ERROR - ' || l_new.name || ' is not a higher level than the current plan!';
+    end if;
+
+    if p_change_type = 'downgrade' and coalesce(l_new.level, 0) >= l_cm.level then
+        return 'ERROR - ' || l_new.name || ' is not a lower level than the current plan!';
+    end if;
+
+    -- The new plan starts today, or with the current one if it has not started yet
+    l_effective_on := greatest(current_date, l_cm.starting_from);
+
+    select i.id, il.total_amount as line_total
+    into l_invoice
+    from invoice_lines il
+             inner join invoices i on i.id = il.invoice_id
+    where il.client_membership_id = p_client_membership_id
+      and i.status <> 'cancelled'
+      and i.invoice_type = 'invoice'
+    order by i.id desc
+    limit 1;
+
+    l_credit := coalesce(round(l_invoice.line_total * client_membership_unused_share(p_client_membership_id, l_effective_on), 2), 0);
+
+    -- The current plan ends the day before the new one starts
+    update client_memberships
+    set status         = 'changed',
+        ending_on      = case when l_effective_on > starting_from then l_effective_on - 1 else ending_on end,
+        auto_renew     = false,
+        dunning_status = null,
+        updated_on     = now(),
+        updated_by     = p_user_id
+    where id = p_client_membership_id;
+
+    l_response := add_client_membership(l_cm.client_id, p_membership_id, l_effective_on, p_user_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    l_new_cm_id := currval(pg_get_serial_sequence('client_memberships', 'id'));
+
+    -- Automatic renewal carries over to the new plan
+    if l_cm.auto_renew then
+        update client_memberships
+        set auto_renew     = true,
+            renewal_gym_id = coalesce(p_gym_id, l_cm.renewal_gym_id)
+        where id = l_new_cm_id;
+    end if;
+
+    l_response := invoice_client_membership(l_new_cm_id, p_gym_id, p_user_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    select il.invoice_id into l_new_invoice_id
+    from invoice_lines il
+             inner join invoices i on i.id = il.invoice_id
+    where il.client_membership_id = l_new_cm_id
+      and i.status <> 'cancelled'
+    order by i.id desc
+    limit 1;
+
+    if l_credit > 0 then
+        l_credit_note_id := issue_credit_note(l_invoice.id, p_client_membership_id, l_credit, p_user_id);
+        if l_credit_note_id is null then
+            return 'ERROR - Invoice series of the membership invoice not found!';
+        end if;
+
+        -- The credit settles what is still owed on the old plan, then the new plan's invoice
+        l_applied := settle_invoice_with_credit(l_invoice.id, l_credit, l_credit_note_id, p_user_id);
+        if l_new_invoice_id is not null then
+            l_applied := l_applied + settle_invoice_with_credit(l_new_invoice_id, l_credit - l_applied,
+                                                                l_credit_note_id, p_user_id);
+        end if;
+
+        l_refund := l_credit - l_applied;
+        if l_refund > 0 then
+            l_refund_method := refund_method_of(l_invoice.id, null);
+        end if;
+    end if;
+
+    insert into client_membership_changes(change_type, client_membership_id, new_client_membership_id,
+                                          from_client_id, to_client_id, from_membership_id, to_membership_id,
+                                          effective_on, credit_amount, credit_note_id, invoice_id,
+                                          refund_amount, refund_method, reason, created_by)
+    values (p_change_type, p_client_membership_id, l_new_cm_id, l_cm.client_id, l_cm.client_id,
+            l_cm.membership_id, p_membership_id, l_effective_on, l_credit, l_credit_note_id, l_new_invoice_id,
+            l_refund, l_refund_method, nullif(trim(p_reason), ''), p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.change_client_membership_plan(integer, integer, integer, varchar, varchar, integer) owner to gogymrest;
+
+create function public.transfer_client_membership(p_client_membership_id integer, p_to_client_id integer, p_reason character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_cm           record;
+    l_balance      numeric(10, 2);
+    l_effective_on date;
+    l_contor       integer;
+    l_new_cm_id    integer;
+    l_gym          record;
+    l_response     varchar;
+begin
+    if p_to_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    if p_reason is null or trim(p_reason) = '' then
+        return 'ERROR - Transfer reason is required!';
+    end if;
+
+    select cm.*, m.plan_type
+    into l_cm
+    from client_memberships cm
+             inner join memberships m on m.id = cm.membership_id
+    where cm.id = p_client_membership_id
+    for update of cm;
+
+    if not found then
+        return 'ERROR - Client membership not found!';
+    end if;
+
+    if l_cm.client_id = p_to_client_id then
+        return 'ERROR - Membership already belongs to this client!';
+    end if;
+
+    if l_cm.canceleted_on is not null then
+        return 'ERROR - Membership is cancelled!';
+    end if;
+
+    if l_cm.status <> 'active' or l_cm.ending_on < current_date then
+        return 'ERROR - Only active memberships can be transferred!';
+    end if;
+
+    if l_cm.corporate_allocation_id is not null then
+        return 'ERROR - Company-paid memberships cannot be transferred!';
+    end if;
+
+    if l_cm.plan_type = 'day' then
+        return 'ERROR - Day passes cannot be transferred!';
+    end if;
+
+    -- A period the scheduler already renewed and invoiced would stay on the old
+    -- plan and holder, so it has to be cancelled on its own first
+    if exists (select 1 from client_memberships
+               where renewed_from_id = p_client_membership_id
+                 and canceleted_on is null
+                 and status = 'active') then
+        return 'ERROR - Membership was already renewed, cancel the renewal period first!';
+    end if;
+
+    if not exists (select 1 from clients where id = p_to_client_id) then
+        return 'ERROR - Client not found!';
+    end if;
+
+    select coalesce(sum(i.total_amount - i.paid_amount), 0) into l_balance
+    from invoice_lines il
+             inner join invoices i on i.id = il.invoice_id
+    where il.client_membership_id = p_client_membership_id
+      and i.status <> 'cancelled';
+
+    if l_balance > 0 then
+        return 'ERROR - Membership has an unpaid balance of ' || l_balance || ' and cannot be transferred!';
+    end if;
+
+    -- The new holder goes through the same age checks as a sale
+    l_response := check_client_age_rules(p_to_client_id, null);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    for l_gym in (select gym_id from membership_gyms where membership_id = l_cm.membership_id) loop
+            l_response := check_client_age_rules(p_to_client_id, l_gym.gym_id);
+            if l_response <> 'OK' then
+                return l_response;
+            end if;
+        end loop;
+
+    l_effective_on := greatest(current_date, l_cm.starting_from);
+
+    select count(*) into l_contor
+    from client_memberships
+    where client_id = p_to_client_id
+      and status = 'active'
+      and starting_from <= l_cm.ending_on
+      and ending_on >= l_effective_on;
+
+    if l_contor > 0 then
+        return 'ERROR - Client already has an active membership in this period!';
+    end if;
+
+    update client_memberships
+    set status         = 'transferred',
+        ending_on      = case when l_effective_on > starting_from then l_effective_on - 1 else ending_on end,
+        auto_renew     = false,
+        dunning_status = null,
+        updated_on     = now(),
+        updated_by     = p_user_id
+    where id = p_client_membership_id;
+
+    -- The rest of the period, with the entries and guest passes left, moves to the new holder
+    insert into client_memberships(client_id, membership_id, starting_from, ending_on, status,
+                                   created_by, updated_by, remaining_entries, remaining_guest_passes)
+    values (p_to_client_id, l_cm.membership_id, l_effective_on, l_cm.ending_on, 'active',
+            p_user_id, p_user_id, l_cm.remaining_entries, coalesce(l_cm.remaining_guest_passes, 0))
+    returning id into l_new_cm_id;
+
+    insert into client_membership_changes(change_type, client_membership_id, new_client_membership_id,
+                                          from_client_id, to_client_id, from_membership_id, to_membership_id,
+                                          effective_on, reason, created_by)
+    values ('transfer', p_client_membership_id, l_new_cm_id, l_cm.client_id, p_to_client_id,
+            l_cm.membership_id, l_cm.membership_id, l_effective_on, trim(p_reason), p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.transfer_client_membership(integer, integer, varchar, integer) owner to gogymrest;
+
+create function public.record_stock_movement(p_gym_id integer, p_product_id integer, p_movement_type character varying, p_quantity integer, p_note character varying, p_sale_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_product products%rowtype;
+    l_stock   product_stock%rowtype;
+begin
+    if p_gym_id is null then
+        return 'ERROR - GYM needs to be selected!';
+    end if;
+
+    if p_movement_type is null or p_movement_type not in ('receipt', 'sale', 'adjustment') then
+        return 'ERROR - Movement type must be receipt, sale or adjustment!';
+    end if;
+
+    if p_quantity is null or p_quantity = 0 then
+        return 'ERROR - Quantity cannot be zero!';
+    end if;
+
+    if p_movement_type = 'receipt' and p_quantity < 0 then
+        return 'ERROR - Received quantity must be positive!';
+    end if;
+
+    if p_movement_type = 'sale' and p_quantity > 0 then
+        return 'ERROR - Sold quantity must be negative!';
+    end if;
+
+    select * into l_product
+    from products
+    where id = p_product_id;
+
+    if not found then
+        return 'ERROR - Product not found!';
+    end if;
+
+    if l_product.product_type <> 'product' then
+        return 'ERROR - ' || l_product.name || ' is a service and has no stock!';
+    end if;
+
+    insert into product_stock(gym_id, product_id)
+    values (p_gym_id, p_product_id)
+    on conflict (gym_id, product_id) do nothing;
+
+    select * into l_stock
+    from product_stock
+    where gym_id = p_gym_id
+      and product_id = p_product_id
+    for update;
+
+    if l_stock.quantity + p_quantity < 0 then
+        return 'ERROR - Not enough ' || l_product.name || ' in stock (' || l_stock.quantity || ' left)!';
+    end if;
+
+    update product_stock
+    set quantity   = quantity + p_quantity,
+        updated_on = now()
+    where id = l_stock.id;
+
+    insert into stock_movements(gym_id, product_id, movement_type, quantity, quantity_after, sale_id, note, created_by)
+    values (p_gym_id, p_product_id, p_movement_type, p_quantity, l_stock.quantity + p_quantity, p_sale_id,
+            nullif(trim(p_note), ''), p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.record_stock_movement(integer, integer, varchar, integer, varchar, integer, integer) owner to gogymrest;
+
+create function public.create_sale(p_gym_id integer, p_client_id integer, p_payment_method character varying, p_currency character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+begin
+    if p_gym_id is null then
+        return 'ERROR - GYM needs to be selected!';
+    end if;
+
+    if not exists (select 1 from gyms where id = p_gym_id) then
+        return 'ERROR - GYM not found!';
+    end if;
+
+    if p_client_id is not null and not exists (select 1 from clients where id = p_client_id) then
+        return 'ERROR - Client not found!';
+    end if;
+
+    if p_payment_method is null or p_payment_method not in ('cash', 'card') then
+        return 'ERROR - Payment method must be cash or card!';
+    end if;
+
+    insert into sales(gym_id, client_id, currency, payment_method, created_by)
+    values (p_gym_id, p_client_id, coalesce(p_currency, 'RON'), p_payment_method, p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.create_sale(integer, integer, varchar, varchar, integer) owner to gogymrest;
+
+create function public.add_sale_line(p_sale_id integer, p_product_id integer, p_quantity integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_sale     sales%rowtype;
+    l_product  products%rowtype;
+    l_total    numeric(10, 2);
+    l_net      numeric(10, 2);
+    l_response varchar;
+begin
+    if p_quantity is null or p_quantity <= 0 then
+        return 'ERROR - Quantity must be positive!';
+    end if;
+
+    select * into l_sale
+    from sales
+    where id = p_sale_id
+    for update;
+
+    if not found then
+        return 'ERROR - Sale not found!';
+    end if;
+
+    select * into l_product
+    from products
+    where id = p_product_id;
+
+    if not found or not l_product.is_active then
+        return 'ERROR - Product not found or inactive!';
+    end if;
+
+    if l_product.currency <> l_sale.currency then
+        return 'ERROR - ' || l_product.name || ' is priced in ' || l_product.currency ||
+               ', the sale is in ' || l_sale.currency || '!';
+    end if;
+
+    -- Products leave the gym's stock; services are only sold
+    if l_product.product_type = 'product' then
+        l_response := record_stock_movement(l_sale.gym_id, p_product_id, 'sale', -p_quantity, null, p_sale_id, p_user_id);
+        if l_response <> 'OK' then
+            return l_response;
+        end if;
+    end if;
+
+    l_total := l_product.price * p_quantity;
+    l_net := round(l_total * 100 / (100 + l_product.vat_rate), 2);
+
+    insert into sale_lines(sale_id, product_id, description, quantity, unit_price,
+                           vat_rate, net_amount, vat_amount, total_amount)
+    values (p_sale_id, p_product_id, l_product.name, p_quantity, l_product.price,
+            l_product.vat_rate, l_net, l_total - l_net, l_total);
+
+    update sales
+    set net_amount   = net_amount + l_net,
+        vat_amount   = vat_amount + l_total - l_net,
+        total_amount = total_amount + l_total
+    where id = p_sale_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.add_sale_line(integer, integer, integer, integer) owner to gogymrest;
+
+create function public.assign_locker(p_locker_id integer, p_client_id integer, p_assignment_type character varying, p_valid_until date, p_note character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_locker    lockers%rowtype;
+    l_pass_id   integer;
+    l_last_pass varchar;
+    l_contor    integer;
+begin
+    if p_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    if p_assignment_type is null or p_assignment_type not in ('daily', 'rental') then
+        return 'ERROR - Assignment type must be daily or rental!';
+    end if;
+
+    select * into l_locker
+    from lockers
+    where id = p_locker_id
+    for update;
+
+    if not found then
+        return 'ERROR - Locker not found!';
+    end if;
+
+    if not l_locker.is_active then
+        return 'ERROR - Locker ' || l_locker.code || ' is out of service!';
+    end if;
+
+    if exists (select 1 from locker_assignments where locker_id = p_locker_id and released_on is null) then
+        return 'ERROR - Locker ' || l_locker.code || ' is already assigned!';
+    end if;
+
+    if not exists (select 1 from clients where id = p_client_id) then
+        return 'ERROR - Client not found!';
+    end if;
+
+    if p_assignment_type = 'daily' then
+        -- A daily locker goes with the client's visit: they must be checked in at the gym now
+        select id, action into l_pass_id, l_last_pass
+        from client_passes
+        where client_id = p_client_id
+          and gym_id = l_locker.gym_id
+          and created_on = current_date
+        order by id desc
+        limit 1;
+
+        if l_pass_id is null or l_last_pass <> 'in' then
+            return 'ERROR - Client is not checked in at this gym!';
+        end if;
+
+        select count(*) into l_contor
+        from locker_assignments
+        where client_id = p_client_id
+          and gym_id = l_locker.gym_id
+          and assignment_type = 'daily'
+          and released_on is null;
+
+        if l_contor > 0 then
+            return 'ERROR - Client already has a daily locker at this gym!';
+        end if;
+    else
+        if p_valid_until is null or p_valid_until < current_date then
+            return 'ERROR - Rental end date must be today or later!';
+        end if;
+    end if;
+
+    insert into locker_assignments(locker_id, gym_id, client_id, assignment_type, client_pass_id,
+                                   valid_until, note, created_by)
+    values (p_locker_id, l_locker.gym_id, p_client_id, p_assignment_type, l_pass_id,
+            case when p_assignment_type = 'daily' then current_date else p_valid_until end,
+            nullif(trim(p_note), ''), p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.assign_locker(integer, integer, varchar, date, varchar, integer) owner to gogymrest;
+
+create function public.release_locker(p_locker_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_contor integer;
+begin
+    update locker_assignments
+    set released_on    = now(),
+        release_reason = 'manual',
+        released_by    = p_user_id
+    where locker_id = p_locker_id
+      and released_on is null;
+
+    get diagnostics l_contor = row_count;
+    if l_contor = 0 then
+        return 'ERROR - Locker is not assigned!';
+    end if;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.release_locker(integer, integer) owner to gogymrest;
+
+create function public.generate_class_sessions(p_days integer, p_schedule_id integer) returns integer
+    language plpgsql
+as
+$$
+declare
+    l_count integer;
+begin
+    -- Sessions are materialized a few days ahead so they can be booked and changed one by one
+    insert into class_sessions(schedule_id, gym_id, class_type_id, instructor_id, starts_at, ends_at,
+                               room, capacity, waitlist_capacity)
+    select s.id, s.gym_id, s.class_type_id, s.instructor_id, d.day + s.start_time,
+           d.day + s.start_time + make_interval(mins => coalesce(s.duration_minutes, ct.duration_minutes, 60)),
+           s.room, s.capacity, coalesce(s.waitlist_capacity, 0)
+    from class_schedules s
+             inner join class_types ct on ct.id = s.class_type_id
+             cross join lateral (select generate_series(greatest(current_date, s.valid_from),
+                                                        least(current_date + p_days, coalesce(s.valid_to, current_date + p_days)),
+                                                        interval '1 day')::date as day) d
+    where s.is_active
+      and ct.is_active
+      and (p_schedule_id is null or s.id = p_schedule_id)
+      and extract(isodow from d.day) = s.weekday
+    on conflict (schedule_id, starts_at) do nothing;
+
+    get diagnostics l_count = row_count;
+
+    return l_count;
+end;
+$$;
+
+alter function public.generate_class_sessions(integer, integer) owner to gogymrest;
+
+create function public.class_eligible_membership(p_client_id integer, p_session_id integer) returns integer
+    language sql
+    stable
+as
+$$
+    -- An active membership for the class's gym, valid on the day and at the hour of the class,
+    -- with entries left and a level high enough for the class type
+    select cm.id
+    from class_sessions cs
+             inner join class_types ct on ct.id = cs.class_type_id
+             inner join client_memberships cm on cm.client_id = p_client_id
+             inner join membership_gyms mg on mg.membership_id = cm.membership_id and mg.gym_id = cs.gym_id
+             inner join memberships m on m.id = cm.membership_id
+    where cs.id = p_session_id
+      and cs.starts_at::date between cm.starting_from and cm.ending_on
+      and cm.status = 'active'
+      and coalesce(cm.dunning_status, '') <> 'suspended'
+      and m.is_active = true
+      and coalesce(m.level, 0) >= coalesce(ct.min_level, 0)
+      and (cm.remaining_entries is null or cm.remaining_entries > 0)
+      and membership_window_open(cm.membership_id, cs.starts_at)
+    order by cm.remaining_entries is not null, cm.ending_on, cm.id
+    limit 1;
+$$;
+
+alter function public.class_eligible_membership(integer, integer) owner to gogymrest;
+
+create function public.book_class(p_session_id integer, p_client_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_session              record;
+    l_client_membership_id integer;
+    l_booked               integer;
+    l_waitlisted           integer;
+    l_response             varchar;
+begin
+    if p_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    -- The session row is locked so concurrent bookings cannot overfill the class
+    select cs.*, ct.name as class_name, ct.min_level
+    into l_session
+    from class_sessions cs
+             inner join class_types ct on ct.id = cs.class_type_id
+    where cs.id = p_session_id
+    for update of cs;
+
+    if not found then
+        return 'ERROR - Class not found!';
+    end if;
+
+    if l_session.status <> 'scheduled' then
+        return 'ERROR - Class is cancelled!';
+    end if;
+
+    if l_session.starts_at <= gym_local_time(l_session.gym_id) then
+        return 'ERROR - Class has already started!';
+    end if;
+
+    l_response := client_booking_ban(p_client_id, l_session.gym_id);
+    if l_response is not null then
+        return l_response;
+    end if;
+
+    if exists (select 1 from class_bookings
+               where session_id = p_session_id
+                 and client_id = p_client_id
+                 and status <> 'cancelled') then
+        return 'ERROR - Client is already booked for this class!';
+    end if;
+
+    l_response := check_client_age_rules(p_client_id, l_session.gym_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    l_client_membership_id := class_eligible_membership(p_client_id, p_session_id);
+    if l_client_membership_id is null then
+        if coalesce(l_session.min_level, 0) > 0 then
+            return 'ERROR - ' || l_session.class_name || ' needs an active membership of level '
+                       || l_session.min_level || ' or higher for this gym at the time of the class!';
+        end if;
+        return 'ERROR - Client has no active membership for this gym at the time of the class!';
+    end if;
+
+    select count(*) filter (where status in ('booked', 'attended')),
+           count(*) filter (where status = 'waitlisted')
+    into l_booked, l_waitlisted
+    from class_bookings
+    where session_id = p_session_id;
+
+    if l_booked < l_session.capacity then
+        insert into class_bookings(session_id, client_id, client_membership_id, status, created_by)
+        values (p_session_id, p_client_id, l_client_membership_id, 'booked', p_user_id);
+    elsif l_waitlisted < coalesce(l_session.waitlist_capacity, 0) then
+        insert into class_bookings(session_id, client_id, client_membership_id, status, created_by)
+        values (p_session_id, p_client_id, l_client_membership_id, 'waitlisted', p_user_id);
+    else
+        return 'ERROR - Class and waitlist are full!';
+    end if;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.book_class(integer, integer, integer) owner to gogymrest;
+
+create function public.promote_class_waitlist(p_session_id integer) returns setof integer
+    language plpgsql
+as
+$$
+declare
+    l_session record;
+    l_free    integer;
+    l_booking record;
+begin
+    select * into l_session
+    from class_sessions
+    where id = p_session_id
+    for update;
+
+    if not found or l_session.status <> 'scheduled'
+        or l_session.starts_at <= gym_local_time(l_session.gym_id) then
+        return;
+    end if;
+
+    select l_session.capacity - count(*) into l_free
+    from class_bookings
+    where session_id = p_session_id
+      and status in ('booked', 'attended');
+
+    -- First come, first served
+    for l_booking in (select id
+                      from class_bookings
+                      where session_id = p_session_id
+                        and status = 'waitlisted'
+                      order by booked_on, id
+                      limit greatest(l_free, 0)) loop
+            update class_bookings
+            set status      = 'booked',
+                promoted_on = now()
+            where id = l_booking.id;
+
+            return next l_booking.id;
+        end loop;
+end;
+$$;
+
+alter function public.promote_class_waitlist(integer) owner to gogymrest;
+
+create function public.cancel_class_booking(p_booking_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_booking record;
+begin
+    select cb.*, cs.starts_at, cs.gym_id
+    into l_booking
+    from class_bookings cb
+             inner join class_sessions cs on cs.id = cb.session_id
+    where cb.id = p_booking_id
+    for update of cb;
+
+    if not found then
+        return 'ERROR - Booking not found!';
+    end if;
+
+    if l_booking.status = 'cancelled' then
+        return 'ERROR - Booking is already cancelled!';
+    end if;
+
+    if l_booking.status = 'attended' then
+        return 'ERROR - Client already attended the class!';
+    end if;
+
+    if l_booking.starts_at <= gym_local_time(l_booking.gym_id) then
+        return 'ERROR - Class has already started!';
+    end if;
+
+    update class_bookings
+    set status       = 'cancelled',
+        cancelled_on = now()
+    where id = p_booking_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.cancel_class_booking(integer, integer) owner to gogymrest;
+
+create function public.check_in_class(p_booking_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_booking   record;
+    l_local_now timestamp;
+    l_pass_id   integer;
+    l_last_pass varchar;
+    l_response  varchar;
+begin
+    select cb.*, cs.gym_id, cs.starts_at, cs.ends_at, cs.status as session_status
+    into l_booking
+    from class_bookings cb
+             inner join class_sessions cs on cs.id = cb.session_id
+    where cb.id = p_booking_id
+    for update of cb;
+
+    if not found then
+        return 'ERROR - Booking not found!';
+    end if;
+
+    if l_booking.session_status <> 'scheduled' then
+        return 'ERROR - Class is cancelled!';
+    end if;
+
+    if l_booking.status = 'attended' then
+        return 'ERROR - Client already checked in for this class!';
+    end if;
+
+    if l_booking.status = 'waitlisted' then
+        return 'ERROR - Client is still on the waitlist!';
+    end if;
+
+    if l_booking.status <> 'booked' then
+        return 'ERROR - Booking is cancelled!';
+    end if;
+
+    -- Check-in opens 30 minutes before the class and closes when it ends
+    l_local_now := gym_local_time(l_booking.gym_id);
+    if l_local_now < l_booking.starts_at - interval '30 minutes' or l_local_now > l_booking.ends_at then
+        return 'ERROR - Class check-in is open from 30 minutes before the class until it ends!';
+    end if;
+
+    -- A client already in the gym is not checked in twice
+    select id, action into l_pass_id, l_last_pass
+    from client_passes
+    where client_id = l_booking.client_id
+      and gym_id = l_booking.gym_id
+      and created_on = current_date
+    order by id desc
+    limit 1;
+
+    if l_pass_id is null or l_last_pass <> 'in' then
+        l_response := do_client_check_in_gym(l_booking.client_id, l_booking.gym_id, p_user_id);
+        if l_response <> 'OK' then
+            return l_response;
+        end if;
+
+        l_pass_id := currval(pg_get_serial_sequence('client_passes', 'id'));
+    end if;
+
+    update client_passes
+    set class_session_id = l_booking.session_id
+    where id = l_pass_id
+      and class_session_id is null;
+
+    update class_bookings
+    set status         = 'attended',
+        checked_in_on  = now(),
+        client_pass_id = l_pass_id
+    where id = p_booking_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.check_in_class(integer, integer) owner to gogymrest;
+
+create function public.cancel_class_session(p_session_id integer, p_reason character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_session class_sessions%rowtype;
+begin
+    select * into l_session
+    from class_sessions
+    where id = p_session_id
+    for update;
+
+    if not found then
+        return 'ERROR - Class not found!';
+    end if;
+
+    if l_session.status = 'cancelled' then
+        return 'ERROR - Class is already cancelled!';
+    end if;
+
+    if l_session.ends_at <= gym_local_time(l_session.gym_id) then
+        return 'ERROR - Class has already taken place!';
+    end if;
+
+    update class_sessions
+    set status        = 'cancelled',
+        cancel_reason = nullif(trim(p_reason), ''),
+        sequence      = coalesce(sequence, 0) + 1
+    where id = p_session_id;
+
+    update class_bookings
+    set status       = 'cancelled',
+        cancelled_on = now()
+    where session_id = p_session_id
+      and status in ('booked', 'waitlisted');
+
+    return 'OK';
+end;
+$$;
+
+alter function public.cancel_class_session(integer, varchar, integer) owner to gogymrest;
+
+create function public.trainer_is_available(p_trainer_id integer, p_gym_id integer, p_starts_at timestamp,
+                                            p_ends_at timestamp) returns boolean
+    language sql
+    stable
+as
+$$
+    -- Inside one of the trainer's weekly slots at the gym and not during time off
+    select p_starts_at::date = (p_ends_at - interval '1 second')::date
+       and exists (select 1
+                   from trainer_availability a
+                   where a.trainer_id = p_trainer_id
+                     and a.gym_id = p_gym_id
+                     and a.weekday = extract(isodow from p_starts_at)
+                     and p_starts_at::date >= a.valid_from
+                     and (a.valid_to is null or p_starts_at::date <= a.valid_to)
+                     and a.start_time <= p_starts_at::time
+                     and p_ends_at <= p_starts_at::date + a.end_time)
+       and not exists (select 1
+                       from trainer_time_off t
+                       where t.trainer_id = p_trainer_id
+                         and t.starts_at < p_ends_at
+                         and t.ends_at > p_starts_at);
+$$;
+
+alter function public.trainer_is_available(integer, integer, timestamp, timestamp) owner to gogymrest;
+
+create function public.trainer_appointment_conflict(p_trainer_id integer, p_client_id integer, p_starts_at timestamp,
+                                                    p_ends_at timestamp, p_appointment_id integer) returns character varying
+    language plpgsql
+    stable
+as
+$$
+declare
+    l_starts_at  timestamp;
+    l_class_name varchar;
+begin
+    -- Returns null when the trainer and the client are both free, the error otherwise
+    select starts_at into l_starts_at
+    from trainer_appointments
+    where trainer_id = p_trainer_id
+      and status in ('booked', 'completed')
+      and id <> coalesce(p_appointment_id, 0)
+      and starts_at < p_ends_at
+      and ends_at > p_starts_at
+    limit 1;
+
+    if found then
+        return 'ERROR - Trainer already has an appointment at ' || to_char(l_starts_at, 'HH24:MI') || '!';
+    end if;
+
+    select ct.name into l_class_name
+    from class_sessions cs
+             inner join class_types ct on ct.id = cs.class_type_id
+    where cs.instructor_id = p_trainer_id
+      and cs.status = 'scheduled'
+      and cs.starts_at < p_ends_at
+      and cs.ends_at > p_starts_at
+    limit 1;
+
+    if found then
+        return 'ERROR - Trainer is teaching ' || l_class_name || ' at that time!';
+    end if;
+
+    if p_client_id is null then
+        return null;
+    end if;
+
+    if exists (select 1
+               from trainer_appointments
+               where client_id = p_client_id
+                 and status in ('booked', 'completed')
+                 and id <> coalesce(p_appointment_id, 0)
+                 and starts_at < p_ends_at
+                 and ends_at > p_starts_at) then
+        return 'ERROR - Client already has an appointment at that time!';
+    end if;
+
+    select ct.name into l_class_name
+    from class_bookings cb
+             inner join class_sessions cs on cs.id = cb.session_id
+             inner join class_types ct on ct.id = cs.class_type_id
+    where cb.client_id = p_client_id
+      and cb.status in ('booked', 'waitlisted', 'attended')
+      and cs.status = 'scheduled'
+      and cs.starts_at < p_ends_at
+      and cs.ends_at > p_starts_at
+    limit 1;
+
+    if found then
+        return 'ERROR - Client is booked for ' || l_class_name || ' at that time!';
+    end if;
+
+    return null;
+end;
+$$;
+
+alter function public.trainer_appointment_conflict(integer, integer, timestamp, timestamp, integer) owner to gogymrest;
+
+create function public.book_trainer_appointment(p_trainer_id integer, p_gym_id integer, p_client_id integer,
+                                                p_starts_at timestamp, p_client_package_id integer,
+                                                p_source character varying, p_notes character varying,
+                                                p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_package  client_trainer_packages%rowtype;
+    l_ends_at  timestamp;
+    l_response varchar;
+begin
+    if p_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    if not exists (select 1 from user_gyms where user_id = p_trainer_id and gym_id = p_gym_id) then
+        return 'ERROR - Trainer does not work at this gym!';
+    end if;
+
+    if p_starts_at <= gym_local_time(p_gym_id) then
+        return 'ERROR - Appointment must be in the future!';
+    end if;
+
+    -- Bookings of a trainer are serialized so two of them cannot take the same slot
+    perform 1 from users where id = p_trainer_id for update;
+
+    l_response := check_client_age_rules(p_client_id, p_gym_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    l_response := client_booking_ban(p_client_id, p_gym_id);
+    if l_response is not null then
+        return l_response;
+    end if;
+
+    -- Without a package given, the one expiring first is used
+    select * into l_package
+    from client_trainer_packages
+    where client_id = p_client_id
+      and (p_client_package_id is null or id = p_client_package_id)
+      and sessions_remaining > 0
+      and p_starts_at::date <= valid_until
+      and (trainer_id is null or trainer_id = p_trainer_id)
+    order by valid_until, id
+    limit 1
+    for update;
+
+    if not found then
+        if p_client_package_id is not null then
+            return 'ERROR - Session package has no sessions left for this trainer on that date!';
+        end if;
+        return 'ERROR - Client has no session package with sessions left for this trainer on that date!';
+    end if;
+
+    l_ends_at := p_starts_at + make_interval(mins => l_package.session_minutes);
+
+    if not trainer_is_available(p_trainer_id, p_gym_id, p_starts_at, l_ends_at) then
+        return 'ERROR - Trainer is not available at that time!';
+    end if;
+
+    l_response := trainer_appointment_conflict(p_trainer_id, p_client_id, p_starts_at, l_ends_at, null);
+    if l_response is not null then
+        return l_response;
+    end if;
+
+    insert into trainer_appointments(trainer_id, gym_id, client_id, client_trainer_package_id, starts_at, ends_at,
+                                     source, notes, created_by)
+    values (p_trainer_id, p_gym_id, p_client_id, l_package.id, p_starts_at, l_ends_at,
+            coalesce(p_source, 'staff'), nullif(trim(p_notes), ''), p_user_id);
+
+    update client_trainer_packages
+    set sessions_remaining = sessions_remaining - 1
+    where id = l_package.id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.book_trainer_appointment(integer, integer, integer, timestamp, integer, varchar, varchar, integer) owner to gogymrest;
+
+create function public.reschedule_trainer_appointment(p_appointment_id integer, p_starts_at timestamp,
+                                                      p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_appointment trainer_appointments%rowtype;
+    l_ends_at     timestamp;
+    l_response    varchar;
+begin
+    select * into l_appointment
+    from trainer_appointments
+    where id = p_appointment_id;
+
+    if not found then
+        return 'ERROR - Appointment not found!';
+    end if;
+
+    perform 1 from users where id = l_appointment.trainer_id for update;
+
+    select * into l_appointment
+    from trainer_appointments
+    where id = p_appointment_id
+    for update;
+
+    if l_appointment.status <> 'booked' then
+        return 'ERROR - Only booked appointments can be rescheduled!';
+    end if;
+
+    if l_appointment.starts_at <= gym_local_time(l_appointment.gym_id)
+        or p_starts_at <= gym_local_time(l_appointment.gym_id) then
+        return 'ERROR - Only future appointments can be moved, to a future time!';
+    end if;
+
+    l_ends_at := p_starts_at + (l_appointment.ends_at - l_appointment.starts_at);
+
+    if not trainer_is_available(l_appointment.trainer_id, l_appointment.gym_id, p_starts_at, l_ends_at) then
+        return 'ERROR - Trainer is not available at that time!';
+    end if;
+
+    l_response := trainer_appointment_conflict(l_appointment.trainer_id, l_appointment.client_id, p_starts_at,
+                                               l_ends_at, p_appointment_id);
+    if l_response is not null then
+        return l_response;
+    end if;
+
+    update trainer_appointments
+    set starts_at = p_starts_at,
+        ends_at   = l_ends_at,
+        sequence  = coalesce(sequence, 0) + 1
+    where id = p_appointment_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.reschedule_trainer_appointment(integer, timestamp, integer) owner to gogymrest;
+
+create function public.cancel_trainer_appointment(p_appointment_id integer, p_reason character varying,
+                                                  p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_appointment trainer_appointments%rowtype;
+begin
+    select * into l_appointment
+    from trainer_appointments
+    where id = p_appointment_id
+    for update;
+
+    if not found then
+        return 'ERROR - Appointment not found!';
+    end if;
+
+    if l_appointment.status <> 'booked' then
+        return 'ERROR - Only booked appointments can be cancelled!';
+    end if;
+
+    if l_appointment.starts_at <= gym_local_time(l_appointment.gym_id) then
+        return 'ERROR - Appointment has already started!';
+    end if;
+
+    update trainer_appointments
+    set status        = 'cancelled',
+        cancel_reason = nullif(trim(p_reason), ''),
+        cancelled_on  = now(),
+        sequence      = coalesce(sequence, 0) + 1
+    where id = p_appointment_id;
+
+    -- The session goes back to the package
+    update client_trainer_packages
+    set sessions_remaining = sessions_remaining + 1
+    where id = l_appointment.client_trainer_package_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.cancel_trainer_appointment(integer, varchar, integer) owner to gogymrest;
+
+create function public.complete_trainer_appointment(p_appointment_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_appointment trainer_appointments%rowtype;
+begin
+    select * into l_appointment
+    from trainer_appointments
+    where id = p_appointment_id
+    for update;
+
+    if not found then
+        return 'ERROR - Appointment not found!';
+    end if;
+
+    if l_appointment.status <> 'booked' then
+        return 'ERROR - Only booked appointments can be completed!';
+    end if;
+
+    if l_appointment.starts_at > gym_local_time(l_appointment.gym_id) then
+        return 'ERROR - Appointment has not started yet!';
+    end if;
+
+    update trainer_appointments
+    set status       = 'completed',
+        completed_on = now()
+    where id = p_appointment_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.complete_trainer_appointment(integer, integer) owner to gogymrest;
+
+create function public.trainer_free_slots(p_trainer_id integer, p_gym_id integer, p_day date, p_minutes integer,
+                                          p_step_minutes integer) returns setof timestamp
+    language sql
+    stable
+as
+$$
+    -- Start times on the day at which an appointment of p_minutes fits the trainer's calendar
+    select distinct s.starts_at
+    from trainer_availability a
+             cross join lateral generate_series(p_day + a.start_time,
+                                                p_day + a.end_time - make_interval(mins => p_minutes),
+                                                make_interval(mins => p_step_minutes)) as s(starts_at)
+    where a.trainer_id = p_trainer_id
+      and a.gym_id = p_gym_id
+      and a.weekday = extract(isodow from p_day)
+      and p_day >= a.valid_from
+      and (a.valid_to is null or p_day <= a.valid_to)
+      and s.starts_at > gym_local_time(p_gym_id)
+      and trainer_is_available(p_trainer_id, p_gym_id, s.starts_at, s.starts_at + make_interval(mins => p_minutes))
+      and trainer_appointment_conflict(p_trainer_id, null, s.starts_at, s.starts_at + make_interval(mins => p_minutes),
+                                       null) is null
+    order by s.starts_at;
+$$;
+
+alter function public.trainer_free_slots(integer, integer, date, integer, integer) owner to gogymrest;
+
+create function public.client_booking_ban(p_client_id integer, p_gym_id integer) returns character varying
+    language plpgsql
+    stable
+as
+$$
+declare
+    l_ends_on date;
+begin
+    -- Returns null when the client may book at the gym, the error otherwise
+    select max(ends_on) into l_ends_on
+    from client_booking_bans
+    where client_id = p_client_id
+      and gym_id = p_gym_id
+      and lifted_on is null
+      and gym_local_time(p_gym_id)::date between starts_on and ends_on;
+
+    if l_ends_on is not null then
+        return 'ERROR - Client cannot book until ' || to_char(l_ends_on, 'YYYY-MM-DD') || ' after repeated no-shows!';
+    end if;
+
+    return null;
+end;
+$$;
+
+alter function public.client_booking_ban(integer, integer) owner to gogymrest;
+
+create function public.invoice_no_show_fee(p_no_show_id integer, p_user_id integer) returns integer
+    language plpgsql
+as
+$$
+declare
+    l_no_show    record;
+    l_series     invoice_series%rowtype;
+    l_invoice_id integer;
+    l_net        numeric(10, 2);
+    l_vat        numeric(10, 2);
+begin
+    select ns.*, coalesce(g.no_show_fee_vat_rate, 0) as vat_rate,
+           coalesce(ct.name, 'Personal training') as what
+    into l_no_show
+    from client_no_shows ns
+             inner join gyms g on g.id = ns.gym_id
+             left join class_bookings cb on cb.id = ns.class_booking_id
+             left join class_sessions cs on cs.id = cb.session_id
+             left join class_types ct on ct.id = cs.class_type_id
+    where ns.id = p_no_show_id;
+
+    if not found or l_no_show.fee_amount <= 0 or l_no_show.invoice_id is not null then
+        return null;
+    end if;
+
+    select * into l_series
+    from invoice_series
+    where gym_id = l_no_show.gym_id or gym_id is null
+    order by gym_id is null
+    limit 1
+    for update;
+
+    -- Without an invoice series the fee stays recorded on the no-show, to be collected at the front desk
+    if not found then
+        return null;
+    end if;
+
+    -- Fees are VAT inclusive
+    l_net := round(l_no_show.fee_amount * 100 / (100 + l_no_show.vat_rate), 2);
+    l_vat := l_no_show.fee_amount - l_net;
+
+    insert into invoices(series_code, number, client_id, gym_id, issue_date, due_date,
+                         net_amount, vat_amount, total_amount, paid_amount, status, created_by)
+    values (l_series.code, l_series.next_no, l_no_show.client_id, l_no_show.gym_id, current_date, current_date,
+            l_net, l_vat, l_no_show.fee_amount, 0, 'unpaid', p_user_id)
+    returning id into l_invoice_id;
+
+    insert into invoice_lines(invoice_id, description, quantity, unit_price,
+                              vat_rate, net_amount, vat_amount, total_amount)
+    values (l_invoice_id,
+            'No-show fee: ' || l_no_show.what || ' ' || to_char(l_no_show.occurred_on, 'YYYY-MM-DD HH24:MI'),
+            1, l_net, l_no_show.vat_rate, l_net, l_vat, l_no_show.fee_amount);
+
+    update invoice_series
+    set next_no = next_no + 1
+    where id = l_series.id;
+
+    update client_no_shows
+    set invoice_id = l_invoice_id
+    where id = p_no_show_id;
+
+    return l_invoice_id;
+end;
+$$;
+
+alter function public.invoice_no_show_fee(integer, integer) owner to gogymrest;
+
+create function public.record_client_no_show(p_client_id integer, p_gym_id integer, p_class_booking_id integer,
+                                             p_trainer_appointment_id integer, p_occurred_on timestamp) returns integer
+    language plpgsql
+as
+$$
+declare
+    l_gym        gyms%rowtype;
+    l_no_show_id integer;
+    l_since      timestamp;
+    l_strikes    integer;
+begin
+    select * into l_gym
+    from gyms
+    where id = p_gym_id;
+
+    insert into client_no_shows (client_id, gym_id, class_booking_id, trainer_appointment_id, occurred_on, fee_amount)
+    values (p_client_id, p_gym_id, p_class_booking_id, p_trainer_appointment_id, p_occurred_on,
+            coalesce(l_gym.no_show_fee, 0))
+    returning id into l_no_show_id;
+
+    perform invoice_no_show_fee(l_no_show_id, null);
+
+    if coalesce(l_gym.no_show_strikes, 0) <= 0 or coalesce(l_gym.no_show_ban_days, 0) <= 0 then
+        return l_no_show_id;
+    end if;
+
+    -- Strikes count from the start of the window, or from the no-show that triggered
+    -- the last ban when it is more recent; a waived no-show takes its ban with it
+    select greatest(p_occurred_on - make_interval(days => coalesce(l_gym.no_show_window_days, 30)),
+                    max(ns.occurred_on))
+    into l_since
+    from client_booking_bans b
+             inner join client_no_shows ns on ns.id = b.no_show_id
+    where b.client_id = p_client_id
+      and b.gym_id = p_gym_id
+      and ns.id <> l_no_show_id
+      and ns.waived_on is null;
+
+    select count(*) into l_strikes
+    from client_no_shows
+    where client_id = p_client_id
+      and gym_id = p_gym_id
+      and waived_on is null
+      and occurred_on > l_since
+      and occurred_on <= p_occurred_on;
+
+    if l_strikes >= l_gym.no_show_strikes and client_booking_ban(p_client_id, p_gym_id) is null then
+        insert into client_booking_bans (client_id, gym_id, no_show_id, starts_on, ends_on, reason)
+        values (p_client_id, p_gym_id, l_no_show_id, gym_local_time(p_gym_id)::date,
+                gym_local_time(p_gym_id)::date + l_gym.no_show_ban_days - 1,
+                l_strikes || ' no-shows in ' || coalesce(l_gym.no_show_window_days, 30) || ' days');
+    end if;
+
+    return l_no_show_id;
+end;
+$$;
+
+alter function public.record_client_no_show(integer, integer, integer, integer, timestamp) owner to gogymrest;
+
+create function public.detect_no_shows(p_lookback_days integer) returns setof integer
+    language plpgsql
+as
+$$
+declare
+    l_booking     record;
+    l_appointment record;
+    l_pass_id     integer;
+begin
+    -- Class bookings of sessions that ended without a class check-in
+    for l_booking in (select cb.id, cb.client_id, cs.gym_id, cs.starts_at
+                      from class_bookings cb
+                               inner join class_sessions cs on cs.id = cb.session_id
+                      where cb.status = 'booked'
+                        and cs.status = 'scheduled'
+                        and cs.ends_at < gym_local_time(cs.gym_id)
+                        and cs.ends_at >= gym_local_time(cs.gym_id) - make_interval(days => p_lookback_days)
+                      order by cs.starts_at, cb.id
+                      for update of cb) loop
+            -- A client who came to the gym that day only skipped the class check-in
+            select id into l_pass_id
+            from client_passes
+            where client_id = l_booking.client_id
+              and gym_id = l_booking.gym_id
+              and created_on = l_booking.starts_at::date
+              and action = 'in'
+            order by id
+            limit 1;
+
+            if l_pass_id is not null then
+                update class_bookings
+                set status         = 'attended',
+                    client_pass_id = l_pass_id
+                where id = l_booking.id;
+            else
+                update class_bookings
+                set status = 'no_show'
+                where id = l_booking.id;
+
+                return next record_client_no_show(l_booking.client_id, l_booking.gym_id, l_booking.id, null,
+                                                  l_booking.starts_at);
+            end if;
+        end loop;
+
+    -- Appointments that ended with no visit of the client to the gym that day; the
+    -- session stays used. Those the client came to are left for the trainer to complete.
+    for l_appointment in (select ta.id, ta.client_id, ta.gym_id, ta.starts_at
+                          from trainer_appointments ta
+                          where ta.status = 'booked'
+                            and ta.ends_at < gym_local_time(ta.gym_id)
+                            and ta.ends_at >= gym_local_time(ta.gym_id) - make_interval(days => p_lookback_days)
+                            and not exists (select 1 from client_passes cp
+                                            where cp.client_id = ta.client_id
+                                              and cp.gym_id = ta.gym_id
+                                              and cp.created_on = ta.starts_at::date
+                                              and cp.action = 'in')
+                          order by ta.starts_at, ta.id
+                          for update of ta) loop
+            update trainer_appointments
+            set status = 'no_show'
+            where id = l_appointment.id;
+
+            return next record_client_no_show(l_appointment.client_id, l_appointment.gym_id, null,
+                                              l_appointment.id, l_appointment.starts_at);
+        end loop;
+end;
+$$;
+
+alter function public.detect_no_shows(integer) owner to gogymrest;
+
+create function public.waive_client_no_show(p_no_show_id integer, p_reason character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_no_show     client_no_shows%rowtype;
+    l_invoice     invoices%rowtype;
+    l_credit_note integer;
+begin
+    select * into l_no_show
+    from client_no_shows
+    where id = p_no_show_id
+    for update;
+
+    if not found then
+        return 'ERROR - No-show not found!';
+    end if;
+
+    if l_no_show.waived_on is not null then
+        return 'ERROR - No-show is already waived!';
+    end if;
+
+    if nullif(trim(p_reason), '') is null then
+        return 'ERROR - Reason is required!';
+    end if;
+
+    if l_no_show.invoice_id is not null then
+        select * into l_invoice
+        from invoices
+        where id = l_no_show.invoice_id
+        for update;
+
+        if l_invoice.paid_amount > 0 then
+            return 'ERROR - The no-show fee is already paid!';
+        end if;
+
+        -- The issued fee invoice is reversed with a credit note settling it
+        if l_invoice.status <> 'cancelled' then
+            l_credit_note := issue_credit_note(l_invoice.id, null, l_invoice.total_amount, p_user_id);
+            if l_credit_note is null then
+                return 'ERROR - Invoice series of the no-show fee invoice not found!';
+            end if;
+
+            perform settle_invoice_with_credit(l_invoice.id, l_invoice.total_amount, l_credit_note, p_user_id);
+        end if;
+    end if;
+
+    update client_no_shows
+    set waived_on      = now(),
+        waived_by      = p_user_id,
+        waive_reason   = trim(p_reason),
+        credit_note_id = l_credit_note
+    where id = p_no_show_id;
+
+    -- The ban this no-show triggered goes with it
+    update client_booking_bans
+    set lifted_on = now(),
+        lifted_by = p_user_id
+    where no_show_id = p_no_show_id
+      and lifted_on is null;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.waive_client_no_show(integer, varchar, integer) owner to gogymrest;
+
+create function public.lift_client_booking_ban(p_ban_id integer, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_ban client_booking_bans%rowtype;
+begin
+    select * into l_ban
+    from client_booking_bans
+    where id = p_ban_id
+    for update;
+
+    if not found then
+        return 'ERROR - Booking ban not found!';
+    end if;
+
+    if l_ban.lifted_on is not null then
+        return 'ERROR - Booking ban is already lifted!';
+    end if;
+
+    if l_ban.ends_on < gym_local_time(l_ban.gym_id)::date then
+        return 'ERROR - Booking ban has already ended!';
+    end if;
+
+    update client_booking_bans
+    set lifted_on = now(),
+        lifted_by = p_user_id
+    where id = p_ban_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.lift_client_booking_ban(integer, integer) owner to gogymrest;
+
+create function public.resource_day_slots(p_resource_id integer, p_day date)
+    returns table (starts_at timestamp, ends_at timestamp, price numeric, is_booked boolean)
+    language sql
+    stable
+as
+$$
+    -- The slots of a day, on the grid starting at each opening of the resource
+    select s.starts_at,
+           s.starts_at + make_interval(mins => r.slot_minutes),
+           coalesce(h.slot_price, 0),
+           exists (select 1 from resource_bookings b
+                   where b.resource_id = r.id
+                     and b.status = 'booked'
+                     and b.starts_at < s.starts_at + make_interval(mins => r.slot_minutes)
+                     and b.ends_at > s.starts_at)
+    from resources r
+             inner join resource_hours h on h.resource_id = r.id
+             cross join lateral generate_series(p_day + h.open_time,
+                                                p_day + h.close_time - make_interval(mins => r.slot_minutes),
+                                                make_interval(mins => r.slot_minutes)) as s(starts_at)
+    where r.id = p_resource_id
+      and h.weekday = extract(isodow from p_day)
+    order by s.starts_at;
+$$;
+
+alter function public.resource_day_slots(integer, date) owner to gogymrest;
+
+create function public.invoice_resource_booking(p_booking_id integer, p_user_id integer) returns integer
+    language plpgsql
+as
+$$
+declare
+    l_booking    record;
+    l_series     invoice_series%rowtype;
+    l_invoice_id integer;
+    l_net        numeric(10, 2);
+    l_vat        numeric(10, 2);
+begin
+    select b.*, r.name as resource_name, coalesce(r.vat_rate, 0) as vat_rate
+    into l_booking
+    from resource_bookings b
+             inner join resources r on r.id = b.resource_id
+    where b.id = p_booking_id;
+
+    if not found or l_booking.price <= 0 or l_booking.invoice_id is not null then
+        return null;
+    end if;
+
+    select * into l_series
+    from invoice_series
+    where gym_id = l_booking.gym_id or gym_id is null
+    order by gym_id is null
+    limit 1
+    for update;
+
+    -- Without an invoice series the booking is paid at the front desk
+    if not found then
+        return null;
+    end if;
+
+    -- Prices are VAT inclusive
+    l_net := round(l_booking.price * 100 / (100 + l_booking.vat_rate), 2);
+    l_vat := l_booking.price - l_net;
+
+    insert into invoices(series_code, number, client_id, gym_id, issue_date, due_date, currency,
+                         net_amount, vat_amount, total_amount, paid_amount, status, created_by)
+    values (l_series.code, l_series.next_no, l_booking.client_id, l_booking.gym_id, current_date,
+            least(greatest(current_date, l_booking.starts_at::date), current_date + 30), l_booking.currency,
+            l_net, l_vat, l_booking.price, 0, 'unpaid', p_user_id)
+    returning id into l_invoice_id;
+
+    insert into invoice_lines(invoice_id, description, quantity, unit_price,
+                              vat_rate, net_amount, vat_amount, total_amount)
+    values (l_invoice_id,
+            left(l_booking.resource_name || ' ' || to_char(l_booking.starts_at, 'YYYY-MM-DD HH24:MI') || ' - ' ||
+                 to_char(l_booking.ends_at, 'HH24:MI'), 256),
+            1, l_net, l_booking.vat_rate, l_net, l_vat, l_booking.price);
+
+    update invoice_series
+    set next_no = next_no + 1
+    where id = l_series.id;
+
+    update resource_bookings
+    set invoice_id = l_invoice_id
+    where id = p_booking_id;
+
+    return l_invoice_id;
+end;
+$$;
+
+alter function public.invoice_resource_booking(integer, integer) owner to gogymrest;
+
+create function public.book_resource(p_resource_id integer, p_client_id integer, p_starts_at timestamp,
+                                     p_slots integer, p_notes character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_resource   resources%rowtype;
+    l_local_now  timestamp;
+    l_ends_at    timestamp;
+    l_slot_start timestamp;
+    l_slot_price numeric(10, 2);
+    l_price      numeric(10, 2) := 0;
+    l_taken      record;
+    l_booking_id integer;
+    l_response   varchar;
+begin
+    if p_client_id is null then
+        return 'ERROR - Client needs to be selected!';
+    end if;
+
+    -- The resource row is locked so concurrent bookings of it are serialized
+    select * into l_resource
+    from resources
+    where id = p_resource_id
+    for update;
+
+    if not found then
+        return 'ERROR - Resource not found!';
+    end if;
+
+    if not l_resource.is_active then
+        return 'ERROR - Resource is out of service!';
+    end if;
+
+    if p_slots is null or p_slots < 1 or p_slots > l_resource.max_slots then
+        return 'ERROR - A booking takes between 1 and ' || l_resource.max_slots || ' slots!';
+    end if;
+
+    l_local_now := gym_local_time(l_resource.gym_id);
+    if p_starts_at <= l_local_now then
+        return 'ERROR - Booking must be in the future!';
+    end if;
+
+    if p_starts_at::date > l_local_now::date + l_resource.advance_days then
+        return 'ERROR - Bookings open ' || l_resource.advance_days || ' days ahead!';
+    end if;
+
+    l_response := client_booking_ban(p_client_id, l_resource.gym_id);
+    if l_response is not null then
+        return l_response;
+    end if;
+
+    l_response := check_client_age_rules(p_client_id, l_resource.gym_id);
+    if l_response <> 'OK' then
+        return l_response;
+    end if;
+
+    -- Every slot must be on the grid of an opening; the price is the sum of the slots
+    for i in 0 .. p_slots - 1 loop
+            l_slot_start := p_starts_at + make_interval(mins => i * l_resource.slot_minutes);
+
+            select price into l_slot_price
+            from resource_day_slots(p_resource_id, l_slot_start::date)
+            where starts_at = l_slot_start;
+
+            if not found then
+                return 'ERROR - No slot starts at ' || to_char(l_slot_start, 'YYYY-MM-DD HH24:MI') ||
+                       ', the resource is closed or the time is off the slot grid!';
+            end if;
+
+            l_price := l_price + l_slot_price;
+        end loop;
+
+    l_ends_at := p_starts_at + make_interval(mins => p_slots * l_resource.slot_minutes);
+
+    select starts_at, ends_at into l_taken
+    from resource_bookings
+    where resource_id = p_resource_id
+      and status = 'booked'
+      and starts_at < l_ends_at
+      and ends_at > p_starts_at
+    order by starts_at
+    limit 1;
+
+    if found then
+        return 'ERROR - Resource is already booked from ' || to_char(l_taken.starts_at, 'HH24:MI') ||
+               ' to ' || to_char(l_taken.ends_at, 'HH24:MI') || '!';
+    end if;
+
+    insert into resource_bookings (resource_id, gym_id, client_id, starts_at, ends_at, slots, price, currency,
+                                   notes, created_by)
+    values (p_resource_id, l_resource.gym_id, p_client_id, p_starts_at, l_ends_at, p_slots, l_price,
+            l_resource.currency, nullif(trim(p_notes), ''), p_user_id)
+    returning id into l_booking_id;
+
+    perform invoice_resource_booking(l_booking_id, p_user_id);
+
+    return 'OK';
+end;
+$$;
+
+alter function public.book_resource(integer, integer, timestamp, integer, varchar, integer) owner to gogymrest;
+
+create function public.cancel_resource_booking(p_booking_id integer, p_reason character varying, p_user_id integer) returns character varying
+    language plpgsql
+as
+$$
+declare
+    l_booking     record;
+    l_invoice     invoices%rowtype;
+    l_late        boolean;
+    l_credit_note integer;
+begin
+    select b.*, r.cancel_hours
+    into l_booking
+    from resource_bookings b
+             inner join resources r on r.id = b.resource_id
+    where b.id = p_booking_id
+    for update of b;
+
+    if not found then
+        return 'ERROR - Booking not found!';
+    end if;
+
+    if l_booking.status <> 'booked' then
+        return 'ERROR - Booking is already cancelled!';
+    end if;
+
+    if l_booking.starts_at <= gym_local_time(l_booking.gym_id) then
+        return 'ERROR - Booking has already started!';
+    end if;
+
+    -- Inside the cancellation window the slot is freed but the booking is still charged
+    l_late := gym_local_time(l_booking.gym_id) > l_booking.starts_at - make_interval(hours => coalesce(l_booking.cancel_hours, 0));
+
+    if not l_late and l_booking.invoice_id is not null then
+        select * into l_invoice
+        from invoices
+        where id = l_booking.invoice_id
+        for update;
+
+        -- The invoice is reversed with a credit note: the credit settles what is still owed
+        -- and only what was paid is given back
+        if l_invoice.status <> 'cancelled' then
+            l_credit_note := issue_credit_note(l_invoice.id, null, l_invoice.total_amount, p_user_id);
+            if l_credit_note is null then
+                return 'ERROR - Invoice series of the booking invoice not found!';
+            end if;
+
+            perform settle_invoice_with_credit(l_invoice.id, l_invoice.total_amount - l_invoice.paid_amount,
+                                               l_credit_note, p_user_id);
+        end if;
+    end if;
+
+    update resource_bookings
+    set status            = 'cancelled',
+        cancel_reason     = nullif(trim(p_reason), ''),
+        cancelled_on      = now(),
+        late_cancellation = l_late,
+        credit_note_id    = l_credit_note
+    where id = p_booking_id;
+
+    return 'OK';
+end;
+$$;
+
+alter function public.cancel_resource_booking(integer, varchar, integer) owner to gogymrest;
@@ -0,0 +1,580 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// TrainerAppointment is a 1:1 personal training session
+type TrainerAppointment struct {
+	ID                     int    `json:"id"`
+	TrainerID              int    `json:"trainer_id"`
+	TrainerName            string `json:"trainer_name"`
+	GymID                  int    `json:"gym_id"`
+	GymName                string `json:"gym_name"`
+	ClientID               int    `json:"client_id"`
+	ClientName             string `json:"client_name"`
+	ClientTrainerPackageID *int   `json:"client_trainer_package_id"`
+	StartsAt               string `json:"starts_at"` // gym local time
+	EndsAt                 string `json:"ends_at"`
+	Status                 string `json:"status"` // booked, completed, no_show or cancelled
+	Source                 string `json:"source"` // staff or client
+	Notes                  string `json:"notes,omitempty"`
+	CancelReason           string `json:"cancel_reason,omitempty"`
+	CreatedOn              string `json:"created_on"`
+}
+
+type BookTrainerAppointmentRequest struct {
+	TrainerID       int    `json:"trainer_id"`
+	ClientID        int    `json:"client_id"`
+	StartsAt        string `json:"starts_at"`                   // YYYY-MM-DD HH:MM, gym local time
+	ClientPackageID int    `json:"client_package_id,omitempty"` // defaults to the package expiring first
+	Source          string `json:"source,omitempty"`            // staff (default) or client
+	Notes           string `json:"notes,omitempty"`
+}
+
+type RescheduleTrainerAppointmentRequest struct {
+	StartsAt string `json:"starts_at"`
+}
+
+type CancelTrainerAppointmentRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// TrainerAppointmentNotice is the data of the trainer appointment notifications
+type TrainerAppointmentNotice struct {
+	ClientName  string
+	TrainerName string
+	GymName     string
+	StartsAt    string
+	Reason      string
+	Rescheduled bool
+}
+
+const trainerAppointmentQuery = `SELECT ta.id, ta.trainer_id, COALESCE(u.full_name, ''), ta.gym_id, COALESCE(g.name, ''),
+                                        ta.client_id, COALESCE(c.name, ''), ta.client_trainer_package_id,
+                                        TO_CHAR(ta.starts_at, 'YYYY-MM-DD HH24:MI'), TO_CHAR(ta.ends_at, 'YYYY-MM-DD HH24:MI'),
+                                        ta.status, COALESCE(ta.source, 'staff'), COALESCE(ta.notes, ''),
+                                        COALESCE(ta.cancel_reason, ''), TO_CHAR(ta.created_on, 'YYYY-MM-DD HH24:MI:SS')
+                                 FROM trainer_appointments ta
+                                 LEFT JOIN users u ON u.id = ta.trainer_id
+                                 LEFT JOIN gyms g ON g.id = ta.gym_id
+                                 LEFT JOIN clients c ON c.id = ta.client_id`
+
+func scanTrainerAppointment(scanner interface{ Scan(...interface{}) error }, a *TrainerAppointment) error {
+	return scanner.Scan(&a.ID, &a.TrainerID, &a.TrainerName, &a.GymID, &a.GymName, &a.ClientID, &a.ClientName,
+		&a.ClientTrainerPackageID, &a.StartsAt, &a.EndsAt, &a.Status, &a.Source, &a.Notes, &a.CancelReason,
+		&a.CreatedOn)
+}
+
+// Book a personal training session; one session is taken from the client's package
+func (app *App) bookGymAppointment(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req BookTrainerAppointmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Source == "" {
+		req.Source = "staff"
+	}
+	var fieldErrs ValidationErrors
+	if req.TrainerID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "trainer_id", Message: "Valid trainer_id is required"})
+	}
+	if req.ClientID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "client_id", Message: "Valid client_id is required"})
+	}
+	if _, err := time.Parse(appointmentTimeLayout, req.StartsAt); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "starts_at", Message: "time must be in YYYY-MM-DD HH:MM format"})
+	}
+	if req.Source != "staff" && req.Source != "client" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "source", Message: "source must be staff or client"})
+	}
+	if len(req.Notes) > 512 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "notes", Message: "notes cannot exceed 512 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the gym and the client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)
+	                      AND EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, req.ClientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym or client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// currval needs the same connection as the insert
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT book_trainer_appointment($1, $2, $3, $4, $5, $6, $7, $8)", req.TrainerID, gymID,
+		req.ClientID, req.StartsAt, nullIfZero(req.ClientPackageID), req.Source, nullIfEmpty(req.Notes),
+		claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	var appointmentID int
+	err = tx.QueryRow("SELECT currval(pg_get_serial_sequence('trainer_appointments', 'id'))").Scan(&appointmentID)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	app.notifyTrainerAppointment(appointmentID, "trainer_appointment_booked", "", false)
+
+	app.sendTrainerAppointment(w, "Appointment booked successfully", appointmentID)
+}
+
+// List the appointments at a gym, by default the next 7 days
+func (app *App) getGymAppointments(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseAppointmentPeriod(w, r)
+	if !ok {
+		return
+	}
+	trainerID := 0
+	if trainerIDStr := r.URL.Query().Get("trainer_id"); trainerIDStr != "" {
+		trainerID, err = strconv.Atoi(trainerIDStr)
+		if err != nil || trainerID <= 0 {
+			sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	status := r.URL.Query().Get("status")
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	app.sendTrainerAppointments(w, `WHERE ta.gym_id = $1 AND ta.starts_at::date BETWEEN $2 AND $3
+	                                  AND ($4 = 0 OR ta.trainer_id = $4) AND ($5 = '' OR ta.status = $5)
+	                                ORDER BY ta.starts_at, u.full_name`,
+		gymID, from, to, trainerID, status)
+}
+
+// List a trainer's appointments at every gym, by default the next 7 days
+func (app *App) getTrainerAppointments(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseAppointmentPeriod(w, r)
+	if !ok {
+		return
+	}
+	status := r.URL.Query().Get("status")
+
+	// Check if user works with this trainer
+	var exists bool
+	err = app.DB.QueryRow(trainerAccessQuery, claims.UserID, trainerID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Trainer not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	app.sendTrainerAppointments(w, `WHERE ta.trainer_id = $1 AND ta.starts_at::date BETWEEN $2 AND $3
+	                                  AND ($4 = '' OR ta.status = $4)
+	                                ORDER BY ta.starts_at`,
+		trainerID, from, to, status)
+}
+
+// List the appointments of a client, latest first
+func (app *App) getClientAppointments(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	upcomingOnly := r.URL.Query().Get("upcoming_only") == "true"
+
+	app.sendTrainerAppointments(w, `WHERE ta.client_id = $1
+	                                  AND ($2 = false OR (ta.status = 'booked' AND ta.starts_at > gym_local_time(ta.gym_id)))
+	                                ORDER BY ta.starts_at DESC
+	                                LIMIT 100`,
+		clientID, upcomingOnly)
+}
+
+// Get an appointment
+func (app *App) getGymAppointmentByID(w http.ResponseWriter, r *http.Request) {
+	_, appointmentID, ok := app.authorizeGymAppointment(w, r)
+	if !ok {
+		return
+	}
+
+	app.sendTrainerAppointment(w, "Appointment retrieved successfully", appointmentID)
+}
+
+// Move a booked appointment to another time, with the same trainer and length
+func (app *App) rescheduleGymAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, appointmentID, ok := app.authorizeGymAppointment(w, r)
+	if !ok {
+		return
+	}
+
+	var req RescheduleTrainerAppointmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse(appointmentTimeLayout, req.StartsAt); err != nil {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "starts_at", Message: "time must be in YYYY-MM-DD HH:MM format"}})
+		return
+	}
+
+	var result string
+	err := app.DB.QueryRow("SELECT reschedule_trainer_appointment($1, $2, $3)", appointmentID, req.StartsAt,
+		claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.notifyTrainerAppointment(appointmentID, "trainer_appointment_booked", "", true)
+
+	app.sendTrainerAppointment(w, "Appointment rescheduled successfully", appointmentID)
+}
+
+// Cancel a booked appointment; the session goes back to the client's package
+func (app *App) cancelGymAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, appointmentID, ok := app.authorizeGymAppointment(w, r)
+	if !ok {
+		return
+	}
+
+	var req CancelTrainerAppointmentRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > 256 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "reason", Message: "reason cannot exceed 256 characters"}})
+		return
+	}
+
+	var result string
+	err := app.DB.QueryRow("SELECT cancel_trainer_appointment($1, $2, $3)", appointmentID, nullIfEmpty(req.Reason),
+		claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.notifyTrainerAppointment(appointmentID, "trainer_appointment_cancelled", req.Reason, false)
+
+	app.sendTrainerAppointment(w, "Appointment cancelled successfully", appointmentID)
+}
+
+// Mark an appointment that took place as completed
+func (app *App) completeGymAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, appointmentID, ok := app.authorizeGymAppointment(w, r)
+	if !ok {
+		return
+	}
+
+	var result string
+	err := app.DB.QueryRow("SELECT complete_trainer_appointment($1, $2)", appointmentID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.sendTrainerAppointment(w, "Appointment completed successfully", appointmentID)
+}
+
+// authorizeGymAppointment authenticates the user and checks that the appointment
+// is at the gym and the user works there; on failure the response is already sent
+func (app *App) authorizeGymAppointment(w http.ResponseWriter, r *http.Request) (*Claims, int, bool) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return nil, 0, false
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return nil, 0, false
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	appointmentID, err := strconv.Atoi(vars["appointment_id"])
+	if err != nil || appointmentID <= 0 {
+		sendErrorResponse(w, "Invalid appointment_id parameter", http.StatusBadRequest)
+		return nil, 0, false
+	}
+
+	// Check if user has permission for the appointment's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN trainer_appointments ta ON ta.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND ta.id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, appointmentID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Appointment not found or access denied", http.StatusForbidden)
+		return nil, 0, false
+	}
+
+	return claims, appointmentID, true
+}
+
+// parseAppointmentPeriod reads from/to, today and the next 6 days by default
+func parseAppointmentPeriod(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	var err error
+	from := time.Now()
+	to := from.AddDate(0, 0, 6)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return "", "", false
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return "", "", false
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return "", "", false
+	}
+	return from.Format("2006-01-02"), to.Format("2006-01-02"), true
+}
+
+// sendTrainerAppointments runs trainerAppointmentQuery with the given filter and sends the list
+func (app *App) sendTrainerAppointments(w http.ResponseWriter, filter string, args ...interface{}) {
+	rows, err := app.DB.Query(trainerAppointmentQuery+" "+filter, args...)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch appointments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var appointments []TrainerAppointment
+	for rows.Next() {
+		var appointment TrainerAppointment
+		if err := scanTrainerAppointment(rows, &appointment); err != nil {
+			sendErrorResponse(w, "Failed to scan appointment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		appointments = append(appointments, appointment)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no appointments found, return empty array instead of null
+	if appointments == nil {
+		appointments = []TrainerAppointment{}
+	}
+
+	sendSuccessResponse(w, "Appointments retrieved successfully", appointments)
+}
+
+// sendTrainerAppointment reads an appointment back after a change and sends it
+func (app *App) sendTrainerAppointment(w http.ResponseWriter, message string, appointmentID int) {
+	var appointment TrainerAppointment
+	err := scanTrainerAppointment(app.DB.QueryRow(trainerAppointmentQuery+" WHERE ta.id = $1", appointmentID), &appointment)
+	if err != nil {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     appointmentID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, appointment)
+}
+
+// notifyTrainerAppointment tells the client about a booked, moved or cancelled
+// appointment, with the appointment attached as an .ics file to emails; failures
+// are only logged
+func (app *App) notifyTrainerAppointment(appointmentID int, templateName, reason string, rescheduled bool) {
+	notice := TrainerAppointmentNotice{Reason: reason, Rescheduled: rescheduled}
+	var clientID int
+	err := app.DB.QueryRow(`SELECT ta.client_id, COALESCE(c.name, ''), COALESCE(u.full_name, ''), COALESCE(g.name, ''),
+	                               TO_CHAR(ta.starts_at, 'YYYY-MM-DD HH24:MI')
+	                        FROM trainer_appointments ta
+	                        LEFT JOIN clients c ON c.id = ta.client_id
+	                        LEFT JOIN users u ON u.id = ta.trainer_id
+	                        LEFT JOIN gyms g ON g.id = ta.gym_id
+	                        WHERE ta.id = $1`, appointmentID).Scan(&clientID, &notice.ClientName, &notice.TrainerName,
+		&notice.GymName, &notice.StartsAt)
+	if err != nil {
+		log.Printf("appointments: failed to load appointment %d for notification: %v", appointmentID, err)
+		return
+	}
+
+	err = app.Notifier.NotifyClientWithAttachment(clientID, templateName, notice, app.trainerAppointmentICS(appointmentID))
+	if err != nil && err != errNoContactChannel {
+		log.Printf("appointments: failed to queue %s for client %d: %v", templateName, clientID, err)
+	}
+}
@@ -0,0 +1,694 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	paymentMethodCash     = "cash"
+	paymentMethodCard     = "card"
+	paymentMethodTransfer = "transfer"
+)
+
+const (
+	invoiceTypeInvoice    = "invoice"
+	invoiceTypeCreditNote = "credit_note" // reverses part of an invoice, with negative amounts
+)
+
+// MembershipPrice is a gross (VAT inclusive) price of a membership, for one gym or,
+// when GymID is nil, the default for every gym
+type MembershipPrice struct {
+	ID           int     `json:"id"`
+	MembershipID int     `json:"membership_id"`
+	GymID        *int    `json:"gym_id"`
+	Price        float64 `json:"price"`
+	VATRate      float64 `json:"vat_rate"`
+	Currency     string  `json:"currency"`
+	ValidFrom    string  `json:"valid_from"`
+	ValidTo      string  `json:"valid_to"`
+}
+
+type CreateMembershipPriceRequest struct {
+	GymID     int      `json:"gym_id,omitempty"`
+	Price     float64  `json:"price"`
+	VATRate   *float64 `json:"vat_rate,omitempty"` // defaults to 21
+	Currency  string   `json:"currency,omitempty"` // defaults to RON
+	ValidFrom string   `json:"valid_from,omitempty"`
+	ValidTo   string   `json:"valid_to,omitempty"`
+}
+
+type Invoice struct {
+	ID          int           `json:"id"`
+	InvoiceNo   string        `json:"invoice_no"`
+	SeriesCode  string        `json:"series_code"`
+	Number      int           `json:"number"`
+	ClientID    int           `json:"client_id"`
+	ClientName  string        `json:"client_name"`
+	GymID       *int          `json:"gym_id"`
+	IssueDate   string        `json:"issue_date"`
+	DueDate     string        `json:"due_date"`
+	Currency    string        `json:"currency"`
+	NetAmount   float64       `json:"net_amount"`
+	VATAmount   float64       `json:"vat_amount"`
+	TotalAmount float64       `json:"total_amount"`
+	PaidAmount  float64       `json:"paid_amount"`
+	Balance     float64       `json:"balance"`
+	Status      string        `json:"status"`
+	InvoiceType string        `json:"invoice_type"`
+	Lines       []InvoiceLine `json:"lines,omitempty"`
+	Payments    []Payment     `json:"payments,omitempty"`
+
+	// Set on credit notes
+	CreditedInvoiceID *int   `json:"credited_invoice_id,omitempty"`
+	CreditedInvoiceNo string `json:"credited_invoice_no,omitempty"`
+}
+
+type InvoiceLine struct {
+	ID                 int     `json:"id"`
+	ClientMembershipID *int    `json:"client_membership_id"`
+	Description        string  `json:"description"`
+	Quantity           float64 `json:"quantity"`
+	UnitPrice          float64 `json:"unit_price"`
+	VATRate            float64 `json:"vat_rate"`
+	NetAmount          float64 `json:"net_amount"`
+	VATAmount          float64 `json:"vat_amount"`
+	TotalAmount        float64 `json:"total_amount"`
+}
+
+type Payment struct {
+	ID        int     `json:"id"`
+	InvoiceID int     `json:"invoice_id"`
+	Amount    float64 `json:"amount"`
+	Method    string  `json:"method"` // cash, card, transfer, or credit when settled by a credit note
+	PaidOn    string  `json:"paid_on"`
+	Reference string  `json:"reference"`
+	CreatedBy int     `json:"created_by"`
+}
+
+type RegisterPaymentRequest struct {
+	Amount    float64 `json:"amount"`
+	Method    string  `json:"method"`            // cash, card or transfer
+	PaidOn    string  `json:"paid_on,omitempty"` // defaults to today
+	Reference string  `json:"reference,omitempty"`
+}
+
+type InvoiceMembershipRequest struct {
+	ClientMembershipID int `json:"client_membership_id"`
+	GymID              int `json:"gym_id,omitempty"`
+}
+
+// invoiceQuery selects invoices of clients the user ($1) has access to
+const invoiceQuery = `SELECT i.id, i.series_code || '-' || LPAD(i.number::text, 6, '0'), i.series_code, i.number,
+                             i.client_id, c.name, i.gym_id,
+                             TO_CHAR(i.issue_date, 'YYYY-MM-DD'), COALESCE(TO_CHAR(i.due_date, 'YYYY-MM-DD'), ''),
+                             i.currency, i.net_amount, i.vat_amount, i.total_amount, i.paid_amount,
+                             i.total_amount - i.paid_amount, i.status, COALESCE(i.invoice_type, 'invoice'),
+                             i.credited_invoice_id, COALESCE(ci.series_code || '-' || LPAD(ci.number::text, 6, '0'), '')
+                      FROM invoices i
+                      INNER JOIN clients c ON c.id = i.client_id
+                      INNER JOIN user_clients uc ON uc.client_id = i.client_id
+                      LEFT JOIN invoices ci ON ci.id = i.credited_invoice_id
+                      WHERE uc.user_id = $1`
+
+func scanInvoice(scanner interface{ Scan(...interface{}) error }, invoice *Invoice) error {
+	return scanner.Scan(&invoice.ID, &invoice.InvoiceNo, &invoice.SeriesCode, &invoice.Number,
+		&invoice.ClientID, &invoice.ClientName, &invoice.GymID, &invoice.IssueDate, &invoice.DueDate,
+		&invoice.Currency, &invoice.NetAmount, &invoice.VATAmount, &invoice.TotalAmount, &invoice.PaidAmount,
+		&invoice.Balance, &invoice.Status, &invoice.InvoiceType, &invoice.CreditedInvoiceID, &invoice.CreditedInvoiceNo)
+}
+
+// List the price history of a membership
+func (app *App) getMembershipPrices(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	membershipID, err := strconv.Atoi(vars["membership_id"])
+	if err != nil || membershipID <= 0 {
+		sendErrorResponse(w, "Invalid membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	query := `SELECT id, membership_id, gym_id, price, COALESCE(vat_rate, 0), COALESCE(currency, 'RON'),
+	                 TO_CHAR(valid_from, 'YYYY-MM-DD'), COALESCE(TO_CHAR(valid_to, 'YYYY-MM-DD'), '')
+	          FROM membership_prices
+	          WHERE membership_id = $1
+	          ORDER BY gym_id NULLS FIRST, valid_from DESC`
+
+	rows, err := app.DB.Query(query, membershipID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch membership prices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var prices []MembershipPrice
+	for rows.Next() {
+		var price MembershipPrice
+		err := rows.Scan(&price.ID, &price.MembershipID, &price.GymID, &price.Price, &price.VATRate,
+			&price.Currency, &price.ValidFrom, &price.ValidTo)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan membership price: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		prices = append(prices, price)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no prices found, return empty array instead of null
+	if prices == nil {
+		prices = []MembershipPrice{}
+	}
+
+	sendSuccessResponse(w, "Membership prices retrieved successfully", prices)
+}
+
+// Add a price to a membership; the open-ended price it supersedes ends the day before
+func (app *App) createMembershipPrice(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	membershipID, err := strconv.Atoi(vars["membership_id"])
+	if err != nil || membershipID <= 0 {
+		sendErrorResponse(w, "Invalid membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateMembershipPriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateMembershipPrice(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Gym prices need access to that gym; default prices need access to a gym offering the membership
+	var exists bool
+	if req.GymID > 0 {
+		permissionQuery := `SELECT EXISTS(SELECT 1 FROM membership_gyms mg
+		                                  INNER JOIN user_gyms ug ON ug.gym_id = mg.gym_id
+		                                  WHERE mg.membership_id = $1 AND ug.user_id = $2 AND mg.gym_id = $3)`
+		err = app.DB.QueryRow(permissionQuery, membershipID, claims.UserID, req.GymID).Scan(&exists)
+	} else {
+		permissionQuery := `SELECT EXISTS(SELECT 1 FROM membership_gyms mg
+		                                  INNER JOIN user_gyms ug ON ug.gym_id = mg.gym_id
+		                                  WHERE mg.membership_id = $1 AND ug.user_id = $2)`
+		err = app.DB.QueryRow(permissionQuery, membershipID, claims.UserID).Scan(&exists)
+	}
+	if err != nil || !exists {
+		sendErrorResponse(w, "Membership not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(`UPDATE membership_prices SET valid_to = $3::date - 1
+	                  WHERE membership_id = $1 AND gym_id IS NOT DISTINCT FROM $2
+	                    AND valid_to IS NULL AND valid_from < $3::date`,
+		membershipID, nullIfZero(req.GymID), req.ValidFrom)
+	if err != nil {
+		sendErrorResponse(w, "Failed to close previous price: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var price MembershipPrice
+	err = tx.QueryRow(`INSERT INTO membership_prices (membership_id, gym_id, price, vat_rate, currency,
+	                                                  valid_from, valid_to, created_by)
+	                   VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	                   RETURNING id, membership_id, gym_id, price, vat_rate, currency,
+	                             TO_CHAR(valid_from, 'YYYY-MM-DD'), COALESCE(TO_CHAR(valid_to, 'YYYY-MM-DD'), '')`,
+		membershipID, nullIfZero(req.GymID), req.Price, *req.VATRate, req.Currency, req.ValidFrom,
+		nullIfEmpty(req.ValidTo), claims.UserID).Scan(&price.ID, &price.MembershipID, &price.GymID, &price.Price,
+		&price.VATRate, &price.Currency, &price.ValidFrom, &price.ValidTo)
+	if err != nil {
+		sendErrorResponse(w, "Failed to create membership price: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Membership price created successfully", price)
+}
+
+// validateMembershipPrice checks the request and fills in the defaults
+func validateMembershipPrice(req *CreateMembershipPriceRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	if req.Price <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "price", Message: "price must be positive"})
+	}
+	if req.VATRate == nil {
+		defaultRate := 21.0
+		req.VATRate = &defaultRate
+	} else if *req.VATRate < 0 || *req.VATRate >= 100 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "vat_rate", Message: "VAT rate must be between 0 and 100"})
+	}
+	if req.Currency == "" {
+		req.Currency = "RON"
+	} else if len(req.Currency) != 3 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "currency", Message: "currency must be a 3-letter ISO code"})
+	}
+
+	if req.ValidFrom == "" {
+		req.ValidFrom = time.Now().Format("2006-01-02")
+	}
+	validFrom, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "valid_from", Message: "date must be in YYYY-MM-DD format"})
+	}
+	if req.ValidTo != "" {
+		validTo, err := time.Parse("2006-01-02", req.ValidTo)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "date must be in YYYY-MM-DD format"})
+		} else if validTo.Before(validFrom) {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "valid_to cannot be before valid_from"})
+		}
+	}
+
+	return fieldErrs
+}
+
+// List invoices, optionally filtered by client_id, status and type (invoice or credit_note)
+func (app *App) getInvoices(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	clientID := 0
+	if clientIDStr := r.URL.Query().Get("client_id"); clientIDStr != "" {
+		clientID, err = strconv.Atoi(clientIDStr)
+		if err != nil || clientID <= 0 {
+			sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	status := r.URL.Query().Get("status")
+	invoiceType := r.URL.Query().Get("type")
+	if invoiceType != "" && invoiceType != invoiceTypeInvoice && invoiceType != invoiceTypeCreditNote {
+		sendErrorResponse(w, "Invalid type parameter (invoice or credit_note)", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := app.DB.Query(invoiceQuery+` AND ($2 = 0 OR i.client_id = $2)
+	                                         AND ($3 = '' OR i.status = $3)
+	                                         AND ($4 = '' OR COALESCE(i.invoice_type, 'invoice') = $4)
+	                                         ORDER BY i.issue_date DESC, i.id DESC`,
+		claims.UserID, clientID, status, invoiceType)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var invoices []Invoice
+	for rows.Next() {
+		var invoice Invoice
+		if err := scanInvoice(rows, &invoice); err != nil {
+			sendErrorResponse(w, "Failed to scan invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no invoices found, return empty array instead of null
+	if invoices == nil {
+		invoices = []Invoice{}
+	}
+
+	sendSuccessResponse(w, "Invoices retrieved successfully", invoices)
+}
+
+// Invoice with its lines and payments
+func (app *App) getInvoiceByID(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	invoiceID, err := strconv.Atoi(vars["invoice_id"])
+	if err != nil || invoiceID <= 0 {
+		sendErrorResponse(w, "Invalid invoice_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	invoice, err := app.loadInvoice(invoiceID, claims.UserID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Invoice not found or access denied", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Invoice retrieved successfully", invoice)
+}
+
+// Invoice an existing membership (e.g. one sold before it had a price)
+func (app *App) invoiceMembership(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req InvoiceMembershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ClientMembershipID <= 0 {
+		sendErrorResponse(w, "Valid client_membership_id is required", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the membership's client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM client_memberships cm
+	                                  INNER JOIN user_clients uc ON uc.client_id = cm.client_id
+	                                  WHERE cm.id = $1 AND uc.user_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, req.ClientMembershipID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT invoice_client_membership($1, $2, $3)", req.ClientMembershipID,
+		nullIfZero(req.GymID), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	invoice, err := app.loadMembershipInvoice(req.ClientMembershipID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invoice == nil {
+		sendErrorResponse(w, "Membership has no price and was not invoiced", http.StatusBadRequest)
+		return
+	}
+
+	sendSuccessResponse(w, "Invoice created successfully", invoice)
+}
+
+// Record a full or partial payment of an invoice
+func (app *App) registerPayment(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	invoiceID, err := strconv.Atoi(vars["invoice_id"])
+	if err != nil || invoiceID <= 0 {
+		sendErrorResponse(w, "Invalid invoice_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req RegisterPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.Amount <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "amount", Message: "amount must be positive"})
+	}
+	switch req.Method {
+	case paymentMethodCash, paymentMethodCard, paymentMethodTransfer:
+	default:
+		fieldErrs = append(fieldErrs, FieldError{Field: "method", Message: "method must be cash, card or transfer"})
+	}
+	if req.PaidOn != "" {
+		if _, err := time.Parse("2006-01-02", req.PaidOn); err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "paid_on", Message: "date must be in YYYY-MM-DD format"})
+		}
+	}
+	if len(req.Reference) > 64 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "reference", Message: "reference cannot exceed 64 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the invoice's client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM invoices i
+	                                  INNER JOIN user_clients uc ON uc.client_id = i.client_id
+	                                  WHERE i.id = $1 AND uc.user_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, invoiceID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Invoice not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT register_payment($1, $2, $3, $4, $5, $6)", invoiceID, req.Amount, req.Method,
+		nullIfEmpty(req.PaidOn), nullIfEmpty(req.Reference), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	invoice, err := app.loadInvoice(invoiceID, claims.UserID)
+	if err != nil {
+		sendSuccessResponse(w, "Payment registered successfully", map[string]interface{}{
+			"status":     "OK",
+			"invoice_id": invoiceID,
+			"amount":     req.Amount,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Payment registered successfully", invoice)
+}
+
+// loadInvoice returns an invoice the user can access, with its lines and payments
+func (app *App) loadInvoice(invoiceID, userID int) (*Invoice, error) {
+	var invoice Invoice
+	err := scanInvoice(app.DB.QueryRow(invoiceQuery+" AND i.id = $2", userID, invoiceID), &invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	lineRows, err := app.DB.Query(`SELECT id, client_membership_id, COALESCE(description, ''), quantity,
+	                                      unit_price, COALESCE(vat_rate, 0), net_amount, vat_amount, total_amount
+	                               FROM invoice_lines
+	                               WHERE invoice_id = $1
+	                               ORDER BY id`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer lineRows.Close()
+
+	invoice.Lines = []InvoiceLine{}
+	for lineRows.Next() {
+		var line InvoiceLine
+		err := lineRows.Scan(&line.ID, &line.ClientMembershipID, &line.Description, &line.Quantity,
+			&line.UnitPrice, &line.VATRate, &line.NetAmount, &line.VATAmount, &line.TotalAmount)
+		if err != nil {
+			return nil, err
+		}
+		invoice.Lines = append(invoice.Lines, line)
+	}
+	if err := lineRows.Err(); err != nil {
+		return nil, err
+	}
+
+	paymentRows, err := app.DB.Query(`SELECT id, invoice_id, amount, method, TO_CHAR(paid_on, 'YYYY-MM-DD'),
+	                                         COALESCE(reference, ''), created_by
+	                                  FROM payments
+	                                  WHERE invoice_id = $1
+	                                  ORDER BY paid_on, id`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer paymentRows.Close()
+
+	invoice.Payments = []Payment{}
+	for paymentRows.Next() {
+		var payment Payment
+		err := paymentRows.Scan(&payment.ID, &payment.InvoiceID, &payment.Amount, &payment.Method,
+			&payment.PaidOn, &payment.Reference, &payment.CreatedBy)
+		if err != nil {
+			return nil, err
+		}
+		invoice.Payments = append(invoice.Payments, payment)
+	}
+
+	return &invoice, paymentRows.Err()
+}
+
+// loadMembershipInvoice returns the open (not cancelled) invoice of a client membership, or nil
+func (app *App) loadMembershipInvoice(clientMembershipID, userID int) (*Invoice, error) {
+	var invoiceID int
+	err := app.DB.QueryRow(`SELECT i.id FROM invoices i
+	                        INNER JOIN invoice_lines il ON il.invoice_id = i.id
+	                        WHERE il.client_membership_id = $1 AND i.status <> 'cancelled'
+	                        ORDER BY i.id DESC
+	                        LIMIT 1`, clientMembershipID).Scan(&invoiceID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return app.loadInvoice(invoiceID, userID)
+}
+
+// invoiceNewClientMembership invoices the client membership just created in tx by
+// add_client_membership, using the price list of gymID (0 for the default prices)
+func invoiceNewClientMembership(tx *sql.Tx, gymID, userID int) (string, error) {
+	var result string
+	err := tx.QueryRow(`SELECT invoice_client_membership(currval(pg_get_serial_sequence('client_memberships', 'id'))::integer, $1, $2)`,
+		nullIfZero(gymID), userID).Scan(&result)
+	return result, err
+}
@@ -0,0 +1,414 @@
+package server
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"GoGymRestApi/server/ical"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// CalendarFeed is the secret subscription URL of a user's or a client's iCalendar feed
+type CalendarFeed struct {
+	URL            string `json:"url"`
+	CreatedOn      string `json:"created_on"`
+	LastAccessedOn string `json:"last_accessed_on,omitempty"`
+}
+
+const (
+	// Feeds cover the last month and the next six months
+	calendarFeedDaysBack  = 30
+	calendarFeedDaysAhead = 180
+
+	// How often calendar apps are asked to refresh a feed
+	calendarFeedRefresh = time.Hour
+
+	// Domain part of the event UIDs
+	calendarUIDDomain = "gogym"
+)
+
+// Events of the classes a user teaches
+const instructorClassEventQuery = `SELECT 'class-session', cs.id,
+                                          cs.starts_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                          COALESCE(cs.ends_at, cs.starts_at + INTERVAL '1 hour') AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                          COALESCE(ct.name, ''),
+                                          (SELECT COUNT(*) FROM class_bookings cb
+                                           WHERE cb.session_id = cs.id AND cb.status IN ('booked', 'attended'))
+                                            || '/' || COALESCE(cs.capacity, 0) || ' booked',
+                                          COALESCE(g.name, '') || COALESCE(', ' || cs.room, ''),
+                                          CASE WHEN cs.status = 'cancelled' THEN 'CANCELLED' ELSE 'CONFIRMED' END,
+                                          COALESCE(cs.sequence, 0)
+                                   FROM class_sessions cs
+                                   LEFT JOIN class_types ct ON ct.id = cs.class_type_id
+                                   LEFT JOIN gyms g ON g.id = cs.gym_id`
+
+// Events of a client's class bookings; waitlisted places are tentative
+const clientClassEventQuery = `SELECT 'class-booking', cb.id,
+                                      cs.starts_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                      COALESCE(cs.ends_at, cs.starts_at + INTERVAL '1 hour') AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                      COALESCE(ct.name, ''),
+                                      CASE WHEN cb.status = 'waitlisted' THEN 'On the waitlist' ELSE '' END
+                                        || COALESCE(CASE WHEN cb.status = 'waitlisted' THEN ', instructor: ' ELSE 'Instructor: ' END
+                                                    || u.full_name, ''),
+                                      COALESCE(g.name, '') || COALESCE(', ' || cs.room, ''),
+                                      CASE WHEN cb.status = 'cancelled' OR cs.status = 'cancelled' THEN 'CANCELLED'
+                                           WHEN cb.status = 'waitlisted' THEN 'TENTATIVE'
+                                           ELSE 'CONFIRMED' END,
+                                      COALESCE(cs.sequence, 0) + (cb.promoted_on IS NOT NULL)::int
+                                        + (cb.status = 'cancelled')::int
+                               FROM class_bookings cb
+                               INNER JOIN class_sessions cs ON cs.id = cb.session_id
+                               LEFT JOIN class_types ct ON ct.id = cs.class_type_id
+                               LEFT JOIN users u ON u.id = cs.instructor_id
+                               LEFT JOIN gyms g ON g.id = cs.gym_id`
+
+// Events of the appointments a user holds as a trainer
+const trainerAppointmentEventQuery = `SELECT 'trainer-appointment', ta.id,
+                                             ta.starts_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                             ta.ends_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                             'Personal training: ' || COALESCE(c.name, ''),
+                                             COALESCE(ta.notes, ''),
+                                             COALESCE(g.name, ''),
+                                             CASE WHEN ta.status = 'cancelled' THEN 'CANCELLED' ELSE 'CONFIRMED' END,
+                                             COALESCE(ta.sequence, 0)
+                                      FROM trainer_appointments ta
+                                      LEFT JOIN clients c ON c.id = ta.client_id
+                                      LEFT JOIN gyms g ON g.id = ta.gym_id`
+
+// Events of a client's appointments with a personal trainer
+const clientAppointmentEventQuery = `SELECT 'trainer-appointment', ta.id,
+                                            ta.starts_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                            ta.ends_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                            'Personal training with ' || COALESCE(u.full_name, ''),
+                                            '',
+                                            COALESCE(g.name, ''),
+                                            CASE WHEN ta.status = 'cancelled' THEN 'CANCELLED' ELSE 'CONFIRMED' END,
+                                            COALESCE(ta.sequence, 0)
+                                     FROM trainer_appointments ta
+                                     LEFT JOIN users u ON u.id = ta.trainer_id
+                                     LEFT JOIN gyms g ON g.id = ta.gym_id`
+
+// Events of a client's resource bookings; a booking is changed only by its cancellation
+const clientResourceEventQuery = `SELECT 'resource-booking', rb.id,
+                                         rb.starts_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                         rb.ends_at AT TIME ZONE COALESCE(g.time_zone, 'Europe/Bucharest'),
+                                         COALESCE(r.name, ''),
+                                         COALESCE(rb.notes, ''),
+                                         COALESCE(g.name, ''),
+                                         CASE WHEN rb.status = 'cancelled' THEN 'CANCELLED' ELSE 'CONFIRMED' END,
+                                         CASE WHEN rb.status = 'cancelled' THEN 1 ELSE 0 END
+                                  FROM resource_bookings rb
+                                  LEFT JOIN resources r ON r.id = rb.resource_id
+                                  LEFT JOIN gyms g ON g.id = rb.gym_id`
+
+// calendarFeedOwner authenticates the request and resolves whose feed it is about:
+// the signed in user's, or a client's the user has access to
+func (app *App) calendarFeedOwner(w http.ResponseWriter, r *http.Request) (column string, ownerID int, userID int, ok bool) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return "", 0, 0, false
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return "", 0, 0, false
+	}
+
+	vars := mux.Vars(r)
+	if _, isClient := vars["client_id"]; !isClient {
+		return "user_id", claims.UserID, claims.UserID, true
+	}
+
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return "", 0, 0, false
+	}
+
+	// Check if user has access to this client
+	var exists bool
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`,
+		claims.UserID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return "", 0, 0, false
+	}
+	return "client_id", clientID, claims.UserID, true
+}
+
+// Get the active calendar feed of the signed in user or of a client
+func (app *App) getCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	column, ownerID, _, ok := app.calendarFeedOwner(w, r)
+	if !ok {
+		return
+	}
+
+	var token string
+	var feed CalendarFeed
+	var lastAccessedOn sql.NullString
+	err := app.DB.QueryRow(`SELECT token, TO_CHAR(created_on, 'YYYY-MM-DD HH24:MI:SS'),
+	                               TO_CHAR(last_accessed_on, 'YYYY-MM-DD HH24:MI:SS')
+	                        FROM calendar_feeds
+	                        WHERE `+column+` = $1 AND revoked_on IS NULL
+	                        ORDER BY id DESC LIMIT 1`, ownerID).Scan(&token, &feed.CreatedOn, &lastAccessedOn)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "No calendar feed, create one first", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch calendar feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	feed.URL = app.calendarFeedURL(r, token)
+	feed.LastAccessedOn = lastAccessedOn.String
+
+	sendSuccessResponse(w, "Calendar feed retrieved successfully", feed)
+}
+
+// Create a calendar feed; an existing one is revoked, so this also rotates a leaked URL
+func (app *App) createCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	column, ownerID, userID, ok := app.calendarFeedOwner(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := newCalendarFeedToken()
+	if err != nil {
+		sendErrorResponse(w, "Failed to generate feed token: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(`UPDATE calendar_feeds SET revoked_on = now()
+	                  WHERE `+column+` = $1 AND revoked_on IS NULL`, ownerID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to revoke calendar feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var feed CalendarFeed
+	err = tx.QueryRow(`INSERT INTO calendar_feeds (token, `+column+`, created_by)
+	                   VALUES ($1, $2, $3)
+	                   RETURNING TO_CHAR(created_on, 'YYYY-MM-DD HH24:MI:SS')`, token, ownerID, userID).Scan(&feed.CreatedOn)
+	if err != nil {
+		sendErrorResponse(w, "Failed to create calendar feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	feed.URL = app.calendarFeedURL(r, token)
+
+	sendSuccessResponse(w, "Calendar feed created successfully", feed)
+}
+
+// Revoke the calendar feed; calendar apps subscribed to it stop receiving updates
+func (app *App) revokeCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	column, ownerID, _, ok := app.calendarFeedOwner(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := app.DB.Exec(`UPDATE calendar_feeds SET revoked_on = now()
+	                            WHERE `+column+` = $1 AND revoked_on IS NULL`, ownerID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to revoke calendar feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "No calendar feed to revoke", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Calendar feed revoked successfully", map[string]interface{}{
+		"status": "OK",
+	})
+}
+
+// Serve an iCalendar feed; the token in the URL is the only credential, as
+// calendar apps cannot send an authorization header
+func (app *App) serveCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	var feedID int
+	var userID, clientID sql.NullInt64
+	var name string
+	err := app.DB.QueryRow(`SELECT f.id, f.user_id, f.client_id, COALESCE(u.full_name, c.name, '')
+	                        FROM calendar_feeds f
+	                        LEFT JOIN users u ON u.id = f.user_id
+	                        LEFT JOIN clients c ON c.id = f.client_id
+	                        WHERE f.token = $1 AND f.revoked_on IS NULL`, token).Scan(&feedID, &userID, &clientID, &name)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Calendar feed not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch calendar feed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var events, appointments []ical.Event
+	if userID.Valid {
+		events, err = app.calendarEvents(instructorClassEventQuery+` WHERE cs.instructor_id = $1
+		                                   AND cs.starts_at >= CURRENT_DATE - $2::int
+		                                   AND cs.starts_at < CURRENT_DATE + $3::int`,
+			userID.Int64, calendarFeedDaysBack, calendarFeedDaysAhead)
+		if err == nil {
+			appointments, err = app.calendarEvents(trainerAppointmentEventQuery+` WHERE ta.trainer_id = $1
+			                                         AND ta.starts_at >= CURRENT_DATE - $2::int
+			                                         AND ta.starts_at < CURRENT_DATE + $3::int`,
+				userID.Int64, calendarFeedDaysBack, calendarFeedDaysAhead)
+		}
+	} else {
+		events, err = app.calendarEvents(clientClassEventQuery+` WHERE cb.client_id = $1
+		                                   AND cs.starts_at >= CURRENT_DATE - $2::int
+		                                   AND cs.starts_at < CURRENT_DATE + $3::int`,
+			clientID.Int64, calendarFeedDaysBack, calendarFeedDaysAhead)
+		if err == nil {
+			appointments, err = app.calendarEvents(clientAppointmentEventQuery+` WHERE ta.client_id = $1
+			                                         AND ta.starts_at >= CURRENT_DATE - $2::int
+			                                         AND ta.starts_at < CURRENT_DATE + $3::int`,
+				clientID.Int64, calendarFeedDaysBack, calendarFeedDaysAhead)
+		}
+		if err == nil {
+			var resources []ical.Event
+			resources, err = app.calendarEvents(clientResourceEventQuery+` WHERE rb.client_id = $1
+			                                      AND rb.starts_at >= CURRENT_DATE - $2::int
+			                                      AND rb.starts_at < CURRENT_DATE + $3::int`,
+				clientID.Int64, calendarFeedDaysBack, calendarFeedDaysAhead)
+			appointments = append(appointments, resources...)
+		}
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch calendar events: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := app.DB.Exec(`UPDATE calendar_feeds SET last_accessed_on = now() WHERE id = $1`, feedID); err != nil {
+		log.Printf("calendar: failed to record access to feed %d: %v", feedID, err)
+	}
+
+	calendar := ical.Calendar{
+		Name:    "GoGym - " + name,
+		Refresh: calendarFeedRefresh,
+		Events:  append(events, appointments...),
+	}
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(calendar.Marshal())
+}
+
+// calendarEvents runs one of the event queries above
+func (app *App) calendarEvents(query string, args ...interface{}) ([]ical.Event, error) {
+	rows, err := app.DB.Query(query+` ORDER BY 3`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []ical.Event
+	for rows.Next() {
+		var kind string
+		var id int
+		var event ical.Event
+		if err := rows.Scan(&kind, &id, &event.Start, &event.End, &event.Summary, &event.Description,
+			&event.Location, &event.Status, &event.Sequence); err != nil {
+			return nil, err
+		}
+		event.UID = fmt.Sprintf("%s-%d@%s", kind, id, calendarUIDDomain)
+		events = append(events, event)
+	}
+
+	// Check for any row iteration errors
+	return events, rows.Err()
+}
+
+// classBookingICS is the .ics file attached to the notifications about a class booking
+func (app *App) classBookingICS(bookingID int) *Attachment {
+	return app.calendarAttachment("class.ics", clientClassEventQuery+` WHERE cb.id = $1`, bookingID)
+}
+
+// trainerAppointmentICS is the .ics file attached to the notifications about an appointment
+func (app *App) trainerAppointmentICS(appointmentID int) *Attachment {
+	return app.calendarAttachment("appointment.ics", clientAppointmentEventQuery+` WHERE ta.id = $1`, appointmentID)
+}
+
+// resourceBookingICS is the .ics file attached to the notifications about a resource booking
+func (app *App) resourceBookingICS(bookingID int) *Attachment {
+	return app.calendarAttachment("booking.ics", clientResourceEventQuery+` WHERE rb.id = $1`, bookingID)
+}
+
+// calendarAttachment renders a single event as an .ics file; on failure the
+// notification goes out without it
+func (app *App) calendarAttachment(fileName, query string, id int) *Attachment {
+	events, err := app.calendarEvents(query, id)
+	if err != nil {
+		log.Printf("calendar: failed to build %s for %d: %v", fileName, id, err)
+		return nil
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	calendar := ical.Calendar{Events: events}
+	return &Attachment{
+		Name:        fileName,
+		ContentType: ical.ContentType,
+		Content:     calendar.Marshal(),
+	}
+}
+
+// calendarFeedURL is the subscription URL of a feed token
+func (app *App) calendarFeedURL(r *http.Request, token string) string {
+	baseURL := app.Config.PublicBaseURL
+	if baseURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+			scheme = proto
+		}
+		baseURL = scheme + "://" + r.Host
+	}
+	return baseURL + "/api/calendar/" + token + ".ics"
+}
+
+// newCalendarFeedToken returns 32 random bytes, hex encoded
+func newCalendarFeedToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
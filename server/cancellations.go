@@ -0,0 +1,484 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// CancellationPolicy is how a gym refunds cancelled memberships; memberships not
+// invoiced at a gym use the defaults (30 days notice, no fee, 14 days cooling-off)
+type CancellationPolicy struct {
+	GymID          int     `json:"gym_id"`
+	NoticeDays     int     `json:"notice_days"`
+	Fee            float64 `json:"fee"`
+	FeePercent     float64 `json:"fee_percent"`
+	CoolingOffDays int     `json:"cooling_off_days"`
+}
+
+type CancelClientMembershipRequest struct {
+	Reason       string `json:"reason"`
+	EffectiveOn  string `json:"effective_on,omitempty"`  // first day without access; the notice period still applies
+	RefundMethod string `json:"refund_method,omitempty"` // cash, card or transfer; defaults to how the invoice was paid
+}
+
+// CancellationQuote is what cancelling a membership would refund
+type CancellationQuote struct {
+	ClientMembershipID int     `json:"client_membership_id"`
+	EffectiveOn        string  `json:"effective_on"`
+	UsedDays           int     `json:"used_days"`
+	TotalDays          int     `json:"total_days"`
+	CoolingOff         bool    `json:"cooling_off"`
+	InvoiceID          *int    `json:"invoice_id"`
+	Currency           string  `json:"currency,omitempty"`
+	RefundableAmount   float64 `json:"refundable_amount"`
+	FeeAmount          float64 `json:"fee_amount"`
+	CreditAmount       float64 `json:"credit_amount"`
+	BalanceOffset      float64 `json:"balance_offset"`
+	RefundAmount       float64 `json:"refund_amount"`
+}
+
+type MembershipCancellation struct {
+	ID                 int     `json:"id"`
+	ClientMembershipID int     `json:"client_membership_id"`
+	ClientID           int     `json:"client_id"`
+	Reason             string  `json:"reason"`
+	RequestedOn        string  `json:"requested_on"`
+	EffectiveOn        string  `json:"effective_on"`
+	UsedDays           int     `json:"used_days"`
+	TotalDays          int     `json:"total_days"`
+	CoolingOff         bool    `json:"cooling_off"`
+	InvoiceID          *int    `json:"invoice_id"`
+	CreditNoteID       *int    `json:"credit_note_id"`
+	CreditNoteNo       string  `json:"credit_note_no,omitempty"`
+	Currency           string  `json:"currency,omitempty"`
+	RefundableAmount   float64 `json:"refundable_amount"`
+	FeeAmount          float64 `json:"fee_amount"`
+	CreditAmount       float64 `json:"credit_amount"`
+	RefundAmount       float64 `json:"refund_amount"`
+	RefundMethod       string  `json:"refund_method,omitempty"`
+	CreatedBy          int     `json:"created_by"`
+}
+
+// CancellationNotice is the data of the membership_cancelled notification
+type CancellationNotice struct {
+	ClientName     string `json:"client_name"`
+	MembershipName string `json:"membership_name"`
+	LastDay        string `json:"last_day"`
+	RefundAmount   string `json:"refund_amount"`
+	Currency       string `json:"currency"`
+}
+
+// Preview the refund of cancelling a client membership.
+// Query params: optional effective_on (YYYY-MM-DD, first day without access).
+func (app *App) getMembershipCancellationQuote(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientMembershipID, err := strconv.Atoi(vars["client_membership_id"])
+	if err != nil || clientMembershipID <= 0 {
+		sendErrorResponse(w, "Invalid client_membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var effectiveOn interface{}
+	if effectiveOnStr := r.URL.Query().Get("effective_on"); effectiveOnStr != "" {
+		if _, err := time.Parse("2006-01-02", effectiveOnStr); err != nil {
+			sendErrorResponse(w, "Invalid effective_on parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		effectiveOn = effectiveOnStr
+	}
+
+	// Check if user has permission for the membership's client
+	var canceledOn sql.NullString
+	var isActive bool
+	permissionQuery := `SELECT TO_CHAR(cm.canceleted_on, 'YYYY-MM-DD'),
+	                           cm.status = 'active' AND cm.ending_on >= CURRENT_DATE
+	                    FROM client_memberships cm
+	                    INNER JOIN user_clients uc ON uc.client_id = cm.client_id
+	                    WHERE cm.id = $1 AND cm.client_id = $2 AND uc.user_id = $3`
+	err = app.DB.QueryRow(permissionQuery, clientMembershipID, clientID, claims.UserID).Scan(&canceledOn, &isActive)
+	if err != nil {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusForbidden)
+		return
+	}
+	if canceledOn.Valid {
+		sendErrorResponse(w, "Membership is already cancelled, effective "+canceledOn.String, http.StatusConflict)
+		return
+	}
+	if !isActive {
+		sendErrorResponse(w, "Only active memberships can be cancelled", http.StatusConflict)
+		return
+	}
+
+	quote := CancellationQuote{ClientMembershipID: clientMembershipID}
+	err = app.DB.QueryRow(`SELECT TO_CHAR(q.effective_on, 'YYYY-MM-DD'), q.used_days, q.total_days, q.cooling_off,
+	                              q.invoice_id, COALESCE(q.currency, ''), q.refundable_amount, q.fee_amount,
+	                              q.credit_amount, q.balance_offset, q.refund_amount
+	                       FROM quote_membership_cancellation($1, $2::date) q`,
+		clientMembershipID, effectiveOn).Scan(&quote.EffectiveOn, &quote.UsedDays, &quote.TotalDays,
+		&quote.CoolingOff, &quote.InvoiceID, &quote.Currency, &quote.RefundableAmount, &quote.FeeAmount,
+		&quote.CreditAmount, &quote.BalanceOffset, &quote.RefundAmount)
+	if err != nil {
+		sendErrorResponse(w, "Failed to quote cancellation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Cancellation quote retrieved successfully", quote)
+}
+
+// Cancel a client membership: access ends per the cancellation policy, the unused
+// part is credited back and the membership is kept for history
+func (app *App) cancelClientMembership(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientMembershipID, err := strconv.Atoi(vars["client_membership_id"])
+	if err != nil || clientMembershipID <= 0 {
+		sendErrorResponse(w, "Invalid client_membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CancelClientMembershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateCancelClientMembership(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the membership's client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM client_memberships cm
+	                                  INNER JOIN user_clients uc ON uc.client_id = cm.client_id
+	                                  WHERE cm.id = $1 AND cm.client_id = $2 AND uc.user_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, clientMembershipID, clientID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT cancel_client_membership($1, $2, $3, $4, $5)", clientMembershipID,
+		nullIfEmpty(req.EffectiveOn), req.Reason, nullIfEmpty(req.RefundMethod), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	cancellation, err := app.loadMembershipCancellation(clientMembershipID)
+	if err != nil {
+		sendSuccessResponse(w, "Client membership cancelled successfully", map[string]interface{}{
+			"status":               "OK",
+			"client_membership_id": clientMembershipID,
+		})
+		return
+	}
+
+	app.notifyCancellation(cancellation)
+
+	sendSuccessResponse(w, "Client membership cancelled successfully", cancellation)
+}
+
+// Get the cancellation of a client membership
+func (app *App) getMembershipCancellation(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientMembershipID, err := strconv.Atoi(vars["client_membership_id"])
+	if err != nil || clientMembershipID <= 0 {
+		sendErrorResponse(w, "Invalid client_membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the membership's client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM client_memberships cm
+	                                  INNER JOIN user_clients uc ON uc.client_id = cm.client_id
+	                                  WHERE cm.id = $1 AND cm.client_id = $2 AND uc.user_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, clientMembershipID, clientID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	cancellation, err := app.loadMembershipCancellation(clientMembershipID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Membership is not cancelled", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch cancellation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Cancellation retrieved successfully", cancellation)
+}
+
+// Get the cancellation policy of a gym
+func (app *App) getGymCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var policy CancellationPolicy
+	query := `SELECT g.id, COALESCE(g.cancellation_notice_days, 30), COALESCE(g.cancellation_fee, 0),
+	                 COALESCE(g.cancellation_fee_percent, 0), COALESCE(g.cancellation_cooling_off_days, 14)
+	          FROM gyms g
+	          INNER JOIN user_gyms ug ON ug.gym_id = g.id
+	          WHERE g.id = $1 AND ug.user_id = $2`
+	err = app.DB.QueryRow(query, gymID, claims.UserID).Scan(&policy.GymID, &policy.NoticeDays, &policy.Fee,
+		&policy.FeePercent, &policy.CoolingOffDays)
+	if err != nil {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	sendSuccessResponse(w, "Gym cancellation policy retrieved successfully", policy)
+}
+
+// Update the notice period, fees and cooling-off period of a gym's cancellations
+func (app *App) updateGymCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CancellationPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.NoticeDays < 0 || req.NoticeDays > 365 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "notice_days", Message: "notice period must be between 0 and 365 days"})
+	}
+	if req.Fee < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "fee", Message: "fee cannot be negative"})
+	}
+	if req.FeePercent < 0 || req.FeePercent > 100 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "fee_percent", Message: "fee percentage must be between 0 and 100"})
+	}
+	if req.CoolingOffDays < 0 || req.CoolingOffDays > 365 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "cooling_off_days", Message: "cooling-off period must be between 0 and 365 days"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	_, err = app.DB.Exec(`UPDATE gyms
+	                      SET cancellation_notice_days = $2, cancellation_fee = $3,
+	                          cancellation_fee_percent = $4, cancellation_cooling_off_days = $5
+	                      WHERE id = $1`,
+		gymID, req.NoticeDays, req.Fee, req.FeePercent, req.CoolingOffDays)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update gym cancellation policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.GymID = gymID
+	sendSuccessResponse(w, "Gym cancellation policy updated successfully", req)
+}
+
+// validateCancelClientMembership checks the request and trims the reason
+func validateCancelClientMembership(req *CancelClientMembershipRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "reason", Message: "reason is required"})
+	} else if len(req.Reason) > 256 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "reason", Message: "reason cannot exceed 256 characters"})
+	}
+	if req.EffectiveOn != "" {
+		if _, err := time.Parse("2006-01-02", req.EffectiveOn); err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "effective_on", Message: "date must be in YYYY-MM-DD format"})
+		}
+	}
+	switch req.RefundMethod {
+	case "", paymentMethodCash, paymentMethodCard, paymentMethodTransfer:
+	default:
+		fieldErrs = append(fieldErrs, FieldError{Field: "refund_method", Message: "refund method must be cash, card or transfer"})
+	}
+
+	return fieldErrs
+}
+
+// loadMembershipCancellation reads the cancellation of a client membership with its credit note number
+func (app *App) loadMembershipCancellation(clientMembershipID int) (*MembershipCancellation, error) {
+	var c MembershipCancellation
+	query := `SELECT mc.id, mc.client_membership_id, mc.client_id, COALESCE(mc.reason, ''),
+	                 TO_CHAR(mc.requested_on, 'YYYY-MM-DD'), TO_CHAR(mc.effective_on, 'YYYY-MM-DD'),
+	                 mc.used_days, mc.total_days, COALESCE(mc.cooling_off, false), mc.invoice_id, mc.credit_note_id,
+	                 COALESCE(cn.series_code || '-' || LPAD(cn.number::text, 6, '0'), ''), COALESCE(mc.currency, ''),
+	                 mc.refundable_amount, mc.fee_amount, mc.credit_amount, mc.refund_amount,
+	                 COALESCE(mc.refund_method, ''), mc.created_by
+	          FROM membership_cancellations mc
+	          LEFT JOIN invoices cn ON cn.id = mc.credit_note_id
+	          WHERE mc.client_membership_id = $1`
+	err := app.DB.QueryRow(query, clientMembershipID).Scan(&c.ID, &c.ClientMembershipID, &c.ClientID, &c.Reason,
+		&c.RequestedOn, &c.EffectiveOn, &c.UsedDays, &c.TotalDays, &c.CoolingOff, &c.InvoiceID, &c.CreditNoteID,
+		&c.CreditNoteNo, &c.Currency, &c.RefundableAmount, &c.FeeAmount, &c.CreditAmount, &c.RefundAmount,
+		&c.RefundMethod, &c.CreatedBy)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// notifyCancellation confirms a cancellation to the client; failures are only logged
+func (app *App) notifyCancellation(c *MembershipCancellation) {
+	notice := CancellationNotice{
+		RefundAmount: fmt.Sprintf("%.2f", c.RefundAmount),
+		Currency:     c.Currency,
+	}
+	err := app.DB.QueryRow(`SELECT cl.name, m.name, TO_CHAR(cm.ending_on, 'YYYY-MM-DD')
+	                        FROM client_memberships cm
+	                        INNER JOIN clients cl ON cl.id = cm.client_id
+	                        INNER JOIN memberships m ON m.id = cm.membership_id
+	                        WHERE cm.id = $1`, c.ClientMembershipID).Scan(&notice.ClientName,
+		&notice.MembershipName, &notice.LastDay)
+	if err != nil {
+		log.Printf("cancellation: failed to load membership %d for notification: %v", c.ClientMembershipID, err)
+		return
+	}
+	// Memberships cancelled before they started have no last day of access
+	if notice.LastDay >= c.EffectiveOn {
+		notice.LastDay = ""
+	}
+
+	err = app.Notifier.NotifyClient(c.ClientID, "membership_cancelled", notice)
+	if err != nil && err != errNoContactChannel {
+		log.Printf("cancellation: failed to queue membership_cancelled for client %d: %v", c.ClientID, err)
+	}
+}
@@ -0,0 +1,396 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+type ClassBooking struct {
+	ID                 int    `json:"id"`
+	SessionID          int    `json:"session_id"`
+	GymID              int    `json:"gym_id"`
+	ClassName          string `json:"class_name"`
+	StartsAt           string `json:"starts_at"`
+	ClientID           int    `json:"client_id"`
+	ClientName         string `json:"client_name"`
+	ClientMembershipID *int   `json:"client_membership_id"`
+	Status             string `json:"status"` // booked, waitlisted, attended, cancelled or no_show
+	WaitlistPosition   int    `json:"waitlist_position,omitempty"`
+	BookedOn           string `json:"booked_on"`
+	PromotedOn         string `json:"promoted_on,omitempty"`
+	CancelledOn        string `json:"cancelled_on,omitempty"`
+	CheckedInOn        string `json:"checked_in_on,omitempty"`
+	ClientPassID       *int   `json:"client_pass_id"`
+}
+
+type BookClassRequest struct {
+	ClientID int `json:"client_id"`
+}
+
+// classBookingQuery selects bookings with their session; waitlist_position is
+// the place in the queue of a waitlisted booking
+const classBookingQuery = `SELECT cb.id, cb.session_id, cs.gym_id, COALESCE(ct.name, ''),
+                                  TO_CHAR(cs.starts_at, 'YYYY-MM-DD HH24:MI'), cb.client_id, COALESCE(c.name, ''),
+                                  cb.client_membership_id, cb.status,
+                                  CASE WHEN cb.status = 'waitlisted'
+                                       THEN (SELECT COUNT(*) FROM class_bookings w
+                                             WHERE w.session_id = cb.session_id AND w.status = 'waitlisted'
+                                               AND (w.booked_on, w.id) <= (cb.booked_on, cb.id))
+                                       ELSE 0 END,
+                                  TO_CHAR(cb.booked_on, 'YYYY-MM-DD HH24:MI:SS'),
+                                  COALESCE(TO_CHAR(cb.promoted_on, 'YYYY-MM-DD HH24:MI:SS'), ''),
+                                  COALESCE(TO_CHAR(cb.cancelled_on, 'YYYY-MM-DD HH24:MI:SS'), ''),
+                                  COALESCE(TO_CHAR(cb.checked_in_on, 'YYYY-MM-DD HH24:MI:SS'), ''),
+                                  cb.client_pass_id
+                           FROM class_bookings cb
+                           INNER JOIN class_sessions cs ON cs.id = cb.session_id
+                           LEFT JOIN class_types ct ON ct.id = cs.class_type_id
+                           LEFT JOIN clients c ON c.id = cb.client_id`
+
+func scanClassBooking(scanner interface{ Scan(...interface{}) error }, b *ClassBooking) error {
+	return scanner.Scan(&b.ID, &b.SessionID, &b.GymID, &b.ClassName, &b.StartsAt, &b.ClientID, &b.ClientName,
+		&b.ClientMembershipID, &b.Status, &b.WaitlistPosition, &b.BookedOn, &b.PromotedOn, &b.CancelledOn,
+		&b.CheckedInOn, &b.ClientPassID)
+}
+
+// Book a client into a class; a full class puts the client on its waitlist
+func (app *App) bookGymClass(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	sessionID, err := strconv.Atoi(vars["session_id"])
+	if err != nil || sessionID <= 0 {
+		sendErrorResponse(w, "Invalid session_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req BookClassRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ClientID <= 0 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "client_id", Message: "Valid client_id is required"}})
+		return
+	}
+
+	// Check if user has permission for the session's gym and the client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN class_sessions cs ON cs.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND cs.id = $3)
+	                      AND EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $4)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, sessionID, req.ClientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Class or client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT book_class($1, $2, $3)", sessionID, req.ClientID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	var booking ClassBooking
+	err = scanClassBooking(app.DB.QueryRow(classBookingQuery+` WHERE cb.session_id = $1 AND cb.client_id = $2
+	                                                            AND cb.status <> 'cancelled'`, sessionID, req.ClientID), &booking)
+	if err != nil {
+		sendSuccessResponse(w, "Class booked successfully", map[string]interface{}{
+			"status": "OK",
+		})
+		return
+	}
+
+	message := "Class booked successfully"
+	if booking.Status == "waitlisted" {
+		message = "Class is full, client added to the waitlist"
+	} else {
+		app.notifyClass(booking.ID, "class_booked", "")
+	}
+	sendSuccessResponse(w, message, booking)
+}
+
+// Cancel a booking; the freed place goes to the first client on the waitlist
+func (app *App) cancelGymClassBooking(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gymID, sessionID, bookingID, ok := parseClassBookingVars(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkClassBookingAccess(w, claims.UserID, gymID, sessionID, bookingID) {
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT cancel_class_booking($1, $2)", bookingID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	rows, err := tx.Query(`SELECT p FROM promote_class_waitlist($1) p`, sessionID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to promote waitlist: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var promotedBookingIDs []int
+	for rows.Next() {
+		var promotedID int
+		if err = rows.Scan(&promotedID); err != nil {
+			rows.Close()
+			sendErrorResponse(w, "Failed to promote waitlist: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promotedBookingIDs = append(promotedBookingIDs, promotedID)
+	}
+	rows.Close()
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, promotedID := range promotedBookingIDs {
+		app.notifyClass(promotedID, "class_waitlist_promoted", "")
+	}
+	if len(promotedBookingIDs) > 0 {
+		log.Printf("classes: %d client(s) promoted from the waitlist of session %d", len(promotedBookingIDs), sessionID)
+	}
+
+	app.sendClassBooking(w, "Booking cancelled successfully", bookingID)
+}
+
+// Check a booked client in for the class; the client is checked in at the gym
+// too unless already there
+func (app *App) checkInGymClassBooking(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gymID, sessionID, bookingID, ok := parseClassBookingVars(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.checkClassBookingAccess(w, claims.UserID, gymID, sessionID, bookingID) {
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT check_in_class($1, $2)", bookingID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.sendClassBooking(w, "Client checked in for the class successfully", bookingID)
+}
+
+// List the class bookings of a client, upcoming first
+func (app *App) getClientClassBookings(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	upcomingOnly := r.URL.Query().Get("upcoming_only") == "true"
+
+	rows, err := app.DB.Query(classBookingQuery+` WHERE cb.client_id = $1
+	                                               AND ($2 = false OR (cs.starts_at > gym_local_time(cs.gym_id)
+	                                                                   AND cb.status IN ('booked', 'waitlisted')))
+	                                             ORDER BY cs.starts_at DESC, cb.id DESC
+	                                             LIMIT 100`, clientID, upcomingOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch class bookings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var bookings []ClassBooking
+	for rows.Next() {
+		var booking ClassBooking
+		if err := scanClassBooking(rows, &booking); err != nil {
+			sendErrorResponse(w, "Failed to scan class booking: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		bookings = append(bookings, booking)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no bookings found, return empty array instead of null
+	if bookings == nil {
+		bookings = []ClassBooking{}
+	}
+
+	sendSuccessResponse(w, "Class bookings retrieved successfully", bookings)
+}
+
+// parseClassBookingVars reads the gym, session and booking ids of a booking route
+func parseClassBookingVars(w http.ResponseWriter, r *http.Request) (gymID, sessionID, bookingID int, ok bool) {
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+	sessionID, err = strconv.Atoi(vars["session_id"])
+	if err != nil || sessionID <= 0 {
+		sendErrorResponse(w, "Invalid session_id parameter", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+	bookingID, err = strconv.Atoi(vars["booking_id"])
+	if err != nil || bookingID <= 0 {
+		sendErrorResponse(w, "Invalid booking_id parameter", http.StatusBadRequest)
+		return 0, 0, 0, false
+	}
+	return gymID, sessionID, bookingID, true
+}
+
+// checkClassBookingAccess checks that the booking belongs to the session and the
+// user works at its gym; on failure the response is already sent
+func (app *App) checkClassBookingAccess(w http.ResponseWriter, userID, gymID, sessionID, bookingID int) bool {
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN class_sessions cs ON cs.gym_id = ug.gym_id
+	                                  INNER JOIN class_bookings cb ON cb.session_id = cs.id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND cs.id = $3 AND cb.id = $4)`
+	err := app.DB.QueryRow(permissionQuery, userID, gymID, sessionID, bookingID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Booking not found or access denied", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// sendClassBooking reads a booking back after a change and sends it
+func (app *App) sendClassBooking(w http.ResponseWriter, message string, bookingID int) {
+	var booking ClassBooking
+	err := scanClassBooking(app.DB.QueryRow(classBookingQuery+" WHERE cb.id = $1", bookingID), &booking)
+	if err != nil {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     bookingID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, booking)
+}
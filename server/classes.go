@@ -0,0 +1,968 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+type ClassType struct {
+	ID              int    `json:"id"`
+	Name            string `json:"name"`
+	Description     string `json:"description,omitempty"`
+	DurationMinutes int    `json:"duration_minutes"`
+	MinLevel        int    `json:"min_level"` // lowest membership level allowed to book
+	IsActive        bool   `json:"is_active"`
+	CreatedOn       string `json:"created_on"`
+}
+
+type ClassTypeRequest struct {
+	Name            string `json:"name"`
+	Description     string `json:"description,omitempty"`
+	DurationMinutes int    `json:"duration_minutes,omitempty"` // defaults to 60
+	MinLevel        int    `json:"min_level,omitempty"`
+	IsActive        *bool  `json:"is_active,omitempty"`
+}
+
+// ClassSchedule repeats a class every week at a gym; sessions are generated from it
+// CLASS_SCHEDULE_DAYS ahead
+type ClassSchedule struct {
+	ID               int    `json:"id"`
+	GymID            int    `json:"gym_id"`
+	ClassTypeID      int    `json:"class_type_id"`
+	ClassName        string `json:"class_name"`
+	InstructorID     int    `json:"instructor_id"`
+	InstructorName   string `json:"instructor_name"`
+	Weekday          int    `json:"weekday"`    // ISO weekday, 1 = Monday
+	StartTime        string `json:"start_time"` // HH:MM, gym local time
+	DurationMinutes  int    `json:"duration_minutes"`
+	Room             string `json:"room,omitempty"`
+	Capacity         int    `json:"capacity"`
+	WaitlistCapacity int    `json:"waitlist_capacity"`
+	ValidFrom        string `json:"valid_from"`
+	ValidTo          string `json:"valid_to,omitempty"`
+	IsActive         bool   `json:"is_active"`
+}
+
+type CreateClassScheduleRequest struct {
+	ClassTypeID      int    `json:"class_type_id"`
+	InstructorID     int    `json:"instructor_id"`
+	Weekday          int    `json:"weekday"`
+	StartTime        string `json:"start_time"`
+	DurationMinutes  int    `json:"duration_minutes,omitempty"` // defaults to the class type's
+	Room             string `json:"room,omitempty"`
+	Capacity         int    `json:"capacity"`
+	WaitlistCapacity *int   `json:"waitlist_capacity,omitempty"` // defaults to 10, 0 for no waitlist
+	ValidFrom        string `json:"valid_from,omitempty"`        // defaults to today
+	ValidTo          string `json:"valid_to,omitempty"`
+}
+
+type ClassSession struct {
+	ID               int            `json:"id"`
+	ScheduleID       *int           `json:"schedule_id"`
+	GymID            int            `json:"gym_id"`
+	ClassTypeID      int            `json:"class_type_id"`
+	ClassName        string         `json:"class_name"`
+	InstructorID     *int           `json:"instructor_id"`
+	InstructorName   string         `json:"instructor_name"`
+	StartsAt         string         `json:"starts_at"` // gym local time
+	EndsAt           string         `json:"ends_at"`
+	Room             string         `json:"room,omitempty"`
+	Capacity         int            `json:"capacity"`
+	WaitlistCapacity int            `json:"waitlist_capacity"`
+	Booked           int            `json:"booked"`
+	Waitlisted       int            `json:"waitlisted"`
+	Attended         int            `json:"attended"`
+	PlacesLeft       int            `json:"places_left"`
+	Status           string         `json:"status"` // scheduled or cancelled
+	CancelReason     string         `json:"cancel_reason,omitempty"`
+	Bookings         []ClassBooking `json:"bookings,omitempty"`
+}
+
+type CancelClassSessionRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// ClassNotice is the data of the class_waitlist_promoted and class_cancelled notifications
+type ClassNotice struct {
+	ClientName string
+	ClassName  string
+	GymName    string
+	StartsAt   string
+	Reason     string
+}
+
+const classTypeQuery = `SELECT id, name, COALESCE(description, ''), COALESCE(duration_minutes, 60),
+                               COALESCE(min_level, 0), COALESCE(is_active, false), TO_CHAR(created_on, 'YYYY-MM-DD')
+                        FROM class_types`
+
+func scanClassType(scanner interface{ Scan(...interface{}) error }, ct *ClassType) error {
+	return scanner.Scan(&ct.ID, &ct.Name, &ct.Description, &ct.DurationMinutes, &ct.MinLevel, &ct.IsActive,
+		&ct.CreatedOn)
+}
+
+// classScheduleQuery selects class schedules with the class and instructor names
+const classScheduleQuery = `SELECT s.id, s.gym_id, s.class_type_id, COALESCE(ct.name, ''), s.instructor_id,
+                                   COALESCE(u.full_name, ''), s.weekday, TO_CHAR(s.start_time, 'HH24:MI'),
+                                   COALESCE(s.duration_minutes, ct.duration_minutes, 60), COALESCE(s.room, ''),
+                                   s.capacity, COALESCE(s.waitlist_capacity, 0), TO_CHAR(s.valid_from, 'YYYY-MM-DD'),
+                                   COALESCE(TO_CHAR(s.valid_to, 'YYYY-MM-DD'), ''), COALESCE(s.is_active, false)
+                            FROM class_schedules s
+                            LEFT JOIN class_types ct ON ct.id = s.class_type_id
+                            LEFT JOIN users u ON u.id = s.instructor_id`
+
+func scanClassSchedule(scanner interface{ Scan(...interface{}) error }, s *ClassSchedule) error {
+	return scanner.Scan(&s.ID, &s.GymID, &s.ClassTypeID, &s.ClassName, &s.InstructorID, &s.InstructorName,
+		&s.Weekday, &s.StartTime, &s.DurationMinutes, &s.Room, &s.Capacity, &s.WaitlistCapacity, &s.ValidFrom,
+		&s.ValidTo, &s.IsActive)
+}
+
+// classSessionQuery selects class sessions with their booking counts
+const classSessionQuery = `SELECT cs.id, cs.schedule_id, cs.gym_id, cs.class_type_id, COALESCE(ct.name, ''),
+                                  cs.instructor_id, COALESCE(u.full_name, ''),
+                                  TO_CHAR(cs.starts_at, 'YYYY-MM-DD HH24:MI'), TO_CHAR(cs.ends_at, 'YYYY-MM-DD HH24:MI'),
+                                  COALESCE(cs.room, ''), cs.capacity, COALESCE(cs.waitlist_capacity, 0),
+                                  COUNT(cb.id) FILTER (WHERE cb.status = 'booked'),
+                                  COUNT(cb.id) FILTER (WHERE cb.status = 'waitlisted'),
+                                  COUNT(cb.id) FILTER (WHERE cb.status = 'attended'),
+                                  cs.status, COALESCE(cs.cancel_reason, '')
+                           FROM class_sessions cs
+                           LEFT JOIN class_types ct ON ct.id = cs.class_type_id
+                           LEFT JOIN users u ON u.id = cs.instructor_id
+                           LEFT JOIN class_bookings cb ON cb.session_id = cs.id`
+
+const classSessionGroupBy = ` GROUP BY cs.id, ct.name, u.full_name`
+
+func scanClassSession(scanner interface{ Scan(...interface{}) error }, s *ClassSession) error {
+	err := scanner.Scan(&s.ID, &s.ScheduleID, &s.GymID, &s.ClassTypeID, &s.ClassName, &s.InstructorID,
+		&s.InstructorName, &s.StartsAt, &s.EndsAt, &s.Room, &s.Capacity, &s.WaitlistCapacity, &s.Booked,
+		&s.Waitlisted, &s.Attended, &s.Status, &s.CancelReason)
+	if err != nil {
+		return err
+	}
+	s.PlacesLeft = s.Capacity - s.Booked - s.Attended
+	if s.PlacesLeft < 0 || s.Status != "scheduled" {
+		s.PlacesLeft = 0
+	}
+	return nil
+}
+
+// List the class types
+func (app *App) getClassTypes(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+
+	rows, err := app.DB.Query(classTypeQuery+` WHERE ($1 = false OR is_active) ORDER BY name`, activeOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch class types: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var classTypes []ClassType
+	for rows.Next() {
+		var classType ClassType
+		if err := scanClassType(rows, &classType); err != nil {
+			sendErrorResponse(w, "Failed to scan class type: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		classTypes = append(classTypes, classType)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no class types found, return empty array instead of null
+	if classTypes == nil {
+		classTypes = []ClassType{}
+	}
+
+	sendSuccessResponse(w, "Class types retrieved successfully", classTypes)
+}
+
+// Add a class type; class types are shared by all gyms
+func (app *App) createClassType(w http.ResponseWriter, r *http.Request) {
+	app.saveClassType(w, r, 0)
+}
+
+// Update a class type; sessions already generated keep their duration
+func (app *App) updateClassType(w http.ResponseWriter, r *http.Request) {
+	classTypeID, err := strconv.Atoi(mux.Vars(r)["class_type_id"])
+	if err != nil || classTypeID <= 0 {
+		sendErrorResponse(w, "Invalid class_type_id parameter", http.StatusBadRequest)
+		return
+	}
+	app.saveClassType(w, r, classTypeID)
+}
+
+// saveClassType creates a class type, or updates classTypeID when it is not 0
+func (app *App) saveClassType(w http.ResponseWriter, r *http.Request, classTypeID int) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req ClassTypeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	var fieldErrs ValidationErrors
+	if req.Name == "" || len(req.Name) > 64 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "name", Message: "name must have between 1 and 64 characters"})
+	}
+	if len(req.Description) > 512 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "description", Message: "description cannot exceed 512 characters"})
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = 60
+	}
+	if req.DurationMinutes < 5 || req.DurationMinutes > 480 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "duration_minutes", Message: "duration must be between 5 and 480 minutes"})
+	}
+	if req.MinLevel < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "min_level", Message: "min_level cannot be negative"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+
+	// Class types are managed by users working at a gym
+	var exists bool
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1)`, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM class_types WHERE upper(name) = upper($1) AND id <> $2)`,
+		req.Name, classTypeID).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "name", Message: "a class type with this name already exists"}})
+		return
+	}
+
+	message := "Class type updated successfully"
+	if classTypeID == 0 {
+		message = "Class type created successfully"
+		err = app.DB.QueryRow(`INSERT INTO class_types (name, description, duration_minutes, min_level, is_active, created_by)
+		                       VALUES ($1, $2, $3, $4, $5, $6)
+		                       RETURNING id`,
+			req.Name, nullIfEmpty(req.Description), req.DurationMinutes, req.MinLevel, *req.IsActive,
+			claims.UserID).Scan(&classTypeID)
+	} else {
+		var result sql.Result
+		result, err = app.DB.Exec(`UPDATE class_types
+		                           SET name = $1, description = $2, duration_minutes = $3, min_level = $4, is_active = $5
+		                           WHERE id = $6`,
+			req.Name, nullIfEmpty(req.Description), req.DurationMinutes, req.MinLevel, *req.IsActive, classTypeID)
+		if err == nil {
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				sendErrorResponse(w, "Class type not found", http.StatusNotFound)
+				return
+			}
+		}
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to save class type: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var classType ClassType
+	if err := scanClassType(app.DB.QueryRow(classTypeQuery+" WHERE id = $1", classTypeID), &classType); err != nil {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     classTypeID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, classType)
+}
+
+// List the weekly class schedules of a gym
+func (app *App) getGymClassSchedules(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+
+	rows, err := app.DB.Query(classScheduleQuery+` WHERE s.gym_id = $1
+	                                                 AND ($2 = false OR (s.is_active AND (s.valid_to IS NULL OR s.valid_to >= CURRENT_DATE)))
+	                                               ORDER BY s.weekday, s.start_time, ct.name`, gymID, activeOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch class schedules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var schedules []ClassSchedule
+	for rows.Next() {
+		var schedule ClassSchedule
+		if err := scanClassSchedule(rows, &schedule); err != nil {
+			sendErrorResponse(w, "Failed to scan class schedule: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no schedules found, return empty array instead of null
+	if schedules == nil {
+		schedules = []ClassSchedule{}
+	}
+
+	sendSuccessResponse(w, "Class schedules retrieved successfully", schedules)
+}
+
+// Schedule a weekly class at a gym and generate its upcoming sessions
+func (app *App) createGymClassSchedule(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateClassScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateClassSchedule(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// The instructor has to work at the gym
+	err = app.DB.QueryRow(permissionQuery, req.InstructorID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "instructor_id", Message: "instructor is not a user of this gym"}})
+		return
+	}
+
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM class_types WHERE id = $1 AND is_active)`, req.ClassTypeID).Scan(&exists)
+	if err != nil || !exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "class_type_id", Message: "class type not found or inactive"}})
+		return
+	}
+
+	var scheduleID int
+	err = app.DB.QueryRow(`INSERT INTO class_schedules (gym_id, class_type_id, instructor_id, weekday, start_time,
+	                                                    duration_minutes, room, capacity, waitlist_capacity,
+	                                                    valid_from, valid_to, created_by)
+	                       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	                       RETURNING id`,
+		gymID, req.ClassTypeID, req.InstructorID, req.Weekday, req.StartTime, nullIfZero(req.DurationMinutes),
+		nullIfEmpty(req.Room), req.Capacity, *req.WaitlistCapacity, req.ValidFrom, nullIfEmpty(req.ValidTo),
+		claims.UserID).Scan(&scheduleID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to create class schedule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	app.generateClassSessions(scheduleID)
+
+	var schedule ClassSchedule
+	if err := scanClassSchedule(app.DB.QueryRow(classScheduleQuery+" WHERE s.id = $1", scheduleID), &schedule); err != nil {
+		sendSuccessResponse(w, "Class schedule created successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     scheduleID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Class schedule created successfully", schedule)
+}
+
+// End a weekly class: no more sessions are generated and the upcoming ones are
+// cancelled, notifying the clients booked
+func (app *App) deleteGymClassSchedule(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	scheduleID, err := strconv.Atoi(vars["schedule_id"])
+	if err != nil || scheduleID <= 0 {
+		sendErrorResponse(w, "Invalid schedule_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	result, err := app.DB.Exec(`UPDATE class_schedules SET is_active = false
+	                            WHERE id = $1 AND gym_id = $2 AND is_active`, scheduleID, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to end class schedule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "Active class schedule not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := app.DB.Query(`SELECT id FROM class_sessions
+	                           WHERE schedule_id = $1 AND status = 'scheduled' AND starts_at > gym_local_time(gym_id)`,
+		scheduleID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch upcoming sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var sessionIDs []int
+	for rows.Next() {
+		var sessionID int
+		if err := rows.Scan(&sessionID); err == nil {
+			sessionIDs = append(sessionIDs, sessionID)
+		}
+	}
+	rows.Close()
+
+	cancelled := 0
+	for _, sessionID := range sessionIDs {
+		if err := app.cancelClassSession(sessionID, "The class is no longer scheduled", claims.UserID); err != nil {
+			log.Printf("classes: failed to cancel session %d of schedule %d: %v", sessionID, scheduleID, err)
+			continue
+		}
+		cancelled++
+	}
+
+	sendSuccessResponse(w, "Class schedule ended successfully", map[string]interface{}{
+		"status":             "OK",
+		"id":                 scheduleID,
+		"sessions_cancelled": cancelled,
+	})
+}
+
+// List the class sessions of a gym, by default the next 7 days
+func (app *App) getGymClassSessions(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from := time.Now()
+	to := from.AddDate(0, 0, 6)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return
+	}
+
+	classTypeID := 0
+	if classTypeIDStr := r.URL.Query().Get("class_type_id"); classTypeIDStr != "" {
+		classTypeID, err = strconv.Atoi(classTypeIDStr)
+		if err != nil || classTypeID <= 0 {
+			sendErrorResponse(w, "Invalid class_type_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(classSessionQuery+` WHERE cs.gym_id = $1
+	                                                AND cs.starts_at::date BETWEEN $2 AND $3
+	                                                AND ($4 = 0 OR cs.class_type_id = $4)`+
+		classSessionGroupBy+` ORDER BY cs.starts_at, ct.name`,
+		gymID, from.Format("2006-01-02"), to.Format("2006-01-02"), classTypeID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch class sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var sessions []ClassSession
+	for rows.Next() {
+		var session ClassSession
+		if err := scanClassSession(rows, &session); err != nil {
+			sendErrorResponse(w, "Failed to scan class session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sessions = append(sessions, session)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no sessions found, return empty array instead of null
+	if sessions == nil {
+		sessions = []ClassSession{}
+	}
+
+	sendSuccessResponse(w, "Class sessions retrieved successfully", sessions)
+}
+
+// Get a class session with its bookings and waitlist
+func (app *App) getGymClassSession(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	sessionID, err := strconv.Atoi(vars["session_id"])
+	if err != nil || sessionID <= 0 {
+		sendErrorResponse(w, "Invalid session_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	session, err := app.loadClassSession(sessionID, true)
+	if err == sql.ErrNoRows || (err == nil && session.GymID != gymID) {
+		sendErrorResponse(w, "Class not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch class: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Class retrieved successfully", session)
+}
+
+// Cancel a single class session, notifying the clients booked or waitlisted
+func (app *App) cancelGymClassSession(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	sessionID, err := strconv.Atoi(vars["session_id"])
+	if err != nil || sessionID <= 0 {
+		sendErrorResponse(w, "Invalid session_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CancelClassSessionRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	if len(req.Reason) > 256 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "reason", Message: "reason cannot exceed 256 characters"}})
+		return
+	}
+
+	// Check if user has permission for the session's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN class_sessions cs ON cs.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND cs.id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, sessionID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Class not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	err = app.cancelClassSession(sessionID, strings.TrimSpace(req.Reason), claims.UserID)
+	if err != nil {
+		if result, ok := err.(classResultError); ok {
+			sendErrorResponse(w, string(result), http.StatusBadRequest)
+			return
+		}
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	session, err := app.loadClassSession(sessionID, true)
+	if err != nil {
+		sendSuccessResponse(w, "Class cancelled successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     sessionID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Class cancelled successfully", session)
+}
+
+// classResultError is an 'ERROR - ...' result of a class routine
+type classResultError string
+
+func (e classResultError) Error() string { return string(e) }
+
+// cancelClassSession cancels a session and its bookings and notifies the clients
+// who held a place or were waiting for one
+func (app *App) cancelClassSession(sessionID int, reason string, userID int) error {
+	rows, err := app.DB.Query(`SELECT id FROM class_bookings
+	                           WHERE session_id = $1 AND status IN ('booked', 'waitlisted')`, sessionID)
+	if err != nil {
+		return err
+	}
+	var bookingIDs []int
+	for rows.Next() {
+		var bookingID int
+		if err := rows.Scan(&bookingID); err == nil {
+			bookingIDs = append(bookingIDs, bookingID)
+		}
+	}
+	rows.Close()
+
+	var result string
+	err = app.DB.QueryRow("SELECT cancel_class_session($1, $2, $3)", sessionID, nullIfEmpty(reason), userID).Scan(&result)
+	if err != nil {
+		return err
+	}
+	if result != "OK" {
+		return classResultError(result)
+	}
+
+	for _, bookingID := range bookingIDs {
+		app.notifyClass(bookingID, "class_cancelled", reason)
+	}
+	return nil
+}
+
+// generateClassSessions materializes upcoming sessions of scheduleID, or of every
+// active schedule when it is 0; failures are only logged
+func (app *App) generateClassSessions(scheduleID int) {
+	var count int
+	err := app.DB.QueryRow("SELECT generate_class_sessions($1, $2)", app.Config.ClassScheduleDays,
+		nullIfZero(scheduleID)).Scan(&count)
+	if err != nil {
+		log.Printf("classes: failed to generate class sessions: %v", err)
+		return
+	}
+	if count > 0 && scheduleID == 0 {
+		log.Printf("membership job: %d class session(s) generated", count)
+	}
+}
+
+// loadClassSession reads a session, with its bookings when withBookings is set;
+// the caller checks access to its gym
+func (app *App) loadClassSession(sessionID int, withBookings bool) (*ClassSession, error) {
+	var session ClassSession
+	err := scanClassSession(app.DB.QueryRow(classSessionQuery+" WHERE cs.id = $1"+classSessionGroupBy, sessionID), &session)
+	if err != nil {
+		return nil, err
+	}
+	if !withBookings {
+		return &session, nil
+	}
+
+	rows, err := app.DB.Query(classBookingQuery+` WHERE cb.session_id = $1
+	                                               ORDER BY CASE cb.status WHEN 'attended' THEN 0 WHEN 'booked' THEN 1
+	                                                                       WHEN 'waitlisted' THEN 2 ELSE 3 END,
+	                                                        cb.booked_on, cb.id`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	session.Bookings = []ClassBooking{}
+	for rows.Next() {
+		var booking ClassBooking
+		if err := scanClassBooking(rows, &booking); err != nil {
+			return nil, err
+		}
+		session.Bookings = append(session.Bookings, booking)
+	}
+
+	return &session, rows.Err()
+}
+
+// notifyClass sends a notification about a class booking to its client, with the
+// booking attached as an .ics file to emails; failures are only logged
+func (app *App) notifyClass(bookingID int, templateName, reason string) {
+	notice := ClassNotice{Reason: reason}
+	var clientID int
+	err := app.DB.QueryRow(`SELECT cb.client_id, COALESCE(c.name, ''), COALESCE(ct.name, ''), COALESCE(g.name, ''),
+	                               TO_CHAR(cs.starts_at, 'YYYY-MM-DD HH24:MI')
+	                        FROM class_bookings cb
+	                        INNER JOIN class_sessions cs ON cs.id = cb.session_id
+	                        LEFT JOIN clients c ON c.id = cb.client_id
+	                        LEFT JOIN class_types ct ON ct.id = cs.class_type_id
+	                        LEFT JOIN gyms g ON g.id = cs.gym_id
+	                        WHERE cb.id = $1`, bookingID).Scan(&clientID, &notice.ClientName, &notice.ClassName,
+		&notice.GymName, &notice.StartsAt)
+	if err != nil {
+		log.Printf("classes: failed to load booking %d for notification: %v", bookingID, err)
+		return
+	}
+
+	err = app.Notifier.NotifyClientWithAttachment(clientID, templateName, notice, app.classBookingICS(bookingID))
+	if err != nil && err != errNoContactChannel {
+		log.Printf("classes: failed to queue %s for client %d: %v", templateName, clientID, err)
+	}
+}
+
+// validateClassSchedule checks the request and fills in the defaults
+func validateClassSchedule(req *CreateClassScheduleRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	if req.ClassTypeID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "class_type_id", Message: "Valid class_type_id is required"})
+	}
+	if req.InstructorID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "instructor_id", Message: "Valid instructor_id is required"})
+	}
+	if req.Weekday < 1 || req.Weekday > 7 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "weekday", Message: "weekday must be between 1 (Monday) and 7 (Sunday)"})
+	}
+	if _, err := time.Parse("15:04", req.StartTime); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "start_time", Message: "time must be in HH:MM format"})
+	}
+	if req.DurationMinutes != 0 && (req.DurationMinutes < 5 || req.DurationMinutes > 480) {
+		fieldErrs = append(fieldErrs, FieldError{Field: "duration_minutes", Message: "duration must be between 5 and 480 minutes"})
+	}
+	if len(req.Room) > 32 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "room", Message: "room cannot exceed 32 characters"})
+	}
+	if req.Capacity <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "capacity", Message: "capacity must be positive"})
+	}
+	if req.WaitlistCapacity == nil {
+		waitlist := 10
+		req.WaitlistCapacity = &waitlist
+	} else if *req.WaitlistCapacity < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "waitlist_capacity", Message: "waitlist_capacity cannot be negative"})
+	}
+
+	if req.ValidFrom == "" {
+		req.ValidFrom = time.Now().Format("2006-01-02")
+	}
+	validFrom, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "valid_from", Message: "date must be in YYYY-MM-DD format"})
+	}
+	if req.ValidTo != "" {
+		validTo, err := time.Parse("2006-01-02", req.ValidTo)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "date must be in YYYY-MM-DD format"})
+		} else if validTo.Before(validFrom) {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "valid_to cannot be before valid_from"})
+		}
+	}
+
+	return fieldErrs
+}
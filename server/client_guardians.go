@@ -0,0 +1,496 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// GuardianConsent is a guardian's recorded agreement for a minor client
+type GuardianConsent struct {
+	ID               int    `json:"id"`
+	GuardianClientID int    `json:"guardian_client_id"`
+	ConsentDate      string `json:"consent_date"`
+	DocumentRef      string `json:"document_ref"`
+	Notes            string `json:"notes"`
+	CreatedOn        string `json:"created_on"`
+	CreatedBy        int    `json:"created_by"`
+}
+
+// ClientGuardianInfo describes a client's guardian and whether a consent is on record
+type ClientGuardianInfo struct {
+	ClientID         int              `json:"client_id"`
+	Age              *int             `json:"age"`
+	IsMinor          bool             `json:"is_minor"`
+	GuardianClientID int              `json:"guardian_client_id,omitempty"`
+	GuardianName     string           `json:"guardian_name,omitempty"`
+	GuardianPhone    string           `json:"guardian_phone,omitempty"`
+	Consent          *GuardianConsent `json:"consent"`
+}
+
+type SetClientGuardianRequest struct {
+	GuardianClientID int `json:"guardian_client_id"`
+}
+
+type RecordGuardianConsentRequest struct {
+	ConsentDate string `json:"consent_date,omitempty"` // Format: "2006-01-02", defaults to today
+	DocumentRef string `json:"document_ref,omitempty"`
+	Notes       string `json:"notes,omitempty"`
+}
+
+type GymAgeRules struct {
+	GymID      int `json:"gym_id"`
+	MinAge     int `json:"min_age"`
+	ConsentAge int `json:"consent_age"`
+}
+
+// Get a client's guardian and the active consent
+func (app *App) getClientGuardian(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	info, err := app.loadClientGuardianInfo(clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch guardian: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Client guardian retrieved successfully", info)
+}
+
+// Link a guardian (an adult person client) to a client. Consents from a previous guardian are revoked.
+func (app *App) setClientGuardian(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req SetClientGuardianRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.GuardianClientID <= 0 {
+		sendErrorResponse(w, "guardian_client_id is required", http.StatusBadRequest)
+		return
+	}
+
+	// The user must have access to both the client and the guardian
+	var count int
+	permissionQuery := `SELECT COUNT(DISTINCT client_id) FROM user_clients WHERE user_id = $1 AND client_id IN ($2, $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID, req.GuardianClientID).Scan(&count)
+	if err != nil || count != 2 {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT set_client_guardian($1, $2, $3)", clientID, req.GuardianClientID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	info, err := app.loadClientGuardianInfo(clientID)
+	if err != nil {
+		sendSuccessResponse(w, "Client guardian set successfully", map[string]interface{}{
+			"status":             "OK",
+			"client_id":          clientID,
+			"guardian_client_id": req.GuardianClientID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Client guardian set successfully", info)
+}
+
+// Record the linked guardian's consent for a client
+func (app *App) recordGuardianConsent(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req RecordGuardianConsentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.ConsentDate == "" {
+		req.ConsentDate = time.Now().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", req.ConsentDate); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "consent_date", Message: "consent date must be in YYYY-MM-DD format"})
+	}
+	req.DocumentRef = strings.TrimSpace(req.DocumentRef)
+	if len(req.DocumentRef) > 64 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "document_ref", Message: "document reference cannot exceed 64 characters"})
+	}
+	req.Notes = strings.TrimSpace(req.Notes)
+	if len(req.Notes) > 256 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "notes", Message: "notes cannot exceed 256 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT record_guardian_consent($1, $2, $3, $4, $5)",
+		clientID, req.ConsentDate, nullIfEmpty(req.DocumentRef), nullIfEmpty(req.Notes), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	info, err := app.loadClientGuardianInfo(clientID)
+	if err != nil {
+		sendSuccessResponse(w, "Guardian consent recorded successfully", map[string]interface{}{
+			"status":    "OK",
+			"client_id": clientID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Guardian consent recorded successfully", info)
+}
+
+// Revoke the active guardian consent of a client
+func (app *App) revokeGuardianConsent(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	result, err := app.DB.Exec(`UPDATE client_guardian_consents
+	                            SET revoked_on = CURRENT_DATE, revoked_by = $2
+	                            WHERE client_id = $1 AND revoked_on IS NULL`, clientID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to revoke consent: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		sendErrorResponse(w, "Client has no active guardian consent", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Guardian consent revoked successfully", map[string]interface{}{
+		"status":    "OK",
+		"client_id": clientID,
+	})
+}
+
+// Get the age rules of a gym
+func (app *App) getGymAgeRules(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var rules GymAgeRules
+	query := `SELECT g.id, COALESCE(g.min_age, 0), COALESCE(g.consent_age, 18)
+	          FROM gyms g
+	          INNER JOIN user_gyms ug ON ug.gym_id = g.id
+	          WHERE g.id = $1 AND ug.user_id = $2`
+	err = app.DB.QueryRow(query, gymID, claims.UserID).Scan(&rules.GymID, &rules.MinAge, &rules.ConsentAge)
+	if err != nil {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	sendSuccessResponse(w, "Gym age rules retrieved successfully", rules)
+}
+
+// Update the minimum age and the guardian consent age of a gym
+func (app *App) updateGymAgeRules(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req GymAgeRules
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.MinAge < 0 || req.MinAge > 99 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "min_age", Message: "minimum age must be between 0 and 99"})
+	}
+	if req.ConsentAge < 0 || req.ConsentAge > 99 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "consent_age", Message: "consent age must be between 0 and 99"})
+	}
+	if req.ConsentAge < req.MinAge {
+		fieldErrs = append(fieldErrs, FieldError{Field: "consent_age", Message: "consent age cannot be lower than the minimum age"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	_, err = app.DB.Exec("UPDATE gyms SET min_age = $2, consent_age = $3 WHERE id = $1", gymID, req.MinAge, req.ConsentAge)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update gym age rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.GymID = gymID
+	sendSuccessResponse(w, "Gym age rules updated successfully", req)
+}
+
+// loadClientGuardianInfo reads the client's age, guardian and active consent
+func (app *App) loadClientGuardianInfo(clientID int) (*ClientGuardianInfo, error) {
+	info := &ClientGuardianInfo{ClientID: clientID}
+
+	var age sql.NullInt64
+	var guardianID sql.NullInt64
+	query := `SELECT DATE_PART('year', AGE(CURRENT_DATE, c.dob))::integer,
+	                 c.guardian_client_id,
+	                 COALESCE(g.name, ''), COALESCE(g.phone, '')
+	          FROM clients c
+	          LEFT JOIN clients g ON g.id = c.guardian_client_id
+	          WHERE c.id = $1`
+	err := app.DB.QueryRow(query, clientID).Scan(&age, &guardianID, &info.GuardianName, &info.GuardianPhone)
+	if err != nil {
+		return nil, err
+	}
+	if age.Valid {
+		years := int(age.Int64)
+		info.Age = &years
+		info.IsMinor = years < 18
+	}
+	if !guardianID.Valid {
+		return info, nil
+	}
+	info.GuardianClientID = int(guardianID.Int64)
+
+	var consent GuardianConsent
+	consentQuery := `SELECT id, guardian_client_id, TO_CHAR(consent_date, 'YYYY-MM-DD'),
+	                        COALESCE(document_ref, ''), COALESCE(notes, ''),
+	                        TO_CHAR(created_on, 'YYYY-MM-DD'), COALESCE(created_by, 0)
+	                 FROM client_guardian_consents
+	                 WHERE client_id = $1 AND guardian_client_id = $2 AND revoked_on IS NULL
+	                 ORDER BY id DESC
+	                 LIMIT 1`
+	err = app.DB.QueryRow(consentQuery, clientID, info.GuardianClientID).Scan(&consent.ID, &consent.GuardianClientID,
+		&consent.ConsentDate, &consent.DocumentRef, &consent.Notes, &consent.CreatedOn, &consent.CreatedBy)
+	if err == sql.ErrNoRows {
+		return info, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.Consent = &consent
+
+	return info, nil
+}
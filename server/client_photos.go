@@ -0,0 +1,378 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxPhotoSize         = 5 << 20 // 5 MB
+	thumbnailMaxSide     = 200
+	thumbnailJPEGQuality = 85
+
+	// Decoding allocates width x height pixels whatever the file size, so
+	// uploads declaring more than this are refused before they are decoded
+	maxImagePixels = 40_000_000
+)
+
+var errImageTooLarge = errors.New("image dimensions are too large")
+
+// Upload (or replace) a client's photo. Expects multipart/form-data with a "photo" file.
+func (app *App) uploadClientPhoto(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client and get the current photo keys
+	var oldPhotoKey, oldThumbnailKey string
+	permissionQuery := `SELECT COALESCE(c.photo_key, ''), COALESCE(c.thumbnail_key, '')
+	                    FROM clients c
+	                    INNER JOIN user_clients uc ON uc.client_id = c.id
+	                    WHERE c.id = $1 AND uc.user_id = $2`
+	err = app.DB.QueryRow(permissionQuery, clientID, claims.UserID).Scan(&oldPhotoKey, &oldThumbnailKey)
+	if err != nil {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoSize+1024)
+	file, _, err := r.FormFile("photo")
+	if err != nil {
+		sendErrorResponse(w, "A photo file (max 5 MB) is required in the 'photo' form field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPhotoSize+1))
+	if err != nil {
+		sendErrorResponse(w, "Failed to read photo", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxPhotoSize {
+		sendErrorResponse(w, "Photo cannot exceed 5 MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	img, format, err := decodeUploadedImage(data)
+	if err == errImageTooLarge {
+		sendErrorResponse(w, "Photo cannot exceed 40 megapixels", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Photo must be a JPEG, PNG or GIF image", http.StatusBadRequest)
+		return
+	}
+
+	var thumbnail bytes.Buffer
+	err = jpeg.Encode(&thumbnail, resizeToFit(img, thumbnailMaxSide), &jpeg.Options{Quality: thumbnailJPEGQuality})
+	if err != nil {
+		sendErrorResponse(w, "Failed to generate thumbnail", http.StatusInternalServerError)
+		return
+	}
+
+	// Each upload gets new keys; their version goes in the photo URLs
+	version := time.Now().UnixNano()
+	photoKey := fmt.Sprintf("clients/%d/photo-%d.%s", clientID, version, format)
+	thumbnailKey := fmt.Sprintf("clients/%d/thumbnail-%d.jpeg", clientID, version)
+
+	if err := app.Blobs.Put(photoKey, bytes.NewReader(data)); err != nil {
+		sendErrorResponse(w, "Failed to store photo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := app.Blobs.Put(thumbnailKey, &thumbnail); err != nil {
+		app.Blobs.Delete(photoKey)
+		sendErrorResponse(w, "Failed to store thumbnail: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = app.DB.Exec(`UPDATE clients
+	                      SET photo_key = $2, thumbnail_key = $3, updated_by = $4, updated_on = now()
+	                      WHERE id = $1`, clientID, photoKey, thumbnailKey, claims.UserID)
+	if err != nil {
+		app.Blobs.Delete(photoKey)
+		app.Blobs.Delete(thumbnailKey)
+		sendErrorResponse(w, "Failed to save photo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The previous photo is no longer referenced
+	if oldPhotoKey != "" {
+		app.Blobs.Delete(oldPhotoKey)
+	}
+	if oldThumbnailKey != "" {
+		app.Blobs.Delete(oldThumbnailKey)
+	}
+
+	sendSuccessResponse(w, "Client photo uploaded successfully", map[string]interface{}{
+		"status":        "OK",
+		"client_id":     clientID,
+		"photo_url":     clientPhotoURL(clientID, photoKey),
+		"thumbnail_url": clientThumbnailURL(clientID, thumbnailKey),
+	})
+}
+
+// Serve the client's full-size photo
+func (app *App) getClientPhoto(w http.ResponseWriter, r *http.Request) {
+	app.serveClientImage(w, r, "photo_key")
+}
+
+// Serve the client's photo thumbnail
+func (app *App) getClientPhotoThumbnail(w http.ResponseWriter, r *http.Request) {
+	app.serveClientImage(w, r, "thumbnail_key")
+}
+
+func (app *App) serveClientImage(w http.ResponseWriter, r *http.Request, column string) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// column is one of the two fixed names passed by the handlers above
+	var key string
+	query := `SELECT COALESCE(c.` + column + `, '')
+	          FROM clients c
+	          INNER JOIN user_clients uc ON uc.client_id = c.id
+	          WHERE c.id = $1 AND uc.user_id = $2`
+	err = app.DB.QueryRow(query, clientID, claims.UserID).Scan(&key)
+	if err != nil {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusNotFound)
+		return
+	}
+	if key == "" {
+		sendErrorResponse(w, "Client has no photo", http.StatusNotFound)
+		return
+	}
+
+	// Browsers revalidate every time, so a replaced or removed photo is never
+	// shown from cache; the key changes with every upload
+	etag := `"` + key + `"`
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	blob, err := app.Blobs.Get(key)
+	if err != nil {
+		sendErrorResponse(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		sendErrorResponse(w, "Failed to read photo", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// Remove the client's photo
+func (app *App) deleteClientPhoto(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var photoKey, thumbnailKey string
+	permissionQuery := `SELECT COALESCE(c.photo_key, ''), COALESCE(c.thumbnail_key, '')
+	                    FROM clients c
+	                    INNER JOIN user_clients uc ON uc.client_id = c.id
+	                    WHERE c.id = $1 AND uc.user_id = $2`
+	err = app.DB.QueryRow(permissionQuery, clientID, claims.UserID).Scan(&photoKey, &thumbnailKey)
+	if err != nil {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+	if photoKey == "" {
+		sendErrorResponse(w, "Client has no photo", http.StatusNotFound)
+		return
+	}
+
+	_, err = app.DB.Exec(`UPDATE clients
+	                      SET photo_key = NULL, thumbnail_key = NULL, updated_by = $2, updated_on = now()
+	                      WHERE id = $1`, clientID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to remove photo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	app.Blobs.Delete(photoKey)
+	if thumbnailKey != "" {
+		app.Blobs.Delete(thumbnailKey)
+	}
+
+	sendSuccessResponse(w, "Client photo removed successfully", map[string]interface{}{
+		"status":    "OK",
+		"client_id": clientID,
+	})
+}
+
+// clientPhotoURL returns the URL of the photo stored under key; the version in
+// the URL changes with every upload
+func clientPhotoURL(clientID int, key string) string {
+	return fmt.Sprintf("/api/clients/%d/photo?v=%s", clientID, imageVersion(key))
+}
+
+func clientThumbnailURL(clientID int, key string) string {
+	return fmt.Sprintf("/api/clients/%d/photo/thumbnail?v=%s", clientID, imageVersion(key))
+}
+
+// imageVersion extracts the upload version from a key like "clients/7/photo-1712345678.jpeg"
+func imageVersion(key string) string {
+	name := path.Base(key)
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return name[strings.LastIndex(name, "-")+1:]
+}
+
+// decodeUploadedImage decodes an uploaded JPEG, PNG or GIF after checking from
+// its header that it does not declare more than maxImagePixels
+func decodeUploadedImage(data []byte) (image.Image, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, "", errors.New("image has no pixels")
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, "", errImageTooLarge
+	}
+	return image.Decode(bytes.NewReader(data))
+}
+
+// resizeToFit downscales img so its longest side is at most maxSide, averaging
+// the source pixels covered by each destination pixel (box filter)
+func resizeToFit(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= maxSide && srcH <= maxSide {
+		return img
+	}
+
+	dstW, dstH := maxSide, maxSide
+	if srcW > srcH {
+		dstH = srcH * maxSide / srcW
+	} else {
+		dstW = srcW * maxSide / srcH
+	}
+	if dstW < 1 {
+		dstW = 1
+	}
+	if dstH < 1 {
+		dstH = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := bounds.Min.Y + (y+1)*srcH/dstH
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := bounds.Min.X + (x+1)*srcW/dstW
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					b += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
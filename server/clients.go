@@ -1,11 +1,14 @@
 package server
 
 import (
+	"GoGymRestApi/server/cnp"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +17,7 @@ import (
 // Client struct matching your database schema
 type Client struct {
 	ID              int    `json:"id"`
+	ClientType      string `json:"client_type"`
 	Name            string `json:"name"`
 	CIF             string `json:"cif"`
 	DOB             string `json:"dob"`
@@ -28,10 +32,39 @@ type Client struct {
 	Building        string `json:"building"`
 	Floor           string `json:"floor"`
 	Apartment       string `json:"apartment"`
+	Phone           string `json:"phone"`
+	Email           string `json:"email"`
+	PhotoURL        string `json:"photo_url,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
 	CreatedOn       string `json:"created_on"`
 	UpdatedOn       string `json:"updated_on"`
 	CreatedBy       int    `json:"created_by"`
 	UpdatedBy       int    `json:"updated_by"`
+
+	EmergencyContacts []EmergencyContact `json:"emergency_contacts,omitempty"`
+}
+
+const (
+	clientTypePerson  = "person"
+	clientTypeCompany = "company"
+	clientTypeGuest   = "guest" // walk-ins and guests, recorded without CIF or address
+
+	cuiKey = "753217532"
+)
+
+var (
+	cuiRegex = regexp.MustCompile(`^[0-9]{2,10}$`)
+
+	// Register letter (J companies, F sole traders, C cooperatives), county code 01-52, order number, year
+	tradeRegisterNoRegex = regexp.MustCompile(`^[JFC](0[1-9]|[1-4][0-9]|5[0-2])/[0-9]{1,6}/(19|20)[0-9]{2}$`)
+)
+
+// EmergencyContact is a person front desk staff can call for a client
+type EmergencyContact struct {
+	ID           int    `json:"id,omitempty"`
+	Name         string `json:"name"`
+	Relationship string `json:"relationship"`
+	Phone        string `json:"phone"`
 }
 
 func (app *App) getClients(w http.ResponseWriter, r *http.Request) {
@@ -55,16 +88,19 @@ func (app *App) getClients(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Query to get all clients
-	clientQuery := `SELECT c.id, c.name, c.cif, 
-                          TO_CHAR(c.dob, 'YYYY-MM-DD') as dob,
-                          c.trade_register_no, c.country_id, c.state_id, 
-                          c.city, c.street_name, c.street_no, c.building, 
-                          c.floor, c.apartment,
+	clientQuery := `SELECT c.id, COALESCE(c.client_type, 'person') as client_type, c.name, COALESCE(c.cif, '') as cif,
+                          COALESCE(TO_CHAR(c.dob, 'YYYY-MM-DD'), '') as dob,
+                          COALESCE(c.trade_register_no, '') as trade_register_no,
+                          COALESCE(c.country_id, 0) as country_id, COALESCE(c.state_id, 0) as state_id,
+                          COALESCE(c.city, '') as city, COALESCE(c.street_name, '') as street_name,
+                          COALESCE(c.street_no, '') as street_no, COALESCE(c.building, '') as building,
+                          COALESCE(c.floor, '') as floor, COALESCE(c.apartment, '') as apartment,
+                          COALESCE(c.phone, '') as phone, COALESCE(c.email, '') as email,
                           TO_CHAR(c.created_on, 'YYYY-MM-DD') as created_on,
                           TO_CHAR(c.updated_on, 'YYYY-MM-DD') as updated_on,
-                          c.created_by, c.updated_by, 
-                          (select q.name from countries q where q.id=c.country_id) country_name,
-                          (select q.name from states q where q.id=c.state_id) state_name
+                          COALESCE(c.created_by, 0) as created_by, COALESCE(c.updated_by, 0) as updated_by, 
+                          COALESCE((select q.name from countries q where q.id=c.country_id), '') country_name,
+                          COALESCE((select q.name from states q where q.id=c.state_id), '') state_name
                    FROM clients c
                    inner join user_clients uc on uc.client_id = c.id
                    where uc.user_id = $1
@@ -81,10 +117,11 @@ func (app *App) getClients(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var client Client
 		err := rows.Scan(
-			&client.ID, &client.Name, &client.CIF, &client.DOB,
+			&client.ID, &client.ClientType, &client.Name, &client.CIF, &client.DOB,
 			&client.TradeRegisterNo, &client.CountryID, &client.StateID,
 			&client.City, &client.StreetName, &client.StreetNo, &client.Building,
-			&client.Floor, &client.Apartment, &client.CreatedOn, &client.UpdatedOn,
+			&client.Floor, &client.Apartment, &client.Phone, &client.Email,
+			&client.CreatedOn, &client.UpdatedOn,
 			&client.CreatedBy, &client.UpdatedBy, &client.CountryName, &client.StateName)
 
 		if err != nil {
@@ -258,10 +295,11 @@ func (app *App) addUserToClientByPath(w http.ResponseWriter, r *http.Request) {
 }
 
 type CreateClientRequest struct {
+	ClientType      string `json:"client_type,omitempty"` // "person" (default) or "company"
 	Name            string `json:"name"`
-	CIF             string `json:"cif"`
-	DOB             string `json:"dob"` // Format: "2006-01-02"
-	TradeRegisterNo string `json:"trade_register_no"`
+	CIF             string `json:"cif"`               // CNP for persons, CUI for companies
+	DOB             string `json:"dob"`               // Format: "2006-01-02", required for persons
+	TradeRegisterNo string `json:"trade_register_no"` // Required for companies
 	CountryID       int    `json:"country_id"`
 	StateID         int    `json:"state_id"`
 	City            string `json:"city"`
@@ -270,6 +308,10 @@ type CreateClientRequest struct {
 	Building        string `json:"building,omitempty"`
 	Floor           string `json:"floor,omitempty"`
 	Apartment       string `json:"apartment,omitempty"`
+	Phone           string `json:"phone,omitempty"`
+	Email           string `json:"email,omitempty"`
+
+	EmergencyContacts []EmergencyContact `json:"emergency_contacts,omitempty"`
 }
 
 func (app *App) createClient(w http.ResponseWriter, r *http.Request) {
@@ -300,7 +342,7 @@ func (app *App) createClient(w http.ResponseWriter, r *http.Request) {
 
 	// Basic Go-level validation before calling PostgreSQL function
 	if err := validateCreateClientRequest(&req); err != nil {
-		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		sendRequestValidationError(w, err)
 		return
 	}
 
@@ -320,11 +362,12 @@ func (app *App) createClient(w http.ResponseWriter, r *http.Request) {
 
 	// Call the PostgreSQL function
 	var result string
-	query := "SELECT create_client($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)"
+	query := "SELECT create_client($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)"
 	err = tx.QueryRow(query,
-		claims.UserID, req.Name, req.CIF, req.DOB, req.TradeRegisterNo,
+		claims.UserID, req.Name, req.CIF, nullIfEmpty(req.DOB), nullIfEmpty(req.TradeRegisterNo),
 		req.CountryID, req.StateID, req.City, req.StreetName, req.StreetNo,
-		nullIfEmpty(req.Building), nullIfEmpty(req.Floor), nullIfEmpty(req.Apartment)).Scan(&result)
+		nullIfEmpty(req.Building), nullIfEmpty(req.Floor), nullIfEmpty(req.Apartment),
+		nullIfEmpty(req.Phone), nullIfEmpty(req.Email), req.ClientType).Scan(&result)
 
 	if err != nil {
 		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
@@ -338,6 +381,23 @@ func (app *App) createClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Store emergency contacts for the new client
+	if len(req.EmergencyContacts) > 0 {
+		var newClientID int
+		err = tx.QueryRow(`SELECT id FROM clients WHERE UPPER(cif) = UPPER($1) AND created_by = $2
+		                   ORDER BY id DESC LIMIT 1`, req.CIF, claims.UserID).Scan(&newClientID)
+		if err != nil {
+			sendErrorResponse(w, "Failed to fetch created client: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = replaceEmergencyContacts(tx, newClientID, req.EmergencyContacts, claims.UserID)
+		if err != nil {
+			sendErrorResponse(w, "Failed to save emergency contacts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
@@ -347,13 +407,15 @@ func (app *App) createClient(w http.ResponseWriter, r *http.Request) {
 
 	// Get the created client details
 	var client Client
-	clientQuery := `SELECT id, name, cif, 
-                          TO_CHAR(dob, 'YYYY-MM-DD') as dob,
-                          trade_register_no, country_id, state_id, 
+	clientQuery := `SELECT id, COALESCE(client_type, 'person') as client_type, name, cif, 
+                          COALESCE(TO_CHAR(dob, 'YYYY-MM-DD'), '') as dob,
+                          COALESCE(trade_register_no, '') as trade_register_no, country_id, state_id, 
                           city, street_name, street_no, 
                           COALESCE(building, '') as building, 
                           COALESCE(floor, '') as floor, 
                           COALESCE(apartment, '') as apartment,
+                          COALESCE(phone, '') as phone,
+                          COALESCE(email, '') as email,
                           TO_CHAR(created_on, 'YYYY-MM-DD') as created_on,
                           TO_CHAR(updated_on, 'YYYY-MM-DD') as updated_on,
                           created_by, updated_by
@@ -363,10 +425,11 @@ func (app *App) createClient(w http.ResponseWriter, r *http.Request) {
                    LIMIT 1`
 
 	err = app.DB.QueryRow(clientQuery, req.CIF, claims.UserID).Scan(
-		&client.ID, &client.Name, &client.CIF, &client.DOB,
+		&client.ID, &client.ClientType, &client.Name, &client.CIF, &client.DOB,
 		&client.TradeRegisterNo, &client.CountryID, &client.StateID,
 		&client.City, &client.StreetName, &client.StreetNo, &client.Building,
-		&client.Floor, &client.Apartment, &client.CreatedOn, &client.UpdatedOn,
+		&client.Floor, &client.Apartment, &client.Phone, &client.Email,
+		&client.CreatedOn, &client.UpdatedOn,
 		&client.CreatedBy, &client.UpdatedBy)
 
 	if err != nil {
@@ -379,6 +442,8 @@ func (app *App) createClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	client.EmergencyContacts, _ = app.loadEmergencyContacts(client.ID)
+
 	sendSuccessResponse(w, "Client created successfully", client)
 }
 
@@ -391,12 +456,6 @@ func validateCreateClientRequest(req *CreateClientRequest) error {
 	if strings.TrimSpace(req.CIF) == "" {
 		return fmt.Errorf("CIF is required")
 	}
-	if strings.TrimSpace(req.DOB) == "" {
-		return fmt.Errorf("date of birth is required")
-	}
-	if strings.TrimSpace(req.TradeRegisterNo) == "" {
-		return fmt.Errorf("trade register number is required")
-	}
 	if req.CountryID <= 0 {
 		return fmt.Errorf("valid country ID is required")
 	}
@@ -442,14 +501,174 @@ func validateCreateClientRequest(req *CreateClientRequest) error {
 		return fmt.Errorf("apartment cannot exceed 8 characters")
 	}
 
-	// Date format validation
-	if _, err := time.Parse("2006-01-02", req.DOB); err != nil {
-		return fmt.Errorf("date of birth must be in YYYY-MM-DD format")
+	// Type-specific identity fields
+	if req.ClientType == "" {
+		req.ClientType = clientTypePerson
+	}
+	req.CIF = strings.ToUpper(strings.TrimSpace(req.CIF))
+	req.TradeRegisterNo = strings.ToUpper(strings.TrimSpace(req.TradeRegisterNo))
+	var fieldErrs ValidationErrors
+	switch req.ClientType {
+	case clientTypePerson:
+		// The date of birth is taken from the CNP when missing
+		fieldErrs = append(fieldErrs, checkCNPBirthDate(req.CIF, &req.DOB)...)
+	case clientTypeCompany:
+		if err := validateCUI(req.CIF); err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "cif", Message: err.Error()})
+		}
+		if req.TradeRegisterNo == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: "trade_register_no", Message: "trade register number is required"})
+		}
+		if req.DOB != "" {
+			if _, err := time.Parse("2006-01-02", req.DOB); err != nil {
+				fieldErrs = append(fieldErrs, FieldError{Field: "dob", Message: "date of birth must be in YYYY-MM-DD format"})
+			}
+		}
+	default:
+		return ValidationErrors{{Field: "client_type", Message: "client type must be person or company"}}
+	}
+	if req.TradeRegisterNo != "" {
+		if err := validateTradeRegisterNo(req.TradeRegisterNo); err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "trade_register_no", Message: err.Error()})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		return fieldErrs
+	}
+
+	// Contact details are optional but must be valid when provided
+	req.Email = strings.TrimSpace(req.Email)
+	req.Phone = normalizePhone(req.Phone)
+	if err := validateContactDetails(req.Email, req.Phone); err != nil {
+		return err
+	}
+
+	return validateEmergencyContacts(req.EmergencyContacts)
+}
+
+// checkCNPBirthDate parses a person's CNP and cross-checks it against dob.
+// An empty dob is filled in with the birth date encoded in the CNP.
+func checkCNPBirthDate(code string, dob *string) ValidationErrors {
+	parsed, err := cnp.Parse(strings.TrimSpace(code))
+	if err != nil {
+		return ValidationErrors{{Field: "cif", Message: err.Error()}}
+	}
+
+	if strings.TrimSpace(*dob) == "" {
+		*dob = parsed.BirthDateString()
+		return nil
+	}
+
+	date, err := time.Parse("2006-01-02", *dob)
+	if err != nil {
+		return ValidationErrors{{Field: "dob", Message: "date of birth must be in YYYY-MM-DD format"}}
+	}
+	if !date.Equal(parsed.BirthDate) {
+		return ValidationErrors{{Field: "dob", Message: fmt.Sprintf(
+			"date of birth %s does not match the CNP, which encodes %s", *dob, parsed.BirthDateString())}}
+	}
+	return nil
+}
+
+// validateCUI checks a Romanian company fiscal code (CUI/CIF), with or without the RO prefix
+func validateCUI(cui string) error {
+	digits := strings.TrimPrefix(strings.ToUpper(strings.ReplaceAll(cui, " ", "")), "RO")
+	if !cuiRegex.MatchString(digits) {
+		return fmt.Errorf("CUI must contain between 2 and 10 digits")
+	}
+
+	// Weight the digits without the control digit, right-aligned, against 753217532
+	body := strings.Repeat("0", 10-len(digits)) + digits[:len(digits)-1]
+	sum := 0
+	for i := 0; i < len(cuiKey); i++ {
+		sum += int(body[i]-'0') * int(cuiKey[i]-'0')
+	}
+
+	control := sum * 10 % 11
+	if control == 10 {
+		control = 0
+	}
+	if control != int(digits[len(digits)-1]-'0') {
+		return fmt.Errorf("CUI has an invalid check digit")
+	}
+	return nil
+}
+
+// validateTradeRegisterNo checks the Trade Register number format, e.g. J40/123/2020
+func validateTradeRegisterNo(no string) error {
+	if !tradeRegisterNoRegex.MatchString(strings.ToUpper(strings.TrimSpace(no))) {
+		return fmt.Errorf("trade register number must have the format J40/123/2020")
+	}
+	return nil
+}
+
+// validateEmergencyContacts checks and normalizes a list of emergency contacts
+func validateEmergencyContacts(contacts []EmergencyContact) error {
+	if len(contacts) > 3 {
+		return fmt.Errorf("at most 3 emergency contacts can be provided")
 	}
+	for i := range contacts {
+		contacts[i].Name = strings.TrimSpace(contacts[i].Name)
+		contacts[i].Relationship = strings.TrimSpace(contacts[i].Relationship)
+		contacts[i].Phone = normalizePhone(contacts[i].Phone)
 
+		if contacts[i].Name == "" {
+			return fmt.Errorf("emergency contact name is required")
+		}
+		if len(contacts[i].Name) > 128 {
+			return fmt.Errorf("emergency contact name cannot exceed 128 characters")
+		}
+		if len(contacts[i].Relationship) > 32 {
+			return fmt.Errorf("emergency contact relationship cannot exceed 32 characters")
+		}
+		if contacts[i].Phone == "" {
+			return fmt.Errorf("emergency contact phone is required")
+		}
+		if !phoneRegex.MatchString(contacts[i].Phone) {
+			return fmt.Errorf("emergency contact phone must contain 8 to 15 digits, optionally prefixed by +")
+		}
+	}
 	return nil
 }
 
+// replaceEmergencyContacts swaps a client's emergency contacts for the given list
+func replaceEmergencyContacts(tx *sql.Tx, clientID int, contacts []EmergencyContact, userID int) error {
+	if _, err := tx.Exec("DELETE FROM client_emergency_contacts WHERE client_id = $1", clientID); err != nil {
+		return err
+	}
+	for _, contact := range contacts {
+		_, err := tx.Exec(`INSERT INTO client_emergency_contacts (client_id, name, relationship, phone, created_by)
+		                   VALUES ($1, $2, $3, $4, $5)`,
+			clientID, contact.Name, nullIfEmpty(contact.Relationship), contact.Phone, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadEmergencyContacts returns the emergency contacts of a client
+func (app *App) loadEmergencyContacts(clientID int) ([]EmergencyContact, error) {
+	rows, err := app.DB.Query(`SELECT id, name, COALESCE(relationship, ''), phone
+	                           FROM client_emergency_contacts
+	                           WHERE client_id = $1
+	                           ORDER BY id`, clientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := []EmergencyContact{}
+	for rows.Next() {
+		var contact EmergencyContact
+		if err := rows.Scan(&contact.ID, &contact.Name, &contact.Relationship, &contact.Phone); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
 // nullIfEmpty returns nil if string is empty, otherwise returns the string
 func nullIfEmpty(s string) interface{} {
 	if strings.TrimSpace(s) == "" {
@@ -458,11 +677,22 @@ func nullIfEmpty(s string) interface{} {
 	return s
 }
 
+// nullIfZero returns nil for a zero id, otherwise returns the id
+func nullIfZero(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
 // Add these structs to your existing code
 type AddClientMembershipRequest struct {
 	ClientID     int    `json:"client_id"`
 	MembershipID int    `json:"membership_id"`
-	ValidFrom    string `json:"valid_from"` // Expected format: "2024-01-15" (YYYY-MM-DD)
+	ValidFrom    string `json:"valid_from"`       // Expected format: "2024-01-15" (YYYY-MM-DD)
+	GymID        int    `json:"gym_id,omitempty"` // Gym whose price list applies; default prices when omitted
+	AutoRenew    bool   `json:"auto_renew,omitempty"`
+	PromoCode    string `json:"promo_code,omitempty"` // Discount taken off the sale invoice
 }
 
 type ClientMembership struct {
@@ -476,6 +706,36 @@ type ClientMembership struct {
 	UpdatedBy    int    `json:"updated_by"`
 	CreatedOn    string `json:"created_on"`
 	UpdatedOn    string `json:"updated_on"`
+
+	// Entries left on entries/hybrid plans, null for time plans
+	RemainingEntries *int `json:"remaining_entries"`
+
+	// Automatic renewal; renewals point to the period they continue
+	AutoRenew     bool   `json:"auto_renew"`
+	RenewalGymID  *int   `json:"renewal_gym_id,omitempty"`
+	RenewedFromID *int   `json:"renewed_from_id,omitempty"`
+	DunningStatus string `json:"dunning_status,omitempty"`
+
+	// Date a cancellation takes effect; see the membership's cancellation for the refund
+	CanceledOn string `json:"canceled_on,omitempty"`
+
+	// Invoice issued on sale; memberships without a price are not invoiced
+	Invoice *Invoice `json:"invoice,omitempty"`
+
+	// Printable contract, set when the membership is sold
+	ContractURL string `json:"contract_url,omitempty"`
+}
+
+// GymAccess is the membership a check-in at a gym would use
+type GymAccess struct {
+	ClientMembershipID int    `json:"client_membership_id"`
+	MembershipName     string `json:"membership_name"`
+	PlanType           string `json:"plan_type"`
+	EndingOn           string `json:"ending_on"`
+	RemainingEntries   *int   `json:"remaining_entries"`
+
+	// Guest passes left on the memberships valid at the gym
+	RemainingGuestPasses int `json:"remaining_guest_passes"`
 }
 
 func (app *App) addClientMembership(w http.ResponseWriter, r *http.Request) {
@@ -553,6 +813,47 @@ func (app *App) addClientMembership(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Invoice the sale in the same transaction
+	result, err = invoiceNewClientMembership(tx, req.GymID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.PromoCode) != "" {
+		err = tx.QueryRow(`SELECT apply_promo_code(currval(pg_get_serial_sequence('client_memberships', 'id'))::integer, $1, $2)`,
+			req.PromoCode, claims.UserID).Scan(&result)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result != "OK" {
+			tx.Rollback()
+			sendErrorResponse(w, result, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Renewals use the same price list as the sale
+	if req.AutoRenew {
+		err = tx.QueryRow(`SELECT set_client_membership_auto_renew(currval(pg_get_serial_sequence('client_memberships', 'id'))::integer, true, $1, $2)`,
+			nullIfZero(req.GymID), claims.UserID).Scan(&result)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result != "OK" {
+			tx.Rollback()
+			sendErrorResponse(w, result, http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
@@ -567,7 +868,8 @@ func (app *App) addClientMembership(w http.ResponseWriter, r *http.Request) {
                              TO_CHAR(ending_on, 'YYYY-MM-DD') as ending_on,
                              status, created_by, updated_by,
                              TO_CHAR(created_on, 'YYYY-MM-DD HH24:MI:SS') as created_on,
-                             TO_CHAR(updated_on, 'YYYY-MM-DD HH24:MI:SS') as updated_on
+                             TO_CHAR(updated_on, 'YYYY-MM-DD HH24:MI:SS') as updated_on,
+                             remaining_entries, COALESCE(auto_renew, false), renewal_gym_id
                              FROM client_memberships 
                              WHERE client_id = $1 AND membership_id = $2 
                                AND starting_from = $3
@@ -578,7 +880,13 @@ func (app *App) addClientMembership(w http.ResponseWriter, r *http.Request) {
 		&clientMembership.ID, &clientMembership.ClientID, &clientMembership.MembershipID,
 		&clientMembership.StartingFrom, &clientMembership.EndingOn, &clientMembership.Status,
 		&clientMembership.CreatedBy, &clientMembership.UpdatedBy,
-		&clientMembership.CreatedOn, &clientMembership.UpdatedOn)
+		&clientMembership.CreatedOn, &clientMembership.UpdatedOn, &clientMembership.RemainingEntries,
+		&clientMembership.AutoRenew, &clientMembership.RenewalGymID)
+
+	if err == nil {
+		clientMembership.Invoice, err = app.loadMembershipInvoice(clientMembership.ID, claims.UserID)
+		clientMembership.ContractURL = membershipContractURL(req.ClientID, clientMembership.ID, req.GymID)
+	}
 
 	if err != nil {
 		// Client membership was created but couldn't fetch details
@@ -637,6 +945,16 @@ func (app *App) addClientMembershipByPath(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Optional gym whose price list applies
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Start a transaction
 	tx, err := app.DB.Begin()
 	if err != nil {
@@ -667,6 +985,18 @@ func (app *App) addClientMembershipByPath(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Invoice the sale in the same transaction
+	result, err = invoiceNewClientMembership(tx, gymID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
 	// Commit the transaction
 	err = tx.Commit()
 	if err != nil {
@@ -1150,6 +1480,13 @@ func (app *App) getClientGymStatus(w http.ResponseWriter, r *http.Request) {
                       ORDER BY id DESC 
                       LIMIT 1`
 
+	// Membership the next check-in would use (nil when access would be denied)
+	access, err := app.loadGymAccess(clientID, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch client memberships: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	err = app.DB.QueryRow(lastPassQuery, clientID, gymID).Scan(
 		&lastPass.ID, &lastPass.GymID, &lastPass.ClientID,
 		&lastPass.Action, &lastPass.CreatedBy, &lastPass.CreatedOn)
@@ -1161,15 +1498,16 @@ func (app *App) getClientGymStatus(w http.ResponseWriter, r *http.Request) {
 			"gym_id":        gymID,
 			"status":        "not_visited_today",
 			"last_action":   nil,
-			"can_check_in":  true,
+			"can_check_in":  access != nil,
 			"can_check_out": false,
+			"membership":    access,
 		})
 		return
 	}
 
 	// Determine current status based on last action
 	status := "checked_out"
-	canCheckIn := true
+	canCheckIn := access != nil
 	canCheckOut := false
 
 	if lastPass.Action == "in" {
@@ -1185,11 +1523,50 @@ func (app *App) getClientGymStatus(w http.ResponseWriter, r *http.Request) {
 		"last_action":   lastPass,
 		"can_check_in":  canCheckIn,
 		"can_check_out": canCheckOut,
+		"membership":    access,
 	})
 }
 
+// loadGymAccess returns the membership do_client_check_in_gym would use for the
+// client at this gym right now: time plans first, then the entry plan ending soonest.
+// Memberships outside their time windows are skipped.
+func (app *App) loadGymAccess(clientID, gymID int) (*GymAccess, error) {
+	var access GymAccess
+	query := `SELECT cm.id, COALESCE(m.name, ''), COALESCE(m.plan_type, 'time'),
+	                 TO_CHAR(cm.ending_on, 'YYYY-MM-DD'), cm.remaining_entries,
+	                 (SELECT COALESCE(SUM(g.remaining_guest_passes), 0)
+	                  FROM client_memberships g
+	                  INNER JOIN membership_gyms gg ON gg.membership_id = g.membership_id
+	                  WHERE g.client_id = $1 AND gg.gym_id = $2 AND g.status = 'active'
+	                    AND COALESCE(g.dunning_status, '') <> 'suspended'
+	                    AND gym_local_time($2)::date BETWEEN g.starting_from AND g.ending_on)
+	          FROM client_memberships cm
+	          INNER JOIN membership_gyms mg ON mg.membership_id = cm.membership_id
+	          INNER JOIN memberships m ON m.id = cm.membership_id
+	          WHERE cm.client_id = $1
+	            AND mg.gym_id = $2
+	            AND gym_local_time($2)::date BETWEEN cm.starting_from AND cm.ending_on
+	            AND cm.status = 'active'
+	            AND COALESCE(cm.dunning_status, '') <> 'suspended'
+	            AND m.is_active = true
+	            AND (cm.remaining_entries IS NULL OR cm.remaining_entries > 0)
+	            AND membership_window_open(cm.membership_id, gym_local_time($2))
+	          ORDER BY cm.remaining_entries IS NOT NULL, cm.ending_on, cm.id
+	          LIMIT 1`
+	err := app.DB.QueryRow(query, clientID, gymID).Scan(&access.ClientMembershipID, &access.MembershipName,
+		&access.PlanType, &access.EndingOn, &access.RemainingEntries, &access.RemainingGuestPasses)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &access, nil
+}
+
 // Update Client Request struct
 type UpdateClientRequest struct {
+	ClientType      string `json:"client_type,omitempty"` // Changing the type requires the matching CIF
 	Name            string `json:"name,omitempty"`
 	CIF             string `json:"cif,omitempty"`
 	DOB             string `json:"dob,omitempty"` // Format: "2006-01-02"
@@ -1202,6 +1579,11 @@ type UpdateClientRequest struct {
 	Building        string `json:"building,omitempty"`
 	Floor           string `json:"floor,omitempty"`
 	Apartment       string `json:"apartment,omitempty"`
+	Phone           string `json:"phone,omitempty"`
+	Email           string `json:"email,omitempty"`
+
+	// When present, replaces the client's emergency contacts (an empty list removes them)
+	EmergencyContacts *[]EmergencyContact `json:"emergency_contacts,omitempty"`
 }
 
 // Update Client function
@@ -1250,9 +1632,39 @@ func (app *App) updateClient(w http.ResponseWriter, r *http.Request) {
 
 	// Validate update request
 	if err := validateUpdateClientRequest(&req); err != nil {
-		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		sendRequestValidationError(w, err)
+		return
+	}
+
+	// Identity fields are checked against the client's (possibly new) type
+	var storedType, storedCIF string
+	err = app.DB.QueryRow("SELECT COALESCE(client_type, 'person'), COALESCE(cif, '') FROM clients WHERE id = $1",
+		clientID).Scan(&storedType, &storedCIF)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch client: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	clientType := req.ClientType
+	if clientType == "" {
+		clientType = storedType
+	}
+	switch {
+	case clientType == clientTypeCompany && req.CIF != "":
+		if err := validateCUI(req.CIF); err != nil {
+			sendValidationErrorResponse(w, ValidationErrors{{Field: "cif", Message: err.Error()}})
+			return
+		}
+	case clientType == clientTypePerson && (req.CIF != "" || req.DOB != ""):
+		// A new CNP re-derives the date of birth; a new date of birth must match the CNP
+		cnpCode := req.CIF
+		if cnpCode == "" {
+			cnpCode = storedCIF
+		}
+		if fieldErrs := checkCNPBirthDate(cnpCode, &req.DOB); len(fieldErrs) > 0 {
+			sendValidationErrorResponse(w, fieldErrs)
+			return
+		}
+	}
 
 	// Start transaction
 	tx, err := app.DB.Begin()
@@ -1271,6 +1683,11 @@ func (app *App) updateClient(w http.ResponseWriter, r *http.Request) {
 	args := make([]interface{}, 0)
 	argIndex := 1
 
+	if req.ClientType != "" {
+		updateFields = append(updateFields, "client_type = $"+strconv.Itoa(argIndex))
+		args = append(args, req.ClientType)
+		argIndex++
+	}
 	if req.Name != "" {
 		updateFields = append(updateFields, "name = $"+strconv.Itoa(argIndex))
 		args = append(args, req.Name)
@@ -1353,6 +1770,16 @@ func (app *App) updateClient(w http.ResponseWriter, r *http.Request) {
 		args = append(args, nullIfEmpty(req.Apartment))
 		argIndex++
 	}
+	if req.Phone != "" {
+		updateFields = append(updateFields, "phone = $"+strconv.Itoa(argIndex))
+		args = append(args, req.Phone)
+		argIndex++
+	}
+	if req.Email != "" {
+		updateFields = append(updateFields, "email = $"+strconv.Itoa(argIndex))
+		args = append(args, strings.ToLower(req.Email))
+		argIndex++
+	}
 
 	// Always update updated_by
 	updateFields = append(updateFields, "updated_by = $"+strconv.Itoa(argIndex))
@@ -1377,6 +1804,14 @@ func (app *App) updateClient(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if req.EmergencyContacts != nil {
+		err = replaceEmergencyContacts(tx, clientID, *req.EmergencyContacts, claims.UserID)
+		if err != nil {
+			sendErrorResponse(w, "Failed to save emergency contacts: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Commit transaction
 	err = tx.Commit()
 	if err != nil {
@@ -1386,24 +1821,29 @@ func (app *App) updateClient(w http.ResponseWriter, r *http.Request) {
 
 	// Get updated client details
 	var client Client
-	clientQuery := `SELECT c.id, c.name, c.cif, 
-                          TO_CHAR(c.dob, 'YYYY-MM-DD') as dob,
-                          c.trade_register_no, c.country_id, c.state_id, 
-                          c.city, c.street_name, c.street_no, 
+	clientQuery := `SELECT c.id, COALESCE(c.client_type, 'person') as client_type, c.name, COALESCE(c.cif, '') as cif,
+                          COALESCE(TO_CHAR(c.dob, 'YYYY-MM-DD'), '') as dob,
+                          COALESCE(c.trade_register_no, '') as trade_register_no,
+                          COALESCE(c.country_id, 0) as country_id, COALESCE(c.state_id, 0) as state_id,
+                          COALESCE(c.city, '') as city, COALESCE(c.street_name, '') as street_name,
+                          COALESCE(c.street_no, '') as street_no,
                           COALESCE(c.building, '') as building, 
                           COALESCE(c.floor, '') as floor, 
                           COALESCE(c.apartment, '') as apartment,
+                          COALESCE(c.phone, '') as phone,
+                          COALESCE(c.email, '') as email,
                           TO_CHAR(c.created_on, 'YYYY-MM-DD') as created_on,
                           TO_CHAR(c.updated_on, 'YYYY-MM-DD') as updated_on,
-                          c.created_by, c.updated_by
+                          COALESCE(c.created_by, 0) as created_by, COALESCE(c.updated_by, 0) as updated_by
                    FROM clients c
                    WHERE c.id = $1`
 
 	err = app.DB.QueryRow(clientQuery, clientID).Scan(
-		&client.ID, &client.Name, &client.CIF, &client.DOB,
+		&client.ID, &client.ClientType, &client.Name, &client.CIF, &client.DOB,
 		&client.TradeRegisterNo, &client.CountryID, &client.StateID,
 		&client.City, &client.StreetName, &client.StreetNo, &client.Building,
-		&client.Floor, &client.Apartment, &client.CreatedOn, &client.UpdatedOn,
+		&client.Floor, &client.Apartment, &client.Phone, &client.Email,
+		&client.CreatedOn, &client.UpdatedOn,
 		&client.CreatedBy, &client.UpdatedBy)
 
 	if err != nil {
@@ -1414,6 +1854,8 @@ func (app *App) updateClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	client.EmergencyContacts, _ = app.loadEmergencyContacts(client.ID)
+
 	sendSuccessResponse(w, "Client updated successfully", client)
 }
 
@@ -1447,12 +1889,13 @@ func (app *App) deleteClient(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if user has permission to delete this client
-	var clientName string
+	var clientName, photoKey, thumbnailKey string
 	var exists bool
-	permissionQuery := `SELECT c.name, EXISTS(SELECT 1 FROM user_clients uc WHERE uc.user_id = $1 AND uc.client_id = $2)
+	permissionQuery := `SELECT c.name, COALESCE(c.photo_key, ''), COALESCE(c.thumbnail_key, ''),
+	                          EXISTS(SELECT 1 FROM user_clients uc WHERE uc.user_id = $1 AND uc.client_id = $2)
 	                   FROM clients c 
 	                   WHERE c.id = $2`
-	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&clientName, &exists)
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&clientName, &photoKey, &thumbnailKey, &exists)
 	if err != nil || !exists {
 		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
 		return
@@ -1489,6 +1932,23 @@ func (app *App) deleteClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check if client is a company with a corporate account
+	var hasCorporateAccount bool
+	err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM corporate_accounts WHERE company_client_id = $1)",
+		clientID).Scan(&hasCorporateAccount)
+	if err == nil && hasCorporateAccount {
+		sendErrorResponse(w, "Cannot delete client with a corporate account", http.StatusConflict)
+		return
+	}
+
+	// Invoices are accounting records and must keep their client
+	var hasInvoices bool
+	err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM invoices WHERE client_id = $1)", clientID).Scan(&hasInvoices)
+	if err == nil && hasInvoices {
+		sendErrorResponse(w, "Cannot delete client with invoices", http.StatusConflict)
+		return
+	}
+
 	// Start transaction
 	tx, err := app.DB.Begin()
 	if err != nil {
@@ -1510,6 +1970,14 @@ func (app *App) deleteClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Guests' visits stay on record but are no longer attributed to the deleted host
+	_, err = tx.Exec(`UPDATE client_passes SET host_client_id = NULL, client_membership_id = NULL
+	                  WHERE host_client_id = $1`, clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to detach guest passes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Delete client memberships
 	_, err = tx.Exec("DELETE FROM client_memberships WHERE client_id = $1", clientID)
 	if err != nil {
@@ -1517,6 +1985,46 @@ func (app *App) deleteClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Delete contact data
+	_, err = tx.Exec("DELETE FROM client_emergency_contacts WHERE client_id = $1", clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to delete emergency contacts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM client_contact_preferences WHERE client_id = $1", clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to delete contact preferences: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Delete guardian consents and unlink minors this client was guardian of
+	_, err = tx.Exec("DELETE FROM client_guardian_consents WHERE client_id = $1", clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to delete guardian consents: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec(`UPDATE client_guardian_consents SET revoked_on = CURRENT_DATE, revoked_by = $2
+	                  WHERE guardian_client_id = $1 AND revoked_on IS NULL`, clientID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to revoke guardian consents: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE clients SET guardian_client_id = NULL WHERE guardian_client_id = $1", clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to unlink guardian: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Delete corporate employee links
+	_, err = tx.Exec("DELETE FROM corporate_employees WHERE client_id = $1", clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to delete corporate employee links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Delete user-client relationships
 	_, err = tx.Exec("DELETE FROM user_clients WHERE client_id = $1", clientID)
 	if err != nil {
@@ -1545,6 +2053,14 @@ func (app *App) deleteClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Remove stored photos once the client is gone
+	if photoKey != "" {
+		app.Blobs.Delete(photoKey)
+	}
+	if thumbnailKey != "" {
+		app.Blobs.Delete(thumbnailKey)
+	}
+
 	sendSuccessResponse(w, "Client deleted successfully", map[string]interface{}{
 		"status":      "OK",
 		"client_id":   clientID,
@@ -1708,6 +2224,21 @@ func (app *App) removeClientMembership(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Invoiced memberships are kept for history; they are cancelled instead
+	var isInvoiced bool
+	invoicedQuery := `SELECT EXISTS(SELECT 1 FROM client_memberships cm
+	                                INNER JOIN invoice_lines il ON il.client_membership_id = cm.id
+	                                WHERE cm.client_id = $1 AND cm.membership_id = $2)`
+	err = app.DB.QueryRow(invoicedQuery, clientID, membershipID).Scan(&isInvoiced)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if isInvoiced {
+		sendErrorResponse(w, "Cannot remove an invoiced membership. Cancel it instead to keep its history.", http.StatusConflict)
+		return
+	}
+
 	// Remove client membership
 	result, err := app.DB.Exec("DELETE FROM client_memberships WHERE client_id = $1 AND membership_id = $2",
 		clientID, membershipID)
@@ -1815,6 +2346,20 @@ func validateUpdateClientRequest(req *UpdateClientRequest) error {
 	if req.TradeRegisterNo != "" && len(req.TradeRegisterNo) > 16 {
 		return fmt.Errorf("trade register number cannot exceed 16 characters")
 	}
+	if req.ClientType != "" {
+		if req.ClientType != clientTypePerson && req.ClientType != clientTypeCompany {
+			return fmt.Errorf("client type must be person or company")
+		}
+		if strings.TrimSpace(req.CIF) == "" {
+			return fmt.Errorf("CIF is required when changing the client type")
+		}
+	}
+	if req.TradeRegisterNo != "" {
+		req.TradeRegisterNo = strings.ToUpper(strings.TrimSpace(req.TradeRegisterNo))
+		if err := validateTradeRegisterNo(req.TradeRegisterNo); err != nil {
+			return err
+		}
+	}
 	if req.City != "" && len(req.City) > 64 {
 		return fmt.Errorf("city cannot exceed 64 characters")
 	}
@@ -1841,6 +2386,18 @@ func validateUpdateClientRequest(req *UpdateClientRequest) error {
 		}
 	}
 
+	// Contact details validation if provided
+	req.Email = strings.TrimSpace(req.Email)
+	req.Phone = normalizePhone(req.Phone)
+	if err := validateContactDetails(req.Email, req.Phone); err != nil {
+		return err
+	}
+	if req.EmergencyContacts != nil {
+		if err := validateEmergencyContacts(*req.EmergencyContacts); err != nil {
+			return err
+		}
+	}
+
 	// Required field validation (if provided, cannot be empty)
 	if req.Name == "" && req.Name != "" {
 		return fmt.Errorf("name cannot be empty")
@@ -1883,16 +2440,21 @@ func (app *App) getClientByID(w http.ResponseWriter, r *http.Request) {
 
 	// Get client details with country and state names
 	var client Client
-	clientQuery := `SELECT c.id, c.name, c.cif, 
-                          TO_CHAR(c.dob, 'YYYY-MM-DD') as dob,
-                          c.trade_register_no, c.country_id, c.state_id, 
-                          c.city, c.street_name, c.street_no, 
+	clientQuery := `SELECT c.id, COALESCE(c.client_type, 'person') as client_type, c.name, COALESCE(c.cif, '') as cif,
+                          COALESCE(TO_CHAR(c.dob, 'YYYY-MM-DD'), '') as dob,
+                          COALESCE(c.trade_register_no, '') as trade_register_no,
+                          COALESCE(c.country_id, 0) as country_id, COALESCE(c.state_id, 0) as state_id,
+                          COALESCE(c.city, '') as city, COALESCE(c.street_name, '') as street_name,
+                          COALESCE(c.street_no, '') as street_no,
                           COALESCE(c.building, '') as building, 
                           COALESCE(c.floor, '') as floor, 
                           COALESCE(c.apartment, '') as apartment,
+                          COALESCE(c.phone, '') as phone,
+                          COALESCE(c.email, '') as email,
+                          COALESCE(c.photo_key, '') as photo_key, COALESCE(c.thumbnail_key, '') as thumbnail_key,
                           TO_CHAR(c.created_on, 'YYYY-MM-DD') as created_on,
                           TO_CHAR(c.updated_on, 'YYYY-MM-DD') as updated_on,
-                          c.created_by, c.updated_by,
+                          COALESCE(c.created_by, 0) as created_by, COALESCE(c.updated_by, 0) as updated_by,
                           COALESCE(co.name, '') as country_name,
                           COALESCE(s.name, '') as state_name
                    FROM clients c
@@ -1901,11 +2463,13 @@ func (app *App) getClientByID(w http.ResponseWriter, r *http.Request) {
                    LEFT JOIN states s ON c.state_id = s.id
                    WHERE c.id = $1 AND uc.user_id = $2`
 
+	var photoKey, thumbnailKey string
 	err = app.DB.QueryRow(clientQuery, clientID, claims.UserID).Scan(
-		&client.ID, &client.Name, &client.CIF, &client.DOB,
+		&client.ID, &client.ClientType, &client.Name, &client.CIF, &client.DOB,
 		&client.TradeRegisterNo, &client.CountryID, &client.StateID,
 		&client.City, &client.StreetName, &client.StreetNo, &client.Building,
-		&client.Floor, &client.Apartment, &client.CreatedOn, &client.UpdatedOn,
+		&client.Floor, &client.Apartment, &client.Phone, &client.Email, &photoKey, &thumbnailKey,
+		&client.CreatedOn, &client.UpdatedOn,
 		&client.CreatedBy, &client.UpdatedBy, &client.CountryName, &client.StateName)
 
 	if err != nil {
@@ -1913,5 +2477,16 @@ func (app *App) getClientByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if photoKey != "" {
+		client.PhotoURL = clientPhotoURL(client.ID, photoKey)
+		client.ThumbnailURL = clientThumbnailURL(client.ID, thumbnailKey)
+	}
+
+	client.EmergencyContacts, err = app.loadEmergencyContacts(client.ID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch emergency contacts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	sendSuccessResponse(w, "Client retrieved successfully", client)
 }
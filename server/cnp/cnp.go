@@ -0,0 +1,182 @@
+// Package cnp parses and validates Romanian personal numeric codes (Cod Numeric Personal).
+//
+// A CNP has the layout S YY MM DD JJ NNN C:
+//
+//	S   sex and century (1/2: 1900-1999, 3/4: 1800-1899, 5/6: 2000-2099,
+//	    7/8: foreign residents, 9: foreigners)
+//	YY  year, MM month, DD day of birth
+//	JJ  county code (01-48, 51, 52, 70)
+//	NNN sequence number
+//	C   check digit
+package cnp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sex encoded by the first CNP digit
+type Sex string
+
+const (
+	Male    Sex = "M"
+	Female  Sex = "F"
+	Unknown Sex = "" // foreigners (S = 9) do not encode sex
+)
+
+var (
+	ErrLength      = errors.New("CNP must be exactly 13 digits")
+	ErrDigits      = errors.New("CNP must contain only digits")
+	ErrSexCentury  = errors.New("CNP has an invalid sex/century digit")
+	ErrBirthDate   = errors.New("CNP encodes an invalid birth date")
+	ErrFutureDate  = errors.New("CNP encodes a birth date in the future")
+	ErrCountyCode  = errors.New("CNP has an invalid county code")
+	ErrSequence    = errors.New("CNP has an invalid sequence number")
+	ErrCheckDigit  = errors.New("CNP has an invalid check digit")
+	checkDigitKeys = [12]int{2, 7, 9, 1, 4, 6, 3, 5, 8, 2, 7, 9}
+)
+
+// CNP is a parsed personal numeric code
+type CNP struct {
+	Code       string
+	Sex        Sex
+	Century    int // first year of the birth century, e.g. 1900
+	BirthDate  time.Time
+	CountyCode int
+	Sequence   int
+
+	// CenturyInferred is set for residents and foreigners (S = 7, 8, 9), whose
+	// CNP does not encode the century
+	CenturyInferred bool
+}
+
+// Parse validates a CNP and extracts the data encoded in it
+func Parse(code string) (CNP, error) {
+	return parseAt(code, time.Now())
+}
+
+func parseAt(code string, now time.Time) (CNP, error) {
+	if len(code) != 13 {
+		return CNP{}, ErrLength
+	}
+
+	var d [13]int
+	for i := 0; i < 13; i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return CNP{}, ErrDigits
+		}
+		d[i] = int(code[i] - '0')
+	}
+
+	c := CNP{Code: code}
+	switch d[0] {
+	case 1, 2:
+		c.Century = 1900
+	case 3, 4:
+		c.Century = 1800
+	case 5, 6:
+		c.Century = 2000
+	case 7, 8, 9:
+		c.CenturyInferred = true
+	default:
+		return CNP{}, ErrSexCentury
+	}
+	switch d[0] {
+	case 1, 3, 5, 7:
+		c.Sex = Male
+	case 2, 4, 6, 8:
+		c.Sex = Female
+	default:
+		c.Sex = Unknown
+	}
+
+	yy := d[1]*10 + d[2]
+	month := d[3]*10 + d[4]
+	day := d[5]*10 + d[6]
+
+	if c.CenturyInferred {
+		// Assume the most recent century that does not put the birth date in the future
+		c.Century = 2000
+		if time.Date(2000+yy, time.Month(month), day, 0, 0, 0, 0, time.UTC).After(now) {
+			c.Century = 1900
+		}
+	}
+
+	birthDate, ok := calendarDate(c.Century+yy, month, day)
+	if !ok {
+		return CNP{}, ErrBirthDate
+	}
+	if birthDate.After(now) {
+		return CNP{}, ErrFutureDate
+	}
+	c.BirthDate = birthDate
+
+	c.CountyCode = d[7]*10 + d[8]
+	if !validCounty(c.CountyCode) {
+		return CNP{}, ErrCountyCode
+	}
+
+	c.Sequence = d[9]*100 + d[10]*10 + d[11]
+	if c.Sequence == 0 {
+		return CNP{}, ErrSequence
+	}
+
+	sum := 0
+	for i, key := range checkDigitKeys {
+		sum += d[i] * key
+	}
+	check := sum % 11
+	if check == 10 {
+		check = 1
+	}
+	if check != d[12] {
+		return CNP{}, ErrCheckDigit
+	}
+
+	return c, nil
+}
+
+// BirthDateString returns the birth date in YYYY-MM-DD format
+func (c CNP) BirthDateString() string {
+	return c.BirthDate.Format("2006-01-02")
+}
+
+// Age returns the age in full years on the given date
+func (c CNP) Age(on time.Time) int {
+	age := on.Year() - c.BirthDate.Year()
+	if on.Month() < c.BirthDate.Month() ||
+		(on.Month() == c.BirthDate.Month() && on.Day() < c.BirthDate.Day()) {
+		age--
+	}
+	return age
+}
+
+func (c CNP) String() string {
+	return fmt.Sprintf("%s (%s, born %s, county %02d)", c.Code, c.Sex, c.BirthDateString(), c.CountyCode)
+}
+
+// calendarDate builds a date, rejecting days that do not exist (e.g. 31 April, 29 February 2001)
+func calendarDate(year, month, day int) (time.Time, bool) {
+	if month < 1 || month > 12 || day < 1 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// validCounty reports whether code is an assigned county code: 01-40 counties,
+// 41-46 Bucharest sectors (47, 48 for the former sectors 7 and 8), 51 Călărași,
+// 52 Giurgiu and 70 for codes issued regardless of county
+func validCounty(code int) bool {
+	switch {
+	case code >= 1 && code <= 48:
+		return true
+	case code == 51, code == 52, code == 70:
+		return true
+	}
+	return false
+}
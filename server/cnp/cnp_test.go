@@ -0,0 +1,92 @@
+package cnp
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// now is the reference date of the tests, so codes born "this year" stay stable
+var now = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestParseValid(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		sex      Sex
+		born     string
+		county   int
+		inferred bool
+	}{
+		{"man born in the 1900s", "1900101123457", Male, "1990-01-01", 12, false},
+		{"woman born in the 2000s", "6050315400019", Female, "2005-03-15", 40, false},
+		{"man born in the 1800s", "3850720220104", Male, "1885-07-20", 22, false},
+		{"check digit 10 is written as 1", "2850615120091", Female, "1985-06-15", 12, false},
+		{"resident born in 2001", "7010512401238", Male, "2001-05-12", 40, true},
+		{"resident born at the end of 1999", "8991231120125", Female, "1999-12-31", 12, true},
+		{"resident whose birthday this year is still ahead", "7261231010018", Male, "1926-12-31", 1, true},
+		{"foreigner born on 1 January 2000", "9000101700056", Unknown, "2000-01-01", 70, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := parseAt(tc.code, now)
+			if err != nil {
+				t.Fatalf("parseAt(%s): %v", tc.code, err)
+			}
+			if c.Sex != tc.sex {
+				t.Errorf("sex %q, expected %q", c.Sex, tc.sex)
+			}
+			if c.BirthDateString() != tc.born {
+				t.Errorf("born %s, expected %s", c.BirthDateString(), tc.born)
+			}
+			if c.CountyCode != tc.county {
+				t.Errorf("county %d, expected %d", c.CountyCode, tc.county)
+			}
+			if c.CenturyInferred != tc.inferred {
+				t.Errorf("century inferred %v, expected %v", c.CenturyInferred, tc.inferred)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		err  error
+	}{
+		{"too short", "190010112345", ErrLength},
+		{"too long", "19001011234570", ErrLength},
+		{"letters", "19001011234A7", ErrDigits},
+		{"sex/century digit 0", "0900101123457", ErrSexCentury},
+		{"wrong check digit", "1900101123456", ErrCheckDigit},
+		{"check digit 10 written as 0", "2850615120090", ErrCheckDigit},
+		{"born in the future", "5301231120013", ErrFutureDate},
+		{"29 February of a common year", "1010229123454", ErrBirthDate},
+		{"month 13", "1901301123450", ErrBirthDate},
+		{"county 49", "1900101491239", ErrCountyCode},
+		{"sequence 000", "1900101120005", ErrSequence},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseAt(tc.code, now); !errors.Is(err, tc.err) {
+				t.Errorf("parseAt(%s) = %v, expected %v", tc.code, err, tc.err)
+			}
+		})
+	}
+}
+
+func TestAge(t *testing.T) {
+	c, err := parseAt("6050315400019", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age := c.Age(time.Date(2023, 3, 14, 0, 0, 0, 0, time.UTC)); age != 17 {
+		t.Errorf("age the day before the 18th birthday is %d, expected 17", age)
+	}
+	if age := c.Age(time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)); age != 18 {
+		t.Errorf("age on the 18th birthday is %d, expected 18", age)
+	}
+}
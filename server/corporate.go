@@ -0,0 +1,721 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// CorporateAccount lets a company client pay memberships for its employees
+type CorporateAccount struct {
+	ID              int    `json:"id"`
+	CompanyClientID int    `json:"company_client_id"`
+	CompanyName     string `json:"company_name"`
+	CompanyCIF      string `json:"company_cif"`
+	ContactName     string `json:"contact_name"`
+	ContactEmail    string `json:"contact_email"`
+	Status          string `json:"status"`
+	Employees       int    `json:"employees"`
+	SeatsTotal      int    `json:"seats_total"`
+	SeatsUsed       int    `json:"seats_used"`
+	CreatedOn       string `json:"created_on"`
+}
+
+type CorporateEmployee struct {
+	ClientID   int    `json:"client_id"`
+	ClientName string `json:"client_name"`
+	EmployeeNo string `json:"employee_no"`
+	JoinedOn   string `json:"joined_on"`
+	LeftOn     string `json:"left_on,omitempty"`
+}
+
+// CorporateAllocation is a block of company-paid seats for one membership type
+type CorporateAllocation struct {
+	ID             int    `json:"id"`
+	MembershipID   int    `json:"membership_id"`
+	MembershipName string `json:"membership_name"`
+	Seats          int    `json:"seats"`
+	SeatsUsed      int    `json:"seats_used"`
+	ValidFrom      string `json:"valid_from"`
+	ValidTo        string `json:"valid_to,omitempty"`
+}
+
+type CorporateAccountDetails struct {
+	CorporateAccount
+	EmployeeList []CorporateEmployee   `json:"employee_list"`
+	Allocations  []CorporateAllocation `json:"allocations"`
+}
+
+type CreateCorporateAccountRequest struct {
+	CompanyClientID int    `json:"company_client_id"`
+	ContactName     string `json:"contact_name,omitempty"`
+	ContactEmail    string `json:"contact_email,omitempty"`
+}
+
+type AddCorporateEmployeeRequest struct {
+	ClientID   int    `json:"client_id"`
+	EmployeeNo string `json:"employee_no,omitempty"`
+}
+
+type CreateCorporateAllocationRequest struct {
+	MembershipID int    `json:"membership_id"`
+	Seats        int    `json:"seats"`
+	ValidFrom    string `json:"valid_from"`         // Format: "2006-01-02"
+	ValidTo      string `json:"valid_to,omitempty"` // Open-ended when empty
+}
+
+type AssignCorporateMembershipRequest struct {
+	ClientID  int    `json:"client_id"`
+	ValidFrom string `json:"valid_from,omitempty"` // Format: "2006-01-02", defaults to today
+}
+
+// Seats in use are active company-paid memberships that have not ended yet
+const corporateAccountQuery = `SELECT ca.id, ca.company_client_id, co.name, co.cif,
+                                      COALESCE(ca.contact_name, ''), COALESCE(ca.contact_email, ''), ca.status,
+                                      (SELECT COUNT(*) FROM corporate_employees ce
+                                       WHERE ce.corporate_account_id = ca.id AND ce.left_on IS NULL) as employees,
+                                      (SELECT COALESCE(SUM(al.seats), 0) FROM corporate_allocations al
+                                       WHERE al.corporate_account_id = ca.id
+                                         AND (al.valid_to IS NULL OR al.valid_to >= CURRENT_DATE)) as seats_total,
+                                      (SELECT COUNT(*) FROM client_memberships cm
+                                       INNER JOIN corporate_allocations al ON al.id = cm.corporate_allocation_id
+                                       WHERE al.corporate_account_id = ca.id
+                                         AND cm.status = 'active' AND cm.ending_on >= CURRENT_DATE) as seats_used,
+                                      TO_CHAR(ca.created_on, 'YYYY-MM-DD')
+                               FROM corporate_accounts ca
+                               INNER JOIN clients co ON co.id = ca.company_client_id
+                               INNER JOIN user_clients uc ON uc.client_id = ca.company_client_id
+                               WHERE uc.user_id = $1`
+
+func scanCorporateAccount(scanner interface{ Scan(...interface{}) error }, account *CorporateAccount) error {
+	return scanner.Scan(&account.ID, &account.CompanyClientID, &account.CompanyName, &account.CompanyCIF,
+		&account.ContactName, &account.ContactEmail, &account.Status, &account.Employees,
+		&account.SeatsTotal, &account.SeatsUsed, &account.CreatedOn)
+}
+
+// Open a corporate account for a company client
+func (app *App) createCorporateAccount(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreateCorporateAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.CompanyClientID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "company_client_id", Message: "company client is required"})
+	}
+	req.ContactName = strings.TrimSpace(req.ContactName)
+	if len(req.ContactName) > 128 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "contact_name", Message: "contact name cannot exceed 128 characters"})
+	}
+	req.ContactEmail = strings.TrimSpace(req.ContactEmail)
+	if err := validateContactDetails(req.ContactEmail, ""); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "contact_email", Message: err.Error()})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the company client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, req.CompanyClientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT create_corporate_account($1, $2, $3, $4)", req.CompanyClientID,
+		nullIfEmpty(req.ContactName), nullIfEmpty(req.ContactEmail), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	var account CorporateAccount
+	err = scanCorporateAccount(app.DB.QueryRow(corporateAccountQuery+" AND ca.company_client_id = $2",
+		claims.UserID, req.CompanyClientID), &account)
+	if err != nil {
+		sendSuccessResponse(w, "Corporate account created successfully", map[string]interface{}{
+			"status":            "OK",
+			"company_client_id": req.CompanyClientID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Corporate account created successfully", account)
+}
+
+// List the corporate accounts of the user's company clients
+func (app *App) getCorporateAccounts(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := app.DB.Query(corporateAccountQuery+" ORDER BY co.name", claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch corporate accounts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var accounts []CorporateAccount
+	for rows.Next() {
+		var account CorporateAccount
+		if err := scanCorporateAccount(rows, &account); err != nil {
+			sendErrorResponse(w, "Failed to scan corporate account: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		accounts = append(accounts, account)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no accounts found, return empty array instead of null
+	if accounts == nil {
+		accounts = []CorporateAccount{}
+	}
+
+	sendSuccessResponse(w, "Corporate accounts retrieved successfully", accounts)
+}
+
+// Corporate account details with its employees and seat allocations
+func (app *App) getCorporateAccountByID(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["account_id"])
+	if err != nil || accountID <= 0 {
+		sendErrorResponse(w, "Invalid account_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var details CorporateAccountDetails
+	err = scanCorporateAccount(app.DB.QueryRow(corporateAccountQuery+" AND ca.id = $2", claims.UserID, accountID),
+		&details.CorporateAccount)
+	if err != nil {
+		sendErrorResponse(w, "Corporate account not found or access denied", http.StatusNotFound)
+		return
+	}
+
+	employeeQuery := `SELECT ce.client_id, c.name, COALESCE(ce.employee_no, ''),
+	                         TO_CHAR(ce.joined_on, 'YYYY-MM-DD'), COALESCE(TO_CHAR(ce.left_on, 'YYYY-MM-DD'), '')
+	                  FROM corporate_employees ce
+	                  INNER JOIN clients c ON c.id = ce.client_id
+	                  WHERE ce.corporate_account_id = $1
+	                  ORDER BY ce.left_on IS NOT NULL, c.name`
+	rows, err := app.DB.Query(employeeQuery, accountID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch employees: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	details.EmployeeList = []CorporateEmployee{}
+	for rows.Next() {
+		var employee CorporateEmployee
+		err := rows.Scan(&employee.ClientID, &employee.ClientName, &employee.EmployeeNo,
+			&employee.JoinedOn, &employee.LeftOn)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan employee: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		details.EmployeeList = append(details.EmployeeList, employee)
+	}
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	allocationQuery := `SELECT al.id, al.membership_id, COALESCE(m.name, ''), al.seats,
+	                           (SELECT COUNT(*) FROM client_memberships cm
+	                            WHERE cm.corporate_allocation_id = al.id
+	                              AND cm.status = 'active' AND cm.ending_on >= CURRENT_DATE) as seats_used,
+	                           TO_CHAR(al.valid_from, 'YYYY-MM-DD'), COALESCE(TO_CHAR(al.valid_to, 'YYYY-MM-DD'), '')
+	                    FROM corporate_allocations al
+	                    LEFT JOIN memberships m ON m.id = al.membership_id
+	                    WHERE al.corporate_account_id = $1
+	                    ORDER BY al.valid_from DESC, al.id DESC`
+	allocationRows, err := app.DB.Query(allocationQuery, accountID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch allocations: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer allocationRows.Close()
+
+	details.Allocations = []CorporateAllocation{}
+	for allocationRows.Next() {
+		var allocation CorporateAllocation
+		err := allocationRows.Scan(&allocation.ID, &allocation.MembershipID, &allocation.MembershipName,
+			&allocation.Seats, &allocation.SeatsUsed, &allocation.ValidFrom, &allocation.ValidTo)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan allocation: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		details.Allocations = append(details.Allocations, allocation)
+	}
+	if err = allocationRows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Corporate account retrieved successfully", details)
+}
+
+// Add a person client as an employee of the company
+func (app *App) addCorporateEmployee(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["account_id"])
+	if err != nil || accountID <= 0 {
+		sendErrorResponse(w, "Invalid account_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req AddCorporateEmployeeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ClientID <= 0 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "client_id", Message: "client is required"}})
+		return
+	}
+	req.EmployeeNo = strings.TrimSpace(req.EmployeeNo)
+	if len(req.EmployeeNo) > 32 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "employee_no", Message: "employee number cannot exceed 32 characters"}})
+		return
+	}
+
+	// The user must have access to both the company and the employee
+	var count int
+	permissionQuery := `SELECT COUNT(DISTINCT uc.client_id)
+	                    FROM user_clients uc
+	                    WHERE uc.user_id = $1
+	                      AND uc.client_id IN ((SELECT company_client_id FROM corporate_accounts WHERE id = $2), $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, accountID, req.ClientID).Scan(&count)
+	if err != nil || count != 2 {
+		sendErrorResponse(w, "Corporate account or client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT add_corporate_employee($1, $2, $3, $4)",
+		accountID, req.ClientID, nullIfEmpty(req.EmployeeNo), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Employee added successfully", map[string]interface{}{
+		"status":     "OK",
+		"account_id": accountID,
+		"client_id":  req.ClientID,
+	})
+}
+
+// End an employee's link with the company; company-paid memberships are cancelled
+func (app *App) removeCorporateEmployee(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["account_id"])
+	if err != nil || accountID <= 0 {
+		sendErrorResponse(w, "Invalid account_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the company
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM corporate_accounts ca
+	                                  INNER JOIN user_clients uc ON uc.client_id = ca.company_client_id
+	                                  WHERE ca.id = $1 AND uc.user_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, accountID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Corporate account not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT remove_corporate_employee($1, $2, $3)", accountID, clientID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Employee removed successfully", map[string]interface{}{
+		"status":     "OK",
+		"account_id": accountID,
+		"client_id":  clientID,
+	})
+}
+
+// Reserve company-paid seats for a membership type
+func (app *App) createCorporateAllocation(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["account_id"])
+	if err != nil || accountID <= 0 {
+		sendErrorResponse(w, "Invalid account_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateCorporateAllocationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.MembershipID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "membership_id", Message: "membership is required"})
+	}
+	if req.Seats <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "seats", Message: "seats must be greater than 0"})
+	}
+	validFrom, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "valid_from", Message: "valid from must be in YYYY-MM-DD format"})
+	}
+	if req.ValidTo != "" {
+		validTo, err := time.Parse("2006-01-02", req.ValidTo)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "valid to must be in YYYY-MM-DD format"})
+		} else if validTo.Before(validFrom) {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "valid to cannot be before valid from"})
+		}
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the company
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM corporate_accounts ca
+	                                  INNER JOIN user_clients uc ON uc.client_id = ca.company_client_id
+	                                  WHERE ca.id = $1 AND uc.user_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, accountID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Corporate account not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT create_corporate_allocation($1, $2, $3, $4, $5, $6)", accountID, req.MembershipID,
+		req.Seats, req.ValidFrom, nullIfEmpty(req.ValidTo), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Corporate allocation created successfully", map[string]interface{}{
+		"status":        "OK",
+		"account_id":    accountID,
+		"membership_id": req.MembershipID,
+		"seats":         req.Seats,
+	})
+}
+
+// Give an employee a company-paid membership from an allocation
+func (app *App) assignCorporateMembership(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	allocationID, err := strconv.Atoi(vars["allocation_id"])
+	if err != nil || allocationID <= 0 {
+		sendErrorResponse(w, "Invalid allocation_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req AssignCorporateMembershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.ClientID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "client_id", Message: "client is required"})
+	}
+	if req.ValidFrom == "" {
+		req.ValidFrom = time.Now().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", req.ValidFrom); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "valid_from", Message: "valid from must be in YYYY-MM-DD format"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// The user must have access to both the company and the employee
+	var count int
+	permissionQuery := `SELECT COUNT(DISTINCT uc.client_id)
+	                    FROM user_clients uc
+	                    WHERE uc.user_id = $1
+	                      AND uc.client_id IN ((SELECT ca.company_client_id
+	                                            FROM corporate_allocations al
+	                                            INNER JOIN corporate_accounts ca ON ca.id = al.corporate_account_id
+	                                            WHERE al.id = $2), $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, allocationID, req.ClientID).Scan(&count)
+	if err != nil || count != 2 {
+		sendErrorResponse(w, "Allocation or client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT assign_corporate_membership($1, $2, $3, $4)",
+		allocationID, req.ClientID, req.ValidFrom, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Corporate membership assigned successfully", map[string]interface{}{
+		"status":        "OK",
+		"allocation_id": allocationID,
+		"client_id":     req.ClientID,
+		"valid_from":    req.ValidFrom,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	_ "github.com/lib/pq"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -22,6 +23,56 @@ type Config struct {
 	MaxOpenConns int
 	MaxIdleConns int
 	MaxLifetime  time.Duration
+
+	// Background membership jobs
+	MembershipJobInterval time.Duration
+	ReminderDays          int
+
+	// Automatic renewals
+	RenewalLeadDays  int
+	RenewalGraceDays int
+
+	// Free days a referrer gets when a referred client pays for a membership
+	ReferralRewardDays int
+
+	// Days ahead group class sessions are generated from the schedules
+	ClassScheduleDays int
+
+	// Notifications
+	NotifyEmailProvider   string
+	NotifySMSProvider     string
+	NotifyFilePath        string
+	NotifyDefaultLanguage string
+	NotifyMaxAttempts     int
+	NotifyOutboxInterval  time.Duration
+	SMTPHost              string
+	SMTPPort              string
+	SMTPUsername          string
+	SMTPPassword          string
+	SMTPFrom              string
+	SMSAPIURL             string
+	SMSAPIToken           string
+	SMSSender             string
+
+	// Blob storage (client photos)
+	BlobStoreDriver string
+	BlobStorePath   string
+
+	// Seller details printed on invoices and e-Factura exports
+	SellerName            string
+	SellerCUI             string
+	SellerTradeRegisterNo string
+	SellerStreet          string
+	SellerCity            string
+	SellerCounty          string
+	SellerCountry         string
+	SellerIBAN            string
+	SellerEmail           string
+	SellerPhone           string
+
+	// Public address of the API used in calendar feed links, e.g. https://api.gogym.ro;
+	// taken from the request when empty
+	PublicBaseURL string
 }
 
 func loadConfig() *Config {
@@ -32,6 +83,26 @@ func loadConfig() *Config {
 	maxIdleConns, _ := strconv.Atoi(getEnv("DB_MAX_IDLE_CONNS", "10"))
 	maxLifetimeStr := getEnv("DB_MAX_LIFETIME", "300s")
 	maxLifetime, _ := time.ParseDuration(maxLifetimeStr)
+	membershipJobInterval, err := time.ParseDuration(getEnv("MEMBERSHIP_JOB_INTERVAL", "1h"))
+	if err != nil || membershipJobInterval <= 0 {
+		membershipJobInterval = time.Hour
+	}
+	reminderDays, _ := strconv.Atoi(getEnv("MEMBERSHIP_REMINDER_DAYS", "7"))
+	renewalLeadDays, _ := strconv.Atoi(getEnv("RENEWAL_LEAD_DAYS", "3"))
+	renewalGraceDays, _ := strconv.Atoi(getEnv("RENEWAL_GRACE_DAYS", "7"))
+	referralRewardDays, err := strconv.Atoi(getEnv("REFERRAL_REWARD_DAYS", "7"))
+	if err != nil || referralRewardDays < 0 {
+		referralRewardDays = 7
+	}
+	classScheduleDays, err := strconv.Atoi(getEnv("CLASS_SCHEDULE_DAYS", "14"))
+	if err != nil || classScheduleDays < 0 {
+		classScheduleDays = 14
+	}
+	notifyMaxAttempts, _ := strconv.Atoi(getEnv("NOTIFY_MAX_ATTEMPTS", "5"))
+	notifyOutboxInterval, err := time.ParseDuration(getEnv("NOTIFY_OUTBOX_INTERVAL", "30s"))
+	if err != nil || notifyOutboxInterval <= 0 {
+		notifyOutboxInterval = 30 * time.Second
+	}
 
 	return &Config{
 		DBHost:       getEnv("DB_HOST", "postgres"),
@@ -44,6 +115,47 @@ func loadConfig() *Config {
 		MaxOpenConns: maxOpenConns,
 		MaxIdleConns: maxIdleConns,
 		MaxLifetime:  maxLifetime,
+
+		MembershipJobInterval: membershipJobInterval,
+		ReminderDays:          reminderDays,
+
+		RenewalLeadDays:  renewalLeadDays,
+		RenewalGraceDays: renewalGraceDays,
+
+		ReferralRewardDays: referralRewardDays,
+
+		ClassScheduleDays: classScheduleDays,
+
+		NotifyEmailProvider:   getEnv("NOTIFY_EMAIL_PROVIDER", "console"),
+		NotifySMSProvider:     getEnv("NOTIFY_SMS_PROVIDER", "console"),
+		NotifyFilePath:        getEnv("NOTIFY_FILE_PATH", "notifications.log"),
+		NotifyDefaultLanguage: getEnv("NOTIFY_DEFAULT_LANGUAGE", "ro"),
+		NotifyMaxAttempts:     notifyMaxAttempts,
+		NotifyOutboxInterval:  notifyOutboxInterval,
+		SMTPHost:              getEnv("SMTP_HOST", ""),
+		SMTPPort:              getEnv("SMTP_PORT", "587"),
+		SMTPUsername:          getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:          getEnv("SMTP_PASSWORD", ""),
+		SMTPFrom:              getEnv("SMTP_FROM", ""),
+		SMSAPIURL:             getEnv("SMS_API_URL", ""),
+		SMSAPIToken:           getEnv("SMS_API_TOKEN", ""),
+		SMSSender:             getEnv("SMS_SENDER", "GoGym"),
+
+		BlobStoreDriver: getEnv("BLOB_STORE_DRIVER", "local"),
+		BlobStorePath:   getEnv("BLOB_STORE_PATH", "data/blobs"),
+
+		SellerName:            getEnv("SELLER_NAME", ""),
+		SellerCUI:             getEnv("SELLER_CUI", ""),
+		SellerTradeRegisterNo: getEnv("SELLER_TRADE_REGISTER_NO", ""),
+		SellerStreet:          getEnv("SELLER_STREET", ""),
+		SellerCity:            getEnv("SELLER_CITY", ""),
+		SellerCounty:          getEnv("SELLER_COUNTY", ""),
+		SellerCountry:         getEnv("SELLER_COUNTRY", "RO"),
+		SellerIBAN:            getEnv("SELLER_IBAN", ""),
+		SellerEmail:           getEnv("SELLER_EMAIL", ""),
+		SellerPhone:           getEnv("SELLER_PHONE", ""),
+
+		PublicBaseURL: strings.TrimRight(getEnv("PUBLIC_BASE_URL", ""), "/"),
 	}
 }
 
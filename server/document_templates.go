@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// documentTemplate holds the printed labels and the default contract clauses for one language
+type documentTemplate struct {
+	Labels map[string]string
+	// Clauses is a text/template rendered with ContractData; paragraphs are separated by blank lines
+	Clauses string
+}
+
+// Document templates keyed by language code
+var documentTemplates = map[string]documentTemplate{
+	"ro": {
+		Labels: map[string]string{
+			"invoice":          "FACTURĂ",
+			"credit_note":      "FACTURĂ STORNO",
+			"credited_invoice": "Stornează factura",
+			"receipt":          "CHITANȚĂ",
+			"contract":         "CONTRACT DE ABONAMENT",
+			"number":           "Nr.",
+			"date":             "Data",
+			"due_date":         "Scadență",
+			"seller":           "Furnizor",
+			"buyer":            "Client",
+			"cui":              "CUI",
+			"cnp":              "CNP",
+			"trade_register":   "Nr. Reg. Com.",
+			"iban":             "IBAN",
+			"description":      "Denumire",
+			"quantity":         "Cant.",
+			"unit_price":       "Preț unitar",
+			"vat_rate":         "TVA %",
+			"net_amount":       "Valoare",
+			"vat_amount":       "TVA",
+			"total":            "Total de plată",
+			"paid":             "Achitat",
+			"balance":          "Rest de plată",
+			"received_from":    "Am primit de la",
+			"amount":           "suma de",
+			"for_invoice":      "reprezentând contravaloarea facturii",
+			"payment_method":   "Modalitate de plată",
+			"reference":        "Referință",
+			"cash":             "numerar",
+			"card":             "card",
+			"transfer":         "transfer bancar",
+			"credit":           "compensare cu factura storno",
+			"cashier":          "Casier",
+			"membership":       "Abonament",
+			"entries":          "Intrări incluse",
+			"guest_passes":     "Invitați",
+			"valid_from":       "Valabil de la",
+			"valid_to":         "până la",
+			"seller_sign":      "Furnizor",
+			"member_sign":      "Membru",
+			"page":             "Pagina",
+			"status_cancelled": "ANULATĂ",
+		},
+		Clauses: "1. Obiectul contractului: {{.SellerName}} oferă membrului {{.ClientName}} accesul " +
+			"la {{.GymName}} pe baza abonamentului {{.MembershipName}}, în perioada {{.StartingFrom}} - {{.EndingOn}}." +
+			"{{if .EntriesNo}} Abonamentul include {{.EntriesNo}} intrări.{{end}}" +
+			"{{if .GuestPassesNo}} Membrul poate aduce {{.GuestPassesNo}} invitați pe durata abonamentului.{{end}}\n\n" +
+			"2. Prețul: {{if .Price}}{{.Price}} {{.Currency}}, TVA inclus, achitat conform facturii {{.InvoiceNo}}." +
+			"{{else}}conform ofertei comerciale în vigoare la data semnării.{{end}}\n\n" +
+			"3. Obligațiile membrului: să respecte regulamentul intern, programul și capacitatea sălii, " +
+			"să folosească echipamentele conform instrucțiunilor și să prezinte abonamentul la intrare. " +
+			"Abonamentul este personal și nu poate fi cedat.\n\n" +
+			"4. Obligațiile furnizorului: să asigure accesul la spațiile și echipamentele incluse în abonament, " +
+			"în stare de funcționare, pe durata programului afișat.\n\n" +
+			"5. Starea de sănătate: membrul declară că nu are contraindicații medicale pentru efortul fizic " +
+			"și își asumă răspunderea pentru activitatea desfășurată.\n\n" +
+			"6. Date personale: datele membrului sunt prelucrate conform Regulamentului (UE) 2016/679, " +
+			"în scopul executării prezentului contract.\n\n" +
+			"7. Prezentul contract s-a încheiat în două exemplare, câte unul pentru fiecare parte.",
+	},
+	"en": {
+		Labels: map[string]string{
+			"invoice":          "INVOICE",
+			"credit_note":      "CREDIT NOTE",
+			"credited_invoice": "Reverses invoice",
+			"receipt":          "RECEIPT",
+			"contract":         "MEMBERSHIP CONTRACT",
+			"number":           "No.",
+			"date":             "Date",
+			"due_date":         "Due date",
+			"seller":           "Seller",
+			"buyer":            "Customer",
+			"cui":              "Tax ID",
+			"cnp":              "Personal ID",
+			"trade_register":   "Trade reg. no.",
+			"iban":             "IBAN",
+			"description":      "Description",
+			"quantity":         "Qty",
+			"unit_price":       "Unit price",
+			"vat_rate":         "VAT %",
+			"net_amount":       "Amount",
+			"vat_amount":       "VAT",
+			"total":            "Total due",
+			"paid":             "Paid",
+			"balance":          "Balance",
+			"received_from":    "Received from",
+			"amount":           "the amount of",
+			"for_invoice":      "in payment of invoice",
+			"payment_method":   "Payment method",
+			"reference":        "Reference",
+			"cash":             "cash",
+			"card":             "card",
+			"transfer":         "bank transfer",
+			"credit":           "offset by credit note",
+			"cashier":          "Cashier",
+			"membership":       "Membership",
+			"entries":          "Entries included",
+			"guest_passes":     "Guest passes",
+			"valid_from":       "Valid from",
+			"valid_to":         "to",
+			"seller_sign":      "Provider",
+			"member_sign":      "Member",
+			"page":             "Page",
+			"status_cancelled": "CANCELLED",
+		},
+		Clauses: "1. Subject: {{.SellerName}} grants {{.ClientName}} access to {{.GymName}} " +
+			"under the {{.MembershipName}} membership, from {{.StartingFrom}} to {{.EndingOn}}." +
+			"{{if .EntriesNo}} The membership includes {{.EntriesNo}} entries.{{end}}" +
+			"{{if .GuestPassesNo}} The member may bring {{.GuestPassesNo}} guests during the membership.{{end}}\n\n" +
+			"2. Price: {{if .Price}}{{.Price}} {{.Currency}}, VAT included, paid as per invoice {{.InvoiceNo}}." +
+			"{{else}}as per the price list in force on the signing date.{{end}}\n\n" +
+			"3. Member obligations: to follow the house rules, opening hours and capacity limits, " +
+			"to use the equipment as instructed and to show the membership at the entrance. " +
+			"The membership is personal and cannot be transferred.\n\n" +
+			"4. Provider obligations: to provide access to the facilities and equipment included " +
+			"in the membership, in working order, during the posted opening hours.\n\n" +
+			"5. Health: the member declares having no medical contraindication to physical exercise " +
+			"and takes responsibility for their training.\n\n" +
+			"6. Personal data: the member's data is processed under Regulation (EU) 2016/679 " +
+			"for the performance of this contract.\n\n" +
+			"7. This contract is signed in two copies, one for each party.",
+	},
+}
+
+// ContractData is the data available to contract clause templates
+type ContractData struct {
+	ContractNo     string
+	Date           string
+	GymName        string
+	SellerName     string
+	ClientName     string
+	ClientCIF      string
+	ClientAddress  string
+	MembershipName string
+	PlanType       string
+	StartingFrom   string
+	EndingOn       string
+	DaysNo         int
+	EntriesNo      int
+	GuestPassesNo  int
+	Price          string // total with VAT, empty when the membership is not invoiced
+	Currency       string
+	InvoiceNo      string
+}
+
+// documentLanguage returns lang if documents can be printed in it, otherwise Romanian
+func documentLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if _, ok := documentTemplates[lang]; ok {
+		return lang
+	}
+	return "ro"
+}
+
+// renderContractClauses renders the gym's own clauses when set, else the default ones of lang
+func renderContractClauses(customTerms, lang string, data ContractData) (string, error) {
+	clauses := customTerms
+	if strings.TrimSpace(clauses) == "" {
+		clauses = documentTemplates[documentLanguage(lang)].Clauses
+	}
+
+	tpl, err := template.New("contract").Option("missingkey=error").Parse(clauses)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// validateContractTerms checks that custom clauses parse and only use ContractData fields
+func validateContractTerms(terms string) error {
+	if len(terms) > 20000 {
+		return fmt.Errorf("contract terms cannot exceed 20000 characters")
+	}
+	sample := ContractData{ContractNo: "1", GymName: "Gym", SellerName: "Seller", ClientName: "Client",
+		MembershipName: "Plan", StartingFrom: "2025-01-01", EndingOn: "2025-01-31", DaysNo: 30,
+		Price: "100.00", Currency: "RON", InvoiceNo: "GYM-000001"}
+	if _, err := renderContractClauses(terms, "ro", sample); err != nil {
+		return fmt.Errorf("contract terms are not a valid template: %v", err)
+	}
+	return nil
+}
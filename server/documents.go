@@ -0,0 +1,704 @@
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"GoGymRestApi/server/efactura"
+	"GoGymRestApi/server/pdf"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// Page layout of generated documents, in points
+const (
+	docMargin       = 50.0
+	docContentWidth = pdf.A4Width - 2*docMargin
+	docBottom       = pdf.A4Height - 70
+	docLineHeight   = 13.0
+	docFontSize     = 10.0
+)
+
+// Download an invoice as PDF. Query params: lang (ro or en, default ro).
+func (app *App) getInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	invoiceID, err := strconv.Atoi(vars["invoice_id"])
+	if err != nil || invoiceID <= 0 {
+		sendErrorResponse(w, "Invalid invoice_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	invoice, err := app.loadInvoice(invoiceID, claims.UserID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Invoice not found or access denied", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The e-Factura model carries the buyer's full address
+	parties, err := app.loadEFacturaInvoice(invoiceID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lang := documentLanguage(r.URL.Query().Get("lang"))
+	labels := documentTemplates[lang].Labels
+	branding := app.brandingOrDefault(invoiceGym(invoice))
+	title := labels["invoice"]
+	meta := [][2]string{
+		{labels["number"], invoice.InvoiceNo},
+		{labels["date"], invoice.IssueDate},
+		{labels["due_date"], invoice.DueDate},
+	}
+	if invoice.InvoiceType == invoiceTypeCreditNote {
+		title = labels["credit_note"]
+		meta = append(meta, [2]string{labels["credited_invoice"], invoice.CreditedInvoiceNo})
+	}
+	doc := app.newDocumentRenderer(title+" "+invoice.InvoiceNo, branding, lang)
+
+	doc.heading(title, meta)
+	if invoice.Status == "cancelled" {
+		doc.stamp(labels["status_cancelled"])
+	}
+	doc.parties(labels["seller"], partyLines(parties.Seller, labels), labels["buyer"], partyLines(parties.Buyer, labels))
+
+	rows := make([][]string, len(invoice.Lines))
+	for i, line := range invoice.Lines {
+		rows[i] = []string{
+			strconv.Itoa(i + 1), line.Description, formatQuantity(line.Quantity), money(line.UnitPrice),
+			formatQuantity(line.VATRate), money(line.NetAmount), money(line.VATAmount),
+		}
+	}
+	doc.table([]docColumn{
+		{Label: "#", Width: 25},
+		{Label: labels["description"], Width: 180},
+		{Label: labels["quantity"], Width: 40, Right: true},
+		{Label: labels["unit_price"], Width: 65, Right: true},
+		{Label: labels["vat_rate"], Width: 45, Right: true},
+		{Label: labels["net_amount"], Width: 75, Right: true},
+		{Label: labels["vat_amount"], Width: docContentWidth - 430, Right: true},
+	}, rows)
+
+	totals := [][2]string{
+		{labels["net_amount"], money(invoice.NetAmount) + " " + invoice.Currency},
+		{labels["vat_amount"], money(invoice.VATAmount) + " " + invoice.Currency},
+		{labels["total"], money(invoice.TotalAmount) + " " + invoice.Currency},
+	}
+	if invoice.PaidAmount > 0 {
+		totals = append(totals,
+			[2]string{labels["paid"], money(invoice.PaidAmount) + " " + invoice.Currency},
+			[2]string{labels["balance"], money(invoice.Balance) + " " + invoice.Currency})
+	}
+	doc.totals(totals)
+
+	if app.Config.SellerIBAN != "" {
+		doc.paragraph(pdf.Helvetica, docFontSize, labels["iban"]+": "+app.Config.SellerIBAN)
+	}
+
+	app.sendPDF(w, doc, invoice.InvoiceNo)
+}
+
+// Download the receipt of a payment as PDF. Query params: lang (ro or en, default ro).
+func (app *App) getPaymentReceipt(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	invoiceID, err := strconv.Atoi(vars["invoice_id"])
+	if err != nil || invoiceID <= 0 {
+		sendErrorResponse(w, "Invalid invoice_id parameter", http.StatusBadRequest)
+		return
+	}
+	paymentID, err := strconv.Atoi(vars["payment_id"])
+	if err != nil || paymentID <= 0 {
+		sendErrorResponse(w, "Invalid payment_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	invoice, err := app.loadInvoice(invoiceID, claims.UserID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Invoice not found or access denied", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var payment *Payment
+	for i := range invoice.Payments {
+		if invoice.Payments[i].ID == paymentID {
+			payment = &invoice.Payments[i]
+		}
+	}
+	if payment == nil {
+		sendErrorResponse(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+	parties, err := app.loadEFacturaInvoice(invoiceID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lang := documentLanguage(r.URL.Query().Get("lang"))
+	labels := documentTemplates[lang].Labels
+	branding := app.brandingOrDefault(invoiceGym(invoice))
+	receiptNo := fmt.Sprintf("%s-R%06d", invoice.SeriesCode, payment.ID)
+	doc := app.newDocumentRenderer(labels["receipt"]+" "+receiptNo, branding, lang)
+
+	doc.heading(labels["receipt"], [][2]string{
+		{labels["number"], receiptNo},
+		{labels["date"], payment.PaidOn},
+	})
+	doc.parties(labels["seller"], partyLines(parties.Seller, labels), labels["buyer"], partyLines(parties.Buyer, labels))
+
+	doc.paragraph(pdf.Helvetica, 11, fmt.Sprintf("%s %s, %s %s %s, %s %s.",
+		labels["received_from"], invoice.ClientName, labels["amount"], money(payment.Amount), invoice.Currency,
+		labels["for_invoice"], invoice.InvoiceNo))
+	method := payment.Method
+	if label, ok := labels[method]; ok {
+		method = label
+	}
+	doc.paragraph(pdf.Helvetica, docFontSize, labels["payment_method"]+": "+method)
+	if payment.Reference != "" {
+		doc.paragraph(pdf.Helvetica, docFontSize, labels["reference"]+": "+payment.Reference)
+	}
+	doc.totals([][2]string{{labels["paid"], money(payment.Amount) + " " + invoice.Currency}})
+	doc.signatures(labels["cashier"], "")
+
+	app.sendPDF(w, doc, receiptNo)
+}
+
+// Download the contract of a client membership as PDF.
+// Query params: lang (ro or en, default ro), optional gym_id for the branding
+// (defaults to the gym on the membership's invoice, then to a gym offering the plan).
+func (app *App) getMembershipContract(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientMembershipID, err := strconv.Atoi(vars["client_membership_id"])
+	if err != nil || clientMembershipID <= 0 {
+		sendErrorResponse(w, "Invalid client_membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+		if err != nil || !exists {
+			sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	var data ContractData
+	var membershipID int
+	var clientType, streetName, streetNo, building, floor, apartment, city string
+	query := `SELECT TO_CHAR(COALESCE(cm.created_on, cm.starting_from), 'YYYY-MM-DD'),
+	                 TO_CHAR(cm.starting_from, 'YYYY-MM-DD'), COALESCE(TO_CHAR(cm.ending_on, 'YYYY-MM-DD'), ''),
+	                 m.id, m.name, COALESCE(m.plan_type, 'time'), COALESCE(m.days_no, 0),
+	                 COALESCE(m.entries_no, 0), COALESCE(m.guest_passes_no, 0),
+	                 c.name, COALESCE(c.client_type, 'person'), COALESCE(c.cif, ''),
+	                 COALESCE(c.street_name, ''), COALESCE(c.street_no, ''), COALESCE(c.building, ''),
+	                 COALESCE(c.floor, ''), COALESCE(c.apartment, ''), COALESCE(c.city, '')
+	          FROM client_memberships cm
+	          INNER JOIN memberships m ON m.id = cm.membership_id
+	          INNER JOIN clients c ON c.id = cm.client_id
+	          INNER JOIN user_clients uc ON uc.client_id = cm.client_id
+	          WHERE cm.id = $1 AND cm.client_id = $2 AND uc.user_id = $3`
+	err = app.DB.QueryRow(query, clientMembershipID, clientID, claims.UserID).Scan(&data.Date,
+		&data.StartingFrom, &data.EndingOn, &membershipID, &data.MembershipName, &data.PlanType, &data.DaysNo,
+		&data.EntriesNo, &data.GuestPassesNo, &data.ClientName, &clientType, &data.ClientCIF,
+		&streetName, &streetNo, &building, &floor, &apartment, &city)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch client membership: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.ContractNo = fmt.Sprintf("%06d", clientMembershipID)
+	data.SellerName = app.Config.SellerName
+	data.ClientAddress = formatStreet(streetName, streetNo, building, floor, apartment)
+	if city != "" {
+		data.ClientAddress = strings.TrimPrefix(data.ClientAddress+", "+city, ", ")
+	}
+
+	invoice, err := app.loadMembershipInvoice(clientMembershipID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if invoice != nil {
+		data.Price = money(invoice.TotalAmount)
+		data.Currency = invoice.Currency
+		data.InvoiceNo = invoice.InvoiceNo
+		if gymID == 0 && invoice.GymID != nil {
+			gymID = *invoice.GymID
+		}
+	}
+	if gymID == 0 {
+		err = app.DB.QueryRow(`SELECT mg.gym_id FROM membership_gyms mg
+		                       INNER JOIN user_gyms ug ON ug.gym_id = mg.gym_id
+		                       WHERE mg.membership_id = $1 AND ug.user_id = $2
+		                       ORDER BY mg.gym_id
+		                       LIMIT 1`, membershipID, claims.UserID).Scan(&gymID)
+		if err != nil && err != sql.ErrNoRows {
+			sendErrorResponse(w, "Failed to fetch gym: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	branding := app.brandingOrDefault(sql.NullInt64{Int64: int64(gymID), Valid: gymID > 0})
+	data.GymName = branding.Name
+	clauses, err := renderContractClauses(branding.ContractTerms, r.URL.Query().Get("lang"), data)
+	if err != nil {
+		sendErrorResponse(w, "Failed to render contract: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	lang := documentLanguage(r.URL.Query().Get("lang"))
+	labels := documentTemplates[lang].Labels
+	doc := app.newDocumentRenderer(labels["contract"]+" "+data.ContractNo, branding, lang)
+
+	doc.heading(labels["contract"], [][2]string{
+		{labels["number"], data.ContractNo},
+		{labels["date"], data.Date},
+	})
+	member := efactura.Party{Name: data.ClientName, CompanyID: data.ClientCIF, Person: clientType != clientTypeCompany,
+		Street: data.ClientAddress}
+	doc.parties(labels["seller_sign"], partyLines(app.sellerParty(), labels), labels["member_sign"], partyLines(member, labels))
+
+	summary := [][2]string{
+		{labels["membership"], data.MembershipName},
+		{labels["valid_from"], strings.TrimSpace(data.StartingFrom + " " + labels["valid_to"] + " " + data.EndingOn)},
+	}
+	if data.EntriesNo > 0 {
+		summary = append(summary, [2]string{labels["entries"], strconv.Itoa(data.EntriesNo)})
+	}
+	if data.GuestPassesNo > 0 {
+		summary = append(summary, [2]string{labels["guest_passes"], strconv.Itoa(data.GuestPassesNo)})
+	}
+	if data.Price != "" {
+		summary = append(summary, [2]string{labels["total"], data.Price + " " + data.Currency})
+	}
+	doc.summary(summary)
+
+	for _, clause := range strings.Split(clauses, "\n\n") {
+		if strings.TrimSpace(clause) != "" {
+			doc.paragraph(pdf.Helvetica, docFontSize, strings.TrimSpace(clause))
+		}
+	}
+	doc.signatures(labels["seller_sign"], labels["member_sign"])
+
+	app.sendPDF(w, doc, "contract-"+data.ContractNo)
+}
+
+// membershipContractURL is where the contract of a client membership is downloaded from
+func membershipContractURL(clientID, clientMembershipID, gymID int) string {
+	url := fmt.Sprintf("/api/clients/%d/memberships/%d/contract", clientID, clientMembershipID)
+	if gymID > 0 {
+		url += fmt.Sprintf("?gym_id=%d", gymID)
+	}
+	return url
+}
+
+// invoiceGym returns the gym of an invoice for its branding
+func invoiceGym(invoice *Invoice) sql.NullInt64 {
+	if invoice.GymID == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*invoice.GymID), Valid: true}
+}
+
+// partyLines formats the identification and address of a party, name first
+func partyLines(p efactura.Party, labels map[string]string) []string {
+	lines := []string{p.Name}
+	if p.CompanyID != "" {
+		idLabel := labels["cui"]
+		if p.Person {
+			idLabel = labels["cnp"]
+		}
+		lines = append(lines, idLabel+": "+p.CompanyID)
+	}
+	if p.TradeRegisterNo != "" {
+		lines = append(lines, labels["trade_register"]+": "+p.TradeRegisterNo)
+	}
+	if p.Street != "" {
+		lines = append(lines, p.Street)
+	}
+	var place []string
+	for _, part := range []string{p.City, p.County} {
+		if part != "" {
+			place = append(place, part)
+		}
+	}
+	if len(place) > 0 {
+		lines = append(lines, strings.Join(place, ", "))
+	}
+	for _, contact := range []string{p.Phone, p.Email} {
+		if contact != "" {
+			lines = append(lines, contact)
+		}
+	}
+	return lines
+}
+
+func money(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+// formatQuantity prints whole numbers without decimals
+func formatQuantity(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
+
+func (app *App) sendPDF(w http.ResponseWriter, doc *documentRenderer, filename string) {
+	content, err := doc.finish()
+	if err != nil {
+		sendErrorResponse(w, "Failed to render PDF: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, filename))
+	w.Write(content)
+}
+
+// documentRenderer lays out a branded A4 document from top to bottom,
+// starting new pages as the content grows
+type documentRenderer struct {
+	doc      *pdf.Document
+	page     *pdf.Page
+	branding *GymBranding
+	labels   map[string]string
+	accent   pdf.Color
+	logo     *pdf.Image
+	y        float64
+}
+
+type docColumn struct {
+	Label string
+	Width float64
+	Right bool
+}
+
+func (app *App) newDocumentRenderer(title string, branding *GymBranding, lang string) *documentRenderer {
+	d := &documentRenderer{
+		doc:      pdf.New(title),
+		branding: branding,
+		labels:   documentTemplates[lang].Labels,
+	}
+	d.doc.Author = branding.Name
+
+	accent, err := pdf.ParseHexColor(branding.BrandColor)
+	if err != nil {
+		accent, _ = pdf.ParseHexColor(defaultBrandColor)
+	}
+	d.accent = accent
+
+	// A logo that cannot be embedded only leaves the header without it
+	if logo := app.loadLogo(branding); logo != nil {
+		d.logo, _ = d.doc.AddJPEG(logo)
+	}
+
+	d.newPage()
+	return d
+}
+
+// newPage starts a page with the gym header
+func (d *documentRenderer) newPage() {
+	d.page = d.doc.AddPage()
+	d.page.Rect(0, 0, pdf.A4Width, 6, d.accent)
+
+	textX := docMargin
+	if d.logo != nil {
+		// Fit the logo in a 120 x 50 box, keeping its proportions
+		w, h := 120.0, 120.0*float64(d.logo.Height)/float64(d.logo.Width)
+		if h > 50 {
+			w, h = 50*float64(d.logo.Width)/float64(d.logo.Height), 50
+		}
+		d.page.DrawImage(d.logo, docMargin, 22, w, h)
+		textX += w + 14
+	}
+
+	d.page.Text(textX, 42, pdf.HelveticaBold, 16, d.accent, d.branding.Name)
+	y := 56.0
+	if d.branding.Address != "" {
+		d.page.Text(textX, y, pdf.Helvetica, 9, pdf.Gray, d.branding.Address)
+		y += 11
+	}
+	var contacts []string
+	for _, contact := range []string{d.branding.Phone, d.branding.Email, d.branding.Website} {
+		if contact != "" {
+			contacts = append(contacts, contact)
+		}
+	}
+	if len(contacts) > 0 {
+		d.page.Text(textX, y, pdf.Helvetica, 9, pdf.Gray, strings.Join(contacts, "  |  "))
+	}
+
+	d.page.Line(docMargin, 86, pdf.A4Width-docMargin, 86, 1, d.accent)
+	d.y = 110
+}
+
+// ensure starts a new page unless height points still fit on the current one
+func (d *documentRenderer) ensure(height float64) {
+	if d.y+height > docBottom {
+		d.newPage()
+	}
+}
+
+// heading prints the document title with its number and dates on the right
+func (d *documentRenderer) heading(title string, meta [][2]string) {
+	d.page.Text(docMargin, d.y+14, pdf.HelveticaBold, 20, d.accent, title)
+	y := d.y + 4
+	for _, item := range meta {
+		if item[1] == "" {
+			continue
+		}
+		d.page.TextRight(pdf.A4Width-docMargin, y, pdf.Helvetica, docFontSize, pdf.Black, item[0]+": "+item[1])
+		y += docLineHeight
+	}
+	d.y = max(d.y+30, y) + 10
+}
+
+// stamp prints a large status notice, e.g. for cancelled invoices
+func (d *documentRenderer) stamp(text string) {
+	d.ensure(30)
+	d.page.TextCenter(pdf.A4Width/2, d.y+14, pdf.HelveticaBold, 18, pdf.Color{R: 0.75, G: 0.1, B: 0.1}, text)
+	d.y += 30
+}
+
+// parties prints the two parties side by side
+func (d *documentRenderer) parties(leftTitle string, left []string, rightTitle string, right []string) {
+	columnWidth := docContentWidth/2 - 10
+	wrap := func(lines []string) []string {
+		var wrapped []string
+		for _, line := range lines {
+			wrapped = append(wrapped, pdf.Wrap(pdf.Helvetica, 9, line, columnWidth)...)
+		}
+		return wrapped
+	}
+	left, right = wrap(left), wrap(right)
+	height := float64(max(len(left), len(right))+1)*12 + 10
+	d.ensure(height)
+
+	for i, column := range []struct {
+		title string
+		lines []string
+	}{{leftTitle, left}, {rightTitle, right}} {
+		x := docMargin + float64(i)*(columnWidth+20)
+		d.page.Text(x, d.y, pdf.HelveticaBold, 9, d.accent, strings.ToUpper(column.title))
+		for j, line := range column.lines {
+			font := pdf.Helvetica
+			if j == 0 {
+				font = pdf.HelveticaBold
+			}
+			d.page.Text(x, d.y+float64(j+1)*12, font, 9, pdf.Black, line)
+		}
+	}
+	d.y += height
+}
+
+// summary prints label/value pairs in a tinted box
+func (d *documentRenderer) summary(items [][2]string) {
+	height := float64(len(items))*docLineHeight + 12
+	d.ensure(height + 10)
+
+	tint := pdf.Color{R: 1 - (1-d.accent.R)*0.12, G: 1 - (1-d.accent.G)*0.12, B: 1 - (1-d.accent.B)*0.12}
+	d.page.Rect(docMargin, d.y, docContentWidth, height, tint)
+	for i, item := range items {
+		y := d.y + 16 + float64(i)*docLineHeight
+		d.page.Text(docMargin+10, y, pdf.Helvetica, docFontSize, pdf.Gray, item[0])
+		d.page.Text(docMargin+150, y, pdf.HelveticaBold, docFontSize, pdf.Black, item[1])
+	}
+	d.y += height + 16
+}
+
+// paragraph prints wrapped text across the content width
+func (d *documentRenderer) paragraph(font pdf.Font, size float64, text string) {
+	lineHeight := size * 1.3
+	for _, line := range pdf.Wrap(font, size, text, docContentWidth) {
+		d.ensure(lineHeight)
+		d.page.Text(docMargin, d.y+size, font, size, pdf.Black, line)
+		d.y += lineHeight
+	}
+	d.y += size * 0.6
+}
+
+// table prints rows under a header row, which is repeated on every page the table spans.
+// Cells of left-aligned columns wrap; right-aligned ones hold short values.
+func (d *documentRenderer) table(columns []docColumn, rows [][]string) {
+	const size = 9.0
+	header := func() {
+		d.page.Rect(docMargin, d.y, docContentWidth, 18, d.accent)
+		x := docMargin
+		for _, column := range columns {
+			if column.Right {
+				d.page.TextRight(x+column.Width-4, d.y+12, pdf.HelveticaBold, size, pdf.White, column.Label)
+			} else {
+				d.page.Text(x+4, d.y+12, pdf.HelveticaBold, size, pdf.White, column.Label)
+			}
+			x += column.Width
+		}
+		d.y += 18
+	}
+
+	d.ensure(36)
+	header()
+	for _, row := range rows {
+		cells := make([][]string, len(columns))
+		lines := 1
+		for i, column := range columns {
+			if column.Right {
+				cells[i] = []string{row[i]}
+				continue
+			}
+			cells[i] = pdf.Wrap(pdf.Helvetica, size, row[i], column.Width-8)
+			lines = max(lines, len(cells[i]))
+		}
+		height := float64(lines)*12 + 6
+
+		if d.y+height > docBottom {
+			d.newPage()
+			header()
+		}
+		x := docMargin
+		for i, column := range columns {
+			for j, line := range cells[i] {
+				y := d.y + 13 + float64(j)*12
+				if column.Right {
+					d.page.TextRight(x+column.Width-4, y, pdf.Helvetica, size, pdf.Black, line)
+				} else {
+					d.page.Text(x+4, y, pdf.Helvetica, size, pdf.Black, line)
+				}
+			}
+			x += column.Width
+		}
+		d.y += height
+		d.page.Line(docMargin, d.y, pdf.A4Width-docMargin, d.y, 0.3, pdf.Gray)
+	}
+	d.y += 10
+}
+
+// totals prints right-aligned label/value pairs; the last one is emphasized
+func (d *documentRenderer) totals(items [][2]string) {
+	d.ensure(float64(len(items))*16 + 10)
+	right := pdf.A4Width - docMargin
+	for i, item := range items {
+		font, color := pdf.Helvetica, pdf.Black
+		if i == len(items)-1 {
+			font, color = pdf.HelveticaBold, d.accent
+		}
+		d.page.TextRight(right-110, d.y+12, font, docFontSize, pdf.Gray, item[0])
+		d.page.TextRight(right, d.y+12, font, docFontSize, color, item[1])
+		d.y += 16
+	}
+	d.y += 10
+}
+
+// signatures prints signature lines; an empty title leaves that side blank
+func (d *documentRenderer) signatures(left, right string) {
+	d.ensure(80)
+	d.y += 30
+	width := docContentWidth/2 - 40
+	for i, title := range []string{left, right} {
+		if title == "" {
+			continue
+		}
+		x := docMargin + float64(i)*(docContentWidth/2+40)
+		d.page.Text(x, d.y, pdf.HelveticaBold, docFontSize, pdf.Black, title)
+		d.page.Line(x, d.y+40, x+width, d.y+40, 0.5, pdf.Gray)
+	}
+	d.y += 50
+}
+
+// finish prints the footer and page numbers on every page and renders the document
+func (d *documentRenderer) finish() ([]byte, error) {
+	pages := d.doc.Pages()
+	footer := pdf.Wrap(pdf.Helvetica, 8, d.branding.DocumentFooter, docContentWidth-80)
+	for i, page := range pages {
+		y := pdf.A4Height - 40
+		page.Line(docMargin, y-12, pdf.A4Width-docMargin, y-12, 0.3, pdf.Gray)
+		for j, line := range footer {
+			if j == 2 {
+				break
+			}
+			page.Text(docMargin, y+float64(j)*10, pdf.Helvetica, 8, pdf.Gray, line)
+		}
+		page.TextRight(pdf.A4Width-docMargin, y, pdf.Helvetica, 8, pdf.Gray,
+			fmt.Sprintf("%s %d / %d", d.labels["page"], i+1, len(pages)))
+	}
+	return d.doc.Bytes()
+}
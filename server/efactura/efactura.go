@@ -0,0 +1,330 @@
+// Package efactura builds Romanian e-Factura invoices: UBL 2.1 XML following
+// the EN 16931 national specification RO_CIUS, as submitted to ANAF.
+//
+// The package works on a plain Invoice model and knows nothing about the
+// database; callers fill in the model, call Validate and then Marshal.
+package efactura
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// CustomizationID of RO_CIUS invoices (BT-24)
+	CustomizationID = "urn:cen.eu:en16931:2017#compliant#urn:efactura.mfinante.ro:CIUS-RO:1.0.1"
+
+	invoiceTypeCommercial = "380"
+	unitCodeOne           = "C62"
+	paymentMeansTransfer  = "42"
+
+	// AnonymousCNP identifies a natural person buyer who did not give a CNP
+	AnonymousCNP = "0000000000000"
+)
+
+// Party is the seller or the buyer of an invoice
+type Party struct {
+	Name string
+
+	// CUI/CIF of companies, with the RO prefix when VAT registered, or the CNP of persons
+	CompanyID       string
+	TradeRegisterNo string
+	Person          bool
+
+	// WalkIn marks a person served at the counter whose address was not taken;
+	// the invoice gives the seller's address, where the sale took place
+	WalkIn bool
+
+	Street      string
+	City        string
+	PostalZone  string
+	County      string // ISO 3166-2 subdivision without the country, e.g. "CJ" or "B"
+	CountryCode string // ISO 3166-1 alpha-2, e.g. "RO"
+
+	Email string
+	Phone string
+}
+
+// VATRegistered reports whether the party's CUI carries the RO VAT prefix
+func (p Party) VATRegistered() bool {
+	return !p.Person && strings.HasPrefix(strings.ToUpper(p.CompanyID), "RO")
+}
+
+// atPointOfSale returns the walk-in party with the seller's address when it has none of its own
+func (p Party) atPointOfSale(seller Party) Party {
+	if !p.WalkIn || p.Street != "" || p.City != "" || p.County != "" {
+		return p
+	}
+	p.Street = seller.Street
+	p.City = seller.City
+	p.PostalZone = seller.PostalZone
+	p.County = seller.County
+	p.CountryCode = seller.CountryCode
+	return p
+}
+
+// Line is an invoice line; amounts are in the invoice currency
+type Line struct {
+	Description string
+	Quantity    float64
+	UnitPrice   float64 // net, VAT excluded
+	NetAmount   float64
+	VATRate     float64
+
+	// VATAmount is the VAT of the line as recorded by the issuer. VAT inclusive
+	// prices are split by rounding the net amount, so it can differ by a cent
+	// from the net amount x rate; when zero, it is computed that way.
+	VATAmount float64
+}
+
+// VAT returns the recorded VAT of the line, or the net amount x rate when none was recorded
+func (line Line) VAT() float64 {
+	if line.VATAmount != 0 {
+		return round2(line.VATAmount)
+	}
+	return round2(line.NetAmount * line.VATRate / 100)
+}
+
+// Invoice is the data needed to issue an e-Factura
+type Invoice struct {
+	Number     string
+	IssueDate  time.Time
+	DueDate    time.Time
+	Currency   string
+	Note       string
+	Seller     Party
+	Buyer      Party
+	Lines      []Line
+	PaidAmount float64
+	IBAN       string // seller account for payment by transfer, optional
+
+	// PrecedingInvoice is the number of the invoice a credit note reverses (BT-25);
+	// credit notes are issued as invoices with negative quantities
+	PrecedingInvoice string
+
+	// TotalAmount is the total with VAT as recorded by the issuer; when set,
+	// Validate checks that the lines add up to it
+	TotalAmount float64
+}
+
+var sectorRegex = regexp.MustCompile(`(?i)sector(?:ul)?\s*([1-6])`)
+
+// Marshal validates the invoice and renders it as UBL 2.1 XML
+func Marshal(inv Invoice) ([]byte, error) {
+	if err := Validate(inv); err != nil {
+		return nil, err
+	}
+	doc := build(inv)
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// VATBreakdown groups the line net amounts by VAT rate (BG-23)
+type VATBreakdown struct {
+	Rate          float64
+	TaxableAmount float64
+	TaxAmount     float64
+}
+
+// Breakdown returns the VAT breakdown of the invoice, one entry per rate in line
+// order. The VAT of a rate is the sum of its line VAT, so the totals match the
+// amounts the issuer recorded.
+func (inv Invoice) Breakdown() []VATBreakdown {
+	var breakdown []VATBreakdown
+	index := make(map[float64]int)
+	for _, line := range inv.Lines {
+		i, ok := index[line.VATRate]
+		if !ok {
+			i = len(breakdown)
+			index[line.VATRate] = i
+			breakdown = append(breakdown, VATBreakdown{Rate: line.VATRate})
+		}
+		breakdown[i].TaxableAmount = round2(breakdown[i].TaxableAmount + line.NetAmount)
+		breakdown[i].TaxAmount = round2(breakdown[i].TaxAmount + line.VAT())
+	}
+	return breakdown
+}
+
+// Totals returns the sum of line net amounts, the VAT total and the total with VAT
+func (inv Invoice) Totals() (net, vat, gross float64) {
+	for _, b := range inv.Breakdown() {
+		net += b.TaxableAmount
+		vat += b.TaxAmount
+	}
+	net, vat = round2(net), round2(vat)
+	return net, vat, round2(net + vat)
+}
+
+func build(inv Invoice) ublInvoice {
+	currency := inv.Currency
+	net, vat, gross := inv.Totals()
+
+	doc := ublInvoice{
+		XMLNS:                "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2",
+		XMLNSCac:             "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XMLNSCbc:             "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		UBLVersionID:         "2.1",
+		CustomizationID:      CustomizationID,
+		ID:                   inv.Number,
+		IssueDate:            inv.IssueDate.Format("2006-01-02"),
+		InvoiceTypeCode:      invoiceTypeCommercial,
+		Note:                 inv.Note,
+		DocumentCurrencyCode: currency,
+		Supplier:             ublSupplier{Party: buildParty(inv.Seller)},
+		Customer:             ublCustomer{Party: buildParty(inv.Buyer.atPointOfSale(inv.Seller))},
+		LegalMonetaryTotal: ublMonetaryTotal{
+			LineExtensionAmount: amount(net, currency),
+			TaxExclusiveAmount:  amount(net, currency),
+			TaxInclusiveAmount:  amount(gross, currency),
+			PayableAmount:       amount(round2(gross-inv.PaidAmount), currency),
+		},
+	}
+	if !inv.DueDate.IsZero() {
+		doc.DueDate = inv.DueDate.Format("2006-01-02")
+	}
+	if inv.PrecedingInvoice != "" {
+		doc.BillingReference = &ublBillingReference{
+			InvoiceDocumentReference: ublDocumentReference{ID: inv.PrecedingInvoice},
+		}
+	}
+	if inv.PaidAmount > 0 {
+		paid := amount(inv.PaidAmount, currency)
+		doc.LegalMonetaryTotal.PrepaidAmount = &paid
+	}
+	if inv.IBAN != "" {
+		doc.PaymentMeans = &ublPaymentMeans{
+			Code:    paymentMeansTransfer,
+			Account: &ublFinancialAccount{ID: strings.ReplaceAll(inv.IBAN, " ", "")},
+		}
+	}
+
+	taxTotal := ublTaxTotal{TaxAmount: amount(vat, currency)}
+	for _, b := range inv.Breakdown() {
+		taxTotal.Subtotals = append(taxTotal.Subtotals, ublTaxSubtotal{
+			TaxableAmount: amount(b.TaxableAmount, currency),
+			TaxAmount:     amount(b.TaxAmount, currency),
+			Category:      taxCategory(b.Rate, inv.Seller.VATRegistered(), true),
+		})
+	}
+	doc.TaxTotal = taxTotal
+
+	for i, line := range inv.Lines {
+		doc.Lines = append(doc.Lines, ublInvoiceLine{
+			ID:                  fmt.Sprintf("%d", i+1),
+			InvoicedQuantity:    ublQuantity{Value: decimal(line.Quantity), UnitCode: unitCodeOne},
+			LineExtensionAmount: amount(line.NetAmount, currency),
+			Item: ublItem{
+				Name:        line.Description,
+				TaxCategory: taxCategory(line.VATRate, inv.Seller.VATRegistered(), false),
+			},
+			Price: ublPrice{PriceAmount: amount(line.UnitPrice, currency)},
+		})
+	}
+
+	return doc
+}
+
+func buildParty(p Party) ublParty {
+	party := ublParty{
+		PostalAddress: ublAddress{
+			StreetName:       p.Street,
+			CityName:         cityName(p),
+			PostalZone:       p.PostalZone,
+			CountrySubentity: countrySubentity(p),
+			Country:          ublCountry{IdentificationCode: strings.ToUpper(p.CountryCode)},
+		},
+		LegalEntity: ublLegalEntity{RegistrationName: p.Name},
+	}
+
+	companyID := strings.ToUpper(strings.TrimSpace(p.CompanyID))
+	switch {
+	case p.Person:
+		if companyID == "" {
+			companyID = AnonymousCNP
+		}
+		party.LegalEntity.CompanyID = companyID
+	case p.VATRegistered():
+		// VAT identifier (BT-31/BT-48) with the RO prefix, legal registration without it
+		party.TaxSchemes = append(party.TaxSchemes, ublPartyTaxScheme{
+			CompanyID: companyID,
+			TaxScheme: ublTaxScheme{ID: "VAT"},
+		})
+		party.LegalEntity.CompanyID = strings.TrimPrefix(companyID, "RO")
+	default:
+		party.LegalEntity.CompanyID = companyID
+	}
+	if p.TradeRegisterNo != "" && !p.Person {
+		party.LegalEntity.CompanyLegalForm = p.TradeRegisterNo
+	}
+
+	if p.Email != "" || p.Phone != "" {
+		party.Contact = &ublContact{Telephone: p.Phone, ElectronicMail: p.Email}
+	}
+	return party
+}
+
+// countrySubentity returns the ISO 3166-2 code RO_CIUS requires for Romanian addresses
+func countrySubentity(p Party) string {
+	county := strings.ToUpper(strings.TrimSpace(p.County))
+	if county == "" {
+		return ""
+	}
+	country := strings.ToUpper(p.CountryCode)
+	if strings.HasPrefix(county, country+"-") {
+		return county
+	}
+	return country + "-" + county
+}
+
+// cityName returns SECTOR1 ... SECTOR6 for Bucharest addresses, as RO_CIUS requires
+func cityName(p Party) string {
+	if countrySubentity(p) != "RO-B" {
+		return p.City
+	}
+	if m := sectorRegex.FindStringSubmatch(p.City + " " + p.Street); m != nil {
+		return "SECTOR" + m[1]
+	}
+	return p.City
+}
+
+// taxCategory returns standard rated (S) for a positive rate; zero rates are
+// exempt (E) for VAT registered sellers and not subject to VAT (O) otherwise
+func taxCategory(rate float64, sellerVATRegistered, withReason bool) ublTaxCategory {
+	category := ublTaxCategory{ID: "S", Percent: decimal(rate), TaxScheme: ublTaxScheme{ID: "VAT"}}
+	if rate > 0 {
+		return category
+	}
+
+	if sellerVATRegistered {
+		category.ID = "E"
+		if withReason {
+			category.ExemptionReasonCode = "VATEX-EU-132"
+		}
+	} else {
+		category.ID = "O"
+		category.Percent = ""
+		if withReason {
+			category.ExemptionReasonCode = "VATEX-EU-O"
+		}
+	}
+	return category
+}
+
+func amount(value float64, currency string) ublAmount {
+	return ublAmount{Value: decimal(value), CurrencyID: currency}
+}
+
+func decimal(value float64) string {
+	return fmt.Sprintf("%.2f", round2(value))
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,775 @@
+package efactura
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The cases below cover the parties and tax categories the API issues: persons
+// without a CNP, walk-ins without an address, VAT registered companies,
+// sellers outside the VAT system, Bucharest sector addresses and credit notes.
+// Their output is kept in testdata so it can be run through the ANAF validator
+// (DUKIntegrator) when the package changes.
+
+var issued = time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+func gymSeller() Party {
+	return Party{
+		Name:            "Iron Gym SRL",
+		CompanyID:       "RO12345678",
+		TradeRegisterNo: "J12/345/2020",
+		Street:          "Str. Memorandumului 28",
+		City:            "Cluj-Napoca",
+		PostalZone:      "400114",
+		County:          "CJ",
+		CountryCode:     "RO",
+		Email:           "office@irongym.ro",
+	}
+}
+
+func personBuyer() Party {
+	return Party{
+		Name:        "Ana Popescu",
+		Person:      true,
+		Street:      "Str. Horea 5",
+		City:        "Cluj-Napoca",
+		County:      "CJ",
+		CountryCode: "RO",
+	}
+}
+
+var marshalCases = []struct {
+	name  string
+	inv   Invoice
+	check func(t *testing.T, doc *node)
+}{
+	{
+		name: "person_buyer",
+		inv: Invoice{
+			Number:      "IG-0001",
+			IssueDate:   issued,
+			DueDate:     issued.AddDate(0, 0, 15),
+			Currency:    "RON",
+			Seller:      gymSeller(),
+			Buyer:       personBuyer(),
+			Lines:       []Line{{Description: "Monthly membership", Quantity: 1, UnitPrice: 150, NetAmount: 150, VATRate: 19}},
+			PaidAmount:  100,
+			IBAN:        "RO49 AAAA 1B31 0075 9384 0000",
+			TotalAmount: 178.5,
+		},
+		check: func(t *testing.T, doc *node) {
+			buyer := doc.find("AccountingCustomerParty", "Party")
+			expectText(t, buyer.find("PartyLegalEntity", "CompanyID"), AnonymousCNP)
+			if buyer.find("PartyTaxScheme") != nil {
+				t.Error("a person buyer has no VAT identifier")
+			}
+			expectText(t, doc.find("LegalMonetaryTotal", "PrepaidAmount"), "100.00")
+			expectText(t, doc.find("LegalMonetaryTotal", "PayableAmount"), "78.50")
+			expectText(t, doc.find("PaymentMeans", "PayeeFinancialAccount", "ID"), "RO49AAAA1B31007593840000")
+		},
+	},
+	{
+		name: "company_buyer",
+		inv: Invoice{
+			Number:    "IG-0002",
+			IssueDate: issued,
+			Currency:  "RON",
+			Seller:    gymSeller(),
+			Buyer: Party{
+				Name:            "Acme Software SRL",
+				CompanyID:       "ro87654321",
+				TradeRegisterNo: "J40/1234/2015",
+				Street:          "Bd. 21 Decembrie 1989 77",
+				City:            "Cluj-Napoca",
+				County:          "RO-CJ",
+				CountryCode:     "RO",
+			},
+			Lines: []Line{
+				{Description: "Corporate memberships", Quantity: 10, UnitPrice: 120, NetAmount: 1200, VATRate: 19},
+				{Description: "Physiotherapy session", Quantity: 2, UnitPrice: 100, NetAmount: 200, VATRate: 0},
+			},
+			TotalAmount: 1628,
+		},
+		check: func(t *testing.T, doc *node) {
+			buyer := doc.find("AccountingCustomerParty", "Party")
+			expectText(t, buyer.find("PartyTaxScheme", "CompanyID"), "RO87654321")
+			expectText(t, buyer.find("PartyLegalEntity", "CompanyID"), "87654321")
+			expectText(t, buyer.find("PostalAddress", "CountrySubentity"), "RO-CJ")
+
+			subtotals := doc.find("TaxTotal").all("TaxSubtotal")
+			if len(subtotals) != 2 {
+				t.Fatalf("expected 2 VAT subtotals, got %d", len(subtotals))
+			}
+			expectText(t, subtotals[1].find("TaxCategory", "ID"), "E")
+			expectText(t, subtotals[1].find("TaxCategory", "TaxExemptionReasonCode"), "VATEX-EU-132")
+		},
+	},
+	{
+		name: "zero_vat_seller",
+		inv: Invoice{
+			Number:    "SG-0001",
+			IssueDate: issued,
+			Currency:  "RON",
+			Seller: Party{
+				Name:        "Studio Yoga PFA",
+				CompanyID:   "23456789",
+				Street:      "Str. Lunga 10",
+				City:        "Brasov",
+				County:      "BV",
+				CountryCode: "RO",
+			},
+			Buyer:       personBuyer(),
+			Lines:       []Line{{Description: "Yoga pass, 8 classes", Quantity: 1, UnitPrice: 200, NetAmount: 200, VATRate: 0}},
+			TotalAmount: 200,
+		},
+		check: func(t *testing.T, doc *node) {
+			if doc.find("AccountingSupplierParty", "Party", "PartyTaxScheme") != nil {
+				t.Error("a seller outside the VAT system has no VAT identifier")
+			}
+			category := doc.find("TaxTotal", "TaxSubtotal", "TaxCategory")
+			expectText(t, category.find("ID"), "O")
+			expectText(t, category.find("TaxExemptionReasonCode"), "VATEX-EU-O")
+			if category.find("Percent") != nil {
+				t.Error("category O carries no VAT rate")
+			}
+			expectText(t, doc.find("TaxTotal", "TaxAmount"), "0.00")
+		},
+	},
+	{
+		name: "bucharest_address",
+		inv: Invoice{
+			Number:    "IG-0003",
+			IssueDate: issued,
+			Currency:  "RON",
+			Seller: Party{
+				Name:        "Iron Gym Bucuresti SRL",
+				CompanyID:   "RO34567890",
+				Street:      "Calea Victoriei 100, Sector 1",
+				City:        "Bucuresti",
+				County:      "B",
+				CountryCode: "RO",
+			},
+			Buyer: Party{
+				Name:        "Mihai Ionescu",
+				CompanyID:   "1900101123456",
+				Person:      true,
+				Street:      "Str. Fabricii 4",
+				City:        "Bucuresti Sectorul 6",
+				County:      "B",
+				CountryCode: "RO",
+			},
+			Lines:       []Line{{Description: "Personal training", Quantity: 4, UnitPrice: 80, NetAmount: 320, VATRate: 19}},
+			TotalAmount: 380.8,
+		},
+		check: func(t *testing.T, doc *node) {
+			expectText(t, doc.find("AccountingSupplierParty", "Party", "PostalAddress", "CityName"), "SECTOR1")
+			expectText(t, doc.find("AccountingCustomerParty", "Party", "PostalAddress", "CityName"), "SECTOR6")
+			expectText(t, doc.find("AccountingCustomerParty", "Party", "PartyLegalEntity", "CompanyID"), "1900101123456")
+		},
+	},
+	{
+		name: "vat_inclusive_price",
+		inv: Invoice{
+			Number:    "IG-0005",
+			IssueDate: issued,
+			Currency:  "RON",
+			Seller:    gymSeller(),
+			Buyer:     personBuyer(),
+			// A 75.00 RON day pass at 19%: net round(75 x 100 / 119) = 63.03 and VAT
+			// 11.97, where 63.03 x 19% would give 11.98 and a 75.01 total
+			Lines: []Line{{Description: "Day pass", Quantity: 1, UnitPrice: 63.03, NetAmount: 63.03, VATRate: 19,
+				VATAmount: 11.97}},
+			TotalAmount: 75,
+		},
+		check: func(t *testing.T, doc *node) {
+			expectText(t, doc.find("TaxTotal", "TaxAmount"), "11.97")
+			expectText(t, doc.find("TaxTotal", "TaxSubtotal", "TaxAmount"), "11.97")
+			expectText(t, doc.find("LegalMonetaryTotal", "TaxInclusiveAmount"), "75.00")
+		},
+	},
+	{
+		name: "credit_note",
+		inv: Invoice{
+			Number:           "IG-0004",
+			IssueDate:        issued,
+			Currency:         "RON",
+			Note:             "Reverses invoice IG-0001",
+			Seller:           gymSeller(),
+			Buyer:            personBuyer(),
+			Lines:            []Line{{Description: "Monthly membership", Quantity: -1, UnitPrice: 150, NetAmount: -150, VATRate: 19}},
+			PrecedingInvoice: "IG-0001",
+			TotalAmount:      -178.5,
+		},
+		check: func(t *testing.T, doc *node) {
+			expectText(t, doc.find("InvoiceTypeCode"), "380")
+			expectText(t, doc.find("BillingReference", "InvoiceDocumentReference", "ID"), "IG-0001")
+			expectText(t, doc.find("InvoiceLine", "InvoicedQuantity"), "-1.00")
+			expectText(t, doc.find("LegalMonetaryTotal", "PayableAmount"), "-178.50")
+		},
+	},
+	{
+		name: "guest_buyer",
+		inv: Invoice{
+			Number:      "IG-0006",
+			IssueDate:   issued,
+			Currency:    "RON",
+			Seller:      gymSeller(),
+			Buyer:       Party{Name: "Walk-in Guest", Person: true, WalkIn: true, CountryCode: "RO", Phone: "0722123456"},
+			Lines:       []Line{{Description: "Day pass", Quantity: 1, UnitPrice: 50, NetAmount: 50, VATRate: 19}},
+			TotalAmount: 59.5,
+		},
+		check: func(t *testing.T, doc *node) {
+			address := doc.find("AccountingCustomerParty", "Party", "PostalAddress")
+			expectText(t, address.find("StreetName"), "Str. Memorandumului 28")
+			expectText(t, address.find("CityName"), "Cluj-Napoca")
+			expectText(t, address.find("CountrySubentity"), "RO-CJ")
+			expectText(t, doc.find("AccountingCustomerParty", "Party", "PartyLegalEntity", "CompanyID"), AnonymousCNP)
+		},
+	},
+}
+
+func TestMarshal(t *testing.T) {
+	for _, tc := range marshalCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := Marshal(tc.inv)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			golden := filepath.Join("testdata", tc.name+".xml")
+			if *update {
+				if err := os.WriteFile(golden, out, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(out, want) {
+				t.Errorf("output differs from %s:\n%s", golden, out)
+			}
+
+			var doc node
+			if err := xml.Unmarshal(out, &doc); err != nil {
+				t.Fatalf("output is not well-formed XML: %v", err)
+			}
+			checkUBLSchema(t, &doc)
+			checkRules(t, &doc)
+			tc.check(t, &doc)
+		})
+	}
+}
+
+// ublSchema is the Invoice schema of the OASIS UBL 2.1 distribution
+// (os-UBL-2.1.zip), whose xsd directory is unpacked into testdata/xsd
+var ublSchema = filepath.Join("testdata", "xsd", "maindoc", "UBL-Invoice-2.1.xsd")
+
+// TestSchema validates the golden files against the UBL 2.1 XSD with xmllint
+func TestSchema(t *testing.T) {
+	if _, err := os.Stat(ublSchema); err != nil {
+		t.Skipf("UBL 2.1 schema not found at %s: unpack the xsd directory of os-UBL-2.1.zip there", ublSchema)
+	}
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not found")
+	}
+
+	for _, tc := range marshalCases {
+		golden := filepath.Join("testdata", tc.name+".xml")
+		out, err := exec.Command(xmllint, "--noout", "--nonet", "--schema", ublSchema, golden).CombinedOutput()
+		if err != nil {
+			t.Errorf("%s does not validate against the UBL 2.1 schema: %v\n%s", golden, err, out)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	inv := marshalCases[0].inv
+	inv.Number = ""
+	inv.Buyer.County = ""
+	inv.Lines = []Line{{Description: "Monthly membership", Quantity: 1, UnitPrice: 150, NetAmount: 140, VATRate: 19}}
+
+	err := Validate(inv)
+	problems, ok := err.(Problems)
+	if !ok {
+		t.Fatalf("expected Problems, got %v", err)
+	}
+	terms := make(map[string]bool)
+	for _, problem := range problems {
+		terms[problem.Term] = true
+	}
+	for _, term := range []string{"BT-1", "BT-54", "BT-131", "BT-112"} {
+		if !terms[term] {
+			t.Errorf("expected a %s problem, got %v", term, problems)
+		}
+	}
+
+	credit := marshalCases[5].inv
+	credit.PrecedingInvoice = ""
+	if err := Validate(credit); err == nil || !strings.Contains(err.Error(), "BT-25") {
+		t.Errorf("expected a BT-25 problem for a credit note without preceding invoice, got %v", err)
+	}
+
+	dayPass := marshalCases[4].inv
+	dayPass.Lines = []Line{{Description: "Day pass", Quantity: 1, UnitPrice: 63.03, NetAmount: 63.03, VATRate: 19}}
+	if err := Validate(dayPass); err == nil || !strings.Contains(err.Error(), "BT-112") {
+		t.Errorf("expected a BT-112 problem when the recorded VAT is left out, got %v", err)
+	}
+	dayPass.Lines = []Line{{Description: "Day pass", Quantity: 1, UnitPrice: 63.03, NetAmount: 63.03, VATRate: 19,
+		VATAmount: 12.5}}
+	if err := Validate(dayPass); err == nil || !strings.Contains(err.Error(), "BT-117") {
+		t.Errorf("expected a BT-117 problem for a line VAT off the rate, got %v", err)
+	}
+
+	// A walk-in keeps the address it gave, which must then be complete
+	guest := marshalCases[6].inv
+	guest.Buyer.City = "Cluj-Napoca"
+	if err := Validate(guest); err == nil || !strings.Contains(err.Error(), "BT-50") {
+		t.Errorf("expected a BT-50 problem for a walk-in with a partial address, got %v", err)
+	}
+
+	bucharest := marshalCases[3].inv
+	bucharest.Seller.Street = "Calea Victoriei 100"
+	if err := Validate(bucharest); err == nil || !strings.Contains(err.Error(), "SECTOR1 to SECTOR6") {
+		t.Errorf("expected a sector problem for a Bucharest address without sector, got %v", err)
+	}
+}
+
+// The invoice routines split VAT inclusive prices as net = round(price x 100 /
+// (100 + rate), 2) and VAT = price - net; every such invoice has to export
+func TestValidateVATInclusivePrices(t *testing.T) {
+	for _, rate := range []float64{5, 9, 19, 21} {
+		for price := 1.0; price <= 1000; price++ {
+			net := round2(price * 100 / (100 + rate))
+			inv := marshalCases[4].inv
+			inv.Lines = []Line{{Description: "Day pass", Quantity: 1, UnitPrice: net, NetAmount: net, VATRate: rate,
+				VATAmount: round2(price - net)}}
+			inv.TotalAmount = price
+			if err := Validate(inv); err != nil {
+				t.Fatalf("%.2f RON at %.0f%%: %v", price, rate, err)
+			}
+		}
+	}
+}
+
+// node is an element of the marshalled document, namespace prefixes dropped
+type node struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Text     string     `xml:",chardata"`
+	Children []node     `xml:",any"`
+}
+
+// find follows a path of child element names, returning nil when one is missing
+func (n *node) find(path ...string) *node {
+	current := n
+	for _, name := range path {
+		if current == nil {
+			return nil
+		}
+		var next *node
+		for i := range current.Children {
+			if current.Children[i].XMLName.Local == name {
+				next = &current.Children[i]
+				break
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+func (n *node) all(name string) []*node {
+	var found []*node
+	for i := range n.Children {
+		if n.Children[i].XMLName.Local == name {
+			found = append(found, &n.Children[i])
+		}
+	}
+	return found
+}
+
+func (n *node) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func expectText(t *testing.T, n *node, want string) {
+	t.Helper()
+	if n == nil {
+		t.Errorf("missing element, expected %q", want)
+		return
+	}
+	if got := strings.TrimSpace(n.Text); got != want {
+		t.Errorf("<%s> is %q, expected %q", n.XMLName.Local, got, want)
+	}
+}
+
+const (
+	nsInvoice = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	nsCac     = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	nsCbc     = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// ublSequences lists, for the aggregates the package emits, the child elements
+// of the UBL 2.1 schema in their xsd:sequence order (maindoc/UBL-Invoice-2.1.xsd
+// and common/UBL-CommonAggregateComponents-2.1.xsd), restricted to the elements
+// EN 16931 uses. Children are checked to be known, in order, and present when
+// the schema requires them.
+var ublSequences = map[string][]string{
+	"Invoice": {"UBLVersionID", "CustomizationID", "ProfileID", "ID", "IssueDate", "DueDate", "InvoiceTypeCode",
+		"Note", "TaxPointDate", "DocumentCurrencyCode", "TaxCurrencyCode", "AccountingCost", "BuyerReference",
+		"InvoicePeriod", "OrderReference", "BillingReference", "DespatchDocumentReference",
+		"ReceiptDocumentReference", "OriginatorDocumentReference", "ContractDocumentReference",
+		"AdditionalDocumentReference", "ProjectReference", "AccountingSupplierParty", "AccountingCustomerParty",
+		"PayeeParty", "TaxRepresentativeParty", "Delivery", "PaymentMeans", "PaymentTerms", "AllowanceCharge",
+		"TaxTotal", "LegalMonetaryTotal", "InvoiceLine"},
+	"BillingReference":         {"InvoiceDocumentReference"},
+	"InvoiceDocumentReference": {"ID", "IssueDate"},
+	"AccountingSupplierParty":  {"Party"},
+	"AccountingCustomerParty":  {"Party"},
+	"Party": {"EndpointID", "PartyIdentification", "PartyName", "PostalAddress", "PartyTaxScheme",
+		"PartyLegalEntity", "Contact"},
+	"PostalAddress": {"StreetName", "AdditionalStreetName", "CityName", "PostalZone", "CountrySubentity",
+		"AddressLine", "Country"},
+	"Country":          {"IdentificationCode"},
+	"PartyTaxScheme":   {"CompanyID", "TaxScheme"},
+	"PartyLegalEntity": {"RegistrationName", "CompanyID", "CompanyLegalForm"},
+	"Contact":          {"Name", "Telephone", "ElectronicMail"},
+	"PaymentMeans": {"PaymentMeansCode", "PaymentDueDate", "InstructionNote", "PaymentID", "CardAccount",
+		"PayeeFinancialAccount", "PaymentMandate"},
+	"PayeeFinancialAccount": {"ID", "Name", "FinancialInstitutionBranch"},
+	"TaxTotal":              {"TaxAmount", "TaxSubtotal"},
+	"TaxSubtotal":           {"TaxableAmount", "TaxAmount", "TaxCategory"},
+	"TaxCategory":           {"ID", "Percent", "TaxExemptionReasonCode", "TaxExemptionReason", "TaxScheme"},
+	"ClassifiedTaxCategory": {"ID", "Percent", "TaxScheme"},
+	"TaxScheme":             {"ID"},
+	"LegalMonetaryTotal": {"LineExtensionAmount", "TaxExclusiveAmount", "TaxInclusiveAmount",
+		"AllowanceTotalAmount", "ChargeTotalAmount", "PrepaidAmount", "PayableRoundingAmount", "PayableAmount"},
+	"InvoiceLine": {"ID", "Note", "InvoicedQuantity", "LineExtensionAmount", "AccountingCost", "InvoicePeriod",
+		"OrderLineReference", "DocumentReference", "AllowanceCharge", "Item", "Price"},
+	"Item": {"Description", "Name", "BuyersItemIdentification", "SellersItemIdentification",
+		"StandardItemIdentification", "OriginCountry", "CommodityClassification", "ClassifiedTaxCategory",
+		"AdditionalItemProperty"},
+	"Price": {"PriceAmount", "BaseQuantity", "AllowanceCharge"},
+}
+
+// ublRequired lists the children with minOccurs="1" in the UBL 2.1 schema
+var ublRequired = map[string][]string{
+	"Invoice":                  {"ID", "IssueDate", "AccountingSupplierParty", "AccountingCustomerParty", "LegalMonetaryTotal", "InvoiceLine"},
+	"InvoiceDocumentReference": {"ID"},
+	"AccountingSupplierParty":  {"Party"},
+	"AccountingCustomerParty":  {"Party"},
+	"Country":                  {"IdentificationCode"},
+	"PartyTaxScheme":           {"TaxScheme"},
+	"PaymentMeans":             {"PaymentMeansCode"},
+	"TaxTotal":                 {"TaxAmount"},
+	"TaxSubtotal":              {"TaxAmount", "TaxCategory"},
+	"LegalMonetaryTotal":       {"PayableAmount"},
+	"InvoiceLine":              {"ID", "LineExtensionAmount", "Item"},
+	"Price":                    {"PriceAmount"},
+}
+
+// ublAmounts are the elements of the UBL AmountType, which requires currencyID
+var ublAmounts = map[string]bool{
+	"TaxAmount": true, "TaxableAmount": true, "LineExtensionAmount": true, "TaxExclusiveAmount": true,
+	"TaxInclusiveAmount": true, "PrepaidAmount": true, "PayableAmount": true, "PriceAmount": true,
+}
+
+// ublAggregates are the cac elements; every other element is a cbc one
+var ublAggregates = map[string]bool{
+	"BillingReference": true, "InvoiceDocumentReference": true, "AccountingSupplierParty": true,
+	"AccountingCustomerParty": true, "Party": true, "PostalAddress": true, "Country": true,
+	"PartyTaxScheme": true, "PartyLegalEntity": true, "Contact": true, "PaymentMeans": true,
+	"PayeeFinancialAccount": true, "TaxTotal": true, "TaxSubtotal": true, "TaxCategory": true,
+	"ClassifiedTaxCategory": true, "TaxScheme": true, "LegalMonetaryTotal": true, "InvoiceLine": true,
+	"Item": true, "Price": true,
+}
+
+func checkUBLSchema(t *testing.T, doc *node) {
+	t.Helper()
+	if doc.XMLName.Space != nsInvoice || doc.XMLName.Local != "Invoice" {
+		t.Fatalf("root element is {%s}%s, expected {%s}Invoice", doc.XMLName.Space, doc.XMLName.Local, nsInvoice)
+	}
+	checkUBLElement(t, doc, "Invoice")
+}
+
+func checkUBLElement(t *testing.T, n *node, path string) {
+	t.Helper()
+	name := n.XMLName.Local
+	if path != "Invoice" {
+		namespace := nsCbc
+		if ublAggregates[name] {
+			namespace = nsCac
+		}
+		if n.XMLName.Space != namespace {
+			t.Errorf("%s: namespace %q, expected %q", path, n.XMLName.Space, namespace)
+		}
+	}
+	if ublAmounts[name] && n.attr("currencyID") == "" {
+		t.Errorf("%s: amount without currencyID", path)
+	}
+	if name == "InvoicedQuantity" && n.attr("unitCode") == "" {
+		t.Errorf("%s: quantity without unitCode", path)
+	}
+
+	sequence, aggregate := ublSequences[name]
+	if !aggregate {
+		if len(n.Children) > 0 {
+			t.Errorf("%s: basic component with child elements", path)
+		}
+		return
+	}
+
+	position := make(map[string]int, len(sequence))
+	for i, child := range sequence {
+		position[child] = i
+	}
+	last := -1
+	present := make(map[string]bool)
+	for i := range n.Children {
+		child := &n.Children[i]
+		childName := child.XMLName.Local
+		childPath := path + "/" + childName
+		pos, known := position[childName]
+		switch {
+		case !known:
+			t.Errorf("%s: not allowed in %s", childPath, name)
+		case pos < last:
+			t.Errorf("%s: out of the schema sequence of %s", childPath, name)
+		default:
+			last = pos
+		}
+		present[childName] = true
+		checkUBLElement(t, child, childPath)
+	}
+	for _, required := range ublRequired[name] {
+		if !present[required] {
+			t.Errorf("%s: missing required %s", path, required)
+		}
+	}
+}
+
+// roCounties are the ISO 3166-2:RO codes RO_CIUS accepts in CountrySubentity
+var roCounties = strings.Fields(`AB AG AR B BC BH BN BR BT BV BZ CJ CL CS CT CV DB DJ GJ GL GR HD HR IF IL IS
+	MH MM MS NT OT PH SB SJ SM SV TL TM TR VL VN VS`)
+
+// checkRules checks the EN 16931 rules (BR-*, BR-CO-*) and the RO_CIUS address rules
+// that the output has to meet whatever the invoice
+func checkRules(t *testing.T, doc *node) {
+	t.Helper()
+	expectText(t, doc.find("UBLVersionID"), "2.1")
+	expectText(t, doc.find("CustomizationID"), CustomizationID)
+	expectText(t, doc.find("InvoiceTypeCode"), invoiceTypeCommercial)
+
+	currency := strings.TrimSpace(doc.find("DocumentCurrencyCode").Text)
+	for _, path := range [][]string{{"IssueDate"}, {"DueDate"}} {
+		if date := doc.find(path...); date != nil {
+			if _, err := time.Parse("2006-01-02", date.Text); err != nil {
+				t.Errorf("BR-CL: %s %q is not a YYYY-MM-DD date", path[0], date.Text)
+			}
+		}
+	}
+
+	for _, role := range []string{"AccountingSupplierParty", "AccountingCustomerParty"} {
+		party := doc.find(role, "Party")
+		if party.find("PartyLegalEntity", "RegistrationName") == nil {
+			t.Errorf("BR-06/BR-07: %s has no name", role)
+		}
+		if scheme := party.find("PartyTaxScheme"); scheme != nil {
+			expectText(t, scheme.find("TaxScheme", "ID"), "VAT")
+		}
+		address := party.find("PostalAddress")
+		if country := strings.TrimSpace(address.find("Country", "IdentificationCode").Text); country != "RO" {
+			continue
+		}
+		// RO_CIUS: ISO 3166-2:RO county, and SECTOR1 to SECTOR6 in Bucharest
+		subentity := address.find("CountrySubentity")
+		if subentity == nil || !strings.HasPrefix(subentity.Text, "RO-") ||
+			!containsString(roCounties, strings.TrimPrefix(subentity.Text, "RO-")) {
+			t.Errorf("RO_CIUS: %s county is not an ISO 3166-2:RO code", role)
+			continue
+		}
+		city := address.find("CityName")
+		if subentity.Text == "RO-B" && (city == nil || !containsString(strings.Fields("SECTOR1 SECTOR2 SECTOR3 SECTOR4 SECTOR5 SECTOR6"), city.Text)) {
+			t.Errorf("RO_CIUS: %s address in Bucharest does not name the sector", role)
+		}
+		if address.find("StreetName") == nil || city == nil {
+			t.Errorf("RO_CIUS: %s Romanian address has no street or city", role)
+		}
+	}
+	sellerVAT := doc.find("AccountingSupplierParty", "Party", "PartyTaxScheme") != nil
+
+	total := doc.find("LegalMonetaryTotal")
+	lineTotal := 0.0
+	lineNet := make(map[string]float64)
+	lineCount := make(map[string]int)
+	for _, line := range doc.all("InvoiceLine") {
+		net := parseAmount(t, line.find("LineExtensionAmount"), currency)
+		quantity, _ := strconv.ParseFloat(line.find("InvoicedQuantity").Text, 64)
+		price := parseAmount(t, line.find("Price", "PriceAmount"), currency)
+		if price < 0 {
+			t.Error("BR-27: item net price cannot be negative")
+		}
+		if !sameAmount(quantity*price, net) {
+			t.Errorf("BR-CO: line amount %.2f is not %.2f x %.2f", net, quantity, price)
+		}
+		category := line.find("Item", "ClassifiedTaxCategory")
+		id := strings.TrimSpace(category.find("ID").Text)
+		checkCategory(t, category, id, sellerVAT, false)
+		lineTotal += net
+		lineNet[id+"/"+percentOf(category)] += net
+		lineCount[id+"/"+percentOf(category)]++
+	}
+
+	taxTotal := doc.find("TaxTotal")
+	vat := 0.0
+	for _, subtotal := range taxTotal.all("TaxSubtotal") {
+		category := subtotal.find("TaxCategory")
+		id := strings.TrimSpace(category.find("ID").Text)
+		checkCategory(t, category, id, sellerVAT, true)
+		taxable := parseAmount(t, subtotal.find("TaxableAmount"), currency)
+		tax := parseAmount(t, subtotal.find("TaxAmount"), currency)
+		key := id + "/" + percentOf(category)
+		if !sameAmount(taxable, lineNet[key]) {
+			t.Errorf("BR-%s-08: taxable amount %.2f of %s is not the sum of its lines %.2f", id, taxable, key, lineNet[key])
+		}
+		// The VAT of VAT inclusive prices is recorded per line and may be a cent
+		// off the taxable amount x rate for each line
+		rate, _ := strconv.ParseFloat(percentOf(category), 64)
+		if math.Abs(tax-taxable*rate/100) > 0.01*float64(lineCount[key])+0.005 {
+			t.Errorf("BR-%s-09: tax amount %.2f of %s is not %.2f x %.2f%%", id, tax, key, taxable, rate)
+		}
+		delete(lineNet, key)
+		vat += tax
+	}
+	for key := range lineNet {
+		t.Errorf("BR-CO-18: no VAT breakdown for the lines of %s", key)
+	}
+	if !sameAmount(parseAmount(t, taxTotal.find("TaxAmount"), currency), vat) {
+		t.Error("BR-CO-14: invoice VAT total is not the sum of the breakdown")
+	}
+
+	exclusive := parseAmount(t, total.find("TaxExclusiveAmount"), currency)
+	inclusive := parseAmount(t, total.find("TaxInclusiveAmount"), currency)
+	if !sameAmount(parseAmount(t, total.find("LineExtensionAmount"), currency), lineTotal) {
+		t.Error("BR-CO-10: sum of line net amounts does not match")
+	}
+	if !sameAmount(exclusive, lineTotal) {
+		t.Error("BR-CO-13: total without VAT does not match the lines")
+	}
+	if !sameAmount(inclusive, exclusive+vat) {
+		t.Error("BR-CO-15: total with VAT is not the total without VAT plus VAT")
+	}
+	prepaid := 0.0
+	if paid := total.find("PrepaidAmount"); paid != nil {
+		prepaid = parseAmount(t, paid, currency)
+	}
+	if !sameAmount(parseAmount(t, total.find("PayableAmount"), currency), inclusive-prepaid) {
+		t.Error("BR-CO-16: amount due is not the total with VAT less the paid amount")
+	}
+	if inclusive < 0 && doc.find("BillingReference", "InvoiceDocumentReference", "ID") == nil {
+		t.Error("BT-25: a credit note must reference the invoice it reverses")
+	}
+}
+
+// checkCategory checks the rules of the VAT categories the package uses:
+// standard rated (BR-S-*), exempt (BR-E-*) and not subject to VAT (BR-O-*)
+func checkCategory(t *testing.T, category *node, id string, sellerVAT, breakdown bool) {
+	t.Helper()
+	expectText(t, category.find("TaxScheme", "ID"), "VAT")
+	rate, _ := strconv.ParseFloat(percentOf(category), 64)
+	reason := category.find("TaxExemptionReasonCode")
+	switch id {
+	case "S":
+		if rate <= 0 {
+			t.Error("BR-S-05: standard rated category without a positive rate")
+		}
+		if !sellerVAT {
+			t.Error("BR-S-02: standard rated category without seller VAT identifier")
+		}
+		if reason != nil {
+			t.Error("BR-S-10: standard rated category with an exemption reason")
+		}
+	case "E":
+		if category.find("Percent") == nil || rate != 0 {
+			t.Error("BR-E-05: exempt category must have a 0 rate")
+		}
+		if !sellerVAT {
+			t.Error("BR-E-02: exempt category without seller VAT identifier")
+		}
+		if breakdown && reason == nil {
+			t.Error("BR-E-10: exempt breakdown without exemption reason")
+		}
+	case "O":
+		if category.find("Percent") != nil {
+			t.Error("BR-O-05: not subject to VAT category with a rate")
+		}
+		if sellerVAT {
+			t.Error("BR-O-02: not subject to VAT category with seller VAT identifier")
+		}
+		if breakdown && reason == nil {
+			t.Error("BR-O-10: not subject to VAT breakdown without exemption reason")
+		}
+	default:
+		t.Errorf("BR-CL-18: unexpected VAT category %q", id)
+	}
+}
+
+func percentOf(category *node) string {
+	if percent := category.find("Percent"); percent != nil {
+		return strings.TrimSpace(percent.Text)
+	}
+	return "0"
+}
+
+// parseAmount reads an amount, which must be in the document currency with at
+// most two decimals (BR-DEC)
+func parseAmount(t *testing.T, n *node, currency string) float64 {
+	t.Helper()
+	if n == nil {
+		t.Error("missing amount")
+		return 0
+	}
+	text := strings.TrimSpace(n.Text)
+	if i := strings.IndexByte(text, '.'); i >= 0 && len(text)-i-1 > 2 {
+		t.Errorf("BR-DEC: %s %q has more than two decimals", n.XMLName.Local, text)
+	}
+	if got := n.attr("currencyID"); got != currency {
+		t.Errorf("BR-CL-05: %s in %q, expected the document currency %q", n.XMLName.Local, got, currency)
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		t.Errorf("%s %q is not a number", n.XMLName.Local, text)
+	}
+	return value
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(round2(a)-round2(b)) < 0.005
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
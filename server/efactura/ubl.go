@@ -0,0 +1,146 @@
+package efactura
+
+import "encoding/xml"
+
+// UBL 2.1 elements used by RO_CIUS invoices. Field order follows the UBL
+// schema sequence, which validators enforce.
+
+type ublInvoice struct {
+	XMLName  xml.Name `xml:"Invoice"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	XMLNSCac string   `xml:"xmlns:cac,attr"`
+	XMLNSCbc string   `xml:"xmlns:cbc,attr"`
+
+	UBLVersionID         string               `xml:"cbc:UBLVersionID"`
+	CustomizationID      string               `xml:"cbc:CustomizationID"`
+	ID                   string               `xml:"cbc:ID"`
+	IssueDate            string               `xml:"cbc:IssueDate"`
+	DueDate              string               `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode      string               `xml:"cbc:InvoiceTypeCode"`
+	Note                 string               `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode string               `xml:"cbc:DocumentCurrencyCode"`
+	BillingReference     *ublBillingReference `xml:"cac:BillingReference,omitempty"`
+	Supplier             ublSupplier          `xml:"cac:AccountingSupplierParty"`
+	Customer             ublCustomer          `xml:"cac:AccountingCustomerParty"`
+	PaymentMeans         *ublPaymentMeans     `xml:"cac:PaymentMeans,omitempty"`
+	TaxTotal             ublTaxTotal          `xml:"cac:TaxTotal"`
+	LegalMonetaryTotal   ublMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	Lines                []ublInvoiceLine     `xml:"cac:InvoiceLine"`
+}
+
+type ublBillingReference struct {
+	InvoiceDocumentReference ublDocumentReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+type ublDocumentReference struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublSupplier struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublCustomer struct {
+	Party ublParty `xml:"cac:Party"`
+}
+
+type ublParty struct {
+	PostalAddress ublAddress          `xml:"cac:PostalAddress"`
+	TaxSchemes    []ublPartyTaxScheme `xml:"cac:PartyTaxScheme"`
+	LegalEntity   ublLegalEntity      `xml:"cac:PartyLegalEntity"`
+	Contact       *ublContact         `xml:"cac:Contact,omitempty"`
+}
+
+type ublAddress struct {
+	StreetName       string     `xml:"cbc:StreetName,omitempty"`
+	CityName         string     `xml:"cbc:CityName,omitempty"`
+	PostalZone       string     `xml:"cbc:PostalZone,omitempty"`
+	CountrySubentity string     `xml:"cbc:CountrySubentity,omitempty"`
+	Country          ublCountry `xml:"cac:Country"`
+}
+
+type ublCountry struct {
+	IdentificationCode string `xml:"cbc:IdentificationCode"`
+}
+
+type ublPartyTaxScheme struct {
+	CompanyID string       `xml:"cbc:CompanyID"`
+	TaxScheme ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublLegalEntity struct {
+	RegistrationName string `xml:"cbc:RegistrationName"`
+	CompanyID        string `xml:"cbc:CompanyID,omitempty"`
+	CompanyLegalForm string `xml:"cbc:CompanyLegalForm,omitempty"`
+}
+
+type ublContact struct {
+	Telephone      string `xml:"cbc:Telephone,omitempty"`
+	ElectronicMail string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type ublPaymentMeans struct {
+	Code    string               `xml:"cbc:PaymentMeansCode"`
+	Account *ublFinancialAccount `xml:"cac:PayeeFinancialAccount,omitempty"`
+}
+
+type ublFinancialAccount struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublTaxTotal struct {
+	TaxAmount ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	TaxableAmount ublAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     ublAmount      `xml:"cbc:TaxAmount"`
+	Category      ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID                  string       `xml:"cbc:ID"`
+	Percent             string       `xml:"cbc:Percent,omitempty"`
+	ExemptionReasonCode string       `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	TaxScheme           ublTaxScheme `xml:"cac:TaxScheme"`
+}
+
+type ublTaxScheme struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount ublAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  ublAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  ublAmount  `xml:"cbc:TaxInclusiveAmount"`
+	PrepaidAmount       *ublAmount `xml:"cbc:PrepaidAmount,omitempty"`
+	PayableAmount       ublAmount  `xml:"cbc:PayableAmount"`
+}
+
+type ublInvoiceLine struct {
+	ID                  string      `xml:"cbc:ID"`
+	InvoicedQuantity    ublQuantity `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount ublAmount   `xml:"cbc:LineExtensionAmount"`
+	Item                ublItem     `xml:"cac:Item"`
+	Price               ublPrice    `xml:"cac:Price"`
+}
+
+type ublItem struct {
+	Name        string         `xml:"cbc:Name"`
+	TaxCategory ublTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type ublPrice struct {
+	PriceAmount ublAmount `xml:"cbc:PriceAmount"`
+}
+
+type ublAmount struct {
+	Value      string `xml:",chardata"`
+	CurrencyID string `xml:"currencyID,attr"`
+}
+
+type ublQuantity struct {
+	Value    string `xml:",chardata"`
+	UnitCode string `xml:"unitCode,attr"`
+}
@@ -0,0 +1,156 @@
+package efactura
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Problem is a rule the invoice breaks, identified by the EN 16931 business
+// term (BT-n) or group (BG-n) it concerns
+type Problem struct {
+	Term    string
+	Message string
+}
+
+// Problems is returned by Validate and Marshal when an invoice cannot be issued
+type Problems []Problem
+
+func (p Problems) Error() string {
+	msgs := make([]string, len(p))
+	for i, problem := range p {
+		msgs[i] = problem.Term + ": " + problem.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Validate checks the EN 16931 and RO_CIUS rules that depend on the invoice data:
+// mandatory terms, Romanian address coding and the consistency of the totals.
+// It returns Problems, or nil when the invoice can be issued.
+func Validate(inv Invoice) error {
+	var problems Problems
+	add := func(term, format string, args ...interface{}) {
+		problems = append(problems, Problem{Term: term, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(inv.Number) == "" {
+		add("BT-1", "invoice number is required")
+	}
+	if inv.IssueDate.IsZero() {
+		add("BT-2", "issue date is required")
+	}
+	if !inv.DueDate.IsZero() && inv.DueDate.Before(inv.IssueDate) {
+		add("BT-9", "due date cannot be before the issue date")
+	}
+	// Other currencies would also need the VAT total in RON (BT-6, BT-111)
+	if inv.Currency != "RON" {
+		add("BT-5", "only invoices in RON can be exported")
+	}
+
+	validateParty(inv.Seller, "seller", add)
+	validateParty(inv.Buyer.atPointOfSale(inv.Seller), "buyer", add)
+	if inv.Seller.Person {
+		add("BT-27", "the seller must be a legal entity")
+	}
+	if strings.TrimSpace(inv.Seller.CompanyID) == "" {
+		add("BT-31", "seller CUI is required")
+	}
+
+	if len(inv.Lines) == 0 {
+		add("BG-25", "at least one invoice line is required")
+	}
+	for i, line := range inv.Lines {
+		n := i + 1
+		if strings.TrimSpace(line.Description) == "" {
+			add("BT-153", "line %d: item name is required", n)
+		} else if len([]rune(line.Description)) > 100 {
+			add("BT-153", "line %d: RO_CIUS limits the item name to 100 characters", n)
+		}
+		if line.Quantity == 0 {
+			add("BT-129", "line %d: quantity is required", n)
+		}
+		if line.UnitPrice < 0 {
+			add("BT-146", "line %d: item net price cannot be negative", n)
+		}
+		if round2(line.Quantity*line.UnitPrice) != round2(line.NetAmount) {
+			add("BT-131", "line %d: net amount %s is not quantity x price (%s)", n,
+				decimal(line.NetAmount), decimal(line.Quantity*line.UnitPrice))
+		}
+		if line.VATRate < 0 || line.VATRate >= 100 {
+			add("BT-152", "line %d: VAT rate must be between 0 and 100", n)
+		}
+		if line.VATRate == 0 && line.VATAmount != 0 {
+			add("BT-117", "line %d: VAT amount %s is charged at a 0 rate", n, decimal(line.VATAmount))
+		} else if math.Abs(line.VAT()-line.NetAmount*line.VATRate/100) > 0.01 {
+			add("BT-117", "line %d: VAT amount %s is not net amount x rate (%s)", n,
+				decimal(line.VATAmount), decimal(line.NetAmount*line.VATRate/100))
+		}
+		if line.VATRate > 0 && !inv.Seller.VATRegistered() {
+			add("BT-31", "line %d: VAT is charged but the seller CUI has no RO VAT prefix", n)
+		}
+	}
+
+	if inv.TotalAmount != 0 && len(inv.Lines) > 0 {
+		if _, _, gross := inv.Totals(); gross != round2(inv.TotalAmount) {
+			add("BT-112", "lines add up to %s with VAT, but the invoice total is %s",
+				decimal(gross), decimal(inv.TotalAmount))
+		}
+	}
+	if inv.PaidAmount < 0 || (inv.TotalAmount > 0 && round2(inv.PaidAmount) > round2(inv.TotalAmount)) {
+		add("BT-113", "paid amount must be between 0 and the invoice total")
+	}
+	if inv.TotalAmount < 0 {
+		if inv.PaidAmount != 0 {
+			add("BT-113", "a credit note cannot carry a paid amount")
+		}
+		if strings.TrimSpace(inv.PrecedingInvoice) == "" {
+			add("BT-25", "a credit note must reference the invoice it reverses")
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func validateParty(p Party, role string, add func(term, format string, args ...interface{})) {
+	// Business terms of the seller (BG-4) and the buyer (BG-7)
+	terms := map[string][2]string{
+		"name":    {"BT-27", "BT-44"},
+		"street":  {"BT-35", "BT-50"},
+		"city":    {"BT-37", "BT-52"},
+		"county":  {"BT-39", "BT-54"},
+		"country": {"BT-40", "BT-55"},
+	}
+	term := func(key string) string {
+		if role == "seller" {
+			return terms[key][0]
+		}
+		return terms[key][1]
+	}
+
+	if strings.TrimSpace(p.Name) == "" {
+		add(term("name"), "%s name is required", role)
+	}
+	if len(p.CountryCode) != 2 {
+		add(term("country"), "%s country must be an ISO 3166-1 alpha-2 code", role)
+	}
+	if !strings.EqualFold(p.CountryCode, "RO") {
+		return
+	}
+
+	// RO_CIUS requires a full address for Romanian parties
+	if strings.TrimSpace(p.Street) == "" {
+		add(term("street"), "%s street is required for Romanian addresses", role)
+	}
+	if strings.TrimSpace(p.City) == "" {
+		add(term("city"), "%s city is required for Romanian addresses", role)
+	}
+	switch subentity := countrySubentity(p); {
+	case subentity == "":
+		add(term("county"), "%s county is required for Romanian addresses", role)
+	case subentity == "RO-B" && !strings.HasPrefix(cityName(p), "SECTOR"):
+		add(term("city"), "%s address in Bucharest must name the sector (SECTOR1 to SECTOR6)", role)
+	}
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+type Exercise struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	MuscleGroup  string `json:"muscle_group,omitempty"`
+	MachineID    *int   `json:"machine_id"` // usual machine; null for free weights and bodyweight
+	MachineName  string `json:"machine_name,omitempty"`
+	Instructions string `json:"instructions,omitempty"`
+	IsActive     bool   `json:"is_active"`
+	CreatedOn    string `json:"created_on"`
+	UpdatedOn    string `json:"updated_on"`
+}
+
+type ExerciseRequest struct {
+	Name         string `json:"name"`
+	MuscleGroup  string `json:"muscle_group,omitempty"`
+	MachineID    int    `json:"machine_id,omitempty"`
+	Instructions string `json:"instructions,omitempty"`
+	IsActive     *bool  `json:"is_active,omitempty"`
+}
+
+// exerciseQuery selects exercises of the catalog
+const exerciseQuery = `SELECT e.id, e.name, COALESCE(e.muscle_group, ''), e.machine_id, COALESCE(m.name, ''),
+                              COALESCE(e.instructions, ''), COALESCE(e.is_active, false),
+                              TO_CHAR(e.created_on, 'YYYY-MM-DD'), TO_CHAR(e.updated_on, 'YYYY-MM-DD')
+                       FROM exercises e
+                       LEFT JOIN machines m ON m.id = e.machine_id`
+
+func scanExercise(scanner interface{ Scan(...interface{}) error }, exercise *Exercise) error {
+	return scanner.Scan(&exercise.ID, &exercise.Name, &exercise.MuscleGroup, &exercise.MachineID,
+		&exercise.MachineName, &exercise.Instructions, &exercise.IsActive, &exercise.CreatedOn, &exercise.UpdatedOn)
+}
+
+// List the exercise catalog, optionally only the exercises of a muscle group or machine
+func (app *App) getExercises(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+	muscleGroup := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("muscle_group")))
+	machineID := 0
+	if machineIDStr := r.URL.Query().Get("machine_id"); machineIDStr != "" {
+		machineID, err = strconv.Atoi(machineIDStr)
+		if err != nil || machineID <= 0 {
+			sendErrorResponse(w, "Invalid machine_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := app.DB.Query(exerciseQuery+` WHERE ($1 = false OR e.is_active)
+	                                           AND ($2 = '' OR e.muscle_group = $2)
+	                                           AND ($3 = 0 OR e.machine_id = $3)
+	                                         ORDER BY e.name`, activeOnly, muscleGroup, machineID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch exercises: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var exercises []Exercise
+	for rows.Next() {
+		var exercise Exercise
+		if err := scanExercise(rows, &exercise); err != nil {
+			sendErrorResponse(w, "Failed to scan exercise: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		exercises = append(exercises, exercise)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no exercises found, return empty array instead of null
+	if exercises == nil {
+		exercises = []Exercise{}
+	}
+
+	sendSuccessResponse(w, "Exercises retrieved successfully", exercises)
+}
+
+// Add an exercise to the catalog shared by all gyms
+func (app *App) createExercise(w http.ResponseWriter, r *http.Request) {
+	app.saveExercise(w, r, 0)
+}
+
+// Update an exercise; plans and logged workouts keep pointing to it
+func (app *App) updateExercise(w http.ResponseWriter, r *http.Request) {
+	exerciseID, err := strconv.Atoi(mux.Vars(r)["exercise_id"])
+	if err != nil || exerciseID <= 0 {
+		sendErrorResponse(w, "Invalid exercise_id parameter", http.StatusBadRequest)
+		return
+	}
+	app.saveExercise(w, r, exerciseID)
+}
+
+// saveExercise creates an exercise, or updates exerciseID when it is not 0
+func (app *App) saveExercise(w http.ResponseWriter, r *http.Request, exerciseID int) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req ExerciseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateExercise(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// The catalog is managed by users working at a gym
+	var exists bool
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1)`, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	if req.MachineID != 0 {
+		err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM machines WHERE id = $1)", req.MachineID).Scan(&exists)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			sendValidationErrorResponse(w, ValidationErrors{{Field: "machine_id", Message: "machine not found"}})
+			return
+		}
+	}
+
+	err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM exercises WHERE upper(name) = upper($1) AND id <> $2)",
+		req.Name, exerciseID).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "name", Message: "an exercise with this name already exists"}})
+		return
+	}
+
+	message := "Exercise updated successfully"
+	if exerciseID == 0 {
+		message = "Exercise created successfully"
+		err = app.DB.QueryRow(`INSERT INTO exercises (name, muscle_group, machine_id, instructions, is_active,
+		                                              created_by, updated_by)
+		                       VALUES ($1, $2, $3, $4, $5, $6, $6)
+		                       RETURNING id`,
+			req.Name, nullIfEmpty(req.MuscleGroup), nullIfZero(req.MachineID), nullIfEmpty(req.Instructions),
+			*req.IsActive, claims.UserID).Scan(&exerciseID)
+	} else {
+		var result sql.Result
+		result, err = app.DB.Exec(`UPDATE exercises
+		                           SET name = $1, muscle_group = $2, machine_id = $3, instructions = $4, is_active = $5,
+		                               updated_on = now(), updated_by = $6
+		                           WHERE id = $7`,
+			req.Name, nullIfEmpty(req.MuscleGroup), nullIfZero(req.MachineID), nullIfEmpty(req.Instructions),
+			*req.IsActive, claims.UserID, exerciseID)
+		if err == nil {
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				sendErrorResponse(w, "Exercise not found", http.StatusNotFound)
+				return
+			}
+		}
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to save exercise: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var exercise Exercise
+	if err := scanExercise(app.DB.QueryRow(exerciseQuery+" WHERE e.id = $1", exerciseID), &exercise); err != nil {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     exerciseID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, exercise)
+}
+
+// validateExercise checks the request and fills in the defaults
+func validateExercise(req *ExerciseRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 128 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "name", Message: "name must have between 1 and 128 characters"})
+	}
+
+	req.MuscleGroup = strings.ToLower(strings.TrimSpace(req.MuscleGroup))
+	if len(req.MuscleGroup) > 32 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "muscle_group", Message: "muscle_group cannot exceed 32 characters"})
+	}
+
+	if req.MachineID < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "machine_id", Message: "invalid machine_id"})
+	}
+
+	req.Instructions = strings.TrimSpace(req.Instructions)
+	if len(req.Instructions) > 1024 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "instructions", Message: "instructions cannot exceed 1024 characters"})
+	}
+
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+
+	return fieldErrs
+}
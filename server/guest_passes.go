@@ -0,0 +1,361 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// SellDayPassRequest sells a day pass to an existing client or, when ClientID is
+// omitted, to a walk-in recorded as a guest client
+type SellDayPassRequest struct {
+	GymID        int    `json:"gym_id"`
+	MembershipID int    `json:"membership_id"`
+	ClientID     int    `json:"client_id,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	Email        string `json:"email,omitempty"`
+	ValidOn      string `json:"valid_on,omitempty"` // YYYY-MM-DD, defaults to today in the gym's time zone
+}
+
+// GuestCheckInRequest brings a guest in on the host member's guest passes; the
+// guest is an existing client or a new guest record built from Name, Phone and Email
+type GuestCheckInRequest struct {
+	GymID         int    `json:"gym_id"`
+	GuestClientID int    `json:"guest_client_id,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Phone         string `json:"phone,omitempty"`
+	Email         string `json:"email,omitempty"`
+}
+
+type GuestPass struct {
+	ID                 int    `json:"id"`
+	GymID              int    `json:"gym_id"`
+	GuestClientID      int    `json:"guest_client_id"`
+	HostClientID       int    `json:"host_client_id"`
+	ClientMembershipID int    `json:"client_membership_id"`
+	CreatedBy          int    `json:"created_by"`
+	CreatedOn          string `json:"created_on"`
+}
+
+// Sell single-day access at a gym
+func (app *App) sellDayPass(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req SellDayPassRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	if req.GymID <= 0 {
+		sendErrorResponse(w, "Valid gym_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.MembershipID <= 0 {
+		sendErrorResponse(w, "Valid membership_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.ClientID < 0 || (req.ClientID == 0 && req.Name == "") {
+		sendErrorResponse(w, "Either client_id or the walk-in's name is required", http.StatusBadRequest)
+		return
+	}
+	if req.ValidOn != "" {
+		if _, err := time.Parse("2006-01-02", req.ValidOn); err != nil {
+			sendErrorResponse(w, "Invalid valid_on date. Expected YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user has permission for the gym (and the client, when one is given)
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, req.GymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+	if req.ClientID > 0 {
+		permissionQuery = `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, req.ClientID).Scan(&exists)
+		if err != nil || !exists {
+			sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	clientID := req.ClientID
+	var result string
+	if clientID == 0 {
+		clientID, result, err = createGuestClient(tx, req.Name, req.Phone, req.Email, claims.UserID)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result != "OK" {
+			tx.Rollback()
+			sendErrorResponse(w, result, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = tx.QueryRow("SELECT sell_day_pass($1, $2, $3, $4, $5)", clientID, req.MembershipID, req.GymID,
+		nullIfEmpty(req.ValidOn), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	// Invoice the sale in the same transaction
+	result, err = invoiceNewClientMembership(tx, req.GymID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	var clientMembership ClientMembership
+	clientMembershipQuery := `SELECT id, client_id, membership_id,
+                             TO_CHAR(starting_from, 'YYYY-MM-DD') as starting_from,
+                             TO_CHAR(ending_on, 'YYYY-MM-DD') as ending_on,
+                             status, created_by, updated_by,
+                             TO_CHAR(created_on, 'YYYY-MM-DD HH24:MI:SS') as created_on,
+                             TO_CHAR(updated_on, 'YYYY-MM-DD HH24:MI:SS') as updated_on,
+                             remaining_entries
+                             FROM client_memberships
+                             WHERE client_id = $1 AND membership_id = $2
+                             ORDER BY id DESC
+                             LIMIT 1`
+
+	err = app.DB.QueryRow(clientMembershipQuery, clientID, req.MembershipID).Scan(
+		&clientMembership.ID, &clientMembership.ClientID, &clientMembership.MembershipID,
+		&clientMembership.StartingFrom, &clientMembership.EndingOn, &clientMembership.Status,
+		&clientMembership.CreatedBy, &clientMembership.UpdatedBy,
+		&clientMembership.CreatedOn, &clientMembership.UpdatedOn, &clientMembership.RemainingEntries)
+
+	if err == nil {
+		clientMembership.Invoice, err = app.loadMembershipInvoice(clientMembership.ID, claims.UserID)
+	}
+
+	if err != nil {
+		// Day pass was sold but couldn't fetch details
+		sendSuccessResponse(w, "Day pass sold successfully", map[string]interface{}{
+			"status":        "OK",
+			"client_id":     clientID,
+			"membership_id": req.MembershipID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Day pass sold successfully", map[string]interface{}{
+		"client_id":         clientID,
+		"client_membership": clientMembership,
+	})
+}
+
+// Check in a guest on the host member's guest passes
+func (app *App) doGuestCheckInGym(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	hostClientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || hostClientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req GuestCheckInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Validate required fields
+	if req.GymID <= 0 {
+		sendErrorResponse(w, "Valid gym_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.GuestClientID < 0 || (req.GuestClientID == 0 && req.Name == "") {
+		sendErrorResponse(w, "Either guest_client_id or the guest's name is required", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the host (and the guest, when an existing client is given)
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, hostClientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+	if req.GuestClientID > 0 {
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, req.GuestClientID).Scan(&exists)
+		if err != nil || !exists {
+			sendErrorResponse(w, "Guest not found or access denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	guestClientID := req.GuestClientID
+	var result string
+	if guestClientID == 0 {
+		guestClientID, result, err = createGuestClient(tx, req.Name, req.Phone, req.Email, claims.UserID)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result != "OK" {
+			tx.Rollback()
+			sendErrorResponse(w, result, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = tx.QueryRow("SELECT do_guest_check_in_gym($1, $2, $3, $4)", hostClientID, guestClientID,
+		req.GymID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	var guestPass GuestPass
+	guestPassQuery := `SELECT id, gym_id, client_id, host_client_id, client_membership_id, created_by,
+                       TO_CHAR(created_on, 'YYYY-MM-DD HH24:MI:SS') as created_on
+                       FROM client_passes
+                       WHERE client_id = $1 AND gym_id = $2 AND host_client_id = $3
+                       ORDER BY id DESC
+                       LIMIT 1`
+
+	err = app.DB.QueryRow(guestPassQuery, guestClientID, req.GymID, hostClientID).Scan(
+		&guestPass.ID, &guestPass.GymID, &guestPass.GuestClientID, &guestPass.HostClientID,
+		&guestPass.ClientMembershipID, &guestPass.CreatedBy, &guestPass.CreatedOn)
+
+	if err != nil {
+		// Check-in was successful but couldn't fetch pass details
+		sendSuccessResponse(w, "Guest checked in successfully", map[string]interface{}{
+			"status":          "OK",
+			"host_client_id":  hostClientID,
+			"guest_client_id": guestClientID,
+			"gym_id":          req.GymID,
+		})
+		return
+	}
+
+	responseData := map[string]interface{}{
+		"guest_pass": guestPass,
+	}
+
+	var remaining int
+	err = app.DB.QueryRow("SELECT COALESCE(remaining_guest_passes, 0) FROM client_memberships WHERE id = $1",
+		guestPass.ClientMembershipID).Scan(&remaining)
+	if err == nil {
+		responseData["remaining_guest_passes"] = remaining
+	}
+
+	sendSuccessResponse(w, "Guest checked in successfully", responseData)
+}
+
+// createGuestClient records a walk-in or guest inside tx and returns its id. The
+// second return value is the create_guest_client result; the id is only set when it is "OK".
+func createGuestClient(tx *sql.Tx, name, phone, email string, userID int) (int, string, error) {
+	var result string
+	err := tx.QueryRow("SELECT create_guest_client($1, $2, $3, $4)", name,
+		nullIfEmpty(phone), nullIfEmpty(email), userID).Scan(&result)
+	if err != nil || result != "OK" {
+		return 0, result, err
+	}
+
+	// currval is per session, and the transaction keeps us on one connection
+	var clientID int
+	err = tx.QueryRow("SELECT currval(pg_get_serial_sequence('clients', 'id'))").Scan(&clientID)
+	if err != nil {
+		return 0, "", err
+	}
+	return clientID, result, nil
+}
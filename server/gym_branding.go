@@ -0,0 +1,413 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"GoGymRestApi/server/pdf"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultBrandColor = "#1F4E79"
+	maxLogoSize       = 2 << 20 // 2 MB
+	logoMaxSide       = 600
+	logoJPEGQuality   = 90
+)
+
+// GymBranding is what generated documents (contracts, invoices, receipts) print about a gym
+type GymBranding struct {
+	GymID          int    `json:"gym_id"`
+	Name           string `json:"name"`
+	BrandColor     string `json:"brand_color"`
+	Address        string `json:"address"`
+	Phone          string `json:"phone"`
+	Email          string `json:"email"`
+	Website        string `json:"website"`
+	DocumentFooter string `json:"document_footer"`
+	ContractTerms  string `json:"contract_terms"`
+	HasLogo        bool   `json:"has_logo"`
+
+	logoKey string
+}
+
+type UpdateGymBrandingRequest struct {
+	BrandColor     string `json:"brand_color"`
+	Address        string `json:"address"`
+	Phone          string `json:"phone"`
+	Email          string `json:"email"`
+	Website        string `json:"website"`
+	DocumentFooter string `json:"document_footer"`
+	ContractTerms  string `json:"contract_terms"`
+}
+
+// Get the document branding of a gym
+func (app *App) getGymBranding(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	branding, err := app.loadGymBranding(gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch gym branding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Gym branding retrieved successfully", branding)
+}
+
+// Update the document branding of a gym. Empty fields are cleared; an empty
+// contract_terms restores the default contract clauses.
+func (app *App) updateGymBranding(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateGymBrandingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateGymBranding(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	_, err = app.DB.Exec(`UPDATE gyms
+	                      SET brand_color = $2, address = $3, phone = $4, email = $5, website = $6,
+	                          document_footer = $7, contract_terms = $8
+	                      WHERE id = $1`,
+		gymID, req.BrandColor, nullIfEmpty(req.Address), nullIfEmpty(req.Phone), nullIfEmpty(req.Email),
+		nullIfEmpty(req.Website), nullIfEmpty(req.DocumentFooter), nullIfEmpty(req.ContractTerms))
+	if err != nil {
+		sendErrorResponse(w, "Failed to update gym branding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	branding, err := app.loadGymBranding(gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch gym branding: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Gym branding updated successfully", branding)
+}
+
+// Upload (or replace) the logo printed on a gym's documents. Expects
+// multipart/form-data with a "logo" file; it is stored as a JPEG.
+func (app *App) uploadGymLogo(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym and get the current logo key
+	var oldLogoKey string
+	permissionQuery := `SELECT COALESCE(g.logo_key, '')
+	                    FROM gyms g
+	                    INNER JOIN user_gyms ug ON ug.gym_id = g.id
+	                    WHERE g.id = $1 AND ug.user_id = $2`
+	err = app.DB.QueryRow(permissionQuery, gymID, claims.UserID).Scan(&oldLogoKey)
+	if err != nil {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxLogoSize+1024)
+	file, _, err := r.FormFile("logo")
+	if err != nil {
+		sendErrorResponse(w, "A logo file (max 2 MB) is required in the 'logo' form field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxLogoSize+1))
+	if err != nil {
+		sendErrorResponse(w, "Failed to read logo", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxLogoSize {
+		sendErrorResponse(w, "Logo cannot exceed 2 MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	img, _, err := decodeUploadedImage(data)
+	if err == errImageTooLarge {
+		sendErrorResponse(w, "Logo cannot exceed 40 megapixels", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Logo must be a JPEG, PNG or GIF image", http.StatusBadRequest)
+		return
+	}
+
+	// PDFs embed JPEGs as they are, so every logo is flattened on white and re-encoded
+	resized := resizeToFit(img, logoMaxSide)
+	flat := image.NewRGBA(resized.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), resized, resized.Bounds().Min, draw.Over)
+
+	var logo bytes.Buffer
+	if err := jpeg.Encode(&logo, flat, &jpeg.Options{Quality: logoJPEGQuality}); err != nil {
+		sendErrorResponse(w, "Failed to convert logo", http.StatusInternalServerError)
+		return
+	}
+
+	logoKey := fmt.Sprintf("gyms/%d/logo-%d.jpeg", gymID, time.Now().UnixNano())
+	if err := app.Blobs.Put(logoKey, &logo); err != nil {
+		sendErrorResponse(w, "Failed to store logo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = app.DB.Exec("UPDATE gyms SET logo_key = $2 WHERE id = $1", gymID, logoKey)
+	if err != nil {
+		app.Blobs.Delete(logoKey)
+		sendErrorResponse(w, "Failed to save logo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The previous logo is no longer referenced
+	if oldLogoKey != "" {
+		app.Blobs.Delete(oldLogoKey)
+	}
+
+	sendSuccessResponse(w, "Gym logo uploaded successfully", map[string]interface{}{
+		"status": "OK",
+		"gym_id": gymID,
+	})
+}
+
+// Remove a gym's logo
+func (app *App) deleteGymLogo(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var logoKey string
+	permissionQuery := `SELECT COALESCE(g.logo_key, '')
+	                    FROM gyms g
+	                    INNER JOIN user_gyms ug ON ug.gym_id = g.id
+	                    WHERE g.id = $1 AND ug.user_id = $2`
+	err = app.DB.QueryRow(permissionQuery, gymID, claims.UserID).Scan(&logoKey)
+	if err != nil {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+	if logoKey == "" {
+		sendErrorResponse(w, "Gym has no logo", http.StatusNotFound)
+		return
+	}
+
+	_, err = app.DB.Exec("UPDATE gyms SET logo_key = NULL WHERE id = $1", gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to remove logo: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	app.Blobs.Delete(logoKey)
+
+	sendSuccessResponse(w, "Gym logo removed successfully", map[string]interface{}{
+		"status": "OK",
+		"gym_id": gymID,
+	})
+}
+
+// validateGymBranding checks the request and fills in the default brand color
+func validateGymBranding(req *UpdateGymBrandingRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	req.BrandColor = strings.ToUpper(strings.TrimSpace(req.BrandColor))
+	if req.BrandColor == "" {
+		req.BrandColor = defaultBrandColor
+	} else if _, err := pdf.ParseHexColor(req.BrandColor); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "brand_color", Message: "brand color must be in #RRGGBB format"})
+	}
+	if len(req.Address) > 256 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "address", Message: "address cannot exceed 256 characters"})
+	}
+	req.Phone = normalizePhone(req.Phone)
+	if err := validateContactDetails(req.Email, req.Phone); err != nil {
+		field := "email"
+		if strings.HasPrefix(err.Error(), "phone") {
+			field = "phone"
+		}
+		fieldErrs = append(fieldErrs, FieldError{Field: field, Message: err.Error()})
+	}
+	if len(req.Website) > 128 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "website", Message: "website cannot exceed 128 characters"})
+	}
+	if len(req.DocumentFooter) > 512 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "document_footer", Message: "document footer cannot exceed 512 characters"})
+	}
+	if strings.TrimSpace(req.ContractTerms) != "" {
+		if err := validateContractTerms(req.ContractTerms); err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "contract_terms", Message: err.Error()})
+		}
+	}
+
+	return fieldErrs
+}
+
+// loadGymBranding reads a gym's branding; the caller checks access to the gym
+func (app *App) loadGymBranding(gymID int) (*GymBranding, error) {
+	branding := &GymBranding{GymID: gymID}
+	err := app.DB.QueryRow(`SELECT COALESCE(name, ''), COALESCE(brand_color, $2), COALESCE(address, ''),
+	                               COALESCE(phone, ''), COALESCE(email, ''), COALESCE(website, ''),
+	                               COALESCE(document_footer, ''), COALESCE(contract_terms, ''),
+	                               COALESCE(logo_key, '')
+	                        FROM gyms
+	                        WHERE id = $1`, gymID, defaultBrandColor).Scan(&branding.Name, &branding.BrandColor,
+		&branding.Address, &branding.Phone, &branding.Email, &branding.Website, &branding.DocumentFooter,
+		&branding.ContractTerms, &branding.logoKey)
+	if err != nil {
+		return nil, err
+	}
+	branding.HasLogo = branding.logoKey != ""
+	return branding, nil
+}
+
+// loadLogo returns the JPEG logo of the branding, or nil when it has none or it went missing
+func (app *App) loadLogo(branding *GymBranding) []byte {
+	if branding == nil || branding.logoKey == "" {
+		return nil
+	}
+	blob, err := app.Blobs.Get(branding.logoKey)
+	if err != nil {
+		return nil
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// brandingOrDefault returns the branding of gymID, falling back to the seller
+// details when the document has no gym or the gym cannot be read
+func (app *App) brandingOrDefault(gymID sql.NullInt64) *GymBranding {
+	if gymID.Valid {
+		if branding, err := app.loadGymBranding(int(gymID.Int64)); err == nil {
+			return branding
+		}
+	}
+	return &GymBranding{
+		Name:       app.Config.SellerName,
+		BrandColor: defaultBrandColor,
+		Phone:      app.Config.SellerPhone,
+		Email:      app.Config.SellerEmail,
+	}
+}
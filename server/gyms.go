@@ -7,6 +7,7 @@ import (
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 // Add this struct to your existing code
@@ -1363,3 +1364,81 @@ func (app *App) removeMachineFromGym(w http.ResponseWriter, r *http.Request) {
 		"machine_id": machineID,
 	})
 }
+
+type UpdateGymTimeZoneRequest struct {
+	TimeZone string `json:"time_zone"`
+}
+
+// Set the time zone membership time windows are evaluated in
+func (app *App) updateGymTimeZone(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateGymTimeZoneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	// LoadLocation also takes "" and "Local", which mean nothing to PostgreSQL
+	location, err := time.LoadLocation(req.TimeZone)
+	if req.TimeZone == "" || req.TimeZone == "Local" || err != nil || len(req.TimeZone) > 64 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "time_zone",
+			Message: "time zone must be an IANA name such as Europe/Bucharest"}})
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// gym_local_time() converts with AT TIME ZONE, so the database has to know the zone too
+	err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM pg_timezone_names WHERE name = $1)", req.TimeZone).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "time_zone",
+			Message: "time zone must be an IANA name such as Europe/Bucharest"}})
+		return
+	}
+
+	_, err = app.DB.Exec("UPDATE gyms SET time_zone = $2 WHERE id = $1", gymID, req.TimeZone)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update gym time zone: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Gym time zone updated successfully", map[string]interface{}{
+		"gym_id":     gymID,
+		"time_zone":  req.TimeZone,
+		"local_time": time.Now().In(location).Format("2006-01-02 15:04"),
+	})
+}
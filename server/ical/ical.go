@@ -0,0 +1,161 @@
+// Package ical writes iCalendar (RFC 5545) calendars, for the calendar feeds and
+// for the .ics files attached to booking confirmations.
+//
+// Times are written in UTC, so calendars need no VTIMEZONE components; callers
+// convert gym local times before filling in the events.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// ContentType of iCalendar files and feeds
+	ContentType = "text/calendar; charset=utf-8"
+
+	// Event status values (RFC 5545, 3.8.1.11)
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+
+	// MethodPublish is used for feeds and for confirmations sent without an organizer
+	MethodPublish = "PUBLISH"
+
+	prodID        = "-//GoGym//GoGym REST API//EN"
+	utcLayout     = "20060102T150405Z"
+	maxLineOctets = 75
+)
+
+// Event is a VEVENT
+type Event struct {
+	// UID must stay the same for every version of the event so calendar apps
+	// update it instead of adding a copy
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	Status      string // StatusConfirmed when empty
+
+	// Sequence is raised when the event changes (a new time, a cancellation)
+	Sequence int
+}
+
+// Calendar is a VCALENDAR with its events
+type Calendar struct {
+	Name    string // shown by calendar apps for subscribed feeds
+	Method  string // MethodPublish when empty
+	Refresh time.Duration
+	Events  []Event
+
+	// Stamp is the DTSTAMP of every event; the current time when zero
+	Stamp time.Time
+}
+
+// Marshal renders the calendar with CRLF line endings and folded lines
+func (c Calendar) Marshal() []byte {
+	var buf bytes.Buffer
+	w := &writer{buf: &buf}
+
+	stamp := c.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	method := c.Method
+	if method == "" {
+		method = MethodPublish
+	}
+
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + prodID)
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:" + method)
+	if c.Name != "" {
+		w.line("NAME:" + escapeText(c.Name))
+		w.line("X-WR-CALNAME:" + escapeText(c.Name))
+	}
+	if c.Refresh > 0 {
+		w.line("REFRESH-INTERVAL;VALUE=DURATION:" + duration(c.Refresh))
+		w.line("X-PUBLISHED-TTL:" + duration(c.Refresh))
+	}
+
+	for _, e := range c.Events {
+		status := e.Status
+		if status == "" {
+			status = StatusConfirmed
+		}
+
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + escapeText(e.UID))
+		w.line("DTSTAMP:" + stamp.UTC().Format(utcLayout))
+		w.line("DTSTART:" + e.Start.UTC().Format(utcLayout))
+		w.line("DTEND:" + e.End.UTC().Format(utcLayout))
+		w.line("SUMMARY:" + escapeText(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION:" + escapeText(e.Description))
+		}
+		if e.Location != "" {
+			w.line("LOCATION:" + escapeText(e.Location))
+		}
+		w.line("STATUS:" + status)
+		if e.Sequence > 0 {
+			w.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		}
+		w.line("END:VEVENT")
+	}
+
+	w.line("END:VCALENDAR")
+	return buf.Bytes()
+}
+
+// writer writes content lines folded at 75 octets (RFC 5545, 3.1)
+type writer struct {
+	buf *bytes.Buffer
+}
+
+func (w *writer) line(s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		// Never split a UTF-8 sequence
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with the folding space
+		limit = maxLineOctets - 1
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeText escapes a TEXT value (RFC 5545, 3.3.11)
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// duration renders a positive duration as an RFC 5545 DURATION, e.g. PT1H30M
+func duration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+
+	out := "PT"
+	if hours > 0 {
+		out += fmt.Sprintf("%dH", hours)
+	}
+	if minutes > 0 || hours == 0 {
+		out += fmt.Sprintf("%dM", minutes)
+	}
+	return out
+}
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"GoGymRestApi/server/efactura"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// Download the e-Factura (UBL 2.1, RO_CIUS) XML of an invoice
+func (app *App) exportInvoiceEFactura(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	invoiceID, err := strconv.Atoi(vars["invoice_id"])
+	if err != nil || invoiceID <= 0 {
+		sendErrorResponse(w, "Invalid invoice_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	invoice, err := app.loadEFacturaInvoice(invoiceID, claims.UserID)
+	if err == sql.ErrNoRows {
+		sendErrorResponse(w, "Invoice not found or access denied", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	content, err := efactura.Marshal(invoice)
+	if err != nil {
+		sendEFacturaError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.xml"`, invoice.Number))
+	w.Write(content)
+}
+
+// Download the e-Factura XML of all invoices issued in a period as a zip archive.
+// Query params: from, to (YYYY-MM-DD, default the current month), optional gym_id.
+// Invoices that fail validation are listed in validation-errors.txt instead.
+func (app *App) exportEFacturaBatch(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := app.DB.Query(`SELECT i.id FROM invoices i
+	                           INNER JOIN user_clients uc ON uc.client_id = i.client_id
+	                           WHERE uc.user_id = $1
+	                             AND i.status <> 'cancelled'
+	                             AND i.issue_date BETWEEN $2 AND $3
+	                             AND ($4 = 0 OR i.gym_id = $4)
+	                           ORDER BY i.series_code, i.number`,
+		claims.UserID, from.Format("2006-01-02"), to.Format("2006-01-02"), gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch invoices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var invoiceIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			sendErrorResponse(w, "Failed to scan invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		invoiceIDs = append(invoiceIDs, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	var report strings.Builder
+	for _, invoiceID := range invoiceIDs {
+		invoice, err := app.loadEFacturaInvoice(invoiceID, claims.UserID)
+		if err != nil {
+			sendErrorResponse(w, "Failed to fetch invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		content, err := efactura.Marshal(invoice)
+		if err != nil {
+			fmt.Fprintf(&report, "%s: %v\n", invoice.Number, err)
+			continue
+		}
+
+		f, err := archive.Create(invoice.Number + ".xml")
+		if err == nil {
+			_, err = f.Write(content)
+		}
+		if err != nil {
+			sendErrorResponse(w, "Failed to build archive: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if report.Len() > 0 {
+		f, err := archive.Create("validation-errors.txt")
+		if err == nil {
+			_, err = f.Write([]byte(report.String()))
+		}
+		if err != nil {
+			sendErrorResponse(w, "Failed to build archive: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		sendErrorResponse(w, "Failed to build archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="efactura_%s_%s.zip"`,
+		from.Format("20060102"), to.Format("20060102")))
+	w.Write(buf.Bytes())
+}
+
+// loadEFacturaInvoice builds the e-Factura model of an invoice the user can access,
+// with the client as buyer and the configured seller
+func (app *App) loadEFacturaInvoice(invoiceID, userID int) (efactura.Invoice, error) {
+	var inv efactura.Invoice
+	var issueDate, dueDate string
+	var clientType, streetName, streetNo, building, floor, apartment string
+
+	query := `SELECT i.series_code || '-' || LPAD(i.number::text, 6, '0'),
+	                 TO_CHAR(i.issue_date, 'YYYY-MM-DD'), COALESCE(TO_CHAR(i.due_date, 'YYYY-MM-DD'), ''),
+	                 COALESCE(i.currency, 'RON'), i.total_amount, i.paid_amount,
+	                 c.name, COALESCE(c.client_type, 'person'), COALESCE(c.cif, ''),
+	                 COALESCE(c.trade_register_no, ''),
+	                 COALESCE(c.street_name, ''), COALESCE(c.street_no, ''), COALESCE(c.building, ''),
+	                 COALESCE(c.floor, ''), COALESCE(c.apartment, ''), COALESCE(c.city, ''),
+	                 COALESCE(s.iso_code, ''), COALESCE(co.iso_code, 'RO'),
+	                 COALESCE(c.email, ''), COALESCE(c.phone, ''),
+	                 COALESCE(ci.series_code || '-' || LPAD(ci.number::text, 6, '0'), '')
+	          FROM invoices i
+	          INNER JOIN clients c ON c.id = i.client_id
+	          INNER JOIN user_clients uc ON uc.client_id = i.client_id
+	          LEFT JOIN invoices ci ON ci.id = i.credited_invoice_id
+	          LEFT JOIN states s ON s.id = c.state_id
+	          LEFT JOIN countries co ON co.id = c.country_id
+	          WHERE uc.user_id = $1 AND i.id = $2`
+
+	err := app.DB.QueryRow(query, userID, invoiceID).Scan(&inv.Number, &issueDate, &dueDate,
+		&inv.Currency, &inv.TotalAmount, &inv.PaidAmount,
+		&inv.Buyer.Name, &clientType, &inv.Buyer.CompanyID, &inv.Buyer.TradeRegisterNo,
+		&streetName, &streetNo, &building, &floor, &apartment, &inv.Buyer.City,
+		&inv.Buyer.County, &inv.Buyer.CountryCode, &inv.Buyer.Email, &inv.Buyer.Phone,
+		&inv.PrecedingInvoice)
+	if err != nil {
+		return inv, err
+	}
+	// A credit note is settled against the invoice it reverses, so nothing is prepaid on it
+	if inv.PrecedingInvoice != "" {
+		inv.PaidAmount = 0
+	}
+
+	inv.IssueDate, err = time.Parse("2006-01-02", issueDate)
+	if err != nil {
+		return inv, err
+	}
+	if dueDate != "" {
+		if inv.DueDate, err = time.Parse("2006-01-02", dueDate); err != nil {
+			return inv, err
+		}
+	}
+	inv.Buyer.Person = clientType != clientTypeCompany
+	inv.Buyer.WalkIn = clientType == clientTypeGuest
+	inv.Buyer.Street = formatStreet(streetName, streetNo, building, floor, apartment)
+	inv.Seller = app.sellerParty()
+	inv.IBAN = app.Config.SellerIBAN
+
+	rows, err := app.DB.Query(`SELECT COALESCE(description, ''), quantity, unit_price, net_amount,
+	                                  COALESCE(vat_rate, 0), COALESCE(vat_amount, 0)
+	                           FROM invoice_lines
+	                           WHERE invoice_id = $1
+	                           ORDER BY id`, invoiceID)
+	if err != nil {
+		return inv, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line efactura.Line
+		if err := rows.Scan(&line.Description, &line.Quantity, &line.UnitPrice, &line.NetAmount,
+			&line.VATRate, &line.VATAmount); err != nil {
+			return inv, err
+		}
+		inv.Lines = append(inv.Lines, line)
+	}
+	return inv, rows.Err()
+}
+
+func (app *App) sellerParty() efactura.Party {
+	return efactura.Party{
+		Name:            app.Config.SellerName,
+		CompanyID:       app.Config.SellerCUI,
+		TradeRegisterNo: app.Config.SellerTradeRegisterNo,
+		Street:          app.Config.SellerStreet,
+		City:            app.Config.SellerCity,
+		County:          app.Config.SellerCounty,
+		CountryCode:     app.Config.SellerCountry,
+		Email:           app.Config.SellerEmail,
+		Phone:           app.Config.SellerPhone,
+	}
+}
+
+// formatStreet joins the address parts the Romanian way: "Str. Lunga nr. 5, bl. A2, et. 3, ap. 12"
+func formatStreet(streetName, streetNo, building, floor, apartment string) string {
+	parts := []string{strings.TrimSpace(streetName)}
+	if streetNo != "" {
+		parts[0] += " nr. " + streetNo
+	}
+	if building != "" {
+		parts = append(parts, "bl. "+building)
+	}
+	if floor != "" {
+		parts = append(parts, "et. "+floor)
+	}
+	if apartment != "" {
+		parts = append(parts, "ap. "+apartment)
+	}
+	if parts[0] == "" {
+		return ""
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sendEFacturaError reports e-Factura rule violations as field errors keyed by business term
+func sendEFacturaError(w http.ResponseWriter, err error) {
+	var problems efactura.Problems
+	if !errors.As(err, &problems) {
+		sendErrorResponse(w, "Failed to build e-Factura: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fieldErrs := make(ValidationErrors, len(problems))
+	for i, problem := range problems {
+		fieldErrs[i] = FieldError{Field: problem.Term, Message: problem.Message}
+	}
+	sendValidationErrorResponse(w, fieldErrs)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"log"
+	"time"
+)
+
+// RenewalReminder is a membership that just entered the reminder window
+type RenewalReminder struct {
+	ClientMembershipID int    `json:"client_membership_id"`
+	ClientID           int    `json:"client_id"`
+	ClientName         string `json:"client_name"`
+	MembershipName     string `json:"membership_name"`
+	EndingOn           string `json:"ending_on"`
+	DaysLeft           int    `json:"days_left"`
+}
+
+// Start the periodic membership maintenance jobs (expiry, renewal reminders and automatic renewals)
+func (app *App) startMembershipJobs() {
+	ticker := time.NewTicker(app.Config.MembershipJobInterval)
+	go func() {
+		// Run once at startup so a restart does not delay expiry by a full interval
+		app.runMembershipJobs()
+		for {
+			select {
+			case <-ticker.C:
+				app.runMembershipJobs()
+			}
+		}
+	}()
+}
+
+func (app *App) runMembershipJobs() {
+	expired, err := app.expireMemberships()
+	if err != nil {
+		log.Printf("membership job: failed to expire memberships: %v", err)
+	} else if expired > 0 {
+		log.Printf("membership job: %d membership(s) marked as expired", expired)
+	}
+
+	reminders, err := app.queueRenewalReminders(app.Config.ReminderDays)
+	if err != nil {
+		log.Printf("membership job: failed to queue renewal reminders: %v", err)
+	}
+	for _, reminder := range reminders {
+		app.emitRenewalReminder(reminder)
+	}
+
+	app.runBillingJobs()
+	app.applyReferralRewards()
+	app.generateClassSessions(0)
+	app.detectNoShows()
+}
+
+// expireMemberships moves active memberships past their ending date to 'expired'
+func (app *App) expireMemberships() (int, error) {
+	var count int
+	err := app.DB.QueryRow("SELECT expire_client_memberships()").Scan(&count)
+	return count, err
+}
+
+// queueRenewalReminders records a reminder for every active membership ending within
+// the given number of days. Memberships already reminded for this lead time, and those
+// that renew automatically, are skipped.
+func (app *App) queueRenewalReminders(days int) ([]RenewalReminder, error) {
+	if days <= 0 {
+		return nil, nil
+	}
+
+	query := `WITH queued AS (
+	              INSERT INTO membership_reminders (client_membership_id, client_id, days_before, ending_on)
+	              SELECT cm.id, cm.client_id, $1, cm.ending_on
+	              FROM client_memberships cm
+	              WHERE cm.status = 'active'
+	                AND NOT COALESCE(cm.auto_renew, false)
+	                AND cm.ending_on BETWEEN CURRENT_DATE AND CURRENT_DATE + $1::integer
+	              ON CONFLICT (client_membership_id, days_before) DO NOTHING
+	              RETURNING client_membership_id, client_id, ending_on
+	          )
+	          SELECT q.client_membership_id, q.client_id, COALESCE(c.name, ''), COALESCE(m.name, ''),
+	                 TO_CHAR(q.ending_on, 'YYYY-MM-DD'), q.ending_on - CURRENT_DATE
+	          FROM queued q
+	          INNER JOIN client_memberships cm ON cm.id = q.client_membership_id
+	          LEFT JOIN clients c ON c.id = q.client_id
+	          LEFT JOIN memberships m ON m.id = cm.membership_id`
+
+	rows, err := app.DB.Query(query, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reminders []RenewalReminder
+	for rows.Next() {
+		var reminder RenewalReminder
+		err := rows.Scan(&reminder.ClientMembershipID, &reminder.ClientID, &reminder.ClientName,
+			&reminder.MembershipName, &reminder.EndingOn, &reminder.DaysLeft)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	return reminders, rows.Err()
+}
+
+func (app *App) emitRenewalReminder(reminder RenewalReminder) {
+	err := app.Notifier.NotifyClient(reminder.ClientID, "membership_renewal_reminder", reminder)
+	if err == errNoContactChannel {
+		log.Printf("renewal reminder: client %d (%s) has no reachable contact channel, skipped",
+			reminder.ClientID, reminder.ClientName)
+		return
+	}
+	if err != nil {
+		log.Printf("renewal reminder: failed to queue notification for client %d: %v", reminder.ClientID, err)
+	}
+}
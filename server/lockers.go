@@ -0,0 +1,648 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	lockerAssignmentDaily  = "daily"
+	lockerAssignmentRental = "rental"
+)
+
+type Locker struct {
+	ID         int               `json:"id"`
+	GymID      int               `json:"gym_id"`
+	Code       string            `json:"code"`
+	Location   string            `json:"location,omitempty"`
+	IsActive   bool              `json:"is_active"`
+	Status     string            `json:"status"` // free, occupied or out_of_service
+	Assignment *LockerAssignment `json:"assignment,omitempty"`
+}
+
+type LockerAssignment struct {
+	ID             int    `json:"id"`
+	LockerID       int    `json:"locker_id"`
+	LockerCode     string `json:"locker_code"`
+	GymID          int    `json:"gym_id"`
+	ClientID       int    `json:"client_id"`
+	ClientName     string `json:"client_name"`
+	AssignmentType string `json:"assignment_type"` // daily or rental
+	ClientPassID   *int   `json:"client_pass_id,omitempty"`
+	AssignedOn     string `json:"assigned_on"`
+	ValidUntil     string `json:"valid_until"`
+	Note           string `json:"note,omitempty"`
+	ReleasedOn     string `json:"released_on,omitempty"`
+	ReleaseReason  string `json:"release_reason,omitempty"` // checkout or manual
+	DaysOverdue    int    `json:"days_overdue,omitempty"`
+}
+
+// CreateLockersRequest adds one locker, or a batch with Codes
+type CreateLockersRequest struct {
+	Code     string   `json:"code,omitempty"`
+	Codes    []string `json:"codes,omitempty"`
+	Location string   `json:"location,omitempty"`
+}
+
+type UpdateLockerRequest struct {
+	Code     string `json:"code"`
+	Location string `json:"location,omitempty"`
+	IsActive *bool  `json:"is_active,omitempty"`
+}
+
+type AssignLockerRequest struct {
+	ClientID       int    `json:"client_id"`
+	AssignmentType string `json:"assignment_type"`       // daily (for the current visit) or rental
+	ValidUntil     string `json:"valid_until,omitempty"` // last day of a rental, YYYY-MM-DD
+	Note           string `json:"note,omitempty"`
+}
+
+// lockerAssignmentQuery selects locker assignments with the locker code and client name
+const lockerAssignmentQuery = `SELECT la.id, la.locker_id, COALESCE(l.code, ''), la.gym_id, la.client_id,
+                                      COALESCE(c.name, ''), la.assignment_type, la.client_pass_id,
+                                      TO_CHAR(la.assigned_on, 'YYYY-MM-DD HH24:MI:SS'),
+                                      TO_CHAR(la.valid_until, 'YYYY-MM-DD'), COALESCE(la.note, ''),
+                                      COALESCE(TO_CHAR(la.released_on, 'YYYY-MM-DD HH24:MI:SS'), ''),
+                                      COALESCE(la.release_reason, ''),
+                                      CASE WHEN la.released_on IS NULL
+                                           THEN GREATEST(CURRENT_DATE - la.valid_until, 0) ELSE 0 END
+                               FROM locker_assignments la
+                               LEFT JOIN lockers l ON l.id = la.locker_id
+                               LEFT JOIN clients c ON c.id = la.client_id`
+
+func scanLockerAssignment(scanner interface{ Scan(...interface{}) error }, a *LockerAssignment) error {
+	return scanner.Scan(&a.ID, &a.LockerID, &a.LockerCode, &a.GymID, &a.ClientID, &a.ClientName,
+		&a.AssignmentType, &a.ClientPassID, &a.AssignedOn, &a.ValidUntil, &a.Note, &a.ReleasedOn,
+		&a.ReleaseReason, &a.DaysOverdue)
+}
+
+// List the lockers of a gym with who is using them
+func (app *App) getGymLockers(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "free" && status != "occupied" && status != "out_of_service" {
+		sendErrorResponse(w, "Invalid status parameter (free, occupied or out_of_service)", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	lockers, err := app.loadGymLockers(gymID, 0)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch lockers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filtered := []Locker{}
+	for _, locker := range lockers {
+		if status == "" || locker.Status == status {
+			filtered = append(filtered, locker)
+		}
+	}
+
+	sendSuccessResponse(w, "Lockers retrieved successfully", filtered)
+}
+
+// Add lockers to a gym's inventory
+func (app *App) createGymLockers(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateLockersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	codes := req.Codes
+	if req.Code != "" {
+		codes = append(codes, req.Code)
+	}
+	var fieldErrs ValidationErrors
+	if len(codes) == 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "code", Message: "code or codes is required"})
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		codes[i] = strings.TrimSpace(code)
+		key := strings.ToUpper(codes[i])
+		if codes[i] == "" || len(codes[i]) > 16 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "codes", Message: "locker codes must have between 1 and 16 characters"})
+		} else if seen[key] {
+			fieldErrs = append(fieldErrs, FieldError{Field: "codes", Message: fmt.Sprintf("locker %s is listed twice", codes[i])})
+		}
+		seen[key] = true
+	}
+	if len(req.Location) > 64 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "location", Message: "location cannot exceed 64 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// Start a transaction
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we rollback if something goes wrong
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, code := range codes {
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM lockers WHERE gym_id = $1 AND upper(code) = upper($2))`,
+			gymID, code).Scan(&exists)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			tx.Rollback()
+			sendValidationErrorResponse(w, ValidationErrors{{Field: "codes", Message: fmt.Sprintf("locker %s already exists at this gym", code)}})
+			return
+		}
+
+		_, err = tx.Exec(`INSERT INTO lockers (gym_id, code, location, created_by) VALUES ($1, $2, $3, $4)`,
+			gymID, code, nullIfEmpty(strings.TrimSpace(req.Location)), claims.UserID)
+		if err != nil {
+			sendErrorResponse(w, "Failed to create locker: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Lockers created successfully", map[string]interface{}{
+		"status": "OK",
+		"gym_id": gymID,
+		"codes":  codes,
+	})
+}
+
+// Rename a locker, move it or take it out of service
+func (app *App) updateGymLocker(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	lockerID, err := strconv.Atoi(vars["locker_id"])
+	if err != nil || lockerID <= 0 {
+		sendErrorResponse(w, "Invalid locker_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateLockerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Code = strings.TrimSpace(req.Code)
+	var fieldErrs ValidationErrors
+	if req.Code == "" || len(req.Code) > 16 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "code", Message: "code must have between 1 and 16 characters"})
+	}
+	if len(req.Location) > 64 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "location", Message: "location cannot exceed 64 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM lockers WHERE gym_id = $1 AND upper(code) = upper($2) AND id <> $3)`,
+		gymID, req.Code, lockerID).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "code", Message: "a locker with this code already exists at this gym"}})
+		return
+	}
+
+	// An assigned locker has to be released before it goes out of service
+	if !*req.IsActive {
+		err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM locker_assignments WHERE locker_id = $1 AND released_on IS NULL)`,
+			lockerID).Scan(&exists)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			sendErrorResponse(w, "Locker is assigned; release it first", http.StatusConflict)
+			return
+		}
+	}
+
+	result, err := app.DB.Exec(`UPDATE lockers SET code = $1, location = $2, is_active = $3
+	                            WHERE id = $4 AND gym_id = $5`,
+		req.Code, nullIfEmpty(strings.TrimSpace(req.Location)), *req.IsActive, lockerID, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update locker: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "Locker not found", http.StatusNotFound)
+		return
+	}
+
+	app.sendGymLocker(w, "Locker updated successfully", gymID, lockerID)
+}
+
+// Give a locker to a client, for the current visit or as a rental
+func (app *App) assignGymLocker(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	lockerID, err := strconv.Atoi(vars["locker_id"])
+	if err != nil || lockerID <= 0 {
+		sendErrorResponse(w, "Invalid locker_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req AssignLockerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var fieldErrs ValidationErrors
+	if req.ClientID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "client_id", Message: "Valid client_id is required"})
+	}
+	if req.AssignmentType == "" {
+		req.AssignmentType = lockerAssignmentDaily
+	}
+	switch req.AssignmentType {
+	case lockerAssignmentDaily:
+		req.ValidUntil = ""
+	case lockerAssignmentRental:
+		if req.ValidUntil == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_until", Message: "rentals need an end date"})
+		} else if _, err := time.Parse("2006-01-02", req.ValidUntil); err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_until", Message: "date must be in YYYY-MM-DD format"})
+		}
+	default:
+		fieldErrs = append(fieldErrs, FieldError{Field: "assignment_type", Message: "assignment type must be daily or rental"})
+	}
+	if len(req.Note) > 256 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "note", Message: "note cannot exceed 256 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the gym and the client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN lockers l ON l.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND l.id = $3)
+	                      AND EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $4)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, lockerID, req.ClientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Locker or client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT assign_locker($1, $2, $3, $4, $5, $6)", lockerID, req.ClientID,
+		req.AssignmentType, nullIfEmpty(req.ValidUntil), nullIfEmpty(req.Note), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.sendGymLocker(w, "Locker assigned successfully", gymID, lockerID)
+}
+
+// Take a locker back from the client using it
+func (app *App) releaseGymLocker(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	lockerID, err := strconv.Atoi(vars["locker_id"])
+	if err != nil || lockerID <= 0 {
+		sendErrorResponse(w, "Invalid locker_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the locker's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN lockers l ON l.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND l.id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, lockerID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Locker not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT release_locker($1, $2)", lockerID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.sendGymLocker(w, "Locker released successfully", gymID, lockerID)
+}
+
+// List a client's lockers, current first
+func (app *App) getClientLockers(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	currentOnly := r.URL.Query().Get("current_only") == "true"
+
+	rows, err := app.DB.Query(lockerAssignmentQuery+` WHERE la.client_id = $1
+	                                                   AND ($2 = false OR la.released_on IS NULL)
+	                                                 ORDER BY la.released_on IS NULL DESC, la.assigned_on DESC
+	                                                 LIMIT 100`, clientID, currentOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch lockers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var assignments []LockerAssignment
+	for rows.Next() {
+		var assignment LockerAssignment
+		if err := scanLockerAssignment(rows, &assignment); err != nil {
+			sendErrorResponse(w, "Failed to scan locker assignment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no lockers found, return empty array instead of null
+	if assignments == nil {
+		assignments = []LockerAssignment{}
+	}
+
+	sendSuccessResponse(w, "Client lockers retrieved successfully", assignments)
+}
+
+// loadGymLockers reads the lockers of a gym, or only lockerID, with their current assignment
+func (app *App) loadGymLockers(gymID, lockerID int) ([]Locker, error) {
+	rows, err := app.DB.Query(`SELECT l.id, l.gym_id, l.code, COALESCE(l.location, ''), COALESCE(l.is_active, false)
+	                           FROM lockers l
+	                           WHERE l.gym_id = $1 AND ($2 = 0 OR l.id = $2)
+	                           ORDER BY l.code`, gymID, lockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lockers := []Locker{}
+	index := map[int]int{}
+	for rows.Next() {
+		var locker Locker
+		if err := rows.Scan(&locker.ID, &locker.GymID, &locker.Code, &locker.Location, &locker.IsActive); err != nil {
+			return nil, err
+		}
+		locker.Status = "free"
+		if !locker.IsActive {
+			locker.Status = "out_of_service"
+		}
+		index[locker.ID] = len(lockers)
+		lockers = append(lockers, locker)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	assignmentRows, err := app.DB.Query(lockerAssignmentQuery+` WHERE la.gym_id = $1 AND ($2 = 0 OR la.locker_id = $2)
+	                                                              AND la.released_on IS NULL`, gymID, lockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer assignmentRows.Close()
+
+	for assignmentRows.Next() {
+		var assignment LockerAssignment
+		if err := scanLockerAssignment(assignmentRows, &assignment); err != nil {
+			return nil, err
+		}
+		if i, ok := index[assignment.LockerID]; ok {
+			lockers[i].Status = "occupied"
+			lockers[i].Assignment = &assignment
+		}
+	}
+
+	return lockers, assignmentRows.Err()
+}
+
+// sendGymLocker responds with a locker and its current assignment
+func (app *App) sendGymLocker(w http.ResponseWriter, message string, gymID, lockerID int) {
+	lockers, err := app.loadGymLockers(gymID, lockerID)
+	if err != nil || len(lockers) == 0 {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status":    "OK",
+			"gym_id":    gymID,
+			"locker_id": lockerID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, lockers[0])
+}
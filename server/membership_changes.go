@@ -0,0 +1,368 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	membershipChangeUpgrade   = "upgrade"
+	membershipChangeDowngrade = "downgrade"
+)
+
+type ChangeMembershipPlanRequest struct {
+	MembershipID int    `json:"membership_id"`
+	GymID        int    `json:"gym_id,omitempty"` // Gym whose price list applies to the new plan; default prices when omitted
+	Reason       string `json:"reason,omitempty"`
+}
+
+type TransferMembershipRequest struct {
+	ToClientID int    `json:"to_client_id"`
+	Reason     string `json:"reason"`
+}
+
+// ClientMembershipChange is the audit record of a plan change or transfer; the
+// current membership ends and new_client_membership_id continues it
+type ClientMembershipChange struct {
+	ID                    int     `json:"id"`
+	ChangeType            string  `json:"change_type"` // upgrade, downgrade or transfer
+	ClientMembershipID    int     `json:"client_membership_id"`
+	NewClientMembershipID int     `json:"new_client_membership_id"`
+	FromClientID          int     `json:"from_client_id"`
+	ToClientID            int     `json:"to_client_id"`
+	FromMembershipID      int     `json:"from_membership_id"`
+	FromMembershipName    string  `json:"from_membership_name"`
+	ToMembershipID        int     `json:"to_membership_id"`
+	ToMembershipName      string  `json:"to_membership_name"`
+	EffectiveOn           string  `json:"effective_on"`
+	CreditAmount          float64 `json:"credit_amount"`
+	CreditNoteID          *int    `json:"credit_note_id"`
+	CreditNoteNo          string  `json:"credit_note_no,omitempty"`
+	InvoiceID             *int    `json:"invoice_id"` // Invoice of the new plan; transfers are not invoiced
+	RefundAmount          float64 `json:"refund_amount"`
+	RefundMethod          string  `json:"refund_method,omitempty"`
+	Reason                string  `json:"reason,omitempty"`
+	CreatedOn             string  `json:"created_on"`
+	CreatedBy             *int    `json:"created_by"`
+}
+
+// membershipChangeQuery selects membership changes with the plan names and credit note number
+const membershipChangeQuery = `SELECT ch.id, ch.change_type, ch.client_membership_id, ch.new_client_membership_id,
+                                      ch.from_client_id, ch.to_client_id, ch.from_membership_id, COALESCE(fm.name, ''),
+                                      ch.to_membership_id, COALESCE(tm.name, ''), TO_CHAR(ch.effective_on, 'YYYY-MM-DD'),
+                                      COALESCE(ch.credit_amount, 0), ch.credit_note_id,
+                                      COALESCE(cn.series_code || '-' || LPAD(cn.number::text, 6, '0'), ''),
+                                      ch.invoice_id, COALESCE(ch.refund_amount, 0), COALESCE(ch.refund_method, ''),
+                                      COALESCE(ch.reason, ''), TO_CHAR(ch.created_on, 'YYYY-MM-DD HH24:MI:SS'),
+                                      ch.created_by
+                               FROM client_membership_changes ch
+                               LEFT JOIN memberships fm ON fm.id = ch.from_membership_id
+                               LEFT JOIN memberships tm ON tm.id = ch.to_membership_id
+                               LEFT JOIN invoices cn ON cn.id = ch.credit_note_id`
+
+func scanMembershipChange(scanner interface{ Scan(...interface{}) error }, c *ClientMembershipChange) error {
+	return scanner.Scan(&c.ID, &c.ChangeType, &c.ClientMembershipID, &c.NewClientMembershipID, &c.FromClientID,
+		&c.ToClientID, &c.FromMembershipID, &c.FromMembershipName, &c.ToMembershipID, &c.ToMembershipName,
+		&c.EffectiveOn, &c.CreditAmount, &c.CreditNoteID, &c.CreditNoteNo, &c.InvoiceID, &c.RefundAmount,
+		&c.RefundMethod, &c.Reason, &c.CreatedOn, &c.CreatedBy)
+}
+
+// Move a client membership to a higher level plan
+func (app *App) upgradeClientMembership(w http.ResponseWriter, r *http.Request) {
+	app.changeClientMembershipPlan(w, r, membershipChangeUpgrade)
+}
+
+// Move a client membership to a lower level plan
+func (app *App) downgradeClientMembership(w http.ResponseWriter, r *http.Request) {
+	app.changeClientMembershipPlan(w, r, membershipChangeDowngrade)
+}
+
+// changeClientMembershipPlan ends the current membership and starts the new plan
+// today. The unused part of the current plan is credited against what is owed,
+// first on the old invoice and then on the new plan's invoice; the rest is refunded.
+func (app *App) changeClientMembershipPlan(w http.ResponseWriter, r *http.Request, changeType string) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientMembershipID, err := strconv.Atoi(vars["client_membership_id"])
+	if err != nil || clientMembershipID <= 0 {
+		sendErrorResponse(w, "Invalid client_membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req ChangeMembershipPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.MembershipID <= 0 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "membership_id", Message: "Valid membership_id is required"}})
+		return
+	}
+	if req.GymID < 0 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "gym_id", Message: "gym_id must be a positive number"}})
+		return
+	}
+
+	// Check if user has permission for the membership's client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM client_memberships cm
+	                                  INNER JOIN user_clients uc ON uc.client_id = cm.client_id
+	                                  WHERE cm.id = $1 AND cm.client_id = $2 AND uc.user_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, clientMembershipID, clientID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// Start a transaction; the function returns an error after partial changes
+	// when the new plan cannot be sold or invoiced
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we rollback if something goes wrong
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT change_client_membership_plan($1, $2, $3, $4, $5, $6)", clientMembershipID,
+		req.MembershipID, nullIfZero(req.GymID), changeType, nullIfEmpty(strings.TrimSpace(req.Reason)),
+		claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	message := "Client membership upgraded successfully"
+	if changeType == membershipChangeDowngrade {
+		message = "Client membership downgraded successfully"
+	}
+	app.sendMembershipChange(w, message, clientMembershipID, claims.UserID)
+}
+
+// Transfer the rest of a paid membership to another client. The current holder's
+// access ends yesterday and the new holder gets the remaining period and entries.
+func (app *App) transferClientMembership(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientMembershipID, err := strconv.Atoi(vars["client_membership_id"])
+	if err != nil || clientMembershipID <= 0 {
+		sendErrorResponse(w, "Invalid client_membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req TransferMembershipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var fieldErrs ValidationErrors
+	if req.ToClientID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "to_client_id", Message: "Valid to_client_id is required"})
+	} else if req.ToClientID == clientID {
+		fieldErrs = append(fieldErrs, FieldError{Field: "to_client_id", Message: "Membership already belongs to this client"})
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "reason", Message: "Transfer reason is required"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the membership's client and the new holder
+	var count int
+	permissionQuery := `SELECT COUNT(DISTINCT uc.client_id) FROM user_clients uc
+	                    WHERE uc.user_id = $1 AND uc.client_id IN ($2, $3)
+	                      AND EXISTS(SELECT 1 FROM client_memberships cm WHERE cm.id = $4 AND cm.client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID, req.ToClientID, clientMembershipID).Scan(&count)
+	if err != nil || count < 2 {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT transfer_client_membership($1, $2, $3, $4)", clientMembershipID,
+		req.ToClientID, strings.TrimSpace(req.Reason), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.sendMembershipChange(w, "Client membership transferred successfully", clientMembershipID, claims.UserID)
+}
+
+// List the plan changes and transfers of a client, given or received
+func (app *App) getClientMembershipChanges(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(membershipChangeQuery+` WHERE ch.from_client_id = $1 OR ch.to_client_id = $1
+	                                                  ORDER BY ch.created_on DESC, ch.id DESC`, clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch membership changes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var changes []ClientMembershipChange
+	for rows.Next() {
+		var change ClientMembershipChange
+		if err := scanMembershipChange(rows, &change); err != nil {
+			sendErrorResponse(w, "Failed to scan membership change: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		changes = append(changes, change)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no changes found, return empty array instead of null
+	if changes == nil {
+		changes = []ClientMembershipChange{}
+	}
+
+	sendSuccessResponse(w, "Membership changes retrieved successfully", changes)
+}
+
+// loadClientMembershipChange reads the latest change made to a client membership
+func (app *App) loadClientMembershipChange(clientMembershipID int) (*ClientMembershipChange, error) {
+	var change ClientMembershipChange
+	err := scanMembershipChange(app.DB.QueryRow(membershipChangeQuery+` WHERE ch.client_membership_id = $1
+	                                                                   ORDER BY ch.id DESC
+	                                                                   LIMIT 1`, clientMembershipID), &change)
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// sendMembershipChange responds with the change record, the membership continuing
+// the old one and its invoice
+func (app *App) sendMembershipChange(w http.ResponseWriter, message string, clientMembershipID, userID int) {
+	change, err := app.loadClientMembershipChange(clientMembershipID)
+	if err != nil {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status":               "OK",
+			"client_membership_id": clientMembershipID,
+		})
+		return
+	}
+
+	response := map[string]interface{}{
+		"change": change,
+	}
+	if clientMembership, err := app.loadClientMembership(change.NewClientMembershipID); err == nil {
+		response["client_membership"] = clientMembership
+	}
+	if change.InvoiceID != nil {
+		if invoice, err := app.loadMembershipInvoice(change.NewClientMembershipID, userID); err == nil && invoice != nil {
+			response["invoice"] = invoice
+		}
+	}
+
+	sendSuccessResponse(w, message, response)
+}
@@ -2,7 +2,15 @@ package server
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
 )
 
 // Add this struct to your existing code
@@ -11,6 +19,27 @@ type Membership struct {
 	Name     string `json:"name"`
 	IsActive bool   `json:"is_active"`
 	DaysNo   int    `json:"days_no"`
+
+	// "time", "entries", "hybrid" or "day"; entry plans use their entries within DaysNo days
+	PlanType  string `json:"plan_type"`
+	EntriesNo *int   `json:"entries_no"`
+
+	// Guests a member can bring during the membership
+	GuestPassesNo int `json:"guest_passes_no"`
+
+	// Allowed entry windows in the gym's time zone; empty means no restriction
+	TimeWindows []TimeWindow `json:"time_windows"`
+}
+
+// TimeWindow allows entry on an ISO weekday (1 = Monday) between StartTime and EndTime (HH:MM, end exclusive)
+type TimeWindow struct {
+	Weekday   int    `json:"weekday"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+type UpdateTimeWindowsRequest struct {
+	TimeWindows []TimeWindow `json:"time_windows"`
 }
 
 func (app *App) getMemberships(w http.ResponseWriter, r *http.Request) {
@@ -27,11 +56,15 @@ func (app *App) getMemberships(w http.ResponseWriter, r *http.Request) {
 
 	if activeOnly == "true" {
 		// Only return active memberships
-		query = "SELECT id, name, is_active, days_no FROM memberships WHERE is_active = true ORDER BY level"
+		query = `SELECT id, name, is_active, days_no, COALESCE(plan_type, 'time'), entries_no,
+		         COALESCE(guest_passes_no, 0)
+		         FROM memberships WHERE is_active = true ORDER BY level`
 		rows, err = app.DB.Query(query)
 	} else {
 		// Return all memberships
-		query = "SELECT id, name, is_active, days_no FROM memberships ORDER BY level"
+		query = `SELECT id, name, is_active, days_no, COALESCE(plan_type, 'time'), entries_no,
+		         COALESCE(guest_passes_no, 0)
+		         FROM memberships ORDER BY level`
 		rows, err = app.DB.Query(query)
 	}
 
@@ -44,7 +77,8 @@ func (app *App) getMemberships(w http.ResponseWriter, r *http.Request) {
 	var memberships []Membership
 	for rows.Next() {
 		var membership Membership
-		err := rows.Scan(&membership.ID, &membership.Name, &membership.IsActive, &membership.DaysNo)
+		err := rows.Scan(&membership.ID, &membership.Name, &membership.IsActive, &membership.DaysNo,
+			&membership.PlanType, &membership.EntriesNo, &membership.GuestPassesNo)
 		if err != nil {
 			sendErrorResponse(w, "Failed to scan membership data", http.StatusInternalServerError)
 			return
@@ -63,5 +97,171 @@ func (app *App) getMemberships(w http.ResponseWriter, r *http.Request) {
 		memberships = []Membership{}
 	}
 
+	windows, err := app.loadTimeWindows()
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch membership time windows", http.StatusInternalServerError)
+		return
+	}
+	for i := range memberships {
+		memberships[i].TimeWindows = windows[memberships[i].ID]
+		if memberships[i].TimeWindows == nil {
+			memberships[i].TimeWindows = []TimeWindow{}
+		}
+	}
+
 	sendSuccessResponse(w, "Memberships retrieved successfully", memberships)
 }
+
+// Replace the time windows of a membership (an empty list removes the restriction)
+func (app *App) updateMembershipTimeWindows(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	membershipID, err := strconv.Atoi(vars["membership_id"])
+	if err != nil || membershipID <= 0 {
+		sendErrorResponse(w, "Invalid membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateTimeWindowsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateTimeWindows(req.TimeWindows); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Only users of a gym offering the membership may change its windows
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM membership_gyms mg
+	                                  INNER JOIN user_gyms ug ON ug.gym_id = mg.gym_id
+	                                  WHERE mg.membership_id = $1 AND ug.user_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, membershipID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Membership not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("DELETE FROM membership_time_windows WHERE membership_id = $1", membershipID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update time windows: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, window := range req.TimeWindows {
+		_, err = tx.Exec(`INSERT INTO membership_time_windows (membership_id, weekday, start_time, end_time, created_by)
+		                  VALUES ($1, $2, $3, $4, $5)`,
+			membershipID, window.Weekday, window.StartTime, window.EndTime, claims.UserID)
+		if err != nil {
+			sendErrorResponse(w, "Failed to update time windows: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	if req.TimeWindows == nil {
+		req.TimeWindows = []TimeWindow{}
+	}
+	sendSuccessResponse(w, "Membership time windows updated successfully", map[string]interface{}{
+		"membership_id": membershipID,
+		"time_windows":  req.TimeWindows,
+	})
+}
+
+// loadTimeWindows returns the time windows of all memberships keyed by membership id
+func (app *App) loadTimeWindows() (map[int][]TimeWindow, error) {
+	rows, err := app.DB.Query(`SELECT membership_id, weekday,
+	                                  TO_CHAR(start_time, 'HH24:MI'), TO_CHAR(end_time, 'HH24:MI')
+	                           FROM membership_time_windows
+	                           ORDER BY membership_id, weekday, start_time`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := make(map[int][]TimeWindow)
+	for rows.Next() {
+		var membershipID int
+		var window TimeWindow
+		if err := rows.Scan(&membershipID, &window.Weekday, &window.StartTime, &window.EndTime); err != nil {
+			return nil, err
+		}
+		windows[membershipID] = append(windows[membershipID], window)
+	}
+	return windows, rows.Err()
+}
+
+// validateTimeWindows checks weekdays and HH:MM times and rejects overlapping windows on the same day
+func validateTimeWindows(windows []TimeWindow) ValidationErrors {
+	var fieldErrs ValidationErrors
+	type span struct{ start, end time.Time }
+	byDay := make(map[int][]span)
+
+	for i, window := range windows {
+		field := fmt.Sprintf("time_windows[%d]", i)
+		if window.Weekday < 1 || window.Weekday > 7 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".weekday", Message: "weekday must be between 1 (Monday) and 7 (Sunday)"})
+		}
+		start, err := time.Parse("15:04", window.StartTime)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".start_time", Message: "start time must be in HH:MM format"})
+			continue
+		}
+		end, err := time.Parse("15:04", window.EndTime)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".end_time", Message: "end time must be in HH:MM format"})
+			continue
+		}
+		if !end.After(start) {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".end_time", Message: "end time must be after start time"})
+			continue
+		}
+		byDay[window.Weekday] = append(byDay[window.Weekday], span{start, end})
+	}
+
+	for weekday, spans := range byDay {
+		sort.Slice(spans, func(i, j int) bool { return spans[i].start.Before(spans[j].start) })
+		for i := 1; i < len(spans); i++ {
+			if spans[i].start.Before(spans[i-1].end) {
+				fieldErrs = append(fieldErrs, FieldError{Field: "time_windows",
+					Message: fmt.Sprintf("windows on weekday %d overlap", weekday)})
+				break
+			}
+		}
+	}
+
+	return fieldErrs
+}
@@ -0,0 +1,522 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// Days back the no-show job looks for ended classes and appointments, so a
+// stopped server catches up after a restart
+const noShowLookbackDays = 7
+
+// NoShowPolicy is how a gym penalizes clients who book and do not come
+type NoShowPolicy struct {
+	GymID      int     `json:"gym_id"`
+	Strikes    int     `json:"strikes"`     // no-shows that ban the client from booking, 0 for no bans
+	WindowDays int     `json:"window_days"` // period the strikes are counted over
+	BanDays    int     `json:"ban_days"`
+	Fee        float64 `json:"fee"` // VAT included, 0 for no fee
+	FeeVATRate float64 `json:"fee_vat_rate"`
+}
+
+// ClientNoShow is a class booking or trainer appointment the client did not come to
+type ClientNoShow struct {
+	ID                   int     `json:"id"`
+	ClientID             int     `json:"client_id"`
+	GymID                int     `json:"gym_id"`
+	GymName              string  `json:"gym_name"`
+	ClassBookingID       *int    `json:"class_booking_id"`
+	TrainerAppointmentID *int    `json:"trainer_appointment_id"`
+	Description          string  `json:"description"`
+	OccurredOn           string  `json:"occurred_on"` // gym local time
+	FeeAmount            float64 `json:"fee_amount"`
+	InvoiceID            *int    `json:"invoice_id"`
+	CreditNoteID         *int    `json:"credit_note_id"` // reverses the fee invoice of a waived no-show
+	WaivedOn             string  `json:"waived_on,omitempty"`
+	WaiveReason          string  `json:"waive_reason,omitempty"`
+}
+
+// BookingBan is a period a client cannot book classes or appointments at a gym
+type BookingBan struct {
+	ID        int    `json:"id"`
+	ClientID  int    `json:"client_id"`
+	GymID     int    `json:"gym_id"`
+	GymName   string `json:"gym_name"`
+	NoShowID  *int   `json:"no_show_id"`
+	StartsOn  string `json:"starts_on"`
+	EndsOn    string `json:"ends_on"`
+	Reason    string `json:"reason"`
+	LiftedOn  string `json:"lifted_on,omitempty"`
+	IsActive  bool   `json:"is_active"`
+	CreatedOn string `json:"created_on"`
+}
+
+// ClientNoShowHistory is a client's no-shows and the bans they led to
+type ClientNoShowHistory struct {
+	ClientID int            `json:"client_id"`
+	NoShows  []ClientNoShow `json:"no_shows"`
+	Bans     []BookingBan   `json:"bans"`
+}
+
+type WaiveNoShowRequest struct {
+	Reason string `json:"reason"`
+}
+
+// NoShowNotice is the data of the client_no_show notification
+type NoShowNotice struct {
+	ClientName  string
+	GymName     string
+	ClassName   string // empty for trainer appointments
+	TrainerName string
+	StartsAt    string
+	Fee         string
+	Currency    string
+	BannedUntil string
+}
+
+const clientNoShowQuery = `SELECT ns.id, ns.client_id, ns.gym_id, COALESCE(g.name, ''),
+                                  ns.class_booking_id, ns.trainer_appointment_id,
+                                  CASE WHEN ns.class_booking_id IS NOT NULL THEN COALESCE(ct.name, '') || ' class'
+                                       ELSE 'Personal training with ' || COALESCE(u.full_name, '') END,
+                                  TO_CHAR(ns.occurred_on, 'YYYY-MM-DD HH24:MI'), COALESCE(ns.fee_amount, 0), ns.invoice_id,
+                                  ns.credit_note_id, COALESCE(TO_CHAR(ns.waived_on, 'YYYY-MM-DD HH24:MI'), ''), COALESCE(ns.waive_reason, '')
+                           FROM client_no_shows ns
+                           LEFT JOIN gyms g ON g.id = ns.gym_id
+                           LEFT JOIN class_bookings cb ON cb.id = ns.class_booking_id
+                           LEFT JOIN class_sessions cs ON cs.id = cb.session_id
+                           LEFT JOIN class_types ct ON ct.id = cs.class_type_id
+                           LEFT JOIN trainer_appointments ta ON ta.id = ns.trainer_appointment_id
+                           LEFT JOIN users u ON u.id = ta.trainer_id`
+
+const bookingBanQuery = `SELECT b.id, b.client_id, b.gym_id, COALESCE(g.name, ''), b.no_show_id,
+                                TO_CHAR(b.starts_on, 'YYYY-MM-DD'), TO_CHAR(b.ends_on, 'YYYY-MM-DD'), COALESCE(b.reason, ''),
+                                COALESCE(TO_CHAR(b.lifted_on, 'YYYY-MM-DD HH24:MI'), ''),
+                                b.lifted_on IS NULL AND gym_local_time(b.gym_id)::date BETWEEN b.starts_on AND b.ends_on,
+                                TO_CHAR(b.created_on, 'YYYY-MM-DD HH24:MI')
+                         FROM client_booking_bans b
+                         LEFT JOIN gyms g ON g.id = b.gym_id`
+
+// Get the no-show policy of a gym
+func (app *App) getGymNoShowPolicy(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var policy NoShowPolicy
+	query := `SELECT g.id, COALESCE(g.no_show_strikes, 3), COALESCE(g.no_show_window_days, 30),
+	                 COALESCE(g.no_show_ban_days, 7), COALESCE(g.no_show_fee, 0), COALESCE(g.no_show_fee_vat_rate, 21)
+	          FROM gyms g
+	          INNER JOIN user_gyms ug ON ug.gym_id = g.id
+	          WHERE g.id = $1 AND ug.user_id = $2`
+	err = app.DB.QueryRow(query, gymID, claims.UserID).Scan(&policy.GymID, &policy.Strikes, &policy.WindowDays,
+		&policy.BanDays, &policy.Fee, &policy.FeeVATRate)
+	if err != nil {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	sendSuccessResponse(w, "Gym no-show policy retrieved successfully", policy)
+}
+
+// Update the strikes, ban length and fee of a gym's no-shows
+func (app *App) updateGymNoShowPolicy(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req NoShowPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var fieldErrs ValidationErrors
+	if req.Strikes < 0 || req.Strikes > 100 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "strikes", Message: "strikes must be between 0 and 100"})
+	}
+	if req.WindowDays < 1 || req.WindowDays > 365 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "window_days", Message: "window must be between 1 and 365 days"})
+	}
+	if req.BanDays < 0 || req.BanDays > 365 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "ban_days", Message: "ban must be between 0 and 365 days"})
+	}
+	if req.Fee < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "fee", Message: "fee cannot be negative"})
+	}
+	if req.FeeVATRate < 0 || req.FeeVATRate > 100 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "fee_vat_rate", Message: "VAT rate must be between 0 and 100"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	_, err = app.DB.Exec(`UPDATE gyms
+	                      SET no_show_strikes = $2, no_show_window_days = $3, no_show_ban_days = $4,
+	                          no_show_fee = $5, no_show_fee_vat_rate = $6
+	                      WHERE id = $1`,
+		gymID, req.Strikes, req.WindowDays, req.BanDays, req.Fee, req.FeeVATRate)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update gym no-show policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	req.GymID = gymID
+	sendSuccessResponse(w, "Gym no-show policy updated successfully", req)
+}
+
+// List a client's no-shows and booking bans, newest first
+func (app *App) getClientNoShows(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	app.sendClientNoShows(w, "Client no-shows retrieved successfully", clientID, gymID)
+}
+
+// Waive a no-show: it is no longer a strike, its fee invoice is reversed with a
+// credit note and the ban it triggered is lifted
+func (app *App) waiveClientNoShow(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	noShowID, err := strconv.Atoi(vars["no_show_id"])
+	if err != nil || noShowID <= 0 {
+		sendErrorResponse(w, "Invalid no_show_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req WaiveNoShowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "reason", Message: "reason is required"}})
+		return
+	}
+	if len(req.Reason) > 256 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "reason", Message: "reason must be at most 256 characters"}})
+		return
+	}
+
+	// Check if user has permission for the no-show's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN client_no_shows ns ON ns.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ns.id = $2 AND ns.client_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, noShowID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "No-show not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT waive_client_no_show($1, $2, $3)", noShowID, req.Reason, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.sendClientNoShows(w, "No-show waived successfully", clientID, 0)
+}
+
+// Lift a booking ban before it ends
+func (app *App) liftClientBookingBan(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	banID, err := strconv.Atoi(vars["ban_id"])
+	if err != nil || banID <= 0 {
+		sendErrorResponse(w, "Invalid ban_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the ban's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN client_booking_bans b ON b.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND b.id = $2 AND b.client_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, banID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Booking ban not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT lift_client_booking_ban($1, $2)", banID, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.sendClientNoShows(w, "Booking ban lifted successfully", clientID, 0)
+}
+
+// sendClientNoShows responds with a client's no-show history, at one gym when gymID is set
+func (app *App) sendClientNoShows(w http.ResponseWriter, message string, clientID, gymID int) {
+	history := ClientNoShowHistory{ClientID: clientID, NoShows: []ClientNoShow{}, Bans: []BookingBan{}}
+
+	rows, err := app.DB.Query(clientNoShowQuery+` WHERE ns.client_id = $1 AND ($2 = 0 OR ns.gym_id = $2)
+	                                               ORDER BY ns.occurred_on DESC, ns.id DESC
+	                                               LIMIT 100`, clientID, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch no-shows: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noShow ClientNoShow
+		err := rows.Scan(&noShow.ID, &noShow.ClientID, &noShow.GymID, &noShow.GymName, &noShow.ClassBookingID,
+			&noShow.TrainerAppointmentID, &noShow.Description, &noShow.OccurredOn, &noShow.FeeAmount,
+			&noShow.InvoiceID, &noShow.CreditNoteID, &noShow.WaivedOn, &noShow.WaiveReason)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan no-show: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		history.NoShows = append(history.NoShows, noShow)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	banRows, err := app.DB.Query(bookingBanQuery+` WHERE b.client_id = $1 AND ($2 = 0 OR b.gym_id = $2)
+	                                                ORDER BY b.created_on DESC, b.id DESC
+	                                                LIMIT 100`, clientID, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch booking bans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer banRows.Close()
+
+	for banRows.Next() {
+		var ban BookingBan
+		err := banRows.Scan(&ban.ID, &ban.ClientID, &ban.GymID, &ban.GymName, &ban.NoShowID, &ban.StartsOn,
+			&ban.EndsOn, &ban.Reason, &ban.LiftedOn, &ban.IsActive, &ban.CreatedOn)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan booking ban: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		history.Bans = append(history.Bans, ban)
+	}
+
+	// Check for any row iteration errors
+	if err = banRows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, message, history)
+}
+
+// detectNoShows records the class bookings and appointments that ended without the
+// client coming to the gym, applies the gym's penalties and notifies the clients
+func (app *App) detectNoShows() {
+	rows, err := app.DB.Query("SELECT detect_no_shows($1)", noShowLookbackDays)
+	if err != nil {
+		log.Printf("no-shows: failed to detect no-shows: %v", err)
+		return
+	}
+	var noShowIDs []int
+	for rows.Next() {
+		var noShowID int
+		if err := rows.Scan(&noShowID); err == nil {
+			noShowIDs = append(noShowIDs, noShowID)
+		}
+	}
+	rows.Close()
+
+	if len(noShowIDs) > 0 {
+		log.Printf("no-shows: %d no-show(s) recorded", len(noShowIDs))
+	}
+	for _, noShowID := range noShowIDs {
+		app.notifyNoShow(noShowID)
+	}
+}
+
+// notifyNoShow tells the client about a no-show, its fee and the ban it led to;
+// failures are only logged
+func (app *App) notifyNoShow(noShowID int) {
+	var notice NoShowNotice
+	var clientID int
+	var fee float64
+	var bannedUntil sql.NullString
+	err := app.DB.QueryRow(`SELECT ns.client_id, COALESCE(c.name, ''), COALESCE(g.name, ''), COALESCE(ct.name, ''),
+	                               COALESCE(u.full_name, ''), TO_CHAR(ns.occurred_on, 'YYYY-MM-DD HH24:MI'),
+	                               COALESCE(ns.fee_amount, 0), COALESCE(i.currency, 'RON'), TO_CHAR(b.ends_on, 'YYYY-MM-DD')
+	                        FROM client_no_shows ns
+	                        LEFT JOIN clients c ON c.id = ns.client_id
+	                        LEFT JOIN gyms g ON g.id = ns.gym_id
+	                        LEFT JOIN class_bookings cb ON cb.id = ns.class_booking_id
+	                        LEFT JOIN class_sessions cs ON cs.id = cb.session_id
+	                        LEFT JOIN class_types ct ON ct.id = cs.class_type_id
+	                        LEFT JOIN trainer_appointments ta ON ta.id = ns.trainer_appointment_id
+	                        LEFT JOIN users u ON u.id = ta.trainer_id
+	                        LEFT JOIN invoices i ON i.id = ns.invoice_id
+	                        LEFT JOIN client_booking_bans b ON b.no_show_id = ns.id
+	                        WHERE ns.id = $1`, noShowID).Scan(&clientID, &notice.ClientName, &notice.GymName,
+		&notice.ClassName, &notice.TrainerName, &notice.StartsAt, &fee, &notice.Currency, &bannedUntil)
+	if err != nil {
+		log.Printf("no-shows: failed to load no-show %d for notification: %v", noShowID, err)
+		return
+	}
+	notice.Fee = strconv.FormatFloat(fee, 'f', 2, 64)
+	notice.BannedUntil = bannedUntil.String
+
+	err = app.Notifier.NotifyClient(clientID, "client_no_show", notice)
+	if err != nil && err != errNoContactChannel {
+		log.Printf("no-shows: failed to queue client_no_show for client %d: %v", clientID, err)
+	}
+}
@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboundMessage is a rendered notification ready to be handed to a provider
+type OutboundMessage struct {
+	Channel    string
+	Recipient  string
+	Subject    string
+	Body       string
+	Attachment *Attachment // email only
+}
+
+// Attachment is a file sent along with an email notification
+type Attachment struct {
+	Name        string
+	ContentType string
+	Content     []byte
+}
+
+// NotificationProvider delivers messages for a single channel (email or sms)
+type NotificationProvider interface {
+	Send(ctx context.Context, message OutboundMessage) error
+}
+
+// SMTPProvider sends email notifications through an SMTP relay
+type SMTPProvider struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (p *SMTPProvider) Send(ctx context.Context, message OutboundMessage) error {
+	if p.Host == "" || p.From == "" {
+		return fmt.Errorf("smtp provider is not configured")
+	}
+
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	if _, err := qp.Write([]byte(message.Body)); err != nil {
+		return err
+	}
+	if err := qp.Close(); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + p.From + "\r\n")
+	msg.WriteString("To: " + message.Recipient + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Subject) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	if message.Attachment == nil {
+		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		msg.WriteString("\r\n")
+		msg.Write(body.Bytes())
+	} else if err := writeMultipartMessage(&msg, body.Bytes(), message.Attachment); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if p.Username != "" {
+		auth = smtp.PlainAuth("", p.Username, p.Password, p.Host)
+	}
+
+	// net/smtp has no context support, so honour the deadline with a goroutine
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- smtp.SendMail(net.JoinHostPort(p.Host, p.Port), auth, p.From,
+			[]string{message.Recipient}, msg.Bytes())
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeMultipartMessage writes a multipart/mixed email with the quoted-printable
+// text part followed by the attachment in base64
+func writeMultipartMessage(msg *bytes.Buffer, body []byte, attachment *Attachment) error {
+	mw := multipart.NewWriter(msg)
+	msg.WriteString("Content-Type: multipart/mixed; boundary=\"" + mw.Boundary() + "\"\r\n")
+	msg.WriteString("\r\n")
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(body); err != nil {
+		return err
+	}
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Name})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(part, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	if _, err := io.WriteString(part, encoded+"\r\n"); err != nil {
+		return err
+	}
+
+	return mw.Close()
+}
+
+// SMSHTTPProvider sends SMS notifications through a JSON HTTP gateway
+type SMSHTTPProvider struct {
+	URL    string
+	Token  string
+	Sender string
+	Client *http.Client
+}
+
+func (p *SMSHTTPProvider) Send(ctx context.Context, message OutboundMessage) error {
+	if p.URL == "" {
+		return fmt.Errorf("sms provider is not configured")
+	}
+
+	payload, err := json.Marshal(map[string]string{
+		"from": p.Sender,
+		"to":   message.Recipient,
+		"text": message.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sms gateway returned %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+// FileProvider writes notifications to a file (or stdout when Path is empty).
+// Used as a stand-in for real providers during development and testing.
+type FileProvider struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func (p *FileProvider) Send(ctx context.Context, message OutboundMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var out io.Writer = os.Stdout
+	if p.Path != "" {
+		f, err := os.OpenFile(p.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	_, err := fmt.Fprintf(out, "----- %s [%s] to %s -----\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), message.Channel, message.Recipient, message.Subject, message.Body)
+	if err == nil && message.Attachment != nil {
+		_, err = fmt.Fprintf(out, "Attachment: %s (%s)\n%s\n\n",
+			message.Attachment.Name, message.Attachment.ContentType, message.Attachment.Content)
+	}
+	return err
+}
+
+// newNotificationProvider builds the provider configured for a channel
+func newNotificationProvider(channel string, config *Config) NotificationProvider {
+	kind := config.NotifyEmailProvider
+	if channel == channelSMS {
+		kind = config.NotifySMSProvider
+	}
+
+	switch kind {
+	case "smtp":
+		return &SMTPProvider{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUsername,
+			Password: config.SMTPPassword,
+			From:     config.SMTPFrom,
+		}
+	case "http":
+		return &SMSHTTPProvider{
+			URL:    config.SMSAPIURL,
+			Token:  config.SMSAPIToken,
+			Sender: config.SMSSender,
+			Client: &http.Client{Timeout: 10 * time.Second},
+		}
+	case "file":
+		return &FileProvider{Path: config.NotifyFilePath}
+	default:
+		return &FileProvider{}
+	}
+}
@@ -0,0 +1,328 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// messageTemplate holds the email subject/body and the short SMS text for one language
+type messageTemplate struct {
+	Subject string
+	Body    string
+	SMS     string
+}
+
+// Notification templates keyed by template name and language code
+var notificationTemplates = map[string]map[string]messageTemplate{
+	"membership_renewal_reminder": {
+		"ro": {
+			Subject: "Abonamentul tău {{.MembershipName}} expiră în curând",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Abonamentul tău {{.MembershipName}} expiră pe {{.EndingOn}} ({{.DaysLeft}} zile rămase).\n" +
+				"Te așteptăm la recepție pentru reînnoire.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Abonamentul {{.MembershipName}} expira pe {{.EndingOn}}. Te asteptam la receptie pentru reinnoire.",
+		},
+		"en": {
+			Subject: "Your {{.MembershipName}} membership is ending soon",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"Your {{.MembershipName}} membership ends on {{.EndingOn}} ({{.DaysLeft}} days left).\n" +
+				"Drop by the front desk to renew it.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Your {{.MembershipName}} membership ends on {{.EndingOn}}. Visit the front desk to renew.",
+		},
+	},
+	"membership_renewed": {
+		"ro": {
+			Subject: "Abonamentul tău {{.MembershipName}} a fost reînnoit",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Abonamentul tău {{.MembershipName}} a fost reînnoit automat pentru perioada {{.StartingFrom}} - {{.EndingOn}}.\n" +
+				"{{if .InvoiceNo}}Factura {{.InvoiceNo}}, în valoare de {{.Amount}} {{.Currency}}, este scadentă pe {{.DueDate}}.\n{{end}}" +
+				"\nEchipa GoGym",
+			SMS: "GoGym: Abonamentul {{.MembershipName}} a fost reinnoit pana pe {{.EndingOn}}.{{if .InvoiceNo}} Factura {{.InvoiceNo}}: {{.Amount}} {{.Currency}}, scadenta {{.DueDate}}.{{end}}",
+		},
+		"en": {
+			Subject: "Your {{.MembershipName}} membership has been renewed",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"Your {{.MembershipName}} membership has been renewed automatically for {{.StartingFrom}} - {{.EndingOn}}.\n" +
+				"{{if .InvoiceNo}}Invoice {{.InvoiceNo}} of {{.Amount}} {{.Currency}} is due on {{.DueDate}}.\n{{end}}" +
+				"\nThe GoGym team",
+			SMS: "GoGym: Your {{.MembershipName}} membership was renewed until {{.EndingOn}}.{{if .InvoiceNo}} Invoice {{.InvoiceNo}}: {{.Amount}} {{.Currency}}, due {{.DueDate}}.{{end}}",
+		},
+	},
+	"membership_renewal_overdue": {
+		"ro": {
+			Subject: "Factura {{.InvoiceNo}} pentru abonamentul {{.MembershipName}} este restantă",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Factura {{.InvoiceNo}} pentru reînnoirea abonamentului {{.MembershipName}} era scadentă pe {{.DueDate}}. " +
+				"Suma rămasă de plată este {{.Balance}} {{.Currency}}.\n" +
+				"Dacă nu este achitată, accesul în sală va fi suspendat începând cu {{.SuspendOn}}.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Factura {{.InvoiceNo}} ({{.Balance}} {{.Currency}}) este restanta. Accesul va fi suspendat din {{.SuspendOn}}.",
+		},
+		"en": {
+			Subject: "Invoice {{.InvoiceNo}} for your {{.MembershipName}} membership is overdue",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"Invoice {{.InvoiceNo}} for the renewal of your {{.MembershipName}} membership was due on {{.DueDate}}. " +
+				"The outstanding balance is {{.Balance}} {{.Currency}}.\n" +
+				"Unless it is paid, gym access will be suspended from {{.SuspendOn}}.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Invoice {{.InvoiceNo}} ({{.Balance}} {{.Currency}}) is overdue. Access will be suspended from {{.SuspendOn}}.",
+		},
+	},
+	"membership_suspended": {
+		"ro": {
+			Subject: "Accesul cu abonamentul {{.MembershipName}} a fost suspendat",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Factura {{.InvoiceNo}} pentru reînnoirea abonamentului {{.MembershipName}} nu a fost achitată, " +
+				"așa că accesul în sală este suspendat.\n" +
+				"Accesul se reia imediat după plata sumei de {{.Balance}} {{.Currency}} la recepție.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Accesul cu abonamentul {{.MembershipName}} este suspendat pana la plata facturii {{.InvoiceNo}} ({{.Balance}} {{.Currency}}).",
+		},
+		"en": {
+			Subject: "Access on your {{.MembershipName}} membership is suspended",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"Invoice {{.InvoiceNo}} for the renewal of your {{.MembershipName}} membership has not been paid, " +
+				"so gym access is suspended.\n" +
+				"Access is restored as soon as the {{.Balance}} {{.Currency}} balance is paid at the front desk.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Access on your {{.MembershipName}} membership is suspended until invoice {{.InvoiceNo}} ({{.Balance}} {{.Currency}}) is paid.",
+		},
+	},
+	"membership_cancelled": {
+		"ro": {
+			Subject: "Abonamentul {{.MembershipName}} a fost anulat",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Am înregistrat anularea abonamentului {{.MembershipName}}." +
+				"{{if .LastDay}} Accesul în sală rămâne valabil până pe {{.LastDay}} inclusiv.{{end}}\n" +
+				"{{if ne .RefundAmount \"0.00\"}}Vei primi înapoi suma de {{.RefundAmount}} {{.Currency}}.\n{{end}}\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Abonamentul {{.MembershipName}} a fost anulat.{{if .LastDay}} Acces pana pe {{.LastDay}}.{{end}}{{if ne .RefundAmount \"0.00\"}} Rambursare: {{.RefundAmount}} {{.Currency}}.{{end}}",
+		},
+		"en": {
+			Subject: "Your {{.MembershipName}} membership is cancelled",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"We have recorded the cancellation of your {{.MembershipName}} membership." +
+				"{{if .LastDay}} Gym access remains valid up to and including {{.LastDay}}.{{end}}\n" +
+				"{{if ne .RefundAmount \"0.00\"}}You will be refunded {{.RefundAmount}} {{.Currency}}.\n{{end}}\n" +
+				"The GoGym team",
+			SMS: "GoGym: Your {{.MembershipName}} membership is cancelled.{{if .LastDay}} Access until {{.LastDay}}.{{end}}{{if ne .RefundAmount \"0.00\"}} Refund: {{.RefundAmount}} {{.Currency}}.{{end}}",
+		},
+	},
+	"class_booked": {
+		"ro": {
+			Subject: "Rezervare confirmată: {{.ClassName}}, {{.StartsAt}}",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Rezervarea ta la {{.ClassName}} din {{.StartsAt}}, la {{.GymName}}, este confirmată.\n" +
+				"Am atașat clasa ca eveniment de calendar.\n" +
+				"Dacă nu mai poți ajunge, te rugăm să anulezi rezervarea ca locul să ajungă la altcineva.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Rezervarea ta la {{.ClassName}} din {{.StartsAt}} ({{.GymName}}) este confirmata.",
+		},
+		"en": {
+			Subject: "Booking confirmed: {{.ClassName}}, {{.StartsAt}}",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"Your booking for {{.ClassName}} on {{.StartsAt}} at {{.GymName}} is confirmed.\n" +
+				"The class is attached as a calendar event.\n" +
+				"If you can no longer make it, please cancel the booking so someone else can have the place.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Your booking for {{.ClassName}} on {{.StartsAt}} ({{.GymName}}) is confirmed.",
+		},
+	},
+	"class_waitlist_promoted": {
+		"ro": {
+			Subject: "Ai un loc la {{.ClassName}}, {{.StartsAt}}",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"S-a eliberat un loc și rezervarea ta de pe lista de așteptare pentru {{.ClassName}} " +
+				"din {{.StartsAt}}, la {{.GymName}}, este confirmată.\n" +
+				"Dacă nu mai poți ajunge, te rugăm să anulezi rezervarea ca locul să ajungă la altcineva.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Rezervarea ta la {{.ClassName}} din {{.StartsAt}} ({{.GymName}}) este confirmata.",
+		},
+		"en": {
+			Subject: "You have a place in {{.ClassName}}, {{.StartsAt}}",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"A place opened up and your waitlisted booking for {{.ClassName}} " +
+				"on {{.StartsAt}} at {{.GymName}} is confirmed.\n" +
+				"If you can no longer make it, please cancel the booking so someone else can have the place.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Your booking for {{.ClassName}} on {{.StartsAt}} ({{.GymName}}) is confirmed.",
+		},
+	},
+	"class_cancelled": {
+		"ro": {
+			Subject: "{{.ClassName}} din {{.StartsAt}} a fost anulat",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Ne pare rău, clasa {{.ClassName}} din {{.StartsAt}}, la {{.GymName}}, a fost anulată." +
+				"{{if .Reason}} Motiv: {{.Reason}}.{{end}}\n" +
+				"Rezervarea ta a fost anulată; te așteptăm la o altă clasă.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: {{.ClassName}} din {{.StartsAt}} ({{.GymName}}) a fost anulat.{{if .Reason}} {{.Reason}}.{{end}}",
+		},
+		"en": {
+			Subject: "{{.ClassName}} on {{.StartsAt}} is cancelled",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"We are sorry, the {{.ClassName}} class on {{.StartsAt}} at {{.GymName}} is cancelled." +
+				"{{if .Reason}} Reason: {{.Reason}}.{{end}}\n" +
+				"Your booking has been cancelled; we hope to see you at another class.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: {{.ClassName}} on {{.StartsAt}} ({{.GymName}}) is cancelled.{{if .Reason}} {{.Reason}}.{{end}}",
+		},
+	},
+	"client_no_show": {
+		"ro": {
+			Subject: "Nu te-am văzut la {{if .ClassName}}{{.ClassName}}{{else}}antrenamentul cu {{.TrainerName}}{{end}}, {{.StartsAt}}",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Aveai rezervare la {{if .ClassName}}clasa {{.ClassName}}{{else}}antrenamentul cu {{.TrainerName}}{{end}} " +
+				"din {{.StartsAt}}, la {{.GymName}}, dar nu ai venit.\n" +
+				"{{if ne .Fee \"0.00\"}}Conform regulilor sălii, ți-am facturat o taxă de {{.Fee}} {{.Currency}}.\n{{end}}" +
+				"{{if .BannedUntil}}După mai multe rezervări neonorate, nu vei putea face rezervări până pe {{.BannedUntil}} inclusiv.\n{{end}}" +
+				"Dacă nu poți ajunge, te rugăm să anulezi rezervarea din timp ca locul să ajungă la altcineva.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Nu ai venit la {{if .ClassName}}{{.ClassName}}{{else}}antrenament{{end}} din {{.StartsAt}}.{{if ne .Fee \"0.00\"}} Taxa: {{.Fee}} {{.Currency}}.{{end}}{{if .BannedUntil}} Rezervari blocate pana pe {{.BannedUntil}}.{{end}}",
+		},
+		"en": {
+			Subject: "We missed you at {{if .ClassName}}{{.ClassName}}{{else}}your session with {{.TrainerName}}{{end}}, {{.StartsAt}}",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"You had booked {{if .ClassName}}the {{.ClassName}} class{{else}}a session with {{.TrainerName}}{{end}} " +
+				"on {{.StartsAt}} at {{.GymName}}, but did not come.\n" +
+				"{{if ne .Fee \"0.00\"}}As set by the gym rules, a fee of {{.Fee}} {{.Currency}} has been invoiced.\n{{end}}" +
+				"{{if .BannedUntil}}After several missed bookings, you cannot book until {{.BannedUntil}} inclusive.\n{{end}}" +
+				"If you cannot make it, please cancel in time so someone else can have the place.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: You missed {{if .ClassName}}{{.ClassName}}{{else}}your session{{end}} on {{.StartsAt}}.{{if ne .Fee \"0.00\"}} Fee: {{.Fee}} {{.Currency}}.{{end}}{{if .BannedUntil}} Bookings blocked until {{.BannedUntil}}.{{end}}",
+		},
+	},
+	"trainer_appointment_booked": {
+		"ro": {
+			Subject: "Antrenament cu {{.TrainerName}}, {{.StartsAt}}",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"{{if .Rescheduled}}Antrenamentul tău personal a fost mutat. {{end}}" +
+				"Te așteptăm pe {{.StartsAt}}, la {{.GymName}}, pentru antrenamentul cu {{.TrainerName}}.\n" +
+				"Dacă nu poți ajunge, te rugăm să ne anunți din timp.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Antrenament cu {{.TrainerName}} pe {{.StartsAt}} ({{.GymName}}).",
+		},
+		"en": {
+			Subject: "Training with {{.TrainerName}}, {{.StartsAt}}",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"{{if .Rescheduled}}Your personal training session has been moved. {{end}}" +
+				"We are expecting you on {{.StartsAt}} at {{.GymName}} for your session with {{.TrainerName}}.\n" +
+				"If you cannot make it, please let us know in advance.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Training with {{.TrainerName}} on {{.StartsAt}} ({{.GymName}}).",
+		},
+	},
+	"trainer_appointment_cancelled": {
+		"ro": {
+			Subject: "Antrenamentul din {{.StartsAt}} a fost anulat",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Antrenamentul tău cu {{.TrainerName}} din {{.StartsAt}}, la {{.GymName}}, a fost anulat." +
+				"{{if .Reason}} Motiv: {{.Reason}}.{{end}}\n" +
+				"Ședința a revenit în pachetul tău și o poți programa oricând.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Antrenamentul cu {{.TrainerName}} din {{.StartsAt}} a fost anulat.{{if .Reason}} {{.Reason}}.{{end}}",
+		},
+		"en": {
+			Subject: "Your session on {{.StartsAt}} is cancelled",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"Your session with {{.TrainerName}} on {{.StartsAt}} at {{.GymName}} is cancelled." +
+				"{{if .Reason}} Reason: {{.Reason}}.{{end}}\n" +
+				"The session is back in your package and you can book it again at any time.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Your session with {{.TrainerName}} on {{.StartsAt}} is cancelled.{{if .Reason}} {{.Reason}}.{{end}}",
+		},
+	},
+	"resource_booked": {
+		"ro": {
+			Subject: "Rezervare confirmată: {{.ResourceName}}, {{.StartsAt}}",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Ți-am rezervat {{.ResourceName}} la {{.GymName}}, pe {{.StartsAt}} - {{.EndsAt}}.\n" +
+				"Preț: {{.Price}} {{.Currency}}.\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: {{.ResourceName}} rezervat pe {{.StartsAt}} - {{.EndsAt}}, {{.Price}} {{.Currency}}.",
+		},
+		"en": {
+			Subject: "Booking confirmed: {{.ResourceName}}, {{.StartsAt}}",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"{{.ResourceName}} at {{.GymName}} is booked for you on {{.StartsAt}} - {{.EndsAt}}.\n" +
+				"Price: {{.Price}} {{.Currency}}.\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: {{.ResourceName}} booked on {{.StartsAt}} - {{.EndsAt}}, {{.Price}} {{.Currency}}.",
+		},
+	},
+	"resource_booking_cancelled": {
+		"ro": {
+			Subject: "Rezervarea {{.ResourceName}} din {{.StartsAt}} a fost anulată",
+			Body: "Bună, {{.ClientName}}!\n\n" +
+				"Rezervarea ta pentru {{.ResourceName}} din {{.StartsAt}}, la {{.GymName}}, a fost anulată." +
+				"{{if .Reason}} Motiv: {{.Reason}}.{{end}}\n" +
+				"{{if .Late}}Anularea a fost făcută prea târziu, așa că rezervarea se plătește.{{else}}Rezervarea nu se mai plătește.{{end}}\n\n" +
+				"Echipa GoGym",
+			SMS: "GoGym: Rezervarea {{.ResourceName}} din {{.StartsAt}} a fost anulată.{{if .Reason}} {{.Reason}}.{{end}}",
+		},
+		"en": {
+			Subject: "Your {{.ResourceName}} booking on {{.StartsAt}} is cancelled",
+			Body: "Hello, {{.ClientName}}!\n\n" +
+				"Your booking of {{.ResourceName}} on {{.StartsAt}} at {{.GymName}} is cancelled." +
+				"{{if .Reason}} Reason: {{.Reason}}.{{end}}\n" +
+				"{{if .Late}}It was cancelled too late, so the booking is still charged.{{else}}The booking is no longer charged.{{end}}\n\n" +
+				"The GoGym team",
+			SMS: "GoGym: Your {{.ResourceName}} booking on {{.StartsAt}} is cancelled.{{if .Reason}} {{.Reason}}.{{end}}",
+		},
+	},
+}
+
+var supportedLanguages = map[string]bool{"ro": true, "en": true}
+
+type parsedTemplate struct {
+	subject *template.Template
+	body    *template.Template
+	sms     *template.Template
+}
+
+var parsedTemplates = parseNotificationTemplates()
+
+func parseNotificationTemplates() map[string]parsedTemplate {
+	parsed := make(map[string]parsedTemplate)
+	for name, languages := range notificationTemplates {
+		for lang, tpl := range languages {
+			key := name + "/" + lang
+			parsed[key] = parsedTemplate{
+				subject: template.Must(template.New(key + "/subject").Parse(tpl.Subject)),
+				body:    template.Must(template.New(key + "/body").Parse(tpl.Body)),
+				sms:     template.Must(template.New(key + "/sms").Parse(tpl.SMS)),
+			}
+		}
+	}
+	return parsed
+}
+
+// renderNotification renders a template for a channel, falling back to the default language
+func renderNotification(name, lang, fallbackLang, channel string, data interface{}) (string, string, string, error) {
+	tpl, ok := parsedTemplates[name+"/"+lang]
+	if !ok {
+		lang = fallbackLang
+		tpl, ok = parsedTemplates[name+"/"+lang]
+		if !ok {
+			return "", "", "", fmt.Errorf("notification template %q not found", name)
+		}
+	}
+
+	var subject, body bytes.Buffer
+	if err := tpl.subject.Execute(&subject, data); err != nil {
+		return "", "", "", err
+	}
+
+	bodyTemplate := tpl.body
+	if channel == channelSMS {
+		bodyTemplate = tpl.sms
+	}
+	if err := bodyTemplate.Execute(&body, data); err != nil {
+		return "", "", "", err
+	}
+
+	return subject.String(), body.String(), lang, nil
+}
@@ -0,0 +1,624 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	channelEmail = "email"
+	channelSMS   = "sms"
+	channelNone  = "none"
+
+	outboxBatchSize   = 50
+	outboxSendTimeout = 30 * time.Second
+)
+
+var phoneRegex = regexp.MustCompile(`^\+?[0-9]{8,15}$`)
+
+// errNoContactChannel is returned when a client cannot be reached on any channel
+var errNoContactChannel = errors.New("client has no reachable contact channel")
+
+// NotificationService renders templated messages into the outbox and delivers them
+type NotificationService struct {
+	DB              *sql.DB
+	Providers       map[string]NotificationProvider
+	DefaultLanguage string
+	MaxAttempts     int
+}
+
+func newNotificationService(db *sql.DB, config *Config) *NotificationService {
+	maxAttempts := config.NotifyMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	defaultLanguage := config.NotifyDefaultLanguage
+	if !supportedLanguages[defaultLanguage] {
+		defaultLanguage = "ro"
+	}
+
+	return &NotificationService{
+		DB: db,
+		Providers: map[string]NotificationProvider{
+			channelEmail: newNotificationProvider(channelEmail, config),
+			channelSMS:   newNotificationProvider(channelSMS, config),
+		},
+		DefaultLanguage: defaultLanguage,
+		MaxAttempts:     maxAttempts,
+	}
+}
+
+type ContactPreferences struct {
+	ClientID         int    `json:"client_id"`
+	Email            string `json:"email"`
+	Phone            string `json:"phone"`
+	Language         string `json:"language"`
+	PreferredChannel string `json:"preferred_channel"`
+	EmailOptOut      bool   `json:"email_opt_out"`
+	SMSOptOut        bool   `json:"sms_opt_out"`
+	UpdatedOn        string `json:"updated_on,omitempty"`
+}
+
+// contactChannel picks the channel and recipient to use, honouring opt-outs
+func (p *ContactPreferences) contactChannel() (string, string) {
+	emailOK := p.Email != "" && !p.EmailOptOut
+	smsOK := p.Phone != "" && !p.SMSOptOut
+
+	switch {
+	case p.PreferredChannel == channelNone:
+		return "", ""
+	case p.PreferredChannel == channelSMS && smsOK:
+		return channelSMS, p.Phone
+	case emailOK:
+		return channelEmail, p.Email
+	case smsOK:
+		return channelSMS, p.Phone
+	}
+	return "", ""
+}
+
+// loadContactPreferences combines the client's contact details with their stored
+// preferences. Clients without stored preferences get the defaults.
+func (s *NotificationService) loadContactPreferences(clientID int) (*ContactPreferences, error) {
+	prefs := &ContactPreferences{ClientID: clientID}
+	query := `SELECT COALESCE(c.email, ''), COALESCE(c.phone, ''),
+                     COALESCE(p.language, $2), COALESCE(p.preferred_channel, 'email'),
+                     COALESCE(p.email_opt_out, false), COALESCE(p.sms_opt_out, false),
+                     COALESCE(TO_CHAR(p.updated_on, 'YYYY-MM-DD'), '')
+              FROM clients c
+              LEFT JOIN client_contact_preferences p ON p.client_id = c.id
+              WHERE c.id = $1`
+	err := s.DB.QueryRow(query, clientID, s.DefaultLanguage).Scan(&prefs.Email, &prefs.Phone, &prefs.Language,
+		&prefs.PreferredChannel, &prefs.EmailOptOut, &prefs.SMSOptOut, &prefs.UpdatedOn)
+	if err != nil {
+		return nil, err
+	}
+	return prefs, nil
+}
+
+// NotifyClient renders a template in the client's language and queues it in the outbox
+func (s *NotificationService) NotifyClient(clientID int, templateName string, data interface{}) error {
+	return s.NotifyClientWithAttachment(clientID, templateName, data, nil)
+}
+
+// NotifyClientWithAttachment is NotifyClient with a file attached when the
+// notification goes out by email; SMS notifications are sent without it
+func (s *NotificationService) NotifyClientWithAttachment(clientID int, templateName string, data interface{},
+	attachment *Attachment) error {
+	prefs, err := s.loadContactPreferences(clientID)
+	if err == sql.ErrNoRows {
+		return errNoContactChannel
+	}
+	if err != nil {
+		return err
+	}
+
+	channel, recipient := prefs.contactChannel()
+	if channel == "" {
+		return errNoContactChannel
+	}
+
+	subject, body, lang, err := renderNotification(templateName, prefs.Language, s.DefaultLanguage, channel, data)
+	if err != nil {
+		return err
+	}
+
+	var attachmentName, attachmentType, attachmentContent interface{}
+	if attachment != nil && channel == channelEmail {
+		attachmentName, attachmentType, attachmentContent = attachment.Name, attachment.ContentType, string(attachment.Content)
+	}
+
+	_, err = s.DB.Exec(`INSERT INTO notification_outbox (client_id, channel, recipient, template, language, subject, body,
+	                                                     attachment_name, attachment_type, attachment)
+	                    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		clientID, channel, recipient, templateName, lang, subject, body, attachmentName, attachmentType,
+		attachmentContent)
+	return err
+}
+
+// Start the outbox worker that delivers pending notifications
+func (app *App) startNotificationWorker() {
+	ticker := time.NewTicker(app.Config.NotifyOutboxInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				sent, failed, err := app.Notifier.processOutbox(context.Background())
+				if err != nil {
+					log.Printf("notification worker: %v", err)
+				} else if sent > 0 || failed > 0 {
+					log.Printf("notification worker: %d sent, %d failed", sent, failed)
+				}
+			}
+		}
+	}()
+}
+
+type outboxEntry struct {
+	ID         int
+	Channel    string
+	Recipient  string
+	Subject    string
+	Body       string
+	Attempts   int
+	Attachment *Attachment
+}
+
+// processOutbox delivers one batch of due notifications. The batch is claimed
+// in a short transaction: rows are locked with SKIP LOCKED so several API
+// instances can run the worker concurrently, marked as sending and leased until
+// the batch has had time to go out. Messages are sent outside of any
+// transaction and each result is recorded on its own; a result that cannot be
+// recorded is logged and the batch goes on.
+//
+// A row still sending when its lease expires may or may not have been
+// delivered, so it is not sent again but marked failed for staff to retry.
+func (s *NotificationService) processOutbox(ctx context.Context) (int, int, error) {
+	entries, err := s.claimOutboxEntries(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sent, failed := 0, 0
+	for _, entry := range entries {
+		provider, ok := s.Providers[entry.Channel]
+		if !ok {
+			err = fmt.Errorf("no provider for channel %q", entry.Channel)
+		} else {
+			sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+			err = provider.Send(sendCtx, OutboundMessage{
+				Channel:    entry.Channel,
+				Recipient:  entry.Recipient,
+				Subject:    entry.Subject,
+				Body:       entry.Body,
+				Attachment: entry.Attachment,
+			})
+			cancel()
+		}
+
+		attempts := entry.Attempts + 1
+		if err == nil {
+			sent++
+			_, dbErr := s.DB.ExecContext(ctx, `UPDATE notification_outbox
+			                                   SET status = 'sent', attempts = $2, sent_on = now(), last_error = NULL
+			                                   WHERE id = $1`, entry.ID, attempts)
+			if dbErr != nil {
+				log.Printf("notification worker: notification %d was sent but not marked sent: %v", entry.ID, dbErr)
+			}
+			continue
+		}
+
+		status := "pending"
+		if attempts >= s.MaxAttempts {
+			status = "failed"
+			failed++
+		}
+		// Back off quadratically: 1, 4, 9, 16... minutes between attempts
+		backoff := time.Duration(attempts*attempts) * time.Minute
+		_, dbErr := s.DB.ExecContext(ctx, `UPDATE notification_outbox
+		                                   SET status = $2, attempts = $3, last_error = $4,
+		                                       next_attempt_on = now() + $5::interval
+		                                   WHERE id = $1`,
+			entry.ID, status, attempts, err.Error(), fmt.Sprintf("%d seconds", int(backoff.Seconds())))
+		if dbErr != nil {
+			log.Printf("notification worker: failed to record the failed attempt of notification %d: %v", entry.ID, dbErr)
+		}
+	}
+
+	return sent, failed, nil
+}
+
+// claimOutboxEntries marks a batch of due notifications as sending and commits,
+// so no lock is held while the providers are called
+func (s *NotificationService) claimOutboxEntries(ctx context.Context) ([]outboxEntry, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Rows whose lease expired were left by a worker that stopped or could not
+	// record the result; sending them again could deliver them twice
+	_, err = tx.ExecContext(ctx, `UPDATE notification_outbox
+	                              SET status = 'failed', attempts = attempts + 1,
+	                                  last_error = 'Delivery interrupted, the message may have been sent'
+	                              WHERE status = 'sending' AND next_attempt_on <= now()`)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lease covers every message of the batch timing out
+	lease := time.Duration(outboxBatchSize) * outboxSendTimeout
+	rows, err := tx.QueryContext(ctx, `UPDATE notification_outbox
+	                                   SET status = 'sending', next_attempt_on = now() + $2::interval
+	                                   WHERE id IN (SELECT id
+	                                                FROM notification_outbox
+	                                                WHERE status = 'pending' AND next_attempt_on <= now()
+	                                                ORDER BY id
+	                                                LIMIT $1
+	                                                FOR UPDATE SKIP LOCKED)
+	                                   RETURNING id, channel, recipient, COALESCE(subject, ''), COALESCE(body, ''), attempts,
+	                                             attachment_name, attachment_type, attachment`,
+		outboxBatchSize, fmt.Sprintf("%d seconds", int(lease.Seconds())))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []outboxEntry
+	for rows.Next() {
+		var entry outboxEntry
+		var attachmentName, attachmentType, attachment sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.Channel, &entry.Recipient, &entry.Subject, &entry.Body, &entry.Attempts,
+			&attachmentName, &attachmentType, &attachment); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if attachment.Valid {
+			entry.Attachment = &Attachment{
+				Name:        attachmentName.String,
+				ContentType: attachmentType.String,
+				Content:     []byte(attachment.String),
+			}
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// Get client contact preferences
+func (app *App) getClientContactPreferences(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	prefs, err := app.Notifier.loadContactPreferences(clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch contact preferences: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Contact preferences retrieved successfully", prefs)
+}
+
+// Email and phone live on the client record and are edited through the client endpoints
+type UpdateContactPreferencesRequest struct {
+	Language         string `json:"language"`
+	PreferredChannel string `json:"preferred_channel"`
+	EmailOptOut      bool   `json:"email_opt_out"`
+	SMSOptOut        bool   `json:"sms_opt_out"`
+}
+
+// Create or replace client contact preferences
+func (app *App) updateClientContactPreferences(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateContactPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateContactPreferences(&req); err != nil {
+		sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	_, err = app.DB.Exec(`INSERT INTO client_contact_preferences
+	                          (client_id, language, preferred_channel, email_opt_out, sms_opt_out, updated_by)
+	                      VALUES ($1, $2, $3, $4, $5, $6)
+	                      ON CONFLICT (client_id) DO UPDATE
+	                      SET language = EXCLUDED.language,
+	                          preferred_channel = EXCLUDED.preferred_channel,
+	                          email_opt_out = EXCLUDED.email_opt_out,
+	                          sms_opt_out = EXCLUDED.sms_opt_out,
+	                          updated_on = now(),
+	                          updated_by = EXCLUDED.updated_by`,
+		clientID, req.Language, req.PreferredChannel, req.EmailOptOut, req.SMSOptOut, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to save contact preferences: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	prefs, err := app.Notifier.loadContactPreferences(clientID)
+	if err != nil {
+		sendSuccessResponse(w, "Contact preferences updated successfully", map[string]interface{}{
+			"status":    "OK",
+			"client_id": clientID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Contact preferences updated successfully", prefs)
+}
+
+func validateContactPreferences(req *UpdateContactPreferencesRequest) error {
+	if req.Language == "" {
+		req.Language = "ro"
+	}
+	if !supportedLanguages[req.Language] {
+		return fmt.Errorf("language must be one of: ro, en")
+	}
+	if req.PreferredChannel == "" {
+		req.PreferredChannel = channelEmail
+	}
+	if req.PreferredChannel != channelEmail && req.PreferredChannel != channelSMS && req.PreferredChannel != channelNone {
+		return fmt.Errorf("preferred_channel must be one of: email, sms, none")
+	}
+
+	return nil
+}
+
+// normalizePhone strips the spaces, dots and dashes people type in phone numbers
+func normalizePhone(phone string) string {
+	return strings.NewReplacer(" ", "", "-", "", ".", "").Replace(strings.TrimSpace(phone))
+}
+
+// validateContactDetails checks optional email and phone values
+func validateContactDetails(email, phone string) error {
+	if email != "" {
+		if len(email) > 128 {
+			return fmt.Errorf("email cannot exceed 128 characters")
+		}
+		if _, err := mail.ParseAddress(email); err != nil {
+			return fmt.Errorf("email address is not valid")
+		}
+	}
+	if phone != "" && !phoneRegex.MatchString(phone) {
+		return fmt.Errorf("phone must contain 8 to 15 digits, optionally prefixed by +")
+	}
+	return nil
+}
+
+type OutboxNotification struct {
+	ID            int    `json:"id"`
+	ClientID      int    `json:"client_id"`
+	Channel       string `json:"channel"`
+	Recipient     string `json:"recipient"`
+	Template      string `json:"template"`
+	Language      string `json:"language"`
+	Subject       string `json:"subject"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error,omitempty"`
+	NextAttemptOn string `json:"next_attempt_on"`
+	CreatedOn     string `json:"created_on"`
+	SentOn        string `json:"sent_on,omitempty"`
+}
+
+// List outbox notifications for the user's clients
+func (app *App) getNotifications(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "pending" && status != "sending" && status != "sent" && status != "failed" {
+		sendErrorResponse(w, "Invalid status parameter (pending, sending, sent, failed)", http.StatusBadRequest)
+		return
+	}
+
+	clientID := 0
+	if clientIDStr := r.URL.Query().Get("client_id"); clientIDStr != "" {
+		clientID, err = strconv.Atoi(clientIDStr)
+		if err != nil || clientID <= 0 {
+			sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	query := `SELECT n.id, n.client_id, n.channel, n.recipient, n.template, n.language,
+                     COALESCE(n.subject, ''), n.status, n.attempts, COALESCE(n.last_error, ''),
+                     TO_CHAR(n.next_attempt_on, 'YYYY-MM-DD HH24:MI:SS'),
+                     TO_CHAR(n.created_on, 'YYYY-MM-DD HH24:MI:SS'),
+                     COALESCE(TO_CHAR(n.sent_on, 'YYYY-MM-DD HH24:MI:SS'), '')
+              FROM notification_outbox n
+              INNER JOIN user_clients uc ON uc.client_id = n.client_id
+              WHERE uc.user_id = $1
+                AND ($2 = '' OR n.status = $2)
+                AND ($3 = 0 OR n.client_id = $3)
+              ORDER BY n.id DESC
+              LIMIT 200`
+
+	rows, err := app.DB.Query(query, claims.UserID, status, clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch notifications: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var notifications []OutboxNotification
+	for rows.Next() {
+		var n OutboxNotification
+		err := rows.Scan(&n.ID, &n.ClientID, &n.Channel, &n.Recipient, &n.Template, &n.Language,
+			&n.Subject, &n.Status, &n.Attempts, &n.LastError, &n.NextAttemptOn, &n.CreatedOn, &n.SentOn)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan notification: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		notifications = append(notifications, n)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no notifications found, return empty array instead of null
+	if notifications == nil {
+		notifications = []OutboxNotification{}
+	}
+
+	sendSuccessResponse(w, "Notifications retrieved successfully", notifications)
+}
+
+// Requeue a failed notification for another round of delivery attempts
+func (app *App) retryNotification(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	notificationID, err := strconv.Atoi(vars["notification_id"])
+	if err != nil || notificationID <= 0 {
+		sendErrorResponse(w, "Invalid notification_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	result, err := app.DB.Exec(`UPDATE notification_outbox n
+	                           SET status = 'pending', attempts = 0, next_attempt_on = now()
+	                           WHERE n.id = $1 AND n.status = 'failed'
+	                             AND EXISTS (SELECT 1 FROM user_clients uc
+	                                         WHERE uc.client_id = n.client_id AND uc.user_id = $2)`,
+		notificationID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to requeue notification: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "Failed notification not found", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Notification requeued successfully", map[string]interface{}{
+		"status":          "OK",
+		"notification_id": notificationID,
+	})
+}
@@ -0,0 +1,317 @@
+// Package pdf writes simple PDF 1.4 documents: text in the standard Helvetica
+// fonts, lines, filled rectangles and JPEG images. It has no dependencies
+// outside the standard library and embeds no fonts, so documents stay small.
+//
+// Coordinates are in points (1/72 inch) measured from the top-left corner of
+// the page; for text, y is the baseline.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A4 page size in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Font is one of the standard Type 1 fonts every PDF reader provides
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = [...]string{"Helvetica", "Helvetica-Bold"}
+
+// Color is an RGB color with components between 0 and 1
+type Color struct {
+	R, G, B float64
+}
+
+var (
+	Black = Color{0, 0, 0}
+	White = Color{1, 1, 1}
+	Gray  = Color{0.45, 0.45, 0.45}
+)
+
+// ParseHexColor parses colors written as #RRGGBB
+func ParseHexColor(s string) (Color, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return Color{}, fmt.Errorf("color %q is not in #RRGGBB format", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return Color{}, fmt.Errorf("color %q is not in #RRGGBB format", s)
+	}
+	return Color{
+		R: float64(v>>16&0xff) / 255,
+		G: float64(v>>8&0xff) / 255,
+		B: float64(v&0xff) / 255,
+	}, nil
+}
+
+// Document is a PDF being built in memory
+type Document struct {
+	Title   string
+	Author  string
+	Created time.Time
+
+	pages  []*Page
+	images []*Image
+}
+
+// Page is a page of a Document; drawing operations append to its content stream
+type Page struct {
+	Width, Height float64
+
+	content bytes.Buffer
+	images  map[*Image]bool
+}
+
+// Image is a JPEG added to a document, which any of its pages can draw
+type Image struct {
+	Width, Height int // in pixels
+
+	name       string
+	colorSpace string
+	data       []byte
+}
+
+// New returns an empty document
+func New(title string) *Document {
+	return &Document{Title: title, Created: time.Now()}
+}
+
+// AddPage appends an A4 portrait page
+func (d *Document) AddPage() *Page {
+	page := &Page{Width: A4Width, Height: A4Height, images: make(map[*Image]bool)}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// Pages returns the pages added so far, in order
+func (d *Document) Pages() []*Page {
+	return d.pages
+}
+
+// AddJPEG adds a baseline JPEG image; the data is embedded as is
+func (d *Document) AddJPEG(data []byte) (*Image, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var colorSpace string
+	switch config.ColorModel {
+	case color.GrayModel:
+		colorSpace = "/DeviceGray"
+	case color.YCbCrModel, color.RGBAModel:
+		colorSpace = "/DeviceRGB"
+	default:
+		return nil, errors.New("only grayscale and RGB JPEG images are supported")
+	}
+
+	img := &Image{
+		Width:      config.Width,
+		Height:     config.Height,
+		name:       fmt.Sprintf("Im%d", len(d.images)+1),
+		colorSpace: colorSpace,
+		data:       data,
+	}
+	d.images = append(d.images, img)
+	return img, nil
+}
+
+// Text draws s with its baseline starting at (x, y)
+func (p *Page) Text(x, y float64, font Font, size float64, c Color, s string) {
+	fmt.Fprintf(&p.content, "BT %s rg /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		rgb(c), int(font)+1, num(size), num(x), num(p.Height-y), escape(encode(s)))
+}
+
+// TextRight draws s so that it ends at x
+func (p *Page) TextRight(x, y float64, font Font, size float64, c Color, s string) {
+	p.Text(x-TextWidth(font, size, s), y, font, size, c, s)
+}
+
+// TextCenter draws s centered on x
+func (p *Page) TextCenter(x, y float64, font Font, size float64, c Color, s string) {
+	p.Text(x-TextWidth(font, size, s)/2, y, font, size, c, s)
+}
+
+// Line draws a straight line between two points
+func (p *Page) Line(x1, y1, x2, y2, width float64, c Color) {
+	fmt.Fprintf(&p.content, "%s RG %s w %s %s m %s %s l S\n",
+		rgb(c), num(width), num(x1), num(p.Height-y1), num(x2), num(p.Height-y2))
+}
+
+// Rect fills a rectangle whose top-left corner is (x, y)
+func (p *Page) Rect(x, y, w, h float64, c Color) {
+	fmt.Fprintf(&p.content, "%s rg %s %s %s %s re f\n",
+		rgb(c), num(x), num(p.Height-y-h), num(w), num(h))
+}
+
+// DrawImage draws img scaled to w x h with its top-left corner at (x, y)
+func (p *Page) DrawImage(img *Image, x, y, w, h float64) {
+	p.images[img] = true
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /%s Do Q\n",
+		num(w), num(h), num(x), num(p.Height-y-h), img.name)
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo renders the document to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// Object numbers: catalog, page tree, info, fonts, images, then a page and its content per page
+	const catalogID, pagesID, infoID, firstFontID = 1, 2, 3, 4
+	firstImageID := firstFontID + len(fontNames)
+	firstPageID := firstImageID + len(d.images)
+	imageIDs := make(map[*Image]int, len(d.images))
+	for i, img := range d.images {
+		imageIDs[img] = firstImageID + i
+	}
+
+	out := &pdfWriter{}
+	out.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPageID+2*i)
+	}
+	out.object(catalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+	out.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	out.object(infoID, fmt.Sprintf("<< /Title (%s) /Author (%s) /Producer (GoGymRestApi) /CreationDate (D:%s) >>",
+		escape(encode(d.Title)), escape(encode(d.Author)), d.Created.UTC().Format("20060102150405Z")))
+	for i, name := range fontNames {
+		out.object(firstFontID+i, fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+	for _, img := range d.images {
+		header := fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode /Length %d >>",
+			img.Width, img.Height, img.colorSpace, len(img.data))
+		out.stream(imageIDs[img], header, img.data)
+	}
+
+	var fonts strings.Builder
+	for i := range fontNames {
+		fmt.Fprintf(&fonts, "/F%d %d 0 R ", i+1, firstFontID+i)
+	}
+	for i, page := range d.pages {
+		pageID := firstPageID + 2*i
+
+		var xobjects strings.Builder
+		for _, img := range d.images {
+			if page.images[img] {
+				fmt.Fprintf(&xobjects, "/%s %d 0 R ", img.name, imageIDs[img])
+			}
+		}
+		resources := "<< /Font << " + fonts.String() + ">>"
+		if xobjects.Len() > 0 {
+			resources += " /XObject << " + xobjects.String() + ">>"
+		}
+		resources += " >>"
+
+		out.object(pageID, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %s /Contents %d 0 R >>",
+			pagesID, num(page.Width), num(page.Height), resources, pageID+1))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(page.content.Bytes()); err != nil {
+			return 0, err
+		}
+		if err := zw.Close(); err != nil {
+			return 0, err
+		}
+		out.stream(pageID+1, fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>", compressed.Len()), compressed.Bytes())
+	}
+
+	// Cross-reference table; entries must be exactly 20 bytes
+	xrefOffset := out.buf.Len()
+	objectCount := firstPageID + 2*len(d.pages)
+	out.printf("xref\n0 %d\n0000000000 65535 f \n", objectCount)
+	for id := 1; id < objectCount; id++ {
+		out.printf("%010d 00000 n \n", out.offsets[id])
+	}
+	out.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		objectCount, catalogID, infoID, xrefOffset)
+
+	n, err := w.Write(out.buf.Bytes())
+	return int64(n), err
+}
+
+type pdfWriter struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+}
+
+func (pw *pdfWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&pw.buf, format, args...)
+}
+
+func (pw *pdfWriter) object(id int, body string) {
+	pw.begin(id)
+	pw.printf("%s\nendobj\n", body)
+}
+
+func (pw *pdfWriter) stream(id int, header string, data []byte) {
+	pw.begin(id)
+	pw.printf("%s\nstream\n", header)
+	pw.buf.Write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+func (pw *pdfWriter) begin(id int) {
+	if pw.offsets == nil {
+		pw.offsets = make(map[int]int)
+	}
+	pw.offsets[id] = pw.buf.Len()
+	pw.printf("%d 0 obj\n", id)
+}
+
+func rgb(c Color) string {
+	return num(c.R) + " " + num(c.G) + " " + num(c.B)
+}
+
+// num formats a number compactly, as PDF readers do not accept exponents
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// escape protects the characters that are special inside PDF literal strings
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r', '\n', '\t':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package pdf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Glyph widths of the standard fonts for the printable ASCII characters
+// (32 to 126), in 1/1000 of the font size, from the Adobe font metrics
+var asciiWidths = [...][95]int{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// WinAnsi code points outside Latin-1 (0x80 to 0x9f)
+var winAnsiExtra = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// Romanian letters WinAnsi lacks, written without the diacritic. Both the
+// comma-below and the older cedilla forms are used in practice.
+var transliterations = map[rune]byte{
+	'ă': 'a', 'Ă': 'A', 'ș': 's', 'Ș': 'S', 'ş': 's', 'Ş': 'S', 'ț': 't', 'Ț': 'T', 'ţ': 't', 'Ţ': 'T',
+}
+
+// Width stand-ins for the non-ASCII characters: accented letters take the
+// width of their base letter
+var extraWidthAs = map[byte]byte{
+	0x80: '0', 0x82: ',', 0x84: '"', 0x85: 'm', 0x91: '\'', 0x92: '\'', 0x93: '"', 0x94: '"',
+	0x95: '-', 0x96: 'n', 0x97: 'M', 0x99: 'M',
+}
+
+// encode converts s to WinAnsi bytes; characters the encoding lacks become '?'
+func encode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			b.WriteByte(byte(r))
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			if c, ok := winAnsiExtra[r]; ok {
+				b.WriteByte(c)
+			} else if c, ok := transliterations[r]; ok {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+// TextWidth returns the width of s in points
+func TextWidth(font Font, size float64, s string) float64 {
+	total := 0
+	encoded := encode(s)
+	for i := 0; i < len(encoded); i++ {
+		total += charWidth(font, encoded[i])
+	}
+	return float64(total) * size / 1000
+}
+
+func charWidth(font Font, c byte) int {
+	if c >= 0x80 {
+		if base, ok := extraWidthAs[c]; ok {
+			c = base
+		} else {
+			c = latin1Base(c)
+		}
+	}
+	if c < 32 || c > 126 {
+		return 556
+	}
+	return asciiWidths[font][c-32]
+}
+
+// latin1Base maps an accented Latin-1 letter to its unaccented letter
+func latin1Base(c byte) byte {
+	const bases = "AAAAAAACEEEEIIIIDNOOOOOxOUUUUYPsaaaaaaaceeeeiiiidnooooo/ouuuuypy"
+	if c >= 0xc0 {
+		return bases[c-0xc0]
+	}
+	return 'o'
+}
+
+// Wrap breaks text into lines no wider than maxWidth, at spaces where possible.
+// Newlines in text start a new line; a blank line is kept as an empty string.
+func Wrap(font Font, size float64, text string, maxWidth float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		words := strings.FieldsFunc(paragraph, unicode.IsSpace)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+
+		line := ""
+		for _, word := range words {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if TextWidth(font, size, candidate) <= maxWidth {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Words longer than the line are split wherever they overflow
+			for TextWidth(font, size, word) > maxWidth {
+				runes := []rune(word)
+				n := len(runes) - 1
+				for n > 1 && TextWidth(font, size, string(runes[:n])) > maxWidth {
+					n--
+				}
+				lines = append(lines, string(runes[:n]))
+				word = string(runes[n:])
+			}
+			line = word
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
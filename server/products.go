@@ -0,0 +1,740 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	productTypeProduct = "product"
+	productTypeService = "service"
+)
+
+type Product struct {
+	ID          int     `json:"id"`
+	SKU         string  `json:"sku"`
+	Name        string  `json:"name"`
+	ProductType string  `json:"product_type"` // product or service; only products are kept in stock
+	Price       float64 `json:"price"`        // Gross price, VAT included
+	VATRate     float64 `json:"vat_rate"`
+	Currency    string  `json:"currency"`
+	IsActive    bool    `json:"is_active"`
+	CreatedOn   string  `json:"created_on"`
+	UpdatedOn   string  `json:"updated_on"`
+}
+
+type ProductRequest struct {
+	SKU         string   `json:"sku"`
+	Name        string   `json:"name"`
+	ProductType string   `json:"product_type"` // defaults to product
+	Price       float64  `json:"price"`
+	VATRate     *float64 `json:"vat_rate,omitempty"` // defaults to 21
+	Currency    string   `json:"currency,omitempty"` // defaults to RON
+	IsActive    *bool    `json:"is_active,omitempty"`
+}
+
+type ProductStock struct {
+	GymID        int     `json:"gym_id"`
+	ProductID    int     `json:"product_id"`
+	SKU          string  `json:"sku"`
+	Name         string  `json:"name"`
+	Price        float64 `json:"price"`
+	Currency     string  `json:"currency"`
+	IsActive     bool    `json:"is_active"`
+	Quantity     int     `json:"quantity"`
+	ReorderLevel int     `json:"reorder_level"`
+	LowStock     bool    `json:"low_stock"`
+	UpdatedOn    string  `json:"updated_on,omitempty"`
+}
+
+type StockMovementRequest struct {
+	ProductID    int    `json:"product_id"`
+	MovementType string `json:"movement_type"` // receipt or adjustment; sales move stock on their own
+	Quantity     int    `json:"quantity"`      // received quantity, or signed correction for adjustments
+	Note         string `json:"note,omitempty"`
+}
+
+type UpdateReorderLevelRequest struct {
+	ReorderLevel int `json:"reorder_level"`
+}
+
+type StockMovement struct {
+	ID            int    `json:"id"`
+	GymID         int    `json:"gym_id"`
+	ProductID     int    `json:"product_id"`
+	ProductName   string `json:"product_name"`
+	MovementType  string `json:"movement_type"`
+	Quantity      int    `json:"quantity"`
+	QuantityAfter int    `json:"quantity_after"`
+	SaleID        *int   `json:"sale_id,omitempty"`
+	Note          string `json:"note,omitempty"`
+	CreatedOn     string `json:"created_on"`
+	CreatedBy     *int   `json:"created_by"`
+}
+
+// productQuery selects products of the catalog
+const productQuery = `SELECT p.id, p.sku, p.name, p.product_type, p.price, p.vat_rate, p.currency,
+                             COALESCE(p.is_active, false), TO_CHAR(p.created_on, 'YYYY-MM-DD'),
+                             TO_CHAR(p.updated_on, 'YYYY-MM-DD')
+                      FROM products p`
+
+func scanProduct(scanner interface{ Scan(...interface{}) error }, product *Product) error {
+	return scanner.Scan(&product.ID, &product.SKU, &product.Name, &product.ProductType, &product.Price,
+		&product.VATRate, &product.Currency, &product.IsActive, &product.CreatedOn, &product.UpdatedOn)
+}
+
+// List the product catalog
+func (app *App) getProducts(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+	productType := r.URL.Query().Get("type")
+	if productType != "" && productType != productTypeProduct && productType != productTypeService {
+		sendErrorResponse(w, "Invalid type parameter (product or service)", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := app.DB.Query(productQuery+` WHERE ($1 = false OR p.is_active)
+	                                          AND ($2 = '' OR p.product_type = $2)
+	                                        ORDER BY p.name`, activeOnly, productType)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch products: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var products []Product
+	for rows.Next() {
+		var product Product
+		if err := scanProduct(rows, &product); err != nil {
+			sendErrorResponse(w, "Failed to scan product: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		products = append(products, product)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no products found, return empty array instead of null
+	if products == nil {
+		products = []Product{}
+	}
+
+	sendSuccessResponse(w, "Products retrieved successfully", products)
+}
+
+// Add a product or service to the catalog shared by all gyms
+func (app *App) createProduct(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateProduct(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// The catalog is managed by users working at a gym
+	var exists bool
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1)`, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE upper(sku) = $1)", req.SKU).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "sku", Message: "a product with this SKU already exists"}})
+		return
+	}
+
+	var productID int
+	err = app.DB.QueryRow(`INSERT INTO products (sku, name, product_type, price, vat_rate, currency, is_active,
+	                                             created_by, updated_by)
+	                       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+	                       RETURNING id`,
+		req.SKU, req.Name, req.ProductType, req.Price, *req.VATRate, req.Currency, *req.IsActive,
+		claims.UserID).Scan(&productID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to create product: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var product Product
+	if err := scanProduct(app.DB.QueryRow(productQuery+" WHERE p.id = $1", productID), &product); err != nil {
+		sendSuccessResponse(w, "Product created successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     productID,
+			"sku":    req.SKU,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Product created successfully", product)
+}
+
+// Update a product; past sales keep the price they were sold at
+func (app *App) updateProduct(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	productID, err := strconv.Atoi(vars["product_id"])
+	if err != nil || productID <= 0 {
+		sendErrorResponse(w, "Invalid product_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req ProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateProduct(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	var exists bool
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1)`, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	var current Product
+	if err := scanProduct(app.DB.QueryRow(productQuery+" WHERE p.id = $1", productID), &current); err != nil {
+		sendErrorResponse(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE upper(sku) = $1 AND id <> $2)", req.SKU, productID).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "sku", Message: "a product with this SKU already exists"}})
+		return
+	}
+
+	// A product with stock or movements cannot become a service
+	if current.ProductType == productTypeProduct && req.ProductType == productTypeService {
+		err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM stock_movements WHERE product_id = $1)", productID).Scan(&exists)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			sendValidationErrorResponse(w, ValidationErrors{{Field: "product_type", Message: "a product with stock movements cannot become a service"}})
+			return
+		}
+	}
+
+	_, err = app.DB.Exec(`UPDATE products
+	                      SET sku = $1, name = $2, product_type = $3, price = $4, vat_rate = $5, currency = $6,
+	                          is_active = $7, updated_on = now(), updated_by = $8
+	                      WHERE id = $9`,
+		req.SKU, req.Name, req.ProductType, req.Price, *req.VATRate, req.Currency, *req.IsActive,
+		claims.UserID, productID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update product: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var product Product
+	if err := scanProduct(app.DB.QueryRow(productQuery+" WHERE p.id = $1", productID), &product); err != nil {
+		sendSuccessResponse(w, "Product updated successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     productID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Product updated successfully", product)
+}
+
+// Stock levels of the products at a gym, including products never stocked there
+func (app *App) getGymStock(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	lowOnly := r.URL.Query().Get("low_only") == "true"
+
+	stockQuery := `SELECT p.id, p.sku, p.name, p.price, p.currency, COALESCE(p.is_active, false),
+	                      COALESCE(ps.quantity, 0), COALESCE(ps.reorder_level, 0),
+	                      COALESCE(TO_CHAR(ps.updated_on, 'YYYY-MM-DD HH24:MI:SS'), '')
+	               FROM products p
+	               LEFT JOIN product_stock ps ON ps.product_id = p.id AND ps.gym_id = $1
+	               WHERE p.product_type = 'product'
+	                 AND (p.is_active OR COALESCE(ps.quantity, 0) <> 0)
+	                 AND ($2 = false OR COALESCE(ps.quantity, 0) <= COALESCE(ps.reorder_level, 0))
+	               ORDER BY p.name`
+
+	rows, err := app.DB.Query(stockQuery, gymID, lowOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch stock: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var stock []ProductStock
+	for rows.Next() {
+		item := ProductStock{GymID: gymID}
+		err := rows.Scan(&item.ProductID, &item.SKU, &item.Name, &item.Price, &item.Currency, &item.IsActive,
+			&item.Quantity, &item.ReorderLevel, &item.UpdatedOn)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan stock: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		item.LowStock = item.Quantity <= item.ReorderLevel
+		stock = append(stock, item)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no products found, return empty array instead of null
+	if stock == nil {
+		stock = []ProductStock{}
+	}
+
+	sendSuccessResponse(w, "Stock retrieved successfully", stock)
+}
+
+// Record a receipt of goods or a stock adjustment (count correction, breakage) at a gym
+func (app *App) createStockMovement(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req StockMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var fieldErrs ValidationErrors
+	if req.ProductID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "product_id", Message: "Valid product_id is required"})
+	}
+	switch req.MovementType {
+	case "receipt":
+		if req.Quantity <= 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "quantity", Message: "received quantity must be positive"})
+		}
+	case "adjustment":
+		if req.Quantity == 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "quantity", Message: "quantity cannot be zero"})
+		}
+		if strings.TrimSpace(req.Note) == "" {
+			fieldErrs = append(fieldErrs, FieldError{Field: "note", Message: "adjustments need a note"})
+		}
+	default:
+		fieldErrs = append(fieldErrs, FieldError{Field: "movement_type", Message: "movement type must be receipt or adjustment"})
+	}
+	if len(req.Note) > 256 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "note", Message: "note cannot exceed 256 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT record_stock_movement($1, $2, $3, $4, $5, NULL, $6)", gymID, req.ProductID,
+		req.MovementType, req.Quantity, nullIfEmpty(req.Note), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	var movement StockMovement
+	err = scanStockMovement(app.DB.QueryRow(stockMovementQuery+` WHERE sm.gym_id = $1 AND sm.product_id = $2
+	                                                               ORDER BY sm.id DESC
+	                                                               LIMIT 1`, gymID, req.ProductID), &movement)
+	if err != nil {
+		sendSuccessResponse(w, "Stock movement recorded successfully", map[string]interface{}{
+			"status":     "OK",
+			"gym_id":     gymID,
+			"product_id": req.ProductID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Stock movement recorded successfully", movement)
+}
+
+// Set the stock level at which a product is reported as low at a gym
+func (app *App) updateStockReorderLevel(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	productID, err := strconv.Atoi(vars["product_id"])
+	if err != nil || productID <= 0 {
+		sendErrorResponse(w, "Invalid product_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateReorderLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ReorderLevel < 0 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "reorder_level", Message: "reorder_level cannot be negative"}})
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	result, err := app.DB.Exec(`INSERT INTO product_stock (gym_id, product_id, reorder_level)
+	                            SELECT $1, p.id, $3 FROM products p WHERE p.id = $2 AND p.product_type = 'product'
+	                            ON CONFLICT (gym_id, product_id) DO UPDATE SET reorder_level = EXCLUDED.reorder_level`,
+		gymID, productID, req.ReorderLevel)
+	if err != nil {
+		sendErrorResponse(w, "Failed to update reorder level: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "Product not found or not kept in stock", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Reorder level updated successfully", map[string]interface{}{
+		"status":        "OK",
+		"gym_id":        gymID,
+		"product_id":    productID,
+		"reorder_level": req.ReorderLevel,
+	})
+}
+
+// stockMovementQuery selects stock movements with the product name
+const stockMovementQuery = `SELECT sm.id, sm.gym_id, sm.product_id, COALESCE(p.name, ''), sm.movement_type,
+                                   sm.quantity, sm.quantity_after, sm.sale_id, COALESCE(sm.note, ''),
+                                   TO_CHAR(sm.created_on, 'YYYY-MM-DD HH24:MI:SS'), sm.created_by
+                            FROM stock_movements sm
+                            LEFT JOIN products p ON p.id = sm.product_id`
+
+func scanStockMovement(scanner interface{ Scan(...interface{}) error }, m *StockMovement) error {
+	return scanner.Scan(&m.ID, &m.GymID, &m.ProductID, &m.ProductName, &m.MovementType, &m.Quantity,
+		&m.QuantityAfter, &m.SaleID, &m.Note, &m.CreatedOn, &m.CreatedBy)
+}
+
+// List the stock movements of a gym, optionally for one product and a date range
+func (app *App) getStockMovements(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	productID := 0
+	if productIDStr := r.URL.Query().Get("product_id"); productIDStr != "" {
+		productID, err = strconv.Atoi(productIDStr)
+		if err != nil || productID <= 0 {
+			sendErrorResponse(w, "Invalid product_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	movementType := r.URL.Query().Get("type")
+	if movementType != "" && movementType != "receipt" && movementType != "sale" && movementType != "adjustment" {
+		sendErrorResponse(w, "Invalid type parameter (receipt, sale or adjustment)", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(stockMovementQuery+` WHERE sm.gym_id = $1
+	                                                 AND ($2 = 0 OR sm.product_id = $2)
+	                                                 AND ($3 = '' OR sm.movement_type = $3)
+	                                                 AND sm.created_on::date BETWEEN $4 AND $5
+	                                               ORDER BY sm.created_on DESC, sm.id DESC`,
+		gymID, productID, movementType, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch stock movements: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var movements []StockMovement
+	for rows.Next() {
+		var movement StockMovement
+		if err := scanStockMovement(rows, &movement); err != nil {
+			sendErrorResponse(w, "Failed to scan stock movement: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		movements = append(movements, movement)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no movements found, return empty array instead of null
+	if movements == nil {
+		movements = []StockMovement{}
+	}
+
+	sendSuccessResponse(w, "Stock movements retrieved successfully", movements)
+}
+
+// validateProduct checks the request, normalizes the SKU and fills in the defaults
+func validateProduct(req *ProductRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	req.SKU = strings.ToUpper(strings.TrimSpace(req.SKU))
+	if req.SKU == "" || len(req.SKU) > 32 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "sku", Message: "sku must have between 1 and 32 characters"})
+	} else if strings.ContainsAny(req.SKU, " \t") {
+		fieldErrs = append(fieldErrs, FieldError{Field: "sku", Message: "sku cannot contain spaces"})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 128 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "name", Message: "name must have between 1 and 128 characters"})
+	}
+
+	if req.ProductType == "" {
+		req.ProductType = productTypeProduct
+	}
+	if req.ProductType != productTypeProduct && req.ProductType != productTypeService {
+		fieldErrs = append(fieldErrs, FieldError{Field: "product_type", Message: "product type must be product or service"})
+	}
+
+	if req.Price < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "price", Message: "price cannot be negative"})
+	}
+	if req.VATRate == nil {
+		standard := 21.0
+		req.VATRate = &standard
+	} else if *req.VATRate < 0 || *req.VATRate > 100 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "vat_rate", Message: "vat_rate must be between 0 and 100"})
+	}
+
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	if req.Currency == "" {
+		req.Currency = "RON"
+	}
+	if len(req.Currency) != 3 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "currency", Message: "currency must be a 3-letter ISO code"})
+	}
+
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+
+	return fieldErrs
+}
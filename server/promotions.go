@@ -0,0 +1,325 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	discountTypePercent = "percent"
+	discountTypeFixed   = "fixed"
+)
+
+type PromoCode struct {
+	ID               int     `json:"id"`
+	Code             string  `json:"code"`
+	Description      string  `json:"description"`
+	DiscountType     string  `json:"discount_type"`
+	DiscountValue    float64 `json:"discount_value"`
+	MembershipID     *int    `json:"membership_id"`
+	GymID            *int    `json:"gym_id"`
+	ValidFrom        string  `json:"valid_from"`
+	ValidTo          string  `json:"valid_to"`
+	MaxUses          *int    `json:"max_uses"`
+	MaxUsesPerClient *int    `json:"max_uses_per_client"`
+	UsesCount        int     `json:"uses_count"`
+	IsActive         bool    `json:"is_active"`
+	CreatedOn        string  `json:"created_on"`
+}
+
+type CreatePromoCodeRequest struct {
+	Code             string  `json:"code"`
+	Description      string  `json:"description,omitempty"`
+	DiscountType     string  `json:"discount_type"` // percent or fixed
+	DiscountValue    float64 `json:"discount_value"`
+	MembershipID     int     `json:"membership_id,omitempty"` // every plan when omitted
+	GymID            int     `json:"gym_id,omitempty"`        // every gym when omitted
+	ValidFrom        string  `json:"valid_from,omitempty"`    // defaults to today
+	ValidTo          string  `json:"valid_to,omitempty"`
+	MaxUses          *int    `json:"max_uses,omitempty"`            // no limit when omitted
+	MaxUsesPerClient *int    `json:"max_uses_per_client,omitempty"` // defaults to 1, 0 for no limit
+}
+
+// promoCodeQuery selects the promo codes the user ($1) can see: codes for every gym
+// and codes of the user's gyms
+const promoCodeQuery = `SELECT p.id, p.code, COALESCE(p.description, ''), p.discount_type, p.discount_value,
+                               p.membership_id, p.gym_id, TO_CHAR(p.valid_from, 'YYYY-MM-DD'),
+                               COALESCE(TO_CHAR(p.valid_to, 'YYYY-MM-DD'), ''), p.max_uses, p.max_uses_per_client,
+                               p.uses_count, p.is_active, TO_CHAR(p.created_on, 'YYYY-MM-DD')
+                        FROM promo_codes p
+                        WHERE (p.gym_id IS NULL
+                               OR EXISTS (SELECT 1 FROM user_gyms ug WHERE ug.gym_id = p.gym_id AND ug.user_id = $1))`
+
+func scanPromoCode(scanner interface{ Scan(...interface{}) error }, promo *PromoCode) error {
+	return scanner.Scan(&promo.ID, &promo.Code, &promo.Description, &promo.DiscountType, &promo.DiscountValue,
+		&promo.MembershipID, &promo.GymID, &promo.ValidFrom, &promo.ValidTo, &promo.MaxUses,
+		&promo.MaxUsesPerClient, &promo.UsesCount, &promo.IsActive, &promo.CreatedOn)
+}
+
+// List promo codes. Query params: active_only=true hides expired and deactivated codes.
+func (app *App) getPromoCodes(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+
+	rows, err := app.DB.Query(promoCodeQuery+` AND (NOT $2 OR (p.is_active AND (p.valid_to IS NULL OR p.valid_to >= CURRENT_DATE)))
+	                                          ORDER BY p.created_on DESC, p.id DESC`, claims.UserID, activeOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch promo codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var promos []PromoCode
+	for rows.Next() {
+		var promo PromoCode
+		if err := scanPromoCode(rows, &promo); err != nil {
+			sendErrorResponse(w, "Failed to scan promo code: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		promos = append(promos, promo)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no promo codes found, return empty array instead of null
+	if promos == nil {
+		promos = []PromoCode{}
+	}
+
+	sendSuccessResponse(w, "Promo codes retrieved successfully", promos)
+}
+
+// Create a promo code
+func (app *App) createPromoCode(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req CreatePromoCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validatePromoCode(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Gym codes need access to that gym; plan codes need access to a gym offering the plan
+	var exists bool
+	if req.GymID > 0 {
+		permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, req.GymID).Scan(&exists)
+		if err != nil || !exists {
+			sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+			return
+		}
+	}
+	if req.MembershipID > 0 {
+		permissionQuery := `SELECT EXISTS(SELECT 1 FROM membership_gyms mg
+		                                  INNER JOIN user_gyms ug ON ug.gym_id = mg.gym_id
+		                                  WHERE mg.membership_id = $1 AND ug.user_id = $2
+		                                    AND ($3 = 0 OR mg.gym_id = $3))`
+		err = app.DB.QueryRow(permissionQuery, req.MembershipID, claims.UserID, req.GymID).Scan(&exists)
+		if err != nil || !exists {
+			sendErrorResponse(w, "Membership not found or access denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	err = app.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM promo_codes WHERE upper(code) = $1)", req.Code).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "code", Message: "a promo code with this code already exists"}})
+		return
+	}
+
+	var maxUsesPerClient interface{}
+	if *req.MaxUsesPerClient > 0 {
+		maxUsesPerClient = *req.MaxUsesPerClient
+	}
+
+	var promoID int
+	err = app.DB.QueryRow(`INSERT INTO promo_codes (code, description, discount_type, discount_value, membership_id,
+	                                                gym_id, valid_from, valid_to, max_uses, max_uses_per_client,
+	                                                created_by)
+	                       VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	                       RETURNING id`,
+		req.Code, nullIfEmpty(req.Description), req.DiscountType, req.DiscountValue, nullIfZero(req.MembershipID),
+		nullIfZero(req.GymID), req.ValidFrom, nullIfEmpty(req.ValidTo), req.MaxUses, maxUsesPerClient,
+		claims.UserID).Scan(&promoID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to create promo code: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var promo PromoCode
+	if err := scanPromoCode(app.DB.QueryRow(promoCodeQuery+" AND p.id = $2", claims.UserID, promoID), &promo); err != nil {
+		sendSuccessResponse(w, "Promo code created successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     promoID,
+			"code":   req.Code,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Promo code created successfully", promo)
+}
+
+// Deactivate a promo code; its redemptions are kept for reporting
+func (app *App) deactivatePromoCode(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	promoID, err := strconv.Atoi(vars["promo_code_id"])
+	if err != nil || promoID <= 0 {
+		sendErrorResponse(w, "Invalid promo_code_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Codes for every gym can be deactivated by their creator, gym codes by the gym's users
+	result, err := app.DB.Exec(`UPDATE promo_codes p
+	                           SET is_active = false
+	                           WHERE p.id = $1 AND p.is_active
+	                             AND ((p.gym_id IS NULL AND p.created_by = $2)
+	                                  OR EXISTS (SELECT 1 FROM user_gyms ug WHERE ug.gym_id = p.gym_id AND ug.user_id = $2))`,
+		promoID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to deactivate promo code: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "Active promo code not found or access denied", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Promo code deactivated successfully", map[string]interface{}{
+		"status": "OK",
+		"id":     promoID,
+	})
+}
+
+// validatePromoCode checks the request, normalizes the code and fills in the defaults
+func validatePromoCode(req *CreatePromoCodeRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	req.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	if len(req.Code) < 3 || len(req.Code) > 32 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "code", Message: "code must have between 3 and 32 characters"})
+	} else if strings.ContainsAny(req.Code, " \t") {
+		fieldErrs = append(fieldErrs, FieldError{Field: "code", Message: "code cannot contain spaces"})
+	}
+	if len(req.Description) > 256 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "description", Message: "description cannot exceed 256 characters"})
+	}
+
+	switch req.DiscountType {
+	case discountTypePercent:
+		if req.DiscountValue <= 0 || req.DiscountValue > 100 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "discount_value", Message: "percentage must be between 0 and 100"})
+		}
+	case discountTypeFixed:
+		if req.DiscountValue <= 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: "discount_value", Message: "discount must be positive"})
+		}
+	default:
+		fieldErrs = append(fieldErrs, FieldError{Field: "discount_type", Message: "discount type must be percent or fixed"})
+	}
+
+	if req.MembershipID < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "membership_id", Message: "membership_id must be positive"})
+	}
+	if req.GymID < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "gym_id", Message: "gym_id must be positive"})
+	}
+
+	if req.ValidFrom == "" {
+		req.ValidFrom = time.Now().Format("2006-01-02")
+	}
+	validFrom, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "valid_from", Message: "date must be in YYYY-MM-DD format"})
+	}
+	if req.ValidTo != "" {
+		validTo, err := time.Parse("2006-01-02", req.ValidTo)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "date must be in YYYY-MM-DD format"})
+		} else if validTo.Before(validFrom) {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "valid_to cannot be before valid_from"})
+		}
+	}
+
+	if req.MaxUses != nil && *req.MaxUses <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "max_uses", Message: "max_uses must be positive"})
+	}
+	if req.MaxUsesPerClient == nil {
+		once := 1
+		req.MaxUsesPerClient = &once
+	} else if *req.MaxUsesPerClient < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "max_uses_per_client", Message: "max_uses_per_client cannot be negative"})
+	}
+
+	return fieldErrs
+}
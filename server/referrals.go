@@ -0,0 +1,217 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+type ClientReferral struct {
+	ID                         int    `json:"id"`
+	ReferrerClientID           int    `json:"referrer_client_id"`
+	ReferrerName               string `json:"referrer_name"`
+	ReferredClientID           int    `json:"referred_client_id"`
+	ReferredName               string `json:"referred_name"`
+	RewardDays                 int    `json:"reward_days"`
+	Status                     string `json:"status"` // pending, earned or rewarded
+	ReferredOn                 string `json:"referred_on"`
+	QualifiedOn                string `json:"qualified_on,omitempty"`
+	RewardedOn                 string `json:"rewarded_on,omitempty"`
+	RewardedClientMembershipID *int   `json:"rewarded_client_membership_id,omitempty"`
+}
+
+type SetClientReferrerRequest struct {
+	ReferrerClientID int `json:"referrer_client_id"`
+}
+
+// referralQuery selects referrals with both clients' names
+const referralQuery = `SELECT r.id, r.referrer_client_id, COALESCE(rc.name, ''), r.referred_client_id,
+                              COALESCE(dc.name, ''), r.reward_days, r.status, TO_CHAR(r.referred_on, 'YYYY-MM-DD'),
+                              COALESCE(TO_CHAR(r.qualified_on, 'YYYY-MM-DD'), ''),
+                              COALESCE(TO_CHAR(r.rewarded_on, 'YYYY-MM-DD'), ''), r.rewarded_client_membership_id
+                       FROM client_referrals r
+                       LEFT JOIN clients rc ON rc.id = r.referrer_client_id
+                       LEFT JOIN clients dc ON dc.id = r.referred_client_id`
+
+func scanReferral(scanner interface{ Scan(...interface{}) error }, referral *ClientReferral) error {
+	return scanner.Scan(&referral.ID, &referral.ReferrerClientID, &referral.ReferrerName,
+		&referral.ReferredClientID, &referral.ReferredName, &referral.RewardDays, &referral.Status,
+		&referral.ReferredOn, &referral.QualifiedOn, &referral.RewardedOn, &referral.RewardedClientMembershipID)
+}
+
+// Record which client referred this one. The referrer earns free days once the
+// referred client pays for their first membership.
+func (app *App) setClientReferrer(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req SetClientReferrerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.ReferrerClientID <= 0 {
+		sendErrorResponse(w, "Valid referrer_client_id is required", http.StatusBadRequest)
+		return
+	}
+	if req.ReferrerClientID == clientID {
+		sendErrorResponse(w, "A client cannot refer themselves", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for both clients
+	var count int
+	permissionQuery := `SELECT COUNT(DISTINCT client_id) FROM user_clients WHERE user_id = $1 AND client_id IN ($2, $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID, req.ReferrerClientID).Scan(&count)
+	if err != nil || count < 2 {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT set_client_referrer($1, $2, $3, $4)", clientID, req.ReferrerClientID,
+		app.Config.ReferralRewardDays, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	var referral ClientReferral
+	if err := scanReferral(app.DB.QueryRow(referralQuery+" WHERE r.referred_client_id = $1", clientID), &referral); err != nil {
+		sendSuccessResponse(w, "Referrer recorded successfully", map[string]interface{}{
+			"status":             "OK",
+			"client_id":          clientID,
+			"referrer_client_id": req.ReferrerClientID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Referrer recorded successfully", referral)
+}
+
+// List the client's referrer and the clients they referred
+func (app *App) getClientReferrals(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var referredBy *ClientReferral
+	var referral ClientReferral
+	err = scanReferral(app.DB.QueryRow(referralQuery+" WHERE r.referred_client_id = $1", clientID), &referral)
+	if err == nil {
+		referredBy = &referral
+	}
+
+	rows, err := app.DB.Query(referralQuery+` WHERE r.referrer_client_id = $1
+	                                          ORDER BY r.referred_on DESC, r.id DESC`, clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch referrals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var referrals []ClientReferral
+	rewardDays := 0
+	for rows.Next() {
+		var referral ClientReferral
+		if err := scanReferral(rows, &referral); err != nil {
+			sendErrorResponse(w, "Failed to scan referral: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if referral.Status == "rewarded" {
+			rewardDays += referral.RewardDays
+		}
+		referrals = append(referrals, referral)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no referrals found, return empty array instead of null
+	if referrals == nil {
+		referrals = []ClientReferral{}
+	}
+
+	sendSuccessResponse(w, "Client referrals retrieved successfully", map[string]interface{}{
+		"client_id":          clientID,
+		"referred_by":        referredBy,
+		"referrals":          referrals,
+		"reward_days_earned": rewardDays,
+	})
+}
+
+// applyReferralRewards appends earned referral rewards that were waiting for the
+// referrer to have an active membership
+func (app *App) applyReferralRewards() {
+	var count int
+	if err := app.DB.QueryRow("SELECT apply_referral_rewards(NULL)").Scan(&count); err != nil {
+		log.Printf("membership job: failed to apply referral rewards: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("membership job: %d referral reward(s) applied", count)
+	}
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// Dunning states of a renewal whose invoice is not paid yet
+const (
+	dunningUnpaid    = "unpaid"    // invoiced, not yet due
+	dunningOverdue   = "overdue"   // past the due date, within the grace period
+	dunningSuspended = "suspended" // grace period over, check-ins are refused
+	dunningPaid      = "paid"
+)
+
+type UpdateAutoRenewRequest struct {
+	AutoRenew *bool `json:"auto_renew"`
+	GymID     int   `json:"gym_id,omitempty"` // Gym whose price list renewals use; default prices when omitted
+}
+
+// MembershipRenewal is a period the scheduler sold and invoiced
+type MembershipRenewal struct {
+	ClientMembershipID int    `json:"client_membership_id"`
+	RenewedFromID      int    `json:"renewed_from_id"`
+	ClientID           int    `json:"client_id"`
+	ClientName         string `json:"client_name"`
+	MembershipName     string `json:"membership_name"`
+	StartingFrom       string `json:"starting_from"`
+	EndingOn           string `json:"ending_on"`
+	InvoiceNo          string `json:"invoice_no"`
+	Amount             string `json:"amount"`
+	Currency           string `json:"currency"`
+	DueDate            string `json:"due_date"`
+}
+
+// DunningNotice is a renewal that just moved to a later dunning state
+type DunningNotice struct {
+	ClientMembershipID int    `json:"client_membership_id"`
+	ClientID           int    `json:"client_id"`
+	ClientName         string `json:"client_name"`
+	MembershipName     string `json:"membership_name"`
+	InvoiceNo          string `json:"invoice_no"`
+	Balance            string `json:"balance"`
+	Currency           string `json:"currency"`
+	DueDate            string `json:"due_date"`
+	SuspendOn          string `json:"suspend_on"` // first day check-ins are refused
+}
+
+// Turn automatic renewal of a client membership on or off
+func (app *App) updateClientMembershipAutoRenew(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	clientMembershipID, err := strconv.Atoi(vars["client_membership_id"])
+	if err != nil || clientMembershipID <= 0 {
+		sendErrorResponse(w, "Invalid client_membership_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateAutoRenewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.AutoRenew == nil {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "auto_renew", Message: "auto_renew is required"}})
+		return
+	}
+	if req.GymID < 0 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "gym_id", Message: "gym_id must be positive"}})
+		return
+	}
+
+	// Check if user has permission for the membership's client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM client_memberships cm
+	                                  INNER JOIN user_clients uc ON uc.client_id = cm.client_id
+	                                  WHERE cm.id = $1 AND cm.client_id = $2 AND uc.user_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, clientMembershipID, clientID, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client membership not found or access denied", http.StatusForbidden)
+		return
+	}
+	if req.GymID > 0 {
+		permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, req.GymID).Scan(&exists)
+		if err != nil || !exists {
+			sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT set_client_membership_auto_renew($1, $2, $3, $4)", clientMembershipID,
+		*req.AutoRenew, nullIfZero(req.GymID), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	clientMembership, err := app.loadClientMembership(clientMembershipID)
+	if err != nil {
+		sendSuccessResponse(w, "Automatic renewal updated successfully", map[string]interface{}{
+			"status":               "OK",
+			"client_membership_id": clientMembershipID,
+			"auto_renew":           *req.AutoRenew,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Automatic renewal updated successfully", clientMembership)
+}
+
+// loadClientMembership reads a client membership; the caller checks access to its client
+func (app *App) loadClientMembership(clientMembershipID int) (*ClientMembership, error) {
+	var clientMembership ClientMembership
+	query := `SELECT id, client_id, membership_id,
+	                 TO_CHAR(starting_from, 'YYYY-MM-DD'), TO_CHAR(ending_on, 'YYYY-MM-DD'),
+	                 status, created_by, updated_by,
+	                 TO_CHAR(created_on, 'YYYY-MM-DD HH24:MI:SS'), TO_CHAR(updated_on, 'YYYY-MM-DD HH24:MI:SS'),
+	                 remaining_entries, COALESCE(auto_renew, false), renewal_gym_id, renewed_from_id,
+	                 COALESCE(dunning_status, ''), COALESCE(TO_CHAR(canceleted_on, 'YYYY-MM-DD'), '')
+	          FROM client_memberships
+	          WHERE id = $1`
+	err := app.DB.QueryRow(query, clientMembershipID).Scan(&clientMembership.ID, &clientMembership.ClientID,
+		&clientMembership.MembershipID, &clientMembership.StartingFrom, &clientMembership.EndingOn,
+		&clientMembership.Status, &clientMembership.CreatedBy, &clientMembership.UpdatedBy,
+		&clientMembership.CreatedOn, &clientMembership.UpdatedOn, &clientMembership.RemainingEntries,
+		&clientMembership.AutoRenew, &clientMembership.RenewalGymID, &clientMembership.RenewedFromID,
+		&clientMembership.DunningStatus, &clientMembership.CanceledOn)
+	if err != nil {
+		return nil, err
+	}
+	return &clientMembership, nil
+}
+
+// runBillingJobs renews auto-renew memberships ending soon and moves unpaid renewals
+// through dunning, notifying the clients affected
+func (app *App) runBillingJobs() {
+	renewals, err := app.renewMemberships(app.Config.RenewalLeadDays)
+	if err != nil {
+		log.Printf("billing job: failed to renew memberships: %v", err)
+	} else if len(renewals) > 0 {
+		log.Printf("billing job: %d membership(s) renewed", len(renewals))
+	}
+	for _, renewal := range renewals {
+		app.notifyBilling(renewal.ClientID, "membership_renewed", renewal)
+	}
+
+	overdue, err := app.markOverdueRenewals(app.Config.RenewalGraceDays)
+	if err != nil {
+		log.Printf("billing job: failed to mark overdue renewals: %v", err)
+	}
+	for _, notice := range overdue {
+		app.notifyBilling(notice.ClientID, "membership_renewal_overdue", notice)
+	}
+
+	suspended, err := app.suspendUnpaidRenewals(app.Config.RenewalGraceDays)
+	if err != nil {
+		log.Printf("billing job: failed to suspend unpaid renewals: %v", err)
+	} else if len(suspended) > 0 {
+		log.Printf("billing job: %d unpaid renewal(s) suspended", len(suspended))
+	}
+	for _, notice := range suspended {
+		app.notifyBilling(notice.ClientID, "membership_suspended", notice)
+	}
+}
+
+// renewMemberships sells and invoices the next period of every auto-renew membership
+// ending within the given number of days. Each renewal runs in its own transaction,
+// so one that is refused (e.g. an overlapping membership) does not hold back the others.
+func (app *App) renewMemberships(days int) ([]MembershipRenewal, error) {
+	if days <= 0 {
+		return nil, nil
+	}
+
+	// Renewals are recorded as made by the user who sold the membership
+	rows, err := app.DB.Query(`SELECT cm.id, cm.created_by
+	                           FROM client_memberships cm
+	                           WHERE cm.auto_renew = true
+	                             AND cm.status = 'active'
+	                             AND cm.ending_on BETWEEN CURRENT_DATE AND CURRENT_DATE + $1::integer
+	                             AND COALESCE(cm.dunning_status, '') NOT IN ('overdue', 'suspended')
+	                             AND NOT EXISTS (SELECT 1 FROM client_memberships n WHERE n.renewed_from_id = cm.id)
+	                           ORDER BY cm.ending_on, cm.id`, days)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		id     int
+		userID sql.NullInt64
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.id, &c.userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var renewals []MembershipRenewal
+	for _, c := range candidates {
+		result, err := app.renewClientMembership(c.id, c.userID)
+		if err != nil {
+			return renewals, err
+		}
+		if result != "OK" {
+			log.Printf("billing job: client membership %d not renewed: %s", c.id, result)
+			continue
+		}
+
+		renewal, err := app.loadMembershipRenewal(c.id)
+		if err != nil {
+			log.Printf("billing job: client membership %d renewed, failed to load the renewal: %v", c.id, err)
+			continue
+		}
+		renewals = append(renewals, *renewal)
+	}
+
+	return renewals, nil
+}
+
+// renewClientMembership runs renew_client_membership in a transaction, rolling back refused renewals
+func (app *App) renewClientMembership(clientMembershipID int, userID sql.NullInt64) (string, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	var result string
+	err = tx.QueryRow("SELECT renew_client_membership($1, $2)", clientMembershipID, userID).Scan(&result)
+	if err != nil || result != "OK" {
+		tx.Rollback()
+		return result, err
+	}
+
+	return result, tx.Commit()
+}
+
+// loadMembershipRenewal returns the period renewed from a client membership, with its invoice
+func (app *App) loadMembershipRenewal(renewedFromID int) (*MembershipRenewal, error) {
+	var renewal MembershipRenewal
+	query := `SELECT cm.id, cm.renewed_from_id, cm.client_id, COALESCE(c.name, ''), COALESCE(m.name, ''),
+	                 TO_CHAR(cm.starting_from, 'YYYY-MM-DD'), TO_CHAR(cm.ending_on, 'YYYY-MM-DD'),
+	                 COALESCE(i.series_code || '-' || LPAD(i.number::text, 6, '0'), ''),
+	                 COALESCE(TO_CHAR(i.total_amount, 'FM999999990.00'), ''), COALESCE(i.currency, ''),
+	                 COALESCE(TO_CHAR(i.due_date, 'YYYY-MM-DD'), '')
+	          FROM client_memberships cm
+	          LEFT JOIN clients c ON c.id = cm.client_id
+	          LEFT JOIN memberships m ON m.id = cm.membership_id
+	          LEFT JOIN invoice_lines il ON il.client_membership_id = cm.id
+	          LEFT JOIN invoices i ON i.id = il.invoice_id AND i.status <> 'cancelled'
+	          WHERE cm.renewed_from_id = $1
+	          ORDER BY i.id DESC NULLS LAST
+	          LIMIT 1`
+	err := app.DB.QueryRow(query, renewedFromID).Scan(&renewal.ClientMembershipID, &renewal.RenewedFromID,
+		&renewal.ClientID, &renewal.ClientName, &renewal.MembershipName, &renewal.StartingFrom,
+		&renewal.EndingOn, &renewal.InvoiceNo, &renewal.Amount, &renewal.Currency, &renewal.DueDate)
+	if err != nil {
+		return nil, err
+	}
+	return &renewal, nil
+}
+
+// dunningNoticeQuery selects the notices of the renewals moved by the "moved" CTE
+// it is appended to; $1 is the grace period in days
+const dunningNoticeQuery = `
+	          SELECT mv.id, mv.client_id, COALESCE(c.name, ''), COALESCE(m.name, ''),
+	                 i.series_code || '-' || LPAD(i.number::text, 6, '0'),
+	                 TO_CHAR(i.total_amount - i.paid_amount, 'FM999999990.00'), i.currency,
+	                 TO_CHAR(i.due_date, 'YYYY-MM-DD'), TO_CHAR(i.due_date + $1::integer + 1, 'YYYY-MM-DD')
+	          FROM moved mv
+	          INNER JOIN invoices i ON i.id = mv.invoice_id
+	          LEFT JOIN clients c ON c.id = mv.client_id
+	          LEFT JOIN memberships m ON m.id = mv.membership_id`
+
+// markOverdueRenewals moves renewals whose invoice is past its due date to 'overdue'
+func (app *App) markOverdueRenewals(graceDays int) ([]DunningNotice, error) {
+	query := `WITH moved AS (
+	              UPDATE client_memberships cm
+	              SET dunning_status = 'overdue',
+	                  updated_on = now()
+	              FROM invoice_lines il
+	              INNER JOIN invoices i ON i.id = il.invoice_id
+	              WHERE il.client_membership_id = cm.id
+	                AND cm.dunning_status = 'unpaid'
+	                AND i.status IN ('unpaid', 'partially_paid')
+	                AND i.due_date < CURRENT_DATE
+	              RETURNING cm.id, cm.client_id, cm.membership_id, i.id AS invoice_id
+	          )` + dunningNoticeQuery
+
+	return app.queryDunningNotices(query, graceDays)
+}
+
+// suspendUnpaidRenewals suspends access on overdue renewals still unpaid after the grace period
+func (app *App) suspendUnpaidRenewals(graceDays int) ([]DunningNotice, error) {
+	query := `WITH moved AS (
+	              UPDATE client_memberships cm
+	              SET dunning_status = 'suspended',
+	                  updated_on = now()
+	              FROM invoice_lines il
+	              INNER JOIN invoices i ON i.id = il.invoice_id
+	              WHERE il.client_membership_id = cm.id
+	                AND cm.dunning_status = 'overdue'
+	                AND i.status IN ('unpaid', 'partially_paid')
+	                AND i.due_date + $1::integer < CURRENT_DATE
+	              RETURNING cm.id, cm.client_id, cm.membership_id, i.id AS invoice_id
+	          )` + dunningNoticeQuery
+
+	return app.queryDunningNotices(query, graceDays)
+}
+
+func (app *App) queryDunningNotices(query string, graceDays int) ([]DunningNotice, error) {
+	if graceDays < 0 {
+		graceDays = 0
+	}
+
+	rows, err := app.DB.Query(query, graceDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notices []DunningNotice
+	for rows.Next() {
+		var notice DunningNotice
+		err := rows.Scan(&notice.ClientMembershipID, &notice.ClientID, &notice.ClientName, &notice.MembershipName,
+			&notice.InvoiceNo, &notice.Balance, &notice.Currency, &notice.DueDate, &notice.SuspendOn)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, notice)
+	}
+
+	return notices, rows.Err()
+}
+
+func (app *App) notifyBilling(clientID int, templateName string, data interface{}) {
+	err := app.Notifier.NotifyClient(clientID, templateName, data)
+	if err == errNoContactChannel {
+		log.Printf("billing job: client %d has no reachable contact channel, %s skipped", clientID, templateName)
+		return
+	}
+	if err != nil {
+		log.Printf("billing job: failed to queue %s for client %d: %v", templateName, clientID, err)
+	}
+}
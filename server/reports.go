@@ -0,0 +1,1167 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type ExpiringMembership struct {
+	ClientMembershipID int    `json:"client_membership_id"`
+	ClientID           int    `json:"client_id"`
+	ClientName         string `json:"client_name"`
+	MembershipID       int    `json:"membership_id"`
+	MembershipName     string `json:"membership_name"`
+	StartingFrom       string `json:"starting_from"`
+	EndingOn           string `json:"ending_on"`
+	DaysLeft           int    `json:"days_left"`
+}
+
+// Front desk report: active memberships ending in the next N days
+func (app *App) getExpiringMemberships(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	days := app.Config.ReminderDays
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 0 || days > 365 {
+			sendErrorResponse(w, "Invalid days parameter (0-365)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional gym filter: only memberships that grant access to this gym
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reportQuery := `SELECT cm.id, cm.client_id, c.name, cm.membership_id, m.name,
+                           TO_CHAR(cm.starting_from, 'YYYY-MM-DD') as starting_from,
+                           TO_CHAR(cm.ending_on, 'YYYY-MM-DD') as ending_on,
+                           cm.ending_on - CURRENT_DATE as days_left
+                    FROM client_memberships cm
+                    INNER JOIN clients c ON c.id = cm.client_id
+                    INNER JOIN memberships m ON m.id = cm.membership_id
+                    INNER JOIN user_clients uc ON uc.client_id = c.id
+                    WHERE uc.user_id = $1
+                      AND cm.status = 'active'
+                      AND cm.ending_on BETWEEN CURRENT_DATE AND CURRENT_DATE + $2::integer
+                      AND ($3 = 0 OR EXISTS (SELECT 1 FROM membership_gyms mg
+                                             WHERE mg.membership_id = cm.membership_id
+                                               AND mg.gym_id = $3))
+                    ORDER BY cm.ending_on, c.name`
+
+	rows, err := app.DB.Query(reportQuery, claims.UserID, days, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch expiring memberships: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var memberships []ExpiringMembership
+	for rows.Next() {
+		var membership ExpiringMembership
+		err := rows.Scan(&membership.ClientMembershipID, &membership.ClientID, &membership.ClientName,
+			&membership.MembershipID, &membership.MembershipName, &membership.StartingFrom,
+			&membership.EndingOn, &membership.DaysLeft)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan membership: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		memberships = append(memberships, membership)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no memberships found, return empty array instead of null
+	if memberships == nil {
+		memberships = []ExpiringMembership{}
+	}
+
+	sendSuccessResponse(w, "Expiring memberships retrieved successfully", memberships)
+}
+
+type MinorWithoutConsent struct {
+	ClientID         int    `json:"client_id"`
+	ClientName       string `json:"client_name"`
+	DOB              string `json:"dob"`
+	Age              int    `json:"age"`
+	GuardianClientID int    `json:"guardian_client_id,omitempty"`
+	GuardianName     string `json:"guardian_name,omitempty"`
+	Missing          string `json:"missing"` // "guardian" or "consent"
+}
+
+// Front desk report: minors without a linked guardian or an active guardian consent.
+// With gym_id, lists clients holding a membership for that gym and uses its consent age.
+func (app *App) getMinorsWithoutConsent(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reportQuery := `SELECT c.id, c.name, TO_CHAR(c.dob, 'YYYY-MM-DD'),
+                           DATE_PART('year', AGE(CURRENT_DATE, c.dob))::integer as age,
+                           COALESCE(c.guardian_client_id, 0), COALESCE(g.name, ''),
+                           CASE WHEN c.guardian_client_id IS NULL THEN 'guardian' ELSE 'consent' END as missing
+                    FROM clients c
+                    INNER JOIN user_clients uc ON uc.client_id = c.id
+                    LEFT JOIN clients g ON g.id = c.guardian_client_id
+                    WHERE uc.user_id = $1
+                      AND COALESCE(c.client_type, 'person') = 'person'
+                      AND c.dob IS NOT NULL
+                      AND DATE_PART('year', AGE(CURRENT_DATE, c.dob)) <
+                          COALESCE((SELECT consent_age FROM gyms WHERE id = $2), 18)
+                      AND ($2 = 0 OR EXISTS (SELECT 1 FROM client_memberships cm
+                                             INNER JOIN membership_gyms mg ON mg.membership_id = cm.membership_id
+                                             WHERE cm.client_id = c.id
+                                               AND cm.status = 'active'
+                                               AND cm.ending_on >= CURRENT_DATE
+                                               AND mg.gym_id = $2))
+                      AND NOT EXISTS (SELECT 1 FROM client_guardian_consents gc
+                                      WHERE gc.client_id = c.id
+                                        AND gc.guardian_client_id = c.guardian_client_id
+                                        AND gc.revoked_on IS NULL)
+                    ORDER BY c.dob DESC, c.name`
+
+	rows, err := app.DB.Query(reportQuery, claims.UserID, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch minors without consent: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var minors []MinorWithoutConsent
+	for rows.Next() {
+		var minor MinorWithoutConsent
+		err := rows.Scan(&minor.ClientID, &minor.ClientName, &minor.DOB, &minor.Age,
+			&minor.GuardianClientID, &minor.GuardianName, &minor.Missing)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan client: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		minors = append(minors, minor)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no clients found, return empty array instead of null
+	if minors == nil {
+		minors = []MinorWithoutConsent{}
+	}
+
+	sendSuccessResponse(w, "Minors without guardian consent retrieved successfully", minors)
+}
+
+type CorporateEmployeeUsage struct {
+	ClientID   int    `json:"client_id"`
+	ClientName string `json:"client_name"`
+	EmployeeNo string `json:"employee_no"`
+	Sponsored  bool   `json:"sponsored"`
+	Visits     int    `json:"visits"`
+	VisitDays  int    `json:"visit_days"`
+	LastVisit  string `json:"last_visit,omitempty"`
+}
+
+type CorporateUsageReport struct {
+	AccountID   int                      `json:"account_id"`
+	CompanyName string                   `json:"company_name"`
+	Month       string                   `json:"month"`
+	Employees   []CorporateEmployeeUsage `json:"employees"`
+	TotalVisits int                      `json:"total_visits"`
+	ActiveUsers int                      `json:"active_users"`
+}
+
+// Monthly gym usage of corporate employees, one entry per company.
+// Query params: month (YYYY-MM, defaults to the current month), optional account_id.
+func (app *App) getCorporateUsage(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	month := time.Now().Format("2006-01")
+	if monthStr := r.URL.Query().Get("month"); monthStr != "" {
+		month = monthStr
+	}
+	monthStart, err := time.Parse("2006-01", month)
+	if err != nil {
+		sendErrorResponse(w, "Invalid month parameter (YYYY-MM)", http.StatusBadRequest)
+		return
+	}
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	accountID := 0
+	if accountIDStr := r.URL.Query().Get("account_id"); accountIDStr != "" {
+		accountID, err = strconv.Atoi(accountIDStr)
+		if err != nil || accountID <= 0 {
+			sendErrorResponse(w, "Invalid account_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Employees who were with the company at any point in the month, with their
+	// check-ins while employed
+	reportQuery := `SELECT ca.id, co.name, ce.client_id, c.name, COALESCE(ce.employee_no, ''),
+                           EXISTS (SELECT 1 FROM client_memberships cm
+                                   INNER JOIN corporate_allocations al ON al.id = cm.corporate_allocation_id
+                                   WHERE cm.client_id = ce.client_id
+                                     AND al.corporate_account_id = ca.id
+                                     AND cm.starting_from < $3::date
+                                     AND cm.ending_on >= $2::date) as sponsored,
+                           COUNT(cp.id) as visits,
+                           COUNT(DISTINCT cp.created_on) as visit_days,
+                           COALESCE(TO_CHAR(MAX(cp.created_on), 'YYYY-MM-DD'), '') as last_visit
+                    FROM corporate_accounts ca
+                    INNER JOIN clients co ON co.id = ca.company_client_id
+                    INNER JOIN user_clients uc ON uc.client_id = ca.company_client_id
+                    INNER JOIN corporate_employees ce ON ce.corporate_account_id = ca.id
+                                                     AND ce.joined_on < $3::date
+                                                     AND (ce.left_on IS NULL OR ce.left_on >= $2::date)
+                    INNER JOIN clients c ON c.id = ce.client_id
+                    LEFT JOIN client_passes cp ON cp.client_id = ce.client_id
+                                              AND cp.action = 'in'
+                                              AND cp.created_on >= GREATEST($2::date, ce.joined_on)
+                                              AND cp.created_on < $3::date
+                                              AND (ce.left_on IS NULL OR cp.created_on <= ce.left_on)
+                    WHERE uc.user_id = $1
+                      AND ($4 = 0 OR ca.id = $4)
+                    GROUP BY ca.id, co.name, ce.id, ce.client_id, c.name, ce.employee_no
+                    ORDER BY co.name, ca.id, c.name`
+
+	rows, err := app.DB.Query(reportQuery, claims.UserID, monthStart.Format("2006-01-02"),
+		monthEnd.Format("2006-01-02"), accountID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch corporate usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	reports := []CorporateUsageReport{}
+	for rows.Next() {
+		var rowAccountID int
+		var companyName string
+		var usage CorporateEmployeeUsage
+		err := rows.Scan(&rowAccountID, &companyName, &usage.ClientID, &usage.ClientName, &usage.EmployeeNo,
+			&usage.Sponsored, &usage.Visits, &usage.VisitDays, &usage.LastVisit)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan usage: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Rows are ordered by account, so a new account starts a new report
+		if len(reports) == 0 || reports[len(reports)-1].AccountID != rowAccountID {
+			reports = append(reports, CorporateUsageReport{
+				AccountID:   rowAccountID,
+				CompanyName: companyName,
+				Month:       month,
+				Employees:   []CorporateEmployeeUsage{},
+			})
+		}
+		report := &reports[len(reports)-1]
+		report.Employees = append(report.Employees, usage)
+		report.TotalVisits += usage.Visits
+		if usage.Visits > 0 {
+			report.ActiveUsers++
+		}
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Corporate usage retrieved successfully", reports)
+}
+
+type GuestVisit struct {
+	PassID         int    `json:"pass_id"`
+	VisitDate      string `json:"visit_date"`
+	GuestClientID  int    `json:"guest_client_id"`
+	GuestName      string `json:"guest_name"`
+	HostClientID   int    `json:"host_client_id"`
+	HostName       string `json:"host_name"`
+	MembershipName string `json:"membership_name"`
+}
+
+// Guests brought in by members at a gym, with the host each visit is attributed to.
+// Query params: gym_id, month (YYYY-MM, defaults to the current month).
+func (app *App) getGuestVisits(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gymID, err := strconv.Atoi(r.URL.Query().Get("gym_id"))
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	month := time.Now().Format("2006-01")
+	if monthStr := r.URL.Query().Get("month"); monthStr != "" {
+		month = monthStr
+	}
+	monthStart, err := time.Parse("2006-01", month)
+	if err != nil {
+		sendErrorResponse(w, "Invalid month parameter (YYYY-MM)", http.StatusBadRequest)
+		return
+	}
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	reportQuery := `SELECT cp.id, TO_CHAR(cp.created_on, 'YYYY-MM-DD'),
+                           cp.client_id, g.name, cp.host_client_id, h.name, COALESCE(m.name, '')
+                    FROM client_passes cp
+                    INNER JOIN clients g ON g.id = cp.client_id
+                    INNER JOIN clients h ON h.id = cp.host_client_id
+                    LEFT JOIN client_memberships cm ON cm.id = cp.client_membership_id
+                    LEFT JOIN memberships m ON m.id = cm.membership_id
+                    WHERE cp.gym_id = $1
+                      AND cp.action = 'in'
+                      AND cp.host_client_id IS NOT NULL
+                      AND cp.created_on >= $2::date
+                      AND cp.created_on < $3::date
+                    ORDER BY cp.created_on, h.name, cp.id`
+
+	rows, err := app.DB.Query(reportQuery, gymID, monthStart.Format("2006-01-02"), monthEnd.Format("2006-01-02"))
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch guest visits: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var visits []GuestVisit
+	for rows.Next() {
+		var visit GuestVisit
+		err := rows.Scan(&visit.PassID, &visit.VisitDate, &visit.GuestClientID, &visit.GuestName,
+			&visit.HostClientID, &visit.HostName, &visit.MembershipName)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan guest visit: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		visits = append(visits, visit)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no visits found, return empty array instead of null
+	if visits == nil {
+		visits = []GuestVisit{}
+	}
+
+	sendSuccessResponse(w, "Guest visits retrieved successfully", visits)
+}
+
+type UnpaidInvoice struct {
+	Invoice
+	DaysOverdue int `json:"days_overdue"`
+}
+
+// Invoices with an outstanding balance, most overdue first.
+// Query params: optional gym_id, client_id, overdue_only=true.
+func (app *App) getUnpaidInvoices(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	clientID := 0
+	if clientIDStr := r.URL.Query().Get("client_id"); clientIDStr != "" {
+		clientID, err = strconv.Atoi(clientIDStr)
+		if err != nil || clientID <= 0 {
+			sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	overdueOnly := r.URL.Query().Get("overdue_only") == "true"
+
+	reportQuery := `SELECT i.id, i.series_code || '-' || LPAD(i.number::text, 6, '0'), i.series_code, i.number,
+                           i.client_id, c.name, i.gym_id,
+                           TO_CHAR(i.issue_date, 'YYYY-MM-DD'), COALESCE(TO_CHAR(i.due_date, 'YYYY-MM-DD'), ''),
+                           i.currency, i.net_amount, i.vat_amount, i.total_amount, i.paid_amount,
+                           i.total_amount - i.paid_amount, i.status,
+                           GREATEST(CURRENT_DATE - COALESCE(i.due_date, i.issue_date), 0) as days_overdue
+                    FROM invoices i
+                    INNER JOIN clients c ON c.id = i.client_id
+                    INNER JOIN user_clients uc ON uc.client_id = i.client_id
+                    WHERE uc.user_id = $1
+                      AND i.status IN ('unpaid', 'partially_paid')
+                      AND i.total_amount > i.paid_amount
+                      AND ($2 = 0 OR i.gym_id = $2)
+                      AND ($3 = 0 OR i.client_id = $3)
+                      AND (NOT $4 OR COALESCE(i.due_date, i.issue_date) < CURRENT_DATE)
+                    ORDER BY days_overdue DESC, i.issue_date, i.id`
+
+	rows, err := app.DB.Query(reportQuery, claims.UserID, gymID, clientID, overdueOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch unpaid invoices: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var invoices []UnpaidInvoice
+	totals := map[string]float64{}
+	for rows.Next() {
+		var invoice UnpaidInvoice
+		err := rows.Scan(&invoice.ID, &invoice.InvoiceNo, &invoice.SeriesCode, &invoice.Number,
+			&invoice.ClientID, &invoice.ClientName, &invoice.GymID, &invoice.IssueDate, &invoice.DueDate,
+			&invoice.Currency, &invoice.NetAmount, &invoice.VATAmount, &invoice.TotalAmount, &invoice.PaidAmount,
+			&invoice.Balance, &invoice.Status, &invoice.DaysOverdue)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan invoice: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		invoices = append(invoices, invoice)
+		totals[invoice.Currency] += invoice.Balance
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no invoices found, return empty array instead of null
+	if invoices == nil {
+		invoices = []UnpaidInvoice{}
+	}
+	for currency, total := range totals {
+		totals[currency] = math.Round(total*100) / 100
+	}
+
+	sendSuccessResponse(w, "Unpaid invoices retrieved successfully", map[string]interface{}{
+		"invoices":        invoices,
+		"total_balance":   totals,
+		"invoices_number": len(invoices),
+	})
+}
+
+type RenewalDunning struct {
+	ClientMembershipID int     `json:"client_membership_id"`
+	ClientID           int     `json:"client_id"`
+	ClientName         string  `json:"client_name"`
+	MembershipName     string  `json:"membership_name"`
+	StartingFrom       string  `json:"starting_from"`
+	EndingOn           string  `json:"ending_on"`
+	DunningStatus      string  `json:"dunning_status"`
+	InvoiceID          int     `json:"invoice_id"`
+	InvoiceNo          string  `json:"invoice_no"`
+	Balance            float64 `json:"balance"`
+	Currency           string  `json:"currency"`
+	DueDate            string  `json:"due_date"`
+	DaysOverdue        int     `json:"days_overdue"`
+	SuspendOn          string  `json:"suspend_on"`
+}
+
+// Automatic renewals with an unpaid invoice, most overdue first.
+// Query params: optional gym_id, status (unpaid, overdue or suspended).
+func (app *App) getRenewalDunning(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", dunningUnpaid, dunningOverdue, dunningSuspended:
+	default:
+		sendErrorResponse(w, "Invalid status parameter (unpaid, overdue or suspended)", http.StatusBadRequest)
+		return
+	}
+
+	reportQuery := `SELECT cm.id, cm.client_id, c.name, m.name,
+                           TO_CHAR(cm.starting_from, 'YYYY-MM-DD'), TO_CHAR(cm.ending_on, 'YYYY-MM-DD'),
+                           cm.dunning_status, i.id, i.series_code || '-' || LPAD(i.number::text, 6, '0'),
+                           i.total_amount - i.paid_amount, i.currency, TO_CHAR(i.due_date, 'YYYY-MM-DD'),
+                           GREATEST(CURRENT_DATE - i.due_date, 0) as days_overdue,
+                           TO_CHAR(i.due_date + $4::integer + 1, 'YYYY-MM-DD')
+                    FROM client_memberships cm
+                    INNER JOIN clients c ON c.id = cm.client_id
+                    INNER JOIN memberships m ON m.id = cm.membership_id
+                    INNER JOIN user_clients uc ON uc.client_id = c.id
+                    INNER JOIN invoice_lines il ON il.client_membership_id = cm.id
+                    INNER JOIN invoices i ON i.id = il.invoice_id
+                    WHERE uc.user_id = $1
+                      AND cm.dunning_status IN ('unpaid', 'overdue', 'suspended')
+                      AND ($3 = '' OR cm.dunning_status = $3)
+                      AND i.status IN ('unpaid', 'partially_paid')
+                      AND ($2 = 0 OR EXISTS (SELECT 1 FROM membership_gyms mg
+                                             WHERE mg.membership_id = cm.membership_id
+                                               AND mg.gym_id = $2))
+                    ORDER BY days_overdue DESC, i.due_date, cm.id`
+
+	graceDays := max(app.Config.RenewalGraceDays, 0)
+	rows, err := app.DB.Query(reportQuery, claims.UserID, gymID, status, graceDays)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch renewal dunning: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var renewals []RenewalDunning
+	for rows.Next() {
+		var renewal RenewalDunning
+		err := rows.Scan(&renewal.ClientMembershipID, &renewal.ClientID, &renewal.ClientName,
+			&renewal.MembershipName, &renewal.StartingFrom, &renewal.EndingOn, &renewal.DunningStatus,
+			&renewal.InvoiceID, &renewal.InvoiceNo, &renewal.Balance, &renewal.Currency, &renewal.DueDate,
+			&renewal.DaysOverdue, &renewal.SuspendOn)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan renewal: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		renewals = append(renewals, renewal)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no renewals found, return empty array instead of null
+	if renewals == nil {
+		renewals = []RenewalDunning{}
+	}
+
+	sendSuccessResponse(w, "Renewal dunning retrieved successfully", renewals)
+}
+
+type PromoCodeEffectiveness struct {
+	PromoCodeID     int     `json:"promo_code_id"`
+	Code            string  `json:"code"`
+	DiscountType    string  `json:"discount_type"`
+	DiscountValue   float64 `json:"discount_value"`
+	IsActive        bool    `json:"is_active"`
+	Currency        string  `json:"currency,omitempty"`
+	Redemptions     int     `json:"redemptions"`
+	UniqueClients   int     `json:"unique_clients"`
+	NewClients      int     `json:"new_clients"`
+	ReturningBuyers int     `json:"returning_buyers"`
+	GrossAmount     float64 `json:"gross_amount"`
+	DiscountAmount  float64 `json:"discount_amount"`
+	NetRevenue      float64 `json:"net_revenue"`
+	PaidAmount      float64 `json:"paid_amount"`
+	UsesRemaining   *int    `json:"uses_remaining,omitempty"`
+}
+
+// Promo code usage and revenue over a period, one entry per code and invoice currency.
+// new_clients counts redemptions on a client's first membership, returning_buyers counts
+// clients who bought another membership after the discounted one.
+// Query params: from, to (YYYY-MM-DD, default to the current month), optional gym_id.
+func (app *App) getPromoCodeReport(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, -1)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	reportQuery := `SELECT p.id, p.code, p.discount_type, p.discount_value, p.is_active,
+                           COALESCE(x.currency, ''),
+                           COUNT(x.id),
+                           COUNT(DISTINCT x.client_id),
+                           COUNT(x.id) FILTER (WHERE NOT EXISTS (SELECT 1 FROM client_memberships o
+                                                                 WHERE o.client_id = x.client_id
+                                                                   AND o.id < x.client_membership_id)),
+                           COUNT(DISTINCT x.client_id) FILTER (WHERE EXISTS (SELECT 1 FROM client_memberships o
+                                                                             WHERE o.client_id = x.client_id
+                                                                               AND o.id > x.client_membership_id)),
+                           COALESCE(SUM(x.price), 0), COALESCE(SUM(x.discount_amount), 0),
+                           COALESCE(SUM(x.price - x.discount_amount), 0), COALESCE(SUM(x.paid_amount), 0),
+                           CASE WHEN p.max_uses IS NULL THEN NULL ELSE GREATEST(p.max_uses - p.uses_count, 0) END
+                    FROM promo_codes p
+                    LEFT JOIN (SELECT pr.id, pr.promo_code_id, pr.client_id, pr.client_membership_id,
+                                      pr.price, pr.discount_amount, i.currency, i.paid_amount
+                               FROM promo_redemptions pr
+                               INNER JOIN invoices i ON i.id = pr.invoice_id
+                               WHERE pr.redeemed_on BETWEEN $2 AND $3
+                                 AND i.status <> 'cancelled'
+                                 AND ($4 = 0 OR i.gym_id = $4)) x ON x.promo_code_id = p.id
+                    WHERE (p.gym_id IS NULL
+                           OR EXISTS (SELECT 1 FROM user_gyms ug WHERE ug.gym_id = p.gym_id AND ug.user_id = $1))
+                      AND ($4 = 0 OR p.gym_id IS NULL OR p.gym_id = $4)
+                    GROUP BY p.id, p.code, p.discount_type, p.discount_value, p.is_active, p.max_uses,
+                             p.uses_count, x.currency
+                    ORDER BY COUNT(x.id) DESC, p.code`
+
+	rows, err := app.DB.Query(reportQuery, claims.UserID, from.Format("2006-01-02"), to.Format("2006-01-02"), gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch promo code report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var promos []PromoCodeEffectiveness
+	redemptions := 0
+	for rows.Next() {
+		var promo PromoCodeEffectiveness
+		err := rows.Scan(&promo.PromoCodeID, &promo.Code, &promo.DiscountType, &promo.DiscountValue,
+			&promo.IsActive, &promo.Currency, &promo.Redemptions, &promo.UniqueClients, &promo.NewClients,
+			&promo.ReturningBuyers, &promo.GrossAmount, &promo.DiscountAmount, &promo.NetRevenue,
+			&promo.PaidAmount, &promo.UsesRemaining)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan promo code: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		redemptions += promo.Redemptions
+		promos = append(promos, promo)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no promo codes found, return empty array instead of null
+	if promos == nil {
+		promos = []PromoCodeEffectiveness{}
+	}
+
+	sendSuccessResponse(w, "Promo code report retrieved successfully", map[string]interface{}{
+		"from":        from.Format("2006-01-02"),
+		"to":          to.Format("2006-01-02"),
+		"promo_codes": promos,
+		"redemptions": redemptions,
+	})
+}
+
+// DailySales totals the front desk sales of a day at a gym, for the whole gym or
+// for one user (the cash the user should hand over is CashAmount)
+type DailySales struct {
+	Day         string  `json:"day"`
+	GymID       int     `json:"gym_id"`
+	GymName     string  `json:"gym_name"`
+	UserID      *int    `json:"user_id,omitempty"`
+	UserName    string  `json:"user_name,omitempty"`
+	Currency    string  `json:"currency"`
+	Sales       int     `json:"sales"`
+	Items       int     `json:"items"`
+	NetAmount   float64 `json:"net_amount"`
+	VATAmount   float64 `json:"vat_amount"`
+	TotalAmount float64 `json:"total_amount"`
+	CashAmount  float64 `json:"cash_amount"`
+	CardAmount  float64 `json:"card_amount"`
+}
+
+// Point-of-sale report: daily sales and cash per gym and per user over a period
+// (default today), for the gyms the user works at
+func (app *App) getDailySalesReport(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	from := time.Now()
+	to := from
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		to = from
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// One row per day, gym and currency, and one per day, gym, user and currency
+	reportQuery := `SELECT TO_CHAR(s.sold_on::date, 'YYYY-MM-DD'), s.gym_id, g.name,
+                           GROUPING(s.created_by) = 1, s.created_by, COALESCE(u.full_name, ''), s.currency,
+                           COUNT(*), COALESCE(SUM(li.items), 0),
+                           SUM(s.net_amount), SUM(s.vat_amount), SUM(s.total_amount),
+                           COALESCE(SUM(s.total_amount) FILTER (WHERE s.payment_method = 'cash'), 0),
+                           COALESCE(SUM(s.total_amount) FILTER (WHERE s.payment_method = 'card'), 0)
+                    FROM sales s
+                    INNER JOIN gyms g ON g.id = s.gym_id
+                    INNER JOIN user_gyms ug ON ug.gym_id = s.gym_id AND ug.user_id = $1
+                    LEFT JOIN users u ON u.id = s.created_by
+                    LEFT JOIN (SELECT sale_id, SUM(quantity) AS items
+                               FROM sale_lines
+                               GROUP BY sale_id) li ON li.sale_id = s.id
+                    WHERE s.sold_on::date BETWEEN $2 AND $3
+                      AND ($4 = 0 OR s.gym_id = $4)
+                    GROUP BY GROUPING SETS ((s.sold_on::date, s.gym_id, g.name, s.currency),
+                                            (s.sold_on::date, s.gym_id, g.name, s.currency, s.created_by, u.full_name))
+                    ORDER BY s.sold_on::date, g.name, s.currency, GROUPING(s.created_by) DESC, u.full_name`
+
+	rows, err := app.DB.Query(reportQuery, claims.UserID, from.Format("2006-01-02"), to.Format("2006-01-02"), gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch daily sales: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var gyms, users []DailySales
+	totals := map[string]float64{}
+	for rows.Next() {
+		var day DailySales
+		var gymTotal bool
+		err := rows.Scan(&day.Day, &day.GymID, &day.GymName, &gymTotal, &day.UserID, &day.UserName,
+			&day.Currency, &day.Sales, &day.Items, &day.NetAmount, &day.VATAmount, &day.TotalAmount,
+			&day.CashAmount, &day.CardAmount)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan daily sales: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if gymTotal {
+			day.UserID = nil
+			day.UserName = ""
+			totals[day.Currency] += day.TotalAmount
+			gyms = append(gyms, day)
+		} else {
+			users = append(users, day)
+		}
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no sales found, return empty arrays instead of null
+	if gyms == nil {
+		gyms = []DailySales{}
+	}
+	if users == nil {
+		users = []DailySales{}
+	}
+	for currency, total := range totals {
+		totals[currency] = math.Round(total*100) / 100
+	}
+
+	sendSuccessResponse(w, "Daily sales retrieved successfully", map[string]interface{}{
+		"from":    from.Format("2006-01-02"),
+		"to":      to.Format("2006-01-02"),
+		"by_gym":  gyms,
+		"by_user": users,
+		"totals":  totals,
+	})
+}
+
+// Front desk report: lockers still held after their last day, daily lockers the
+// client left without checking out and rentals past their end date, most overdue first
+func (app *App) getOverdueLockers(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	assignmentType := r.URL.Query().Get("type")
+	if assignmentType != "" && assignmentType != lockerAssignmentDaily && assignmentType != lockerAssignmentRental {
+		sendErrorResponse(w, "Invalid type parameter (daily or rental)", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := app.DB.Query(lockerAssignmentQuery+`
+	                INNER JOIN user_gyms ug ON ug.gym_id = la.gym_id AND ug.user_id = $1
+	                WHERE la.released_on IS NULL
+	                  AND la.valid_until < CURRENT_DATE
+	                  AND ($2 = 0 OR la.gym_id = $2)
+	                  AND ($3 = '' OR la.assignment_type = $3)
+	                ORDER BY la.valid_until, l.code`, claims.UserID, gymID, assignmentType)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch overdue lockers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var assignments []LockerAssignment
+	for rows.Next() {
+		var assignment LockerAssignment
+		if err := scanLockerAssignment(rows, &assignment); err != nil {
+			sendErrorResponse(w, "Failed to scan locker assignment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no lockers found, return empty array instead of null
+	if assignments == nil {
+		assignments = []LockerAssignment{}
+	}
+
+	sendSuccessResponse(w, "Overdue lockers retrieved successfully", assignments)
+}
+
+// TrainerUtilization compares the time a trainer was available at a gym with the
+// time booked in appointments over a period
+type TrainerUtilization struct {
+	TrainerID          int     `json:"trainer_id"`
+	TrainerName        string  `json:"trainer_name"`
+	GymID              int     `json:"gym_id"`
+	GymName            string  `json:"gym_name"`
+	AvailableMinutes   int     `json:"available_minutes"` // weekly slots less time off
+	BookedMinutes      int     `json:"booked_minutes"`
+	Appointments       int     `json:"appointments"` // booked and completed
+	Completed          int     `json:"completed"`
+	Cancelled          int     `json:"cancelled"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+}
+
+// Trainer report: availability against booked appointments per trainer and gym over
+// a period (default the current month), for the gyms the user works at
+func (app *App) getTrainerUtilization(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 1, -1)
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Available time is every weekly slot on the days of the period, less the time off inside it
+	reportQuery := `WITH available AS (
+	                    SELECT a.trainer_id, a.gym_id,
+	                           SUM(EXTRACT(EPOCH FROM a.end_time - a.start_time) / 60
+	                               - COALESCE((SELECT SUM(EXTRACT(EPOCH FROM LEAST(t.ends_at, d.day + a.end_time)
+	                                                                      - GREATEST(t.starts_at, d.day + a.start_time)) / 60)
+	                                           FROM trainer_time_off t
+	                                           WHERE t.trainer_id = a.trainer_id
+	                                             AND t.starts_at < d.day + a.end_time
+	                                             AND t.ends_at > d.day + a.start_time), 0)) AS minutes
+	                    FROM trainer_availability a
+	                    CROSS JOIN LATERAL (SELECT generate_series($2::date, $3::date, interval '1 day')::date AS day) d
+	                    WHERE EXTRACT(ISODOW FROM d.day) = a.weekday
+	                      AND d.day >= a.valid_from
+	                      AND (a.valid_to IS NULL OR d.day <= a.valid_to)
+	                    GROUP BY a.trainer_id, a.gym_id
+	                ), booked AS (
+	                    SELECT trainer_id, gym_id,
+	                           COALESCE(SUM(EXTRACT(EPOCH FROM ends_at - starts_at) / 60)
+	                                        FILTER (WHERE status IN ('booked', 'completed')), 0) AS minutes,
+	                           COUNT(*) FILTER (WHERE status IN ('booked', 'completed')) AS appointments,
+	                           COUNT(*) FILTER (WHERE status = 'completed') AS completed,
+	                           COUNT(*) FILTER (WHERE status = 'cancelled') AS cancelled
+	                    FROM trainer_appointments
+	                    WHERE starts_at::date BETWEEN $2 AND $3
+	                    GROUP BY trainer_id, gym_id
+	                )
+	                SELECT COALESCE(av.trainer_id, b.trainer_id), COALESCE(u.full_name, ''), g.id, g.name,
+	                       COALESCE(av.minutes, 0)::integer, COALESCE(b.minutes, 0)::integer,
+	                       COALESCE(b.appointments, 0), COALESCE(b.completed, 0), COALESCE(b.cancelled, 0)
+	                FROM available av
+	                FULL JOIN booked b ON b.trainer_id = av.trainer_id AND b.gym_id = av.gym_id
+	                INNER JOIN gyms g ON g.id = COALESCE(av.gym_id, b.gym_id)
+	                INNER JOIN user_gyms ug ON ug.gym_id = g.id AND ug.user_id = $1
+	                LEFT JOIN users u ON u.id = COALESCE(av.trainer_id, b.trainer_id)
+	                WHERE ($4 = 0 OR g.id = $4)
+	                ORDER BY g.name, u.full_name`
+
+	rows, err := app.DB.Query(reportQuery, claims.UserID, from.Format("2006-01-02"), to.Format("2006-01-02"), gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch trainer utilization: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var trainers []TrainerUtilization
+	for rows.Next() {
+		var t TrainerUtilization
+		err := rows.Scan(&t.TrainerID, &t.TrainerName, &t.GymID, &t.GymName, &t.AvailableMinutes, &t.BookedMinutes,
+			&t.Appointments, &t.Completed, &t.Cancelled)
+		if err != nil {
+			sendErrorResponse(w, "Failed to scan trainer utilization: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if t.AvailableMinutes > 0 {
+			t.UtilizationPercent = math.Round(float64(t.BookedMinutes)*10000/float64(t.AvailableMinutes)) / 100
+		}
+		trainers = append(trainers, t)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no trainers found, return empty array instead of null
+	if trainers == nil {
+		trainers = []TrainerUtilization{}
+	}
+
+	sendSuccessResponse(w, "Trainer utilization retrieved successfully", map[string]interface{}{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+		"trainers": trainers,
+	})
+}
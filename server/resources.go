@@ -0,0 +1,922 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// Resource is a court, room or piece of equipment clients book by the slot
+type Resource struct {
+	ID           int             `json:"id"`
+	GymID        int             `json:"gym_id"`
+	Name         string          `json:"name"`
+	ResourceType string          `json:"resource_type"` // court, room or equipment
+	Description  string          `json:"description,omitempty"`
+	SlotMinutes  int             `json:"slot_minutes"`
+	MaxSlots     int             `json:"max_slots"`
+	AdvanceDays  int             `json:"advance_days"`
+	CancelHours  int             `json:"cancel_hours"`
+	VATRate      float64         `json:"vat_rate"`
+	Currency     string          `json:"currency"`
+	IsActive     bool            `json:"is_active"`
+	Hours        []ResourceHours `json:"hours"`
+}
+
+// ResourceHours is a weekly opening of a resource and the price of its slots
+type ResourceHours struct {
+	Weekday   int     `json:"weekday"`    // 1 = Monday ... 7 = Sunday
+	OpenTime  string  `json:"open_time"`  // HH:MM, gym local time
+	CloseTime string  `json:"close_time"` // HH:MM
+	SlotPrice float64 `json:"slot_price"` // VAT included
+}
+
+type SaveResourceRequest struct {
+	Name         string          `json:"name"`
+	ResourceType string          `json:"resource_type"`
+	Description  string          `json:"description,omitempty"`
+	SlotMinutes  int             `json:"slot_minutes"`
+	MaxSlots     int             `json:"max_slots"`
+	AdvanceDays  int             `json:"advance_days"`
+	CancelHours  *int            `json:"cancel_hours,omitempty"`
+	VATRate      *float64        `json:"vat_rate,omitempty"`
+	Currency     string          `json:"currency,omitempty"`
+	IsActive     *bool           `json:"is_active,omitempty"`
+	Hours        []ResourceHours `json:"hours"`
+}
+
+// ResourceSlot is one slot of a resource's day
+type ResourceSlot struct {
+	StartsAt string  `json:"starts_at"`
+	EndsAt   string  `json:"ends_at"`
+	Price    float64 `json:"price"`
+	IsFree   bool    `json:"is_free"`
+}
+
+type ResourceBooking struct {
+	ID               int     `json:"id"`
+	ResourceID       int     `json:"resource_id"`
+	ResourceName     string  `json:"resource_name"`
+	GymID            int     `json:"gym_id"`
+	ClientID         int     `json:"client_id"`
+	ClientName       string  `json:"client_name"`
+	StartsAt         string  `json:"starts_at"` // gym local time
+	EndsAt           string  `json:"ends_at"`
+	Slots            int     `json:"slots"`
+	Price            float64 `json:"price"`
+	Currency         string  `json:"currency"`
+	InvoiceID        *int    `json:"invoice_id"`
+	CreditNoteID     *int    `json:"credit_note_id,omitempty"`
+	Status           string  `json:"status"` // booked or cancelled
+	Notes            string  `json:"notes,omitempty"`
+	CancelReason     string  `json:"cancel_reason,omitempty"`
+	CancelledOn      string  `json:"cancelled_on,omitempty"`
+	LateCancellation bool    `json:"late_cancellation"`
+	CreatedOn        string  `json:"created_on"`
+}
+
+type BookResourceRequest struct {
+	ClientID int    `json:"client_id"`
+	StartsAt string `json:"starts_at"`       // YYYY-MM-DD HH:MM, gym local time
+	Slots    int    `json:"slots,omitempty"` // consecutive slots, 1 by default
+	Notes    string `json:"notes,omitempty"`
+}
+
+type CancelResourceBookingRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// ResourceBookingNotice is the data of the resource booking notifications
+type ResourceBookingNotice struct {
+	ClientName   string
+	ResourceName string
+	GymName      string
+	StartsAt     string
+	EndsAt       string
+	Price        string
+	Currency     string
+	Reason       string
+	Late         bool
+}
+
+var validResourceTypes = map[string]bool{"court": true, "room": true, "equipment": true}
+
+const resourceQuery = `SELECT id, gym_id, name, COALESCE(resource_type, 'room'), COALESCE(description, ''),
+                              COALESCE(slot_minutes, 60), COALESCE(max_slots, 1), COALESCE(advance_days, 14),
+                              COALESCE(cancel_hours, 0), COALESCE(vat_rate, 0), COALESCE(currency, 'RON'),
+                              COALESCE(is_active, false)
+                       FROM resources`
+
+const resourceBookingQuery = `SELECT rb.id, rb.resource_id, COALESCE(r.name, ''), rb.gym_id, rb.client_id, COALESCE(c.name, ''),
+                                     TO_CHAR(rb.starts_at, 'YYYY-MM-DD HH24:MI'), TO_CHAR(rb.ends_at, 'YYYY-MM-DD HH24:MI'),
+                                     rb.slots, COALESCE(rb.price, 0), COALESCE(rb.currency, 'RON'), rb.invoice_id,
+                                     rb.credit_note_id, rb.status, COALESCE(rb.notes, ''), COALESCE(rb.cancel_reason, ''),
+                                     COALESCE(TO_CHAR(rb.cancelled_on, 'YYYY-MM-DD HH24:MI:SS'), ''),
+                                     COALESCE(rb.late_cancellation, false), TO_CHAR(rb.created_on, 'YYYY-MM-DD HH24:MI:SS')
+                              FROM resource_bookings rb
+                              LEFT JOIN resources r ON r.id = rb.resource_id
+                              LEFT JOIN clients c ON c.id = rb.client_id`
+
+func scanResource(scanner interface{ Scan(...interface{}) error }, res *Resource) error {
+	return scanner.Scan(&res.ID, &res.GymID, &res.Name, &res.ResourceType, &res.Description, &res.SlotMinutes,
+		&res.MaxSlots, &res.AdvanceDays, &res.CancelHours, &res.VATRate, &res.Currency, &res.IsActive)
+}
+
+func scanResourceBooking(scanner interface{ Scan(...interface{}) error }, b *ResourceBooking) error {
+	return scanner.Scan(&b.ID, &b.ResourceID, &b.ResourceName, &b.GymID, &b.ClientID, &b.ClientName, &b.StartsAt,
+		&b.EndsAt, &b.Slots, &b.Price, &b.Currency, &b.InvoiceID, &b.CreditNoteID, &b.Status, &b.Notes,
+		&b.CancelReason, &b.CancelledOn, &b.LateCancellation, &b.CreatedOn)
+}
+
+// List the bookable resources of a gym with their opening hours
+func (app *App) getGymResources(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+
+	resources, err := app.loadGymResources(gymID, 0, activeOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch resources: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Resources retrieved successfully", resources)
+}
+
+// Add a bookable resource to a gym
+func (app *App) createGymResource(w http.ResponseWriter, r *http.Request) {
+	app.saveGymResource(w, r, 0)
+}
+
+// Update a resource and replace its opening hours; existing bookings are kept
+func (app *App) updateGymResource(w http.ResponseWriter, r *http.Request) {
+	resourceID, err := strconv.Atoi(mux.Vars(r)["resource_id"])
+	if err != nil || resourceID <= 0 {
+		sendErrorResponse(w, "Invalid resource_id parameter", http.StatusBadRequest)
+		return
+	}
+	app.saveGymResource(w, r, resourceID)
+}
+
+// saveGymResource creates a resource, or updates resourceID when it is not 0
+func (app *App) saveGymResource(w http.ResponseWriter, r *http.Request, resourceID int) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req SaveResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateResource(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	if resourceID != 0 {
+		permissionQuery = `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+		                                 INNER JOIN resources r ON r.gym_id = ug.gym_id
+		                                 WHERE ug.user_id = $1 AND ug.gym_id = $2 AND r.id = $3)`
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, resourceID).Scan(&exists)
+	} else {
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	}
+	if err != nil || !exists {
+		sendErrorResponse(w, "Resource not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM resources WHERE gym_id = $1 AND upper(name) = upper($2) AND id <> $3)`,
+		gymID, req.Name, resourceID).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "name", Message: "a resource with this name already exists at this gym"}})
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	message := "Resource updated successfully"
+	if resourceID == 0 {
+		message = "Resource created successfully"
+		err = tx.QueryRow(`INSERT INTO resources (gym_id, name, resource_type, description, slot_minutes, max_slots,
+		                                          advance_days, cancel_hours, vat_rate, currency, is_active, created_by)
+		                   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		                   RETURNING id`,
+			gymID, req.Name, req.ResourceType, nullIfEmpty(req.Description), req.SlotMinutes, req.MaxSlots,
+			req.AdvanceDays, *req.CancelHours, *req.VATRate, req.Currency, *req.IsActive, claims.UserID).Scan(&resourceID)
+	} else {
+		_, err = tx.Exec(`UPDATE resources
+		                  SET name = $1, resource_type = $2, description = $3, slot_minutes = $4, max_slots = $5,
+		                      advance_days = $6, cancel_hours = $7, vat_rate = $8, currency = $9, is_active = $10
+		                  WHERE id = $11`,
+			req.Name, req.ResourceType, nullIfEmpty(req.Description), req.SlotMinutes, req.MaxSlots,
+			req.AdvanceDays, *req.CancelHours, *req.VATRate, req.Currency, *req.IsActive, resourceID)
+		if err == nil {
+			_, err = tx.Exec(`DELETE FROM resource_hours WHERE resource_id = $1`, resourceID)
+		}
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to save resource: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, hours := range req.Hours {
+		_, err = tx.Exec(`INSERT INTO resource_hours (resource_id, weekday, open_time, close_time, slot_price)
+		                  VALUES ($1, $2, $3, $4, $5)`,
+			resourceID, hours.Weekday, hours.OpenTime, hours.CloseTime, hours.SlotPrice)
+		if err != nil {
+			sendErrorResponse(w, "Failed to save opening hours: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resources, err := app.loadGymResources(gymID, resourceID, false)
+	if err != nil || len(resources) == 0 {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     resourceID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, resources[0])
+}
+
+// List the slots of a resource on a day, with their price and whether they are free
+func (app *App) getGymResourceSlots(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	resourceID, err := strconv.Atoi(vars["resource_id"])
+	if err != nil || resourceID <= 0 {
+		sendErrorResponse(w, "Invalid resource_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	day := r.URL.Query().Get("date")
+	if day == "" {
+		day = time.Now().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", day); err != nil {
+		sendErrorResponse(w, "Invalid date parameter (YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the resource's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN resources r ON r.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND r.id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, resourceID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Resource not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// Slots already started count as taken
+	rows, err := app.DB.Query(`SELECT TO_CHAR(s.starts_at, 'YYYY-MM-DD HH24:MI'), TO_CHAR(s.ends_at, 'YYYY-MM-DD HH24:MI'),
+	                                  s.price, NOT s.is_booked AND s.starts_at > gym_local_time($3)
+	                           FROM resource_day_slots($1, $2::date) s`, resourceID, day, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch slots: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var slots []ResourceSlot
+	for rows.Next() {
+		var slot ResourceSlot
+		if err := rows.Scan(&slot.StartsAt, &slot.EndsAt, &slot.Price, &slot.IsFree); err != nil {
+			sendErrorResponse(w, "Failed to scan slot: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slots = append(slots, slot)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If the resource is closed that day, return empty array instead of null
+	if slots == nil {
+		slots = []ResourceSlot{}
+	}
+
+	sendSuccessResponse(w, "Resource slots retrieved successfully", slots)
+}
+
+// Book consecutive slots of a resource for a client
+func (app *App) bookGymResource(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	resourceID, err := strconv.Atoi(vars["resource_id"])
+	if err != nil || resourceID <= 0 {
+		sendErrorResponse(w, "Invalid resource_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req BookResourceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Slots == 0 {
+		req.Slots = 1
+	}
+	var fieldErrs ValidationErrors
+	if req.ClientID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "client_id", Message: "Valid client_id is required"})
+	}
+	if _, err := time.Parse(appointmentTimeLayout, req.StartsAt); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "starts_at", Message: "time must be in YYYY-MM-DD HH:MM format"})
+	}
+	if req.Slots < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "slots", Message: "slots must be positive"})
+	}
+	if len(req.Notes) > 512 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "notes", Message: "notes cannot exceed 512 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the resource's gym and the client
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN resources r ON r.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND r.id = $3)
+	                      AND EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $4)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, resourceID, req.ClientID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Resource or client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// currval needs the same connection as the insert
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT book_resource($1, $2, $3, $4, $5, $6)", resourceID, req.ClientID, req.StartsAt,
+		req.Slots, nullIfEmpty(req.Notes), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	var bookingID int
+	err = tx.QueryRow("SELECT currval(pg_get_serial_sequence('resource_bookings', 'id'))").Scan(&bookingID)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	app.notifyResourceBooking(bookingID, "resource_booked")
+
+	app.sendResourceBooking(w, "Resource booked successfully", bookingID)
+}
+
+// List the resource bookings at a gym, by default the next 7 days
+func (app *App) getGymResourceBookings(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseAppointmentPeriod(w, r)
+	if !ok {
+		return
+	}
+	resourceID := 0
+	if resourceIDStr := r.URL.Query().Get("resource_id"); resourceIDStr != "" {
+		resourceID, err = strconv.Atoi(resourceIDStr)
+		if err != nil || resourceID <= 0 {
+			sendErrorResponse(w, "Invalid resource_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	status := r.URL.Query().Get("status")
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	app.sendResourceBookings(w, `WHERE rb.gym_id = $1 AND rb.starts_at::date BETWEEN $2 AND $3
+	                               AND ($4 = 0 OR rb.resource_id = $4) AND ($5 = '' OR rb.status = $5)
+	                             ORDER BY rb.starts_at, r.name`,
+		gymID, from, to, resourceID, status)
+}
+
+// List a client's resource bookings, newest first
+func (app *App) getClientResourceBookings(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	upcomingOnly := r.URL.Query().Get("upcoming_only") == "true"
+
+	app.sendResourceBookings(w, `WHERE rb.client_id = $1
+	                               AND ($2 = false OR (rb.status = 'booked' AND rb.starts_at > gym_local_time(rb.gym_id)))
+	                             ORDER BY rb.starts_at DESC
+	                             LIMIT 100`,
+		clientID, upcomingOnly)
+}
+
+// Cancel a resource booking; cancelled in time, its invoice is cancelled or credited
+func (app *App) cancelGymResourceBooking(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	bookingID, err := strconv.Atoi(vars["booking_id"])
+	if err != nil || bookingID <= 0 {
+		sendErrorResponse(w, "Invalid booking_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CancelResourceBookingRequest
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > 256 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "reason", Message: "reason cannot exceed 256 characters"}})
+		return
+	}
+
+	// Check if user has permission for the booking's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+	                                  INNER JOIN resource_bookings rb ON rb.gym_id = ug.gym_id
+	                                  WHERE ug.user_id = $1 AND ug.gym_id = $2 AND rb.id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID, bookingID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Booking not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var result string
+	err = app.DB.QueryRow("SELECT cancel_resource_booking($1, $2, $3)", bookingID, nullIfEmpty(req.Reason), claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	app.notifyResourceBooking(bookingID, "resource_booking_cancelled")
+
+	app.sendResourceBooking(w, "Booking cancelled successfully", bookingID)
+}
+
+// loadGymResources reads the resources of a gym, or only resourceID, with their opening hours
+func (app *App) loadGymResources(gymID, resourceID int, activeOnly bool) ([]Resource, error) {
+	rows, err := app.DB.Query(resourceQuery+` WHERE gym_id = $1 AND ($2 = 0 OR id = $2)
+	                                            AND ($3 = false OR is_active = true)
+	                                          ORDER BY name`, gymID, resourceID, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resources := []Resource{}
+	byID := make(map[int]int)
+	for rows.Next() {
+		var res Resource
+		if err := scanResource(rows, &res); err != nil {
+			return nil, err
+		}
+		res.Hours = []ResourceHours{}
+		byID[res.ID] = len(resources)
+		resources = append(resources, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hourRows, err := app.DB.Query(`SELECT h.resource_id, h.weekday, TO_CHAR(h.open_time, 'HH24:MI'),
+	                                      TO_CHAR(h.close_time, 'HH24:MI'), COALESCE(h.slot_price, 0)
+	                               FROM resource_hours h
+	                               INNER JOIN resources r ON r.id = h.resource_id
+	                               WHERE r.gym_id = $1 AND ($2 = 0 OR r.id = $2)
+	                               ORDER BY h.weekday, h.open_time`, gymID, resourceID)
+	if err != nil {
+		return nil, err
+	}
+	defer hourRows.Close()
+
+	for hourRows.Next() {
+		var id int
+		var hours ResourceHours
+		if err := hourRows.Scan(&id, &hours.Weekday, &hours.OpenTime, &hours.CloseTime, &hours.SlotPrice); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[id]; ok {
+			resources[i].Hours = append(resources[i].Hours, hours)
+		}
+	}
+
+	return resources, hourRows.Err()
+}
+
+// sendResourceBookings runs resourceBookingQuery with the given filter and sends the list
+func (app *App) sendResourceBookings(w http.ResponseWriter, filter string, args ...interface{}) {
+	rows, err := app.DB.Query(resourceBookingQuery+" "+filter, args...)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch resource bookings: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var bookings []ResourceBooking
+	for rows.Next() {
+		var booking ResourceBooking
+		if err := scanResourceBooking(rows, &booking); err != nil {
+			sendErrorResponse(w, "Failed to scan resource booking: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		bookings = append(bookings, booking)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no bookings found, return empty array instead of null
+	if bookings == nil {
+		bookings = []ResourceBooking{}
+	}
+
+	sendSuccessResponse(w, "Resource bookings retrieved successfully", bookings)
+}
+
+// sendResourceBooking reads a booking back after a change and sends it
+func (app *App) sendResourceBooking(w http.ResponseWriter, message string, bookingID int) {
+	var booking ResourceBooking
+	err := scanResourceBooking(app.DB.QueryRow(resourceBookingQuery+" WHERE rb.id = $1", bookingID), &booking)
+	if err != nil {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     bookingID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, booking)
+}
+
+// notifyResourceBooking tells the client about a booked or cancelled resource, with
+// the booking attached as an .ics file to emails; failures are only logged
+func (app *App) notifyResourceBooking(bookingID int, templateName string) {
+	var notice ResourceBookingNotice
+	var clientID int
+	var price float64
+	var reason sql.NullString
+	err := app.DB.QueryRow(`SELECT rb.client_id, COALESCE(c.name, ''), COALESCE(r.name, ''), COALESCE(g.name, ''),
+	                               TO_CHAR(rb.starts_at, 'YYYY-MM-DD HH24:MI'), TO_CHAR(rb.ends_at, 'HH24:MI'),
+	                               COALESCE(rb.price, 0), COALESCE(rb.currency, 'RON'), rb.cancel_reason,
+	                               COALESCE(rb.late_cancellation, false)
+	                        FROM resource_bookings rb
+	                        LEFT JOIN clients c ON c.id = rb.client_id
+	                        LEFT JOIN resources r ON r.id = rb.resource_id
+	                        LEFT JOIN gyms g ON g.id = rb.gym_id
+	                        WHERE rb.id = $1`, bookingID).Scan(&clientID, &notice.ClientName, &notice.ResourceName,
+		&notice.GymName, &notice.StartsAt, &notice.EndsAt, &price, &notice.Currency, &reason, &notice.Late)
+	if err != nil {
+		log.Printf("resources: failed to load booking %d for notification: %v", bookingID, err)
+		return
+	}
+	notice.Price = strconv.FormatFloat(price, 'f', 2, 64)
+	notice.Reason = reason.String
+
+	err = app.Notifier.NotifyClientWithAttachment(clientID, templateName, notice, app.resourceBookingICS(bookingID))
+	if err != nil && err != errNoContactChannel {
+		log.Printf("resources: failed to queue %s for client %d: %v", templateName, clientID, err)
+	}
+}
+
+// validateResource checks the request and fills in the defaults
+func validateResource(req *SaveResourceRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.ResourceType == "" {
+		req.ResourceType = "room"
+	}
+	if req.SlotMinutes == 0 {
+		req.SlotMinutes = 60
+	}
+	if req.MaxSlots == 0 {
+		req.MaxSlots = 2
+	}
+	if req.AdvanceDays == 0 {
+		req.AdvanceDays = 14
+	}
+	if req.CancelHours == nil {
+		cancelHours := 24
+		req.CancelHours = &cancelHours
+	}
+	if req.VATRate == nil {
+		vatRate := 21.0
+		req.VATRate = &vatRate
+	}
+	if req.Currency == "" {
+		req.Currency = "RON"
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+
+	if req.Name == "" || len(req.Name) > 64 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "name", Message: "name must have between 1 and 64 characters"})
+	}
+	if !validResourceTypes[req.ResourceType] {
+		fieldErrs = append(fieldErrs, FieldError{Field: "resource_type", Message: "resource_type must be court, room or equipment"})
+	}
+	if len(req.Description) > 512 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "description", Message: "description cannot exceed 512 characters"})
+	}
+	if req.SlotMinutes < 15 || req.SlotMinutes > 240 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "slot_minutes", Message: "slot_minutes must be between 15 and 240"})
+	}
+	if req.MaxSlots < 1 || req.MaxSlots > 12 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "max_slots", Message: "max_slots must be between 1 and 12"})
+	}
+	if req.AdvanceDays < 1 || req.AdvanceDays > 365 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "advance_days", Message: "advance_days must be between 1 and 365"})
+	}
+	if *req.CancelHours < 0 || *req.CancelHours > 720 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "cancel_hours", Message: "cancel_hours must be between 0 and 720"})
+	}
+	if *req.VATRate < 0 || *req.VATRate > 100 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "vat_rate", Message: "VAT rate must be between 0 and 100"})
+	}
+	if len(req.Currency) != 3 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "currency", Message: "currency must be a 3 letter code"})
+	}
+
+	// Openings of the same day cannot overlap
+	type opening struct{ open, close time.Time }
+	openings := make(map[int][]opening)
+	for i, hours := range req.Hours {
+		field := "hours[" + strconv.Itoa(i) + "]"
+		if hours.Weekday < 1 || hours.Weekday > 7 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".weekday", Message: "weekday must be between 1 (Monday) and 7 (Sunday)"})
+		}
+		openTime, err := time.Parse("15:04", hours.OpenTime)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".open_time", Message: "time must be in HH:MM format"})
+			continue
+		}
+		closeTime, err := time.Parse("15:04", hours.CloseTime)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".close_time", Message: "time must be in HH:MM format"})
+			continue
+		}
+		if closeTime.Sub(openTime) < time.Duration(req.SlotMinutes)*time.Minute {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".close_time", Message: "close_time must leave room for at least one slot after open_time"})
+			continue
+		}
+		if hours.SlotPrice < 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".slot_price", Message: "slot_price cannot be negative"})
+		}
+		for _, other := range openings[hours.Weekday] {
+			if openTime.Before(other.close) && closeTime.After(other.open) {
+				fieldErrs = append(fieldErrs, FieldError{Field: field, Message: "opening overlaps another opening of the same day"})
+				break
+			}
+		}
+		openings[hours.Weekday] = append(openings[hours.Weekday], opening{openTime, closeTime})
+	}
+
+	return fieldErrs
+}
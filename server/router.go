@@ -11,6 +11,16 @@ func (app *App) setupApiRouter(r *mux.Router) {
 	app.setupMembershipsRouter(api)
 	app.setupGymsRouter(api)
 	app.setupClientsRouter(api)
+	app.setupCorporateRouter(api)
+	app.setupInvoicesRouter(api)
+	app.setupPromoCodesRouter(api)
+	app.setupProductsRouter(api)
+	app.setupClassTypesRouter(api)
+	app.setupExercisesRouter(api)
+	app.setupTrainersRouter(api)
+	app.setupReportsRouter(api)
+	app.setupNotificationsRouter(api)
+	app.setupCalendarRouter(api)
 	api.HandleFunc("/health", app.healthCheck).Methods("GET")
 }
 
@@ -27,6 +37,9 @@ func (app *App) setupUserRouter(r *mux.Router) {
 	user.HandleFunc("/me", app.authenticateJWT(app.getMe)).Methods("GET")
 	user.HandleFunc("/", app.authenticateJWT(app.getUsers)).Methods("GET")
 	user.HandleFunc("/search", app.authenticateJWT(app.getUsersWithSearch)).Methods("GET")
+	user.HandleFunc("/me/calendar-feed", app.authenticateJWT(app.getCalendarFeed)).Methods("GET")
+	user.HandleFunc("/me/calendar-feed", app.authenticateJWT(app.createCalendarFeed)).Methods("POST")
+	user.HandleFunc("/me/calendar-feed", app.authenticateJWT(app.revokeCalendarFeed)).Methods("DELETE")
 }
 
 func (app *App) setupNomenclatorsRouter(r *mux.Router) {
@@ -40,6 +53,9 @@ func (app *App) setupMembershipsRouter(r *mux.Router) {
 	m := r.PathPrefix("/memberships").Subrouter()
 	m.Use(app.authenticateJWTMiddleware)
 	m.HandleFunc("/", app.getMemberships).Methods("GET")
+	m.HandleFunc("/{membership_id}/time-windows", app.updateMembershipTimeWindows).Methods("PUT")
+	m.HandleFunc("/{membership_id}/prices", app.getMembershipPrices).Methods("GET")
+	m.HandleFunc("/{membership_id}/prices", app.createMembershipPrice).Methods("POST")
 }
 
 // Add these routes to your setupGymsRouter function in router.go
@@ -71,6 +87,72 @@ func (app *App) setupGymsRouter(r *mux.Router) {
 
 	// Stats
 	g.HandleFunc("/{gym_id}/stats", app.getGymStats).Methods("GET")
+
+	// Age rules
+	g.HandleFunc("/{gym_id}/age-rules", app.getGymAgeRules).Methods("GET")
+	g.HandleFunc("/{gym_id}/age-rules", app.updateGymAgeRules).Methods("PUT")
+
+	// Membership cancellation policy
+	g.HandleFunc("/{gym_id}/cancellation-policy", app.getGymCancellationPolicy).Methods("GET")
+	g.HandleFunc("/{gym_id}/cancellation-policy", app.updateGymCancellationPolicy).Methods("PUT")
+
+	// No-show penalties
+	g.HandleFunc("/{gym_id}/no-show-policy", app.getGymNoShowPolicy).Methods("GET")
+	g.HandleFunc("/{gym_id}/no-show-policy", app.updateGymNoShowPolicy).Methods("PUT")
+
+	// Time zone for membership time windows
+	g.HandleFunc("/{gym_id}/time-zone", app.updateGymTimeZone).Methods("PUT")
+
+	// Branding of generated documents
+	g.HandleFunc("/{gym_id}/branding", app.getGymBranding).Methods("GET")
+	g.HandleFunc("/{gym_id}/branding", app.updateGymBranding).Methods("PUT")
+	g.HandleFunc("/{gym_id}/logo", app.uploadGymLogo).Methods("POST")
+	g.HandleFunc("/{gym_id}/logo", app.deleteGymLogo).Methods("DELETE")
+
+	// Point of sale: stock and front desk sales
+	g.HandleFunc("/{gym_id}/stock", app.getGymStock).Methods("GET")
+	g.HandleFunc("/{gym_id}/stock/movements", app.getStockMovements).Methods("GET")
+	g.HandleFunc("/{gym_id}/stock/movements", app.createStockMovement).Methods("POST")
+	g.HandleFunc("/{gym_id}/stock/{product_id}/reorder-level", app.updateStockReorderLevel).Methods("PUT")
+	g.HandleFunc("/{gym_id}/sales", app.getGymSales).Methods("GET")
+	g.HandleFunc("/{gym_id}/sales", app.createSale).Methods("POST")
+	g.HandleFunc("/{gym_id}/sales/{sale_id}", app.getGymSaleByID).Methods("GET")
+
+	// Lockers
+	g.HandleFunc("/{gym_id}/lockers", app.getGymLockers).Methods("GET")
+	g.HandleFunc("/{gym_id}/lockers", app.createGymLockers).Methods("POST")
+	g.HandleFunc("/{gym_id}/lockers/{locker_id}", app.updateGymLocker).Methods("PUT")
+	g.HandleFunc("/{gym_id}/lockers/{locker_id}/assign", app.assignGymLocker).Methods("POST")
+	g.HandleFunc("/{gym_id}/lockers/{locker_id}/release", app.releaseGymLocker).Methods("POST")
+
+	// Group classes
+	g.HandleFunc("/{gym_id}/class-schedules", app.getGymClassSchedules).Methods("GET")
+	g.HandleFunc("/{gym_id}/class-schedules", app.createGymClassSchedule).Methods("POST")
+	g.HandleFunc("/{gym_id}/class-schedules/{schedule_id}", app.deleteGymClassSchedule).Methods("DELETE")
+	g.HandleFunc("/{gym_id}/classes", app.getGymClassSessions).Methods("GET")
+	g.HandleFunc("/{gym_id}/classes/{session_id}", app.getGymClassSession).Methods("GET")
+	g.HandleFunc("/{gym_id}/classes/{session_id}/cancel", app.cancelGymClassSession).Methods("POST")
+	g.HandleFunc("/{gym_id}/classes/{session_id}/bookings", app.bookGymClass).Methods("POST")
+	g.HandleFunc("/{gym_id}/classes/{session_id}/bookings/{booking_id}", app.cancelGymClassBooking).Methods("DELETE")
+	g.HandleFunc("/{gym_id}/classes/{session_id}/bookings/{booking_id}/checkin", app.checkInGymClassBooking).Methods("POST")
+
+	// Personal training
+	g.HandleFunc("/{gym_id}/trainers", app.getGymTrainers).Methods("GET")
+	g.HandleFunc("/{gym_id}/appointments", app.getGymAppointments).Methods("GET")
+	g.HandleFunc("/{gym_id}/appointments", app.bookGymAppointment).Methods("POST")
+	g.HandleFunc("/{gym_id}/appointments/{appointment_id}", app.getGymAppointmentByID).Methods("GET")
+	g.HandleFunc("/{gym_id}/appointments/{appointment_id}/reschedule", app.rescheduleGymAppointment).Methods("POST")
+	g.HandleFunc("/{gym_id}/appointments/{appointment_id}/cancel", app.cancelGymAppointment).Methods("POST")
+	g.HandleFunc("/{gym_id}/appointments/{appointment_id}/complete", app.completeGymAppointment).Methods("POST")
+
+	// Bookable resources
+	g.HandleFunc("/{gym_id}/resources", app.getGymResources).Methods("GET")
+	g.HandleFunc("/{gym_id}/resources", app.createGymResource).Methods("POST")
+	g.HandleFunc("/{gym_id}/resources/{resource_id}", app.updateGymResource).Methods("PUT")
+	g.HandleFunc("/{gym_id}/resources/{resource_id}/slots", app.getGymResourceSlots).Methods("GET")
+	g.HandleFunc("/{gym_id}/resources/{resource_id}/bookings", app.bookGymResource).Methods("POST")
+	g.HandleFunc("/{gym_id}/resource-bookings", app.getGymResourceBookings).Methods("GET")
+	g.HandleFunc("/{gym_id}/resource-bookings/{booking_id}/cancel", app.cancelGymResourceBooking).Methods("POST")
 }
 
 // Add these routes to your setupClientsRouter function in router.go
@@ -96,6 +178,15 @@ func (app *App) setupClientsRouter(r *mux.Router) {
 	c.HandleFunc("/{client_id}/membership/{membership_id}/from/{valid_from}", app.addClientMembershipByPath).Methods("POST")
 	c.HandleFunc("/{client_id}/membership/{membership_id}", app.removeClientMembership).Methods("DELETE")
 	c.HandleFunc("/{client_id}/membership/{membership_id}/deactivate", app.deactivateClientMembership).Methods("PATCH")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/contract", app.getMembershipContract).Methods("GET")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/auto-renew", app.updateClientMembershipAutoRenew).Methods("PUT")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/cancellation-quote", app.getMembershipCancellationQuote).Methods("GET")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/cancel", app.cancelClientMembership).Methods("POST")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/cancellation", app.getMembershipCancellation).Methods("GET")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/upgrade", app.upgradeClientMembership).Methods("POST")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/downgrade", app.downgradeClientMembership).Methods("POST")
+	c.HandleFunc("/{client_id}/memberships/{client_membership_id}/transfer", app.transferClientMembership).Methods("POST")
+	c.HandleFunc("/{client_id}/membership-changes", app.getClientMembershipChanges).Methods("GET")
 
 	// Check-in/Check-out
 	c.HandleFunc("/checkin", app.doClientCheckInGym).Methods("POST")
@@ -103,6 +194,183 @@ func (app *App) setupClientsRouter(r *mux.Router) {
 	c.HandleFunc("/checkout", app.doClientCheckOutGym).Methods("POST")
 	c.HandleFunc("/{client_id}/checkout/gym/{gym_id}", app.doClientCheckOutGymByPath).Methods("POST")
 
+	// Day passes for walk-ins and guests brought in by members
+	c.HandleFunc("/day-pass", app.sellDayPass).Methods("POST")
+	c.HandleFunc("/{client_id}/guests/checkin", app.doGuestCheckInGym).Methods("POST")
+
 	// Status check
 	c.HandleFunc("/{client_id}/gym/{gym_id}/status", app.getClientGymStatus).Methods("GET")
+
+	// Photo
+	c.HandleFunc("/{client_id}/photo", app.uploadClientPhoto).Methods("POST")
+	c.HandleFunc("/{client_id}/photo", app.getClientPhoto).Methods("GET")
+	c.HandleFunc("/{client_id}/photo", app.deleteClientPhoto).Methods("DELETE")
+	c.HandleFunc("/{client_id}/photo/thumbnail", app.getClientPhotoThumbnail).Methods("GET")
+
+	// Contact preferences
+	c.HandleFunc("/{client_id}/contact-preferences", app.getClientContactPreferences).Methods("GET")
+	c.HandleFunc("/{client_id}/contact-preferences", app.updateClientContactPreferences).Methods("PUT")
+
+	// Guardian and consent for minors
+	c.HandleFunc("/{client_id}/guardian", app.getClientGuardian).Methods("GET")
+	c.HandleFunc("/{client_id}/guardian", app.setClientGuardian).Methods("PUT")
+	c.HandleFunc("/{client_id}/guardian/consent", app.recordGuardianConsent).Methods("POST")
+	c.HandleFunc("/{client_id}/guardian/consent", app.revokeGuardianConsent).Methods("DELETE")
+
+	// Referrals
+	c.HandleFunc("/{client_id}/referrer", app.setClientReferrer).Methods("PUT")
+	c.HandleFunc("/{client_id}/referrals", app.getClientReferrals).Methods("GET")
+
+	// Lockers
+	c.HandleFunc("/{client_id}/lockers", app.getClientLockers).Methods("GET")
+
+	// Group classes
+	c.HandleFunc("/{client_id}/class-bookings", app.getClientClassBookings).Methods("GET")
+
+	// Personal training
+	c.HandleFunc("/{client_id}/trainer-packages", app.getClientTrainerPackages).Methods("GET")
+	c.HandleFunc("/{client_id}/trainer-packages", app.sellClientTrainerPackage).Methods("POST")
+	c.HandleFunc("/{client_id}/appointments", app.getClientAppointments).Methods("GET")
+
+	// Bookable resources
+	c.HandleFunc("/{client_id}/resource-bookings", app.getClientResourceBookings).Methods("GET")
+
+	// Workout plans and logged workouts
+	c.HandleFunc("/{client_id}/workout-plans", app.getClientWorkoutPlans).Methods("GET")
+	c.HandleFunc("/{client_id}/workout-plans", app.createClientWorkoutPlan).Methods("POST")
+	c.HandleFunc("/{client_id}/workout-plans/{plan_id}", app.getClientWorkoutPlan).Methods("GET")
+	c.HandleFunc("/{client_id}/workout-plans/{plan_id}", app.updateClientWorkoutPlan).Methods("PUT")
+	c.HandleFunc("/{client_id}/workouts", app.getClientWorkouts).Methods("GET")
+	c.HandleFunc("/{client_id}/workouts", app.createClientWorkout).Methods("POST")
+	c.HandleFunc("/{client_id}/workouts/{workout_id}", app.getClientWorkout).Methods("GET")
+	c.HandleFunc("/{client_id}/workouts/{workout_id}", app.deleteClientWorkout).Methods("DELETE")
+	c.HandleFunc("/{client_id}/exercise-progress", app.getClientExerciseProgress).Methods("GET")
+	c.HandleFunc("/{client_id}/exercise-progress/{exercise_id}", app.getClientExerciseHistory).Methods("GET")
+
+	// No-shows
+	c.HandleFunc("/{client_id}/no-shows", app.getClientNoShows).Methods("GET")
+	c.HandleFunc("/{client_id}/no-shows/{no_show_id}/waive", app.waiveClientNoShow).Methods("POST")
+	c.HandleFunc("/{client_id}/booking-bans/{ban_id}/lift", app.liftClientBookingBan).Methods("POST")
+
+	// Calendar feed
+	c.HandleFunc("/{client_id}/calendar-feed", app.getCalendarFeed).Methods("GET")
+	c.HandleFunc("/{client_id}/calendar-feed", app.createCalendarFeed).Methods("POST")
+	c.HandleFunc("/{client_id}/calendar-feed", app.revokeCalendarFeed).Methods("DELETE")
+}
+
+func (app *App) setupCorporateRouter(r *mux.Router) {
+	corp := r.PathPrefix("/corporate").Subrouter()
+	corp.Use(app.authenticateJWTMiddleware)
+
+	// Accounts
+	corp.HandleFunc("/accounts", app.createCorporateAccount).Methods("POST")
+	corp.HandleFunc("/accounts", app.getCorporateAccounts).Methods("GET")
+	corp.HandleFunc("/accounts/{account_id}", app.getCorporateAccountByID).Methods("GET")
+
+	// Employees
+	corp.HandleFunc("/accounts/{account_id}/employees", app.addCorporateEmployee).Methods("POST")
+	corp.HandleFunc("/accounts/{account_id}/employees/{client_id}", app.removeCorporateEmployee).Methods("DELETE")
+
+	// Seat allocations
+	corp.HandleFunc("/accounts/{account_id}/allocations", app.createCorporateAllocation).Methods("POST")
+	corp.HandleFunc("/allocations/{allocation_id}/assign", app.assignCorporateMembership).Methods("POST")
+}
+
+func (app *App) setupInvoicesRouter(r *mux.Router) {
+	inv := r.PathPrefix("/invoices").Subrouter()
+	inv.Use(app.authenticateJWTMiddleware)
+
+	inv.HandleFunc("/", app.getInvoices).Methods("GET")
+	inv.HandleFunc("/membership", app.invoiceMembership).Methods("POST")
+
+	// e-Factura exports (registered before /{invoice_id})
+	inv.HandleFunc("/efactura", app.exportEFacturaBatch).Methods("GET")
+	inv.HandleFunc("/{invoice_id}/efactura", app.exportInvoiceEFactura).Methods("GET")
+	inv.HandleFunc("/{invoice_id}/pdf", app.getInvoicePDF).Methods("GET")
+
+	inv.HandleFunc("/{invoice_id}", app.getInvoiceByID).Methods("GET")
+
+	// Payments
+	inv.HandleFunc("/{invoice_id}/payments", app.registerPayment).Methods("POST")
+	inv.HandleFunc("/{invoice_id}/payments/{payment_id}/receipt", app.getPaymentReceipt).Methods("GET")
+}
+
+func (app *App) setupPromoCodesRouter(r *mux.Router) {
+	p := r.PathPrefix("/promo-codes").Subrouter()
+	p.Use(app.authenticateJWTMiddleware)
+	p.HandleFunc("/", app.getPromoCodes).Methods("GET")
+	p.HandleFunc("/", app.createPromoCode).Methods("POST")
+	p.HandleFunc("/{promo_code_id}/deactivate", app.deactivatePromoCode).Methods("PATCH")
+}
+
+func (app *App) setupProductsRouter(r *mux.Router) {
+	p := r.PathPrefix("/products").Subrouter()
+	p.Use(app.authenticateJWTMiddleware)
+	p.HandleFunc("/", app.getProducts).Methods("GET")
+	p.HandleFunc("/", app.createProduct).Methods("POST")
+	p.HandleFunc("/{product_id}", app.updateProduct).Methods("PUT")
+}
+
+func (app *App) setupExercisesRouter(r *mux.Router) {
+	e := r.PathPrefix("/exercises").Subrouter()
+	e.Use(app.authenticateJWTMiddleware)
+	e.HandleFunc("/", app.getExercises).Methods("GET")
+	e.HandleFunc("/", app.createExercise).Methods("POST")
+	e.HandleFunc("/{exercise_id}", app.updateExercise).Methods("PUT")
+}
+
+func (app *App) setupClassTypesRouter(r *mux.Router) {
+	ct := r.PathPrefix("/class-types").Subrouter()
+	ct.Use(app.authenticateJWTMiddleware)
+	ct.HandleFunc("/", app.getClassTypes).Methods("GET")
+	ct.HandleFunc("/", app.createClassType).Methods("POST")
+	ct.HandleFunc("/{class_type_id}", app.updateClassType).Methods("PUT")
+}
+
+func (app *App) setupTrainersRouter(r *mux.Router) {
+	t := r.PathPrefix("/trainers").Subrouter()
+	t.Use(app.authenticateJWTMiddleware)
+
+	// Session packages (registered before /{trainer_id})
+	t.HandleFunc("/packages", app.getTrainerPackages).Methods("GET")
+	t.HandleFunc("/packages", app.createTrainerPackage).Methods("POST")
+	t.HandleFunc("/packages/{package_id}", app.updateTrainerPackage).Methods("PUT")
+
+	// Calendar
+	t.HandleFunc("/{trainer_id}/availability", app.getTrainerAvailability).Methods("GET")
+	t.HandleFunc("/{trainer_id}/availability", app.createTrainerAvailability).Methods("POST")
+	t.HandleFunc("/{trainer_id}/availability/{availability_id}", app.deleteTrainerAvailability).Methods("DELETE")
+	t.HandleFunc("/{trainer_id}/time-off", app.getTrainerTimeOff).Methods("GET")
+	t.HandleFunc("/{trainer_id}/time-off", app.createTrainerTimeOff).Methods("POST")
+	t.HandleFunc("/{trainer_id}/time-off/{time_off_id}", app.deleteTrainerTimeOff).Methods("DELETE")
+	t.HandleFunc("/{trainer_id}/slots", app.getTrainerFreeSlots).Methods("GET")
+	t.HandleFunc("/{trainer_id}/appointments", app.getTrainerAppointments).Methods("GET")
+}
+
+func (app *App) setupReportsRouter(r *mux.Router) {
+	rep := r.PathPrefix("/reports").Subrouter()
+	rep.Use(app.authenticateJWTMiddleware)
+	rep.HandleFunc("/expiring-memberships", app.getExpiringMemberships).Methods("GET")
+	rep.HandleFunc("/minors-without-consent", app.getMinorsWithoutConsent).Methods("GET")
+	rep.HandleFunc("/corporate-usage", app.getCorporateUsage).Methods("GET")
+	rep.HandleFunc("/guest-visits", app.getGuestVisits).Methods("GET")
+	rep.HandleFunc("/unpaid-invoices", app.getUnpaidInvoices).Methods("GET")
+	rep.HandleFunc("/renewal-dunning", app.getRenewalDunning).Methods("GET")
+	rep.HandleFunc("/promo-codes", app.getPromoCodeReport).Methods("GET")
+	rep.HandleFunc("/daily-sales", app.getDailySalesReport).Methods("GET")
+	rep.HandleFunc("/overdue-lockers", app.getOverdueLockers).Methods("GET")
+	rep.HandleFunc("/trainer-utilization", app.getTrainerUtilization).Methods("GET")
+}
+
+func (app *App) setupNotificationsRouter(r *mux.Router) {
+	n := r.PathPrefix("/notifications").Subrouter()
+	n.Use(app.authenticateJWTMiddleware)
+	n.HandleFunc("/", app.getNotifications).Methods("GET")
+	n.HandleFunc("/{notification_id}/retry", app.retryNotification).Methods("POST")
+}
+
+// Calendar feeds are fetched by calendar apps, the token in the URL authenticates them
+func (app *App) setupCalendarRouter(r *mux.Router) {
+	cal := r.PathPrefix("/calendar").Subrouter()
+	cal.HandleFunc("/{token:[0-9a-f]{64}}.ics", app.serveCalendarFeed).Methods("GET")
 }
@@ -0,0 +1,412 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+type Sale struct {
+	ID            int        `json:"id"`
+	GymID         int        `json:"gym_id"`
+	ClientID      *int       `json:"client_id"` // null for anonymous sales
+	ClientName    string     `json:"client_name,omitempty"`
+	SoldOn        string     `json:"sold_on"`
+	Currency      string     `json:"currency"`
+	NetAmount     float64    `json:"net_amount"`
+	VATAmount     float64    `json:"vat_amount"`
+	TotalAmount   float64    `json:"total_amount"`
+	PaymentMethod string     `json:"payment_method"`
+	CreatedBy     *int       `json:"created_by"`
+	CreatedByName string     `json:"created_by_name,omitempty"`
+	Lines         []SaleLine `json:"lines,omitempty"`
+}
+
+type SaleLine struct {
+	ID          int     `json:"id"`
+	ProductID   int     `json:"product_id"`
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"` // Gross unit price, VAT included
+	VATRate     float64 `json:"vat_rate"`
+	NetAmount   float64 `json:"net_amount"`
+	VATAmount   float64 `json:"vat_amount"`
+	TotalAmount float64 `json:"total_amount"`
+}
+
+type CreateSaleRequest struct {
+	ClientID      int                     `json:"client_id,omitempty"` // anonymous sale when omitted
+	PaymentMethod string                  `json:"payment_method"`      // cash or card
+	Currency      string                  `json:"currency,omitempty"`  // defaults to RON
+	Lines         []CreateSaleLineRequest `json:"lines"`
+}
+
+type CreateSaleLineRequest struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// saleQuery selects sales with the client and cashier names
+const saleQuery = `SELECT s.id, s.gym_id, s.client_id, COALESCE(c.name, ''),
+                          TO_CHAR(s.sold_on, 'YYYY-MM-DD HH24:MI:SS'), s.currency, s.net_amount, s.vat_amount,
+                          s.total_amount, s.payment_method, s.created_by, COALESCE(u.full_name, '')
+                   FROM sales s
+                   LEFT JOIN clients c ON c.id = s.client_id
+                   LEFT JOIN users u ON u.id = s.created_by`
+
+func scanSale(scanner interface{ Scan(...interface{}) error }, sale *Sale) error {
+	return scanner.Scan(&sale.ID, &sale.GymID, &sale.ClientID, &sale.ClientName, &sale.SoldOn, &sale.Currency,
+		&sale.NetAmount, &sale.VATAmount, &sale.TotalAmount, &sale.PaymentMethod, &sale.CreatedBy,
+		&sale.CreatedByName)
+}
+
+// Sell products and services at a gym's front desk. Products leave the gym's
+// stock; a line without enough stock rejects the whole sale.
+func (app *App) createSale(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateSale(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// Check if user has permission for the client the sale is attached to
+	if req.ClientID > 0 {
+		permissionQuery = `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+		err = app.DB.QueryRow(permissionQuery, claims.UserID, req.ClientID).Scan(&exists)
+		if err != nil || !exists {
+			sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Start a transaction
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we rollback if something goes wrong
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var result string
+	err = tx.QueryRow("SELECT create_sale($1, $2, $3, $4, $5)", gymID, nullIfZero(req.ClientID),
+		req.PaymentMethod, req.Currency, claims.UserID).Scan(&result)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result != "OK" {
+		tx.Rollback()
+		sendErrorResponse(w, result, http.StatusBadRequest)
+		return
+	}
+
+	var saleID int
+	err = tx.QueryRow(`SELECT currval(pg_get_serial_sequence('sales', 'id'))`).Scan(&saleID)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i, line := range req.Lines {
+		err = tx.QueryRow("SELECT add_sale_line($1, $2, $3, $4)", saleID, line.ProductID, line.Quantity,
+			claims.UserID).Scan(&result)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if result != "OK" {
+			tx.Rollback()
+			sendValidationErrorResponse(w, ValidationErrors{{Field: fmt.Sprintf("lines[%d]", i), Message: result}})
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	sale, err := app.loadSale(saleID)
+	if err != nil {
+		sendSuccessResponse(w, "Sale recorded successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     saleID,
+			"gym_id": gymID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Sale recorded successfully", sale)
+}
+
+// List the sales of a gym, by default today's
+func (app *App) getGymSales(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from := time.Now()
+	to := from
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		to = from
+	}
+	if toStr := r.URL.Query().Get("to"); toStr != "" {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	if to.Before(from) {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return
+	}
+
+	clientID := 0
+	if clientIDStr := r.URL.Query().Get("client_id"); clientIDStr != "" {
+		clientID, err = strconv.Atoi(clientIDStr)
+		if err != nil || clientID <= 0 {
+			sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(saleQuery+` WHERE s.gym_id = $1
+	                                        AND s.sold_on::date BETWEEN $2 AND $3
+	                                        AND ($4 = 0 OR s.client_id = $4)
+	                                      ORDER BY s.sold_on DESC, s.id DESC`,
+		gymID, from.Format("2006-01-02"), to.Format("2006-01-02"), clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch sales: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var sales []Sale
+	for rows.Next() {
+		var sale Sale
+		if err := scanSale(rows, &sale); err != nil {
+			sendErrorResponse(w, "Failed to scan sale: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sales = append(sales, sale)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no sales found, return empty array instead of null
+	if sales == nil {
+		sales = []Sale{}
+	}
+
+	sendSuccessResponse(w, "Sales retrieved successfully", sales)
+}
+
+// Get a sale with its lines
+func (app *App) getGymSaleByID(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	saleID, err := strconv.Atoi(vars["sale_id"])
+	if err != nil || saleID <= 0 {
+		sendErrorResponse(w, "Invalid sale_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	sale, err := app.loadSale(saleID)
+	if err == sql.ErrNoRows || (err == nil && sale.GymID != gymID) {
+		sendErrorResponse(w, "Sale not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch sale: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Sale retrieved successfully", sale)
+}
+
+// loadSale reads a sale with its lines; the caller checks access to its gym
+func (app *App) loadSale(saleID int) (*Sale, error) {
+	var sale Sale
+	if err := scanSale(app.DB.QueryRow(saleQuery+" WHERE s.id = $1", saleID), &sale); err != nil {
+		return nil, err
+	}
+
+	rows, err := app.DB.Query(`SELECT id, product_id, description, quantity, unit_price, vat_rate,
+	                                  net_amount, vat_amount, total_amount
+	                           FROM sale_lines
+	                           WHERE sale_id = $1
+	                           ORDER BY id`, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sale.Lines = []SaleLine{}
+	for rows.Next() {
+		var line SaleLine
+		err := rows.Scan(&line.ID, &line.ProductID, &line.Description, &line.Quantity, &line.UnitPrice,
+			&line.VATRate, &line.NetAmount, &line.VATAmount, &line.TotalAmount)
+		if err != nil {
+			return nil, err
+		}
+		sale.Lines = append(sale.Lines, line)
+	}
+
+	return &sale, rows.Err()
+}
+
+// validateSale checks the request and fills in the defaults
+func validateSale(req *CreateSaleRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	if req.ClientID < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "client_id", Message: "client_id must be positive"})
+	}
+	if req.PaymentMethod != "cash" && req.PaymentMethod != "card" {
+		fieldErrs = append(fieldErrs, FieldError{Field: "payment_method", Message: "payment method must be cash or card"})
+	}
+
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	if req.Currency == "" {
+		req.Currency = "RON"
+	}
+	if len(req.Currency) != 3 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "currency", Message: "currency must be a 3-letter ISO code"})
+	}
+
+	if len(req.Lines) == 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "lines", Message: "a sale needs at least one line"})
+	}
+	for i, line := range req.Lines {
+		if line.ProductID <= 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: fmt.Sprintf("lines[%d].product_id", i), Message: "Valid product_id is required"})
+		}
+		if line.Quantity <= 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: fmt.Sprintf("lines[%d].quantity", i), Message: "quantity must be positive"})
+		}
+	}
+
+	return fieldErrs
+}
@@ -14,14 +14,17 @@ import (
 type App struct {
 	DB       *sql.DB
 	Config   *Config
+	Notifier *NotificationService
+	Blobs    BlobStore
 	limiters map[string]*rate.Limiter
 	mu       sync.RWMutex
 }
 
 type Response struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Message string       `json:"message"`
+	Data    interface{}  `json:"data,omitempty"`
+	Error   string       `json:"error,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"`
 }
 
 // Rate limiter configuration
@@ -60,6 +63,18 @@ func RunServer() {
 		log.Fatal("Failed to ping database:", err)
 	}
 
+	app.Blobs, err = newBlobStore(config)
+	if err != nil {
+		log.Fatal("Failed to initialize blob store:", err)
+	}
+
+	// Deliver queued notifications in the background
+	app.Notifier = newNotificationService(app.DB, config)
+	app.startNotificationWorker()
+
+	// Expire finished memberships, queue renewal reminders and renew auto-renew memberships in the background
+	app.startMembershipJobs()
+
 	r := mux.NewRouter()
 
 	// Apply middleware in order (security first, then rate limiting, then logging)
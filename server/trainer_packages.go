@@ -0,0 +1,422 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// TrainerPackage is a bundle of personal training sessions sold to clients
+type TrainerPackage struct {
+	ID             int     `json:"id"`
+	Name           string  `json:"name"`
+	SessionsNo     int     `json:"sessions_no"`
+	SessionMinutes int     `json:"session_minutes"`
+	ValidityDays   int     `json:"validity_days"`
+	Price          float64 `json:"price"` // gross, VAT included
+	Currency       string  `json:"currency"`
+	IsActive       bool    `json:"is_active"`
+}
+
+type TrainerPackageRequest struct {
+	Name           string  `json:"name"`
+	SessionsNo     int     `json:"sessions_no"`
+	SessionMinutes int     `json:"session_minutes,omitempty"` // defaults to 60
+	ValidityDays   int     `json:"validity_days"`
+	Price          float64 `json:"price"`
+	Currency       string  `json:"currency,omitempty"` // defaults to RON
+	IsActive       *bool   `json:"is_active,omitempty"`
+}
+
+// ClientTrainerPackage is a package bought by a client, with the sessions left to book
+type ClientTrainerPackage struct {
+	ID                int     `json:"id"`
+	ClientID          int     `json:"client_id"`
+	TrainerPackageID  int     `json:"trainer_package_id"`
+	PackageName       string  `json:"package_name"`
+	TrainerID         *int    `json:"trainer_id"` // null for any trainer
+	TrainerName       string  `json:"trainer_name,omitempty"`
+	SessionsTotal     int     `json:"sessions_total"`
+	SessionsRemaining int     `json:"sessions_remaining"`
+	SessionsCompleted int     `json:"sessions_completed"`
+	SessionMinutes    int     `json:"session_minutes"`
+	Price             float64 `json:"price"`
+	Currency          string  `json:"currency"`
+	PurchasedOn       string  `json:"purchased_on"`
+	ValidUntil        string  `json:"valid_until"`
+	Status            string  `json:"status"` // active, used_up or expired
+}
+
+type SellTrainerPackageRequest struct {
+	TrainerPackageID int `json:"trainer_package_id"`
+	TrainerID        int `json:"trainer_id,omitempty"` // ties the sessions to one trainer
+}
+
+const trainerPackageQuery = `SELECT id, name, sessions_no, COALESCE(session_minutes, 60), validity_days,
+                                    price, COALESCE(currency, 'RON'), COALESCE(is_active, false)
+                             FROM trainer_packages`
+
+func scanTrainerPackage(scanner interface{ Scan(...interface{}) error }, p *TrainerPackage) error {
+	return scanner.Scan(&p.ID, &p.Name, &p.SessionsNo, &p.SessionMinutes, &p.ValidityDays, &p.Price, &p.Currency,
+		&p.IsActive)
+}
+
+const clientTrainerPackageQuery = `SELECT cp.id, cp.client_id, cp.trainer_package_id, COALESCE(tp.name, ''),
+                                          cp.trainer_id, COALESCE(u.full_name, ''), cp.sessions_total,
+                                          cp.sessions_remaining,
+                                          (SELECT COUNT(*) FROM trainer_appointments ta
+                                           WHERE ta.client_trainer_package_id = cp.id AND ta.status = 'completed'),
+                                          cp.session_minutes, COALESCE(cp.price, 0), COALESCE(cp.currency, 'RON'),
+                                          TO_CHAR(cp.purchased_on, 'YYYY-MM-DD'), TO_CHAR(cp.valid_until, 'YYYY-MM-DD'),
+                                          CASE WHEN cp.valid_until < CURRENT_DATE THEN 'expired'
+                                               WHEN cp.sessions_remaining = 0 THEN 'used_up'
+                                               ELSE 'active' END
+                                   FROM client_trainer_packages cp
+                                   LEFT JOIN trainer_packages tp ON tp.id = cp.trainer_package_id
+                                   LEFT JOIN users u ON u.id = cp.trainer_id`
+
+func scanClientTrainerPackage(scanner interface{ Scan(...interface{}) error }, p *ClientTrainerPackage) error {
+	return scanner.Scan(&p.ID, &p.ClientID, &p.TrainerPackageID, &p.PackageName, &p.TrainerID, &p.TrainerName,
+		&p.SessionsTotal, &p.SessionsRemaining, &p.SessionsCompleted, &p.SessionMinutes, &p.Price, &p.Currency,
+		&p.PurchasedOn, &p.ValidUntil, &p.Status)
+}
+
+// List the personal training packages on sale
+func (app *App) getTrainerPackages(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+
+	rows, err := app.DB.Query(trainerPackageQuery+` WHERE ($1 = false OR is_active) ORDER BY sessions_no, name`, activeOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch trainer packages: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var packages []TrainerPackage
+	for rows.Next() {
+		var p TrainerPackage
+		if err := scanTrainerPackage(rows, &p); err != nil {
+			sendErrorResponse(w, "Failed to scan trainer package: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		packages = append(packages, p)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no packages found, return empty array instead of null
+	if packages == nil {
+		packages = []TrainerPackage{}
+	}
+
+	sendSuccessResponse(w, "Trainer packages retrieved successfully", packages)
+}
+
+// Add a personal training package
+func (app *App) createTrainerPackage(w http.ResponseWriter, r *http.Request) {
+	app.saveTrainerPackage(w, r, 0)
+}
+
+// Update a personal training package; packages already sold are not changed
+func (app *App) updateTrainerPackage(w http.ResponseWriter, r *http.Request) {
+	packageID, err := strconv.Atoi(mux.Vars(r)["package_id"])
+	if err != nil || packageID <= 0 {
+		sendErrorResponse(w, "Invalid package_id parameter", http.StatusBadRequest)
+		return
+	}
+	app.saveTrainerPackage(w, r, packageID)
+}
+
+// saveTrainerPackage creates a package, or updates packageID when it is not 0
+func (app *App) saveTrainerPackage(w http.ResponseWriter, r *http.Request, packageID int) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req TrainerPackageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.SessionMinutes == 0 {
+		req.SessionMinutes = 60
+	}
+	if req.Currency == "" {
+		req.Currency = "RON"
+	}
+	var fieldErrs ValidationErrors
+	if req.Name == "" || len(req.Name) > 64 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "name", Message: "name must have between 1 and 64 characters"})
+	}
+	if req.SessionsNo <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "sessions_no", Message: "sessions_no must be positive"})
+	}
+	if req.SessionMinutes < 15 || req.SessionMinutes > 240 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "session_minutes", Message: "session_minutes must be between 15 and 240"})
+	}
+	if req.ValidityDays <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "validity_days", Message: "validity_days must be positive"})
+	}
+	if req.Price < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "price", Message: "price cannot be negative"})
+	}
+	if len(req.Currency) != 3 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "currency", Message: "currency must be a 3 letter code"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+
+	// Packages are managed by users working at a gym
+	var exists bool
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1)`, claims.UserID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	message := "Trainer package updated successfully"
+	if packageID == 0 {
+		message = "Trainer package created successfully"
+		err = app.DB.QueryRow(`INSERT INTO trainer_packages (name, sessions_no, session_minutes, validity_days, price,
+		                                                     currency, is_active, created_by)
+		                       VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		                       RETURNING id`,
+			req.Name, req.SessionsNo, req.SessionMinutes, req.ValidityDays, req.Price, strings.ToUpper(req.Currency),
+			*req.IsActive, claims.UserID).Scan(&packageID)
+	} else {
+		var result sql.Result
+		result, err = app.DB.Exec(`UPDATE trainer_packages
+		                           SET name = $1, sessions_no = $2, session_minutes = $3, validity_days = $4,
+		                               price = $5, currency = $6, is_active = $7
+		                           WHERE id = $8`,
+			req.Name, req.SessionsNo, req.SessionMinutes, req.ValidityDays, req.Price, strings.ToUpper(req.Currency),
+			*req.IsActive, packageID)
+		if err == nil {
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				sendErrorResponse(w, "Trainer package not found", http.StatusNotFound)
+				return
+			}
+		}
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to save trainer package: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var p TrainerPackage
+	if err := scanTrainerPackage(app.DB.QueryRow(trainerPackageQuery+" WHERE id = $1", packageID), &p); err != nil {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     packageID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, p)
+}
+
+// Sell a personal training package to a client
+func (app *App) sellClientTrainerPackage(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req SellTrainerPackageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.TrainerPackageID <= 0 {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "trainer_package_id", Message: "Valid trainer_package_id is required"}})
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	if req.TrainerID != 0 {
+		var exists bool
+		err = app.DB.QueryRow(trainerAccessQuery, claims.UserID, req.TrainerID).Scan(&exists)
+		if err != nil || !exists {
+			sendValidationErrorResponse(w, ValidationErrors{{Field: "trainer_id", Message: "trainer not found at your gyms"}})
+			return
+		}
+	}
+
+	// Sessions, length and price are copied so later catalog changes do not touch sold packages
+	var clientPackageID int
+	err = app.DB.QueryRow(`INSERT INTO client_trainer_packages (client_id, trainer_package_id, trainer_id, sessions_total,
+	                                                            sessions_remaining, session_minutes, price, currency,
+	                                                            valid_until, created_by)
+	                       SELECT $1, id, $2, sessions_no, sessions_no, COALESCE(session_minutes, 60), price,
+	                              COALESCE(currency, 'RON'), CURRENT_DATE + validity_days, $3
+	                       FROM trainer_packages
+	                       WHERE id = $4 AND is_active
+	                       RETURNING id`,
+		clientID, nullIfZero(req.TrainerID), claims.UserID, req.TrainerPackageID).Scan(&clientPackageID)
+	if err == sql.ErrNoRows {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "trainer_package_id", Message: "trainer package not found or inactive"}})
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to sell trainer package: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var p ClientTrainerPackage
+	if err := scanClientTrainerPackage(app.DB.QueryRow(clientTrainerPackageQuery+" WHERE cp.id = $1", clientPackageID), &p); err != nil {
+		sendSuccessResponse(w, "Trainer package sold successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     clientPackageID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Trainer package sold successfully", p)
+}
+
+// List the personal training packages of a client with their remaining sessions
+func (app *App) getClientTrainerPackages(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	activeOnly := r.URL.Query().Get("active_only") == "true"
+
+	rows, err := app.DB.Query(clientTrainerPackageQuery+` WHERE cp.client_id = $1
+	                                                       AND ($2 = false OR (cp.sessions_remaining > 0 AND cp.valid_until >= CURRENT_DATE))
+	                                                     ORDER BY cp.valid_until DESC, cp.id DESC`, clientID, activeOnly)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch trainer packages: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var packages []ClientTrainerPackage
+	for rows.Next() {
+		var p ClientTrainerPackage
+		if err := scanClientTrainerPackage(rows, &p); err != nil {
+			sendErrorResponse(w, "Failed to scan trainer package: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		packages = append(packages, p)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no packages found, return empty array instead of null
+	if packages == nil {
+		packages = []ClientTrainerPackage{}
+	}
+
+	sendSuccessResponse(w, "Trainer packages retrieved successfully", packages)
+}
@@ -0,0 +1,748 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// Trainer is a user of the gym with weekly availability there
+type Trainer struct {
+	ID            int    `json:"id"`
+	FullName      string `json:"full_name"`
+	Email         string `json:"email,omitempty"`
+	WeeklyMinutes int    `json:"weekly_minutes"` // availability at the gym in a week
+}
+
+// TrainerAvailability is a weekly slot a trainer takes appointments in at a gym
+type TrainerAvailability struct {
+	ID          int    `json:"id"`
+	TrainerID   int    `json:"trainer_id"`
+	TrainerName string `json:"trainer_name"`
+	GymID       int    `json:"gym_id"`
+	GymName     string `json:"gym_name"`
+	Weekday     int    `json:"weekday"`    // ISO weekday, 1 = Monday
+	StartTime   string `json:"start_time"` // HH:MM, gym local time
+	EndTime     string `json:"end_time"`
+	ValidFrom   string `json:"valid_from"`
+	ValidTo     string `json:"valid_to,omitempty"`
+}
+
+type CreateTrainerAvailabilityRequest struct {
+	GymID     int    `json:"gym_id"`
+	Weekday   int    `json:"weekday"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	ValidFrom string `json:"valid_from,omitempty"` // defaults to today
+	ValidTo   string `json:"valid_to,omitempty"`
+}
+
+type TrainerTimeOff struct {
+	ID        int    `json:"id"`
+	TrainerID int    `json:"trainer_id"`
+	StartsAt  string `json:"starts_at"`
+	EndsAt    string `json:"ends_at"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type CreateTrainerTimeOffRequest struct {
+	StartsAt string `json:"starts_at"` // YYYY-MM-DD HH:MM
+	EndsAt   string `json:"ends_at"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// appointmentTimeLayout is the format appointment and time off times are sent in
+const appointmentTimeLayout = "2006-01-02 15:04"
+
+const trainerAvailabilityQuery = `SELECT a.id, a.trainer_id, COALESCE(u.full_name, ''), a.gym_id, COALESCE(g.name, ''),
+                                         a.weekday, TO_CHAR(a.start_time, 'HH24:MI'), TO_CHAR(a.end_time, 'HH24:MI'),
+                                         TO_CHAR(a.valid_from, 'YYYY-MM-DD'), COALESCE(TO_CHAR(a.valid_to, 'YYYY-MM-DD'), '')
+                                  FROM trainer_availability a
+                                  LEFT JOIN users u ON u.id = a.trainer_id
+                                  LEFT JOIN gyms g ON g.id = a.gym_id`
+
+func scanTrainerAvailability(scanner interface{ Scan(...interface{}) error }, a *TrainerAvailability) error {
+	return scanner.Scan(&a.ID, &a.TrainerID, &a.TrainerName, &a.GymID, &a.GymName, &a.Weekday, &a.StartTime,
+		&a.EndTime, &a.ValidFrom, &a.ValidTo)
+}
+
+// trainerAccessQuery checks that the user ($1) works at one of the trainer's ($2) gyms
+const trainerAccessQuery = `SELECT EXISTS(SELECT 1 FROM user_gyms ug
+                                          INNER JOIN user_gyms t ON t.gym_id = ug.gym_id
+                                          WHERE ug.user_id = $1 AND t.user_id = $2)`
+
+// List the trainers of a gym: its users with availability there
+func (app *App) getGymTrainers(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	gymID, err := strconv.Atoi(vars["gym_id"])
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(`SELECT u.id, COALESCE(u.full_name, ''), COALESCE(u.email, ''),
+	                                  SUM(EXTRACT(EPOCH FROM a.end_time - a.start_time) / 60)::integer
+	                           FROM trainer_availability a
+	                           INNER JOIN users u ON u.id = a.trainer_id
+	                           INNER JOIN user_gyms ug ON ug.user_id = a.trainer_id AND ug.gym_id = a.gym_id
+	                           WHERE a.gym_id = $1
+	                             AND a.valid_from <= CURRENT_DATE
+	                             AND (a.valid_to IS NULL OR a.valid_to >= CURRENT_DATE)
+	                           GROUP BY u.id
+	                           ORDER BY u.full_name`, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch trainers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var trainers []Trainer
+	for rows.Next() {
+		var trainer Trainer
+		if err := rows.Scan(&trainer.ID, &trainer.FullName, &trainer.Email, &trainer.WeeklyMinutes); err != nil {
+			sendErrorResponse(w, "Failed to scan trainer: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		trainers = append(trainers, trainer)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no trainers found, return empty array instead of null
+	if trainers == nil {
+		trainers = []Trainer{}
+	}
+
+	sendSuccessResponse(w, "Trainers retrieved successfully", trainers)
+}
+
+// List the weekly availability of a trainer, at every gym or at gym_id
+func (app *App) getTrainerAvailability(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	gymID := 0
+	if gymIDStr := r.URL.Query().Get("gym_id"); gymIDStr != "" {
+		gymID, err = strconv.Atoi(gymIDStr)
+		if err != nil || gymID <= 0 {
+			sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user works with this trainer
+	var exists bool
+	err = app.DB.QueryRow(trainerAccessQuery, claims.UserID, trainerID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Trainer not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(trainerAvailabilityQuery+` WHERE a.trainer_id = $1
+	                                                       AND ($2 = 0 OR a.gym_id = $2)
+	                                                       AND (a.valid_to IS NULL OR a.valid_to >= CURRENT_DATE)
+	                                                     ORDER BY a.weekday, a.start_time`, trainerID, gymID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch availability: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var slots []TrainerAvailability
+	for rows.Next() {
+		var slot TrainerAvailability
+		if err := scanTrainerAvailability(rows, &slot); err != nil {
+			sendErrorResponse(w, "Failed to scan availability: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slots = append(slots, slot)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no availability found, return empty array instead of null
+	if slots == nil {
+		slots = []TrainerAvailability{}
+	}
+
+	sendSuccessResponse(w, "Availability retrieved successfully", slots)
+}
+
+// Add a weekly slot to a trainer's availability at a gym
+func (app *App) createTrainerAvailability(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateTrainerAvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateTrainerAvailability(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Both the user and the trainer have to work at the gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, req.GymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+	err = app.DB.QueryRow(permissionQuery, trainerID, req.GymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Trainer does not work at this gym", http.StatusBadRequest)
+		return
+	}
+
+	// A trainer cannot be in two places at once, whatever the gym
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM trainer_availability
+	                                     WHERE trainer_id = $1 AND weekday = $2
+	                                       AND start_time < $4::time AND end_time > $3::time
+	                                       AND (valid_to IS NULL OR valid_to >= $5::date)
+	                                       AND ($6::date IS NULL OR valid_from <= $6::date))`,
+		trainerID, req.Weekday, req.StartTime, req.EndTime, req.ValidFrom, nullIfEmpty(req.ValidTo)).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "start_time", Message: "slot overlaps another slot of the trainer"}})
+		return
+	}
+
+	var availabilityID int
+	err = app.DB.QueryRow(`INSERT INTO trainer_availability (trainer_id, gym_id, weekday, start_time, end_time,
+	                                                         valid_from, valid_to, created_by)
+	                       VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	                       RETURNING id`,
+		trainerID, req.GymID, req.Weekday, req.StartTime, req.EndTime, req.ValidFrom, nullIfEmpty(req.ValidTo),
+		claims.UserID).Scan(&availabilityID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to create availability: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var slot TrainerAvailability
+	if err := scanTrainerAvailability(app.DB.QueryRow(trainerAvailabilityQuery+" WHERE a.id = $1", availabilityID), &slot); err != nil {
+		sendSuccessResponse(w, "Availability created successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     availabilityID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Availability created successfully", slot)
+}
+
+// Remove a weekly slot; appointments already booked in it are kept
+func (app *App) deleteTrainerAvailability(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+	availabilityID, err := strconv.Atoi(vars["availability_id"])
+	if err != nil || availabilityID <= 0 {
+		sendErrorResponse(w, "Invalid availability_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the slot's gym
+	result, err := app.DB.Exec(`DELETE FROM trainer_availability a
+	                            WHERE a.id = $1 AND a.trainer_id = $2
+	                              AND EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $3 AND gym_id = a.gym_id)`,
+		availabilityID, trainerID, claims.UserID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to delete availability: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "Availability not found or access denied", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Availability deleted successfully", map[string]interface{}{
+		"status": "OK",
+		"id":     availabilityID,
+	})
+}
+
+// List a trainer's time off, from today by default
+func (app *App) getTrainerTimeOff(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from := time.Now()
+	if fromStr := r.URL.Query().Get("from"); fromStr != "" {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user works with this trainer
+	var exists bool
+	err = app.DB.QueryRow(trainerAccessQuery, claims.UserID, trainerID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Trainer not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(`SELECT id, trainer_id, TO_CHAR(starts_at, 'YYYY-MM-DD HH24:MI'),
+	                                  TO_CHAR(ends_at, 'YYYY-MM-DD HH24:MI'), COALESCE(reason, '')
+	                           FROM trainer_time_off
+	                           WHERE trainer_id = $1 AND ends_at >= $2::date
+	                           ORDER BY starts_at`, trainerID, from.Format("2006-01-02"))
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch time off: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var timeOff []TrainerTimeOff
+	for rows.Next() {
+		var t TrainerTimeOff
+		if err := rows.Scan(&t.ID, &t.TrainerID, &t.StartsAt, &t.EndsAt, &t.Reason); err != nil {
+			sendErrorResponse(w, "Failed to scan time off: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		timeOff = append(timeOff, t)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If no time off found, return empty array instead of null
+	if timeOff == nil {
+		timeOff = []TrainerTimeOff{}
+	}
+
+	sendSuccessResponse(w, "Time off retrieved successfully", timeOff)
+}
+
+// Block a period of a trainer's calendar; appointments booked in it are returned
+// so they can be moved or cancelled
+func (app *App) createTrainerTimeOff(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateTrainerTimeOffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	var fieldErrs ValidationErrors
+	startsAt, err := time.Parse(appointmentTimeLayout, req.StartsAt)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "starts_at", Message: "time must be in YYYY-MM-DD HH:MM format"})
+	}
+	endsAt, err := time.Parse(appointmentTimeLayout, req.EndsAt)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "ends_at", Message: "time must be in YYYY-MM-DD HH:MM format"})
+	} else if !endsAt.After(startsAt) {
+		fieldErrs = append(fieldErrs, FieldError{Field: "ends_at", Message: "ends_at must be after starts_at"})
+	}
+	if len(req.Reason) > 256 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "reason", Message: "reason cannot exceed 256 characters"})
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user works with this trainer
+	var exists bool
+	err = app.DB.QueryRow(trainerAccessQuery, claims.UserID, trainerID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Trainer not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	var timeOff TrainerTimeOff
+	err = app.DB.QueryRow(`INSERT INTO trainer_time_off (trainer_id, starts_at, ends_at, reason, created_by)
+	                       VALUES ($1, $2, $3, $4, $5)
+	                       RETURNING id, trainer_id, TO_CHAR(starts_at, 'YYYY-MM-DD HH24:MI'),
+	                                 TO_CHAR(ends_at, 'YYYY-MM-DD HH24:MI'), COALESCE(reason, '')`,
+		trainerID, req.StartsAt, req.EndsAt, nullIfEmpty(strings.TrimSpace(req.Reason)), claims.UserID).Scan(
+		&timeOff.ID, &timeOff.TrainerID, &timeOff.StartsAt, &timeOff.EndsAt, &timeOff.Reason)
+	if err != nil {
+		sendErrorResponse(w, "Failed to create time off: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := app.DB.Query(trainerAppointmentQuery+` WHERE ta.trainer_id = $1 AND ta.status = 'booked'
+	                                                      AND ta.starts_at < $3 AND ta.ends_at > $2
+	                                                    ORDER BY ta.starts_at`, trainerID, req.StartsAt, req.EndsAt)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch affected appointments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	affected := []TrainerAppointment{}
+	for rows.Next() {
+		var appointment TrainerAppointment
+		if err := scanTrainerAppointment(rows, &appointment); err != nil {
+			sendErrorResponse(w, "Failed to scan appointment: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		affected = append(affected, appointment)
+	}
+
+	sendSuccessResponse(w, "Time off created successfully", map[string]interface{}{
+		"time_off":              timeOff,
+		"affected_appointments": affected,
+	})
+}
+
+// Remove a trainer's time off
+func (app *App) deleteTrainerTimeOff(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+	timeOffID, err := strconv.Atoi(vars["time_off_id"])
+	if err != nil || timeOffID <= 0 {
+		sendErrorResponse(w, "Invalid time_off_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user works with this trainer
+	var exists bool
+	err = app.DB.QueryRow(trainerAccessQuery, claims.UserID, trainerID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Trainer not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	result, err := app.DB.Exec(`DELETE FROM trainer_time_off WHERE id = $1 AND trainer_id = $2`, timeOffID, trainerID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to delete time off: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil || rowsAffected == 0 {
+		sendErrorResponse(w, "Time off not found", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Time off deleted successfully", map[string]interface{}{
+		"status": "OK",
+		"id":     timeOffID,
+	})
+}
+
+// List the start times on a day a trainer can still take an appointment at
+func (app *App) getTrainerFreeSlots(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	trainerID, err := strconv.Atoi(vars["trainer_id"])
+	if err != nil || trainerID <= 0 {
+		sendErrorResponse(w, "Invalid trainer_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	gymID, err := strconv.Atoi(query.Get("gym_id"))
+	if err != nil || gymID <= 0 {
+		sendErrorResponse(w, "Invalid gym_id parameter", http.StatusBadRequest)
+		return
+	}
+	day := time.Now()
+	if dateStr := query.Get("date"); dateStr != "" {
+		day, err = time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			sendErrorResponse(w, "Invalid date parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+	}
+	minutes := 60
+	if minutesStr := query.Get("minutes"); minutesStr != "" {
+		minutes, err = strconv.Atoi(minutesStr)
+		if err != nil || minutes < 15 || minutes > 240 {
+			sendErrorResponse(w, "Invalid minutes parameter (15-240)", http.StatusBadRequest)
+			return
+		}
+	}
+	step := 30
+	if stepStr := query.Get("step"); stepStr != "" {
+		step, err = strconv.Atoi(stepStr)
+		if err != nil || step < 5 || step > 120 {
+			sendErrorResponse(w, "Invalid step parameter (5-120)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user has permission for this gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, gymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(`SELECT TO_CHAR(s, 'YYYY-MM-DD HH24:MI') FROM trainer_free_slots($1, $2, $3, $4, $5) s`,
+		trainerID, gymID, day.Format("2006-01-02"), minutes, step)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch free slots: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	slots := []string{}
+	for rows.Next() {
+		var slot string
+		if err := rows.Scan(&slot); err != nil {
+			sendErrorResponse(w, "Failed to scan free slot: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slots = append(slots, slot)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Free slots retrieved successfully", map[string]interface{}{
+		"trainer_id": trainerID,
+		"gym_id":     gymID,
+		"date":       day.Format("2006-01-02"),
+		"minutes":    minutes,
+		"slots":      slots,
+	})
+}
+
+// validateTrainerAvailability checks the request and fills in the defaults
+func validateTrainerAvailability(req *CreateTrainerAvailabilityRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	if req.GymID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "gym_id", Message: "Valid gym_id is required"})
+	}
+	if req.Weekday < 1 || req.Weekday > 7 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "weekday", Message: "weekday must be between 1 (Monday) and 7 (Sunday)"})
+	}
+	startTime, err := time.Parse("15:04", req.StartTime)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "start_time", Message: "time must be in HH:MM format"})
+	}
+	endTime, err := time.Parse("15:04", req.EndTime)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "end_time", Message: "time must be in HH:MM format"})
+	} else if !endTime.After(startTime) {
+		fieldErrs = append(fieldErrs, FieldError{Field: "end_time", Message: "end_time must be after start_time"})
+	}
+
+	if req.ValidFrom == "" {
+		req.ValidFrom = time.Now().Format("2006-01-02")
+	}
+	validFrom, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "valid_from", Message: "date must be in YYYY-MM-DD format"})
+	}
+	if req.ValidTo != "" {
+		validTo, err := time.Parse("2006-01-02", req.ValidTo)
+		if err != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "date must be in YYYY-MM-DD format"})
+		} else if validTo.Before(validFrom) {
+			fieldErrs = append(fieldErrs, FieldError{Field: "valid_to", Message: "valid_to cannot be before valid_from"})
+		}
+	}
+
+	return fieldErrs
+}
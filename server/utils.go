@@ -2,7 +2,9 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 )
 
 func sendSuccessResponse(w http.ResponseWriter, message string, data interface{}) {
@@ -21,3 +23,42 @@ func sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
 		Error: message,
 	})
 }
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects field-level errors. It implements error so validators
+// can return it alongside plain errors.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, fieldErr := range v {
+		messages[i] = fieldErr.Field + ": " + fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// sendValidationErrorResponse sends a 400 with one entry per rejected field
+func sendValidationErrorResponse(w http.ResponseWriter, errs ValidationErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(Response{
+		Message: "Validation failed",
+		Error:   errs.Error(),
+		Errors:  errs,
+	})
+}
+
+// sendRequestValidationError reports a validator error, keeping field-level detail when available
+func sendRequestValidationError(w http.ResponseWriter, err error) {
+	var fieldErrs ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+	sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+}
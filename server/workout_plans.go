@@ -0,0 +1,529 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	workoutPlanActive   = "active"
+	workoutPlanArchived = "archived"
+)
+
+// WorkoutPlan is a trainer's program for a client, split in workout days
+type WorkoutPlan struct {
+	ID          int                   `json:"id"`
+	ClientID    int                   `json:"client_id"`
+	ClientName  string                `json:"client_name"`
+	GymID       int                   `json:"gym_id"`
+	GymName     string                `json:"gym_name"`
+	TrainerID   *int                  `json:"trainer_id"`
+	TrainerName string                `json:"trainer_name,omitempty"`
+	Name        string                `json:"name"`
+	Goal        string                `json:"goal,omitempty"`
+	StartsOn    string                `json:"starts_on"`
+	EndsOn      string                `json:"ends_on,omitempty"`
+	Status      string                `json:"status"` // active or archived
+	CreatedOn   string                `json:"created_on"`
+	UpdatedOn   string                `json:"updated_on"`
+	Exercises   []WorkoutPlanExercise `json:"exercises"`
+}
+
+type WorkoutPlanExercise struct {
+	DayNo        int      `json:"day_no"`
+	Position     int      `json:"position"`
+	ExerciseID   int      `json:"exercise_id"`
+	ExerciseName string   `json:"exercise_name"`
+	MachineID    *int     `json:"machine_id"` // target machine, by default the exercise's machine
+	MachineName  string   `json:"machine_name,omitempty"`
+	Sets         int      `json:"sets"`
+	Reps         int      `json:"reps"`
+	TargetWeight *float64 `json:"target_weight"` // kg
+	RestSeconds  int      `json:"rest_seconds,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
+}
+
+type SaveWorkoutPlanRequest struct {
+	GymID     int                          `json:"gym_id"`
+	TrainerID int                          `json:"trainer_id,omitempty"` // defaults to the signed in user
+	Name      string                       `json:"name"`
+	Goal      string                       `json:"goal,omitempty"`
+	StartsOn  string                       `json:"starts_on,omitempty"` // defaults to today
+	EndsOn    string                       `json:"ends_on,omitempty"`
+	Status    string                       `json:"status,omitempty"` // defaults to active
+	Exercises []WorkoutPlanExerciseRequest `json:"exercises"`
+}
+
+type WorkoutPlanExerciseRequest struct {
+	DayNo        int      `json:"day_no,omitempty"` // defaults to 1
+	ExerciseID   int      `json:"exercise_id"`
+	MachineID    int      `json:"machine_id,omitempty"`
+	Sets         int      `json:"sets"`
+	Reps         int      `json:"reps"`
+	TargetWeight *float64 `json:"target_weight,omitempty"`
+	RestSeconds  int      `json:"rest_seconds,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
+}
+
+const workoutPlanQuery = `SELECT p.id, p.client_id, COALESCE(c.name, ''), p.gym_id, COALESCE(g.name, ''), p.trainer_id,
+                                 COALESCE(u.full_name, ''), p.name, COALESCE(p.goal, ''),
+                                 TO_CHAR(p.starts_on, 'YYYY-MM-DD'), COALESCE(TO_CHAR(p.ends_on, 'YYYY-MM-DD'), ''),
+                                 p.status, TO_CHAR(p.created_on, 'YYYY-MM-DD HH24:MI:SS'),
+                                 TO_CHAR(p.updated_on, 'YYYY-MM-DD HH24:MI:SS')
+                          FROM workout_plans p
+                          LEFT JOIN clients c ON c.id = p.client_id
+                          LEFT JOIN gyms g ON g.id = p.gym_id
+                          LEFT JOIN users u ON u.id = p.trainer_id`
+
+func scanWorkoutPlan(scanner interface{ Scan(...interface{}) error }, p *WorkoutPlan) error {
+	return scanner.Scan(&p.ID, &p.ClientID, &p.ClientName, &p.GymID, &p.GymName, &p.TrainerID, &p.TrainerName,
+		&p.Name, &p.Goal, &p.StartsOn, &p.EndsOn, &p.Status, &p.CreatedOn, &p.UpdatedOn)
+}
+
+// List a client's workout plans, newest first
+func (app *App) getClientWorkoutPlans(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != workoutPlanActive && status != workoutPlanArchived {
+		sendErrorResponse(w, "Invalid status parameter (active or archived)", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	plans, err := app.loadClientWorkoutPlans(clientID, 0, status)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch workout plans: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Workout plans retrieved successfully", plans)
+}
+
+// Get one of a client's workout plans with its exercises
+func (app *App) getClientWorkoutPlan(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	planID, err := strconv.Atoi(vars["plan_id"])
+	if err != nil || planID <= 0 {
+		sendErrorResponse(w, "Invalid plan_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	plans, err := app.loadClientWorkoutPlans(clientID, planID, "")
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch workout plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(plans) == 0 {
+		sendErrorResponse(w, "Workout plan not found", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Workout plan retrieved successfully", plans[0])
+}
+
+// Create a workout plan for a client
+func (app *App) createClientWorkoutPlan(w http.ResponseWriter, r *http.Request) {
+	app.saveClientWorkoutPlan(w, r, 0)
+}
+
+// Update a workout plan and replace its exercises; logged workouts are kept
+func (app *App) updateClientWorkoutPlan(w http.ResponseWriter, r *http.Request) {
+	planID, err := strconv.Atoi(mux.Vars(r)["plan_id"])
+	if err != nil || planID <= 0 {
+		sendErrorResponse(w, "Invalid plan_id parameter", http.StatusBadRequest)
+		return
+	}
+	app.saveClientWorkoutPlan(w, r, planID)
+}
+
+// saveClientWorkoutPlan creates a plan, or updates planID when it is not 0
+func (app *App) saveClientWorkoutPlan(w http.ResponseWriter, r *http.Request, planID int) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req SaveWorkoutPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.TrainerID == 0 {
+		req.TrainerID = claims.UserID
+	}
+	if fieldErrs := validateWorkoutPlan(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the client and the plan's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)
+	                      AND EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $3)
+	                      AND ($4 = 0 OR EXISTS(SELECT 1 FROM workout_plans WHERE id = $4 AND client_id = $2))`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID, req.GymID, planID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Workout plan, client or gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// The trainer has to work at the plan's gym
+	err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $2)`,
+		req.TrainerID, req.GymID).Scan(&exists)
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		sendValidationErrorResponse(w, ValidationErrors{{Field: "trainer_id", Message: "trainer does not work at this gym"}})
+		return
+	}
+
+	fieldErrs, err := app.validateWorkoutMachines(req.GymID, workoutPlanMachines(req.Exercises), "exercises")
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	message := "Workout plan updated successfully"
+	if planID == 0 {
+		message = "Workout plan created successfully"
+		err = tx.QueryRow(`INSERT INTO workout_plans (client_id, gym_id, trainer_id, name, goal, starts_on, ends_on,
+		                                              status, created_by, updated_by)
+		                   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		                   RETURNING id`,
+			clientID, req.GymID, req.TrainerID, req.Name, nullIfEmpty(req.Goal), req.StartsOn, nullIfEmpty(req.EndsOn),
+			req.Status, claims.UserID).Scan(&planID)
+	} else {
+		_, err = tx.Exec(`UPDATE workout_plans
+		                  SET gym_id = $1, trainer_id = $2, name = $3, goal = $4, starts_on = $5, ends_on = $6,
+		                      status = $7, updated_on = now(), updated_by = $8
+		                  WHERE id = $9`,
+			req.GymID, req.TrainerID, req.Name, nullIfEmpty(req.Goal), req.StartsOn, nullIfEmpty(req.EndsOn),
+			req.Status, claims.UserID, planID)
+		if err == nil {
+			_, err = tx.Exec(`DELETE FROM workout_plan_exercises WHERE plan_id = $1`, planID)
+		}
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to save workout plan: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Exercises keep the order they were sent in within their day
+	positions := make(map[int]int)
+	for _, exercise := range req.Exercises {
+		positions[exercise.DayNo]++
+		_, err = tx.Exec(`INSERT INTO workout_plan_exercises (plan_id, day_no, position, exercise_id, machine_id, sets,
+		                                                      reps, target_weight, rest_seconds, notes)
+		                  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			planID, exercise.DayNo, positions[exercise.DayNo], exercise.ExerciseID, nullIfZero(exercise.MachineID),
+			exercise.Sets, exercise.Reps, exercise.TargetWeight, nullIfZero(exercise.RestSeconds),
+			nullIfEmpty(exercise.Notes))
+		if err != nil {
+			sendErrorResponse(w, "Failed to save plan exercises: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	plans, err := app.loadClientWorkoutPlans(clientID, planID, "")
+	if err != nil || len(plans) == 0 {
+		sendSuccessResponse(w, message, map[string]interface{}{
+			"status": "OK",
+			"id":     planID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, message, plans[0])
+}
+
+// loadClientWorkoutPlans reads the plans of a client, or only planID, with their exercises
+func (app *App) loadClientWorkoutPlans(clientID, planID int, status string) ([]WorkoutPlan, error) {
+	rows, err := app.DB.Query(workoutPlanQuery+` WHERE p.client_id = $1 AND ($2 = 0 OR p.id = $2)
+	                                              AND ($3 = '' OR p.status = $3)
+	                                            ORDER BY p.status, p.starts_on DESC, p.id DESC`, clientID, planID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []WorkoutPlan{}
+	byID := make(map[int]int)
+	for rows.Next() {
+		var plan WorkoutPlan
+		if err := scanWorkoutPlan(rows, &plan); err != nil {
+			return nil, err
+		}
+		plan.Exercises = []WorkoutPlanExercise{}
+		byID[plan.ID] = len(plans)
+		plans = append(plans, plan)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	exerciseRows, err := app.DB.Query(`SELECT pe.plan_id, pe.day_no, pe.position, pe.exercise_id, COALESCE(e.name, ''),
+	                                          COALESCE(pe.machine_id, e.machine_id), COALESCE(m.name, ''),
+	                                          pe.sets, pe.reps, pe.target_weight, COALESCE(pe.rest_seconds, 0),
+	                                          COALESCE(pe.notes, '')
+	                                   FROM workout_plan_exercises pe
+	                                   INNER JOIN workout_plans p ON p.id = pe.plan_id
+	                                   LEFT JOIN exercises e ON e.id = pe.exercise_id
+	                                   LEFT JOIN machines m ON m.id = COALESCE(pe.machine_id, e.machine_id)
+	                                   WHERE p.client_id = $1 AND ($2 = 0 OR p.id = $2)
+	                                   ORDER BY pe.day_no, pe.position`, clientID, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer exerciseRows.Close()
+
+	for exerciseRows.Next() {
+		var id int
+		var e WorkoutPlanExercise
+		if err := exerciseRows.Scan(&id, &e.DayNo, &e.Position, &e.ExerciseID, &e.ExerciseName, &e.MachineID,
+			&e.MachineName, &e.Sets, &e.Reps, &e.TargetWeight, &e.RestSeconds, &e.Notes); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[id]; ok {
+			plans[i].Exercises = append(plans[i].Exercises, e)
+		}
+	}
+
+	return plans, exerciseRows.Err()
+}
+
+// workoutMachine is an exercise and the machine it is done on, as sent in a request
+type workoutMachine struct {
+	exerciseID int
+	machineID  int
+}
+
+func workoutPlanMachines(exercises []WorkoutPlanExerciseRequest) []workoutMachine {
+	machines := make([]workoutMachine, len(exercises))
+	for i, exercise := range exercises {
+		machines[i] = workoutMachine{exercise.ExerciseID, exercise.MachineID}
+	}
+	return machines
+}
+
+// validateWorkoutMachines checks that the exercises exist and that the machines
+// picked for them are at the gym; field names are prefix[i]
+func (app *App) validateWorkoutMachines(gymID int, machines []workoutMachine, prefix string) (ValidationErrors, error) {
+	var fieldErrs ValidationErrors
+	for i, m := range machines {
+		field := prefix + "[" + strconv.Itoa(i) + "]"
+
+		var exists bool
+		err := app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM exercises WHERE id = $1)`, m.exerciseID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".exercise_id", Message: "exercise not found"})
+			continue
+		}
+
+		if m.machineID == 0 {
+			continue
+		}
+		err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM gym_machines WHERE gym_id = $1 AND machine_id = $2)`,
+			gymID, m.machineID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".machine_id", Message: "machine is not available at this gym"})
+		}
+	}
+	return fieldErrs, nil
+}
+
+// validateWorkoutPlan checks the request and fills in the defaults
+func validateWorkoutPlan(req *SaveWorkoutPlanRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	if req.GymID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "gym_id", Message: "Valid gym_id is required"})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 128 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "name", Message: "name must have between 1 and 128 characters"})
+	}
+	req.Goal = strings.TrimSpace(req.Goal)
+	if len(req.Goal) > 512 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "goal", Message: "goal cannot exceed 512 characters"})
+	}
+
+	if req.StartsOn == "" {
+		req.StartsOn = time.Now().Format("2006-01-02")
+	}
+	startsOn, err := time.Parse("2006-01-02", req.StartsOn)
+	if err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "starts_on", Message: "date must be in YYYY-MM-DD format"})
+	}
+	if req.EndsOn != "" {
+		endsOn, endErr := time.Parse("2006-01-02", req.EndsOn)
+		if endErr != nil {
+			fieldErrs = append(fieldErrs, FieldError{Field: "ends_on", Message: "date must be in YYYY-MM-DD format"})
+		} else if err == nil && endsOn.Before(startsOn) {
+			fieldErrs = append(fieldErrs, FieldError{Field: "ends_on", Message: "ends_on cannot be before starts_on"})
+		}
+	}
+
+	if req.Status == "" {
+		req.Status = workoutPlanActive
+	}
+	if req.Status != workoutPlanActive && req.Status != workoutPlanArchived {
+		fieldErrs = append(fieldErrs, FieldError{Field: "status", Message: "status must be active or archived"})
+	}
+
+	if len(req.Exercises) == 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "exercises", Message: "a plan needs at least one exercise"})
+	}
+	for i := range req.Exercises {
+		exercise := &req.Exercises[i]
+		field := "exercises[" + strconv.Itoa(i) + "]"
+		if exercise.DayNo == 0 {
+			exercise.DayNo = 1
+		}
+		if exercise.DayNo < 1 || exercise.DayNo > 7 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".day_no", Message: "day_no must be between 1 and 7"})
+		}
+		if exercise.ExerciseID <= 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".exercise_id", Message: "Valid exercise_id is required"})
+		}
+		if exercise.MachineID < 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".machine_id", Message: "invalid machine_id"})
+		}
+		if exercise.Sets < 1 || exercise.Sets > 20 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".sets", Message: "sets must be between 1 and 20"})
+		}
+		if exercise.Reps < 1 || exercise.Reps > 100 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".reps", Message: "reps must be between 1 and 100"})
+		}
+		if exercise.TargetWeight != nil && (*exercise.TargetWeight < 0 || *exercise.TargetWeight > 1000) {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".target_weight", Message: "target_weight must be between 0 and 1000 kg"})
+		}
+		if exercise.RestSeconds < 0 || exercise.RestSeconds > 900 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".rest_seconds", Message: "rest_seconds must be between 0 and 900"})
+		}
+		exercise.Notes = strings.TrimSpace(exercise.Notes)
+		if len(exercise.Notes) > 256 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".notes", Message: "notes cannot exceed 256 characters"})
+		}
+	}
+
+	return fieldErrs
+}
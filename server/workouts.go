@@ -0,0 +1,767 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+// WorkoutLog is a workout the client completed, set by set
+type WorkoutLog struct {
+	ID              int          `json:"id"`
+	ClientID        int          `json:"client_id"`
+	GymID           int          `json:"gym_id"`
+	GymName         string       `json:"gym_name"`
+	PlanID          *int         `json:"plan_id"`
+	PlanName        string       `json:"plan_name,omitempty"`
+	DayNo           *int         `json:"day_no,omitempty"`
+	PerformedOn     string       `json:"performed_on"`
+	DurationMinutes *int         `json:"duration_minutes,omitempty"`
+	Notes           string       `json:"notes,omitempty"`
+	CreatedOn       string       `json:"created_on"`
+	CreatedBy       *int         `json:"created_by"`
+	CreatedByName   string       `json:"created_by_name,omitempty"`
+	Sets            []WorkoutSet `json:"sets"`
+}
+
+type WorkoutSet struct {
+	ExerciseID      int      `json:"exercise_id"`
+	ExerciseName    string   `json:"exercise_name"`
+	MachineID       *int     `json:"machine_id"`
+	MachineName     string   `json:"machine_name,omitempty"`
+	SetNo           int      `json:"set_no"`
+	Reps            *int     `json:"reps"`
+	Weight          *float64 `json:"weight"` // kg
+	DurationSeconds *int     `json:"duration_seconds,omitempty"`
+	Notes           string   `json:"notes,omitempty"`
+}
+
+type LogWorkoutRequest struct {
+	GymID           int                 `json:"gym_id"`
+	PlanID          int                 `json:"plan_id,omitempty"`
+	DayNo           int                 `json:"day_no,omitempty"`
+	PerformedOn     string              `json:"performed_on,omitempty"` // defaults to today
+	DurationMinutes int                 `json:"duration_minutes,omitempty"`
+	Notes           string              `json:"notes,omitempty"`
+	Sets            []WorkoutSetRequest `json:"sets"`
+}
+
+type WorkoutSetRequest struct {
+	ExerciseID      int      `json:"exercise_id"`
+	MachineID       int      `json:"machine_id,omitempty"` // defaults to the plan's, then the exercise's machine
+	Reps            int      `json:"reps,omitempty"`
+	Weight          *float64 `json:"weight,omitempty"`
+	DurationSeconds int      `json:"duration_seconds,omitempty"`
+	Notes           string   `json:"notes,omitempty"`
+}
+
+// ExerciseProgress sums up what a client has logged for an exercise
+type ExerciseProgress struct {
+	ExerciseID       int      `json:"exercise_id"`
+	ExerciseName     string   `json:"exercise_name"`
+	MuscleGroup      string   `json:"muscle_group,omitempty"`
+	Workouts         int      `json:"workouts"`
+	FirstOn          string   `json:"first_on"`
+	LastOn           string   `json:"last_on"`
+	BestWeight       *float64 `json:"best_weight"`
+	LastWeight       *float64 `json:"last_weight"`
+	BestEstimated1RM *float64 `json:"best_estimated_1rm"`
+	TotalVolume      float64  `json:"total_volume"` // kg lifted: reps x weight
+	LastVolume       float64  `json:"last_volume"`
+	ChangeSinceFirst *float64 `json:"change_since_first,omitempty"` // best weight of the last workout minus the first's
+	LastMachineName  string   `json:"last_machine_name,omitempty"`
+	LastWorkoutID    int      `json:"last_workout_id"`
+}
+
+// ExerciseHistoryEntry is one workout of an exercise's progress history
+type ExerciseHistoryEntry struct {
+	WorkoutID       int      `json:"workout_id"`
+	PerformedOn     string   `json:"performed_on"`
+	Machines        string   `json:"machines,omitempty"`
+	Sets            int      `json:"sets"`
+	Reps            int      `json:"reps"`
+	MaxWeight       *float64 `json:"max_weight"`
+	Volume          float64  `json:"volume"`
+	Estimated1RM    *float64 `json:"estimated_1rm"`
+	DurationSeconds int      `json:"duration_seconds,omitempty"`
+}
+
+const workoutLogQuery = `SELECT l.id, l.client_id, l.gym_id, COALESCE(g.name, ''), l.plan_id, COALESCE(p.name, ''),
+                                l.day_no, TO_CHAR(l.performed_on, 'YYYY-MM-DD'), l.duration_minutes,
+                                COALESCE(l.notes, ''), TO_CHAR(l.created_on, 'YYYY-MM-DD HH24:MI:SS'), l.created_by,
+                                COALESCE(u.full_name, '')
+                         FROM workout_logs l
+                         LEFT JOIN gyms g ON g.id = l.gym_id
+                         LEFT JOIN workout_plans p ON p.id = l.plan_id
+                         LEFT JOIN users u ON u.id = l.created_by`
+
+func scanWorkoutLog(scanner interface{ Scan(...interface{}) error }, l *WorkoutLog) error {
+	return scanner.Scan(&l.ID, &l.ClientID, &l.GymID, &l.GymName, &l.PlanID, &l.PlanName, &l.DayNo, &l.PerformedOn,
+		&l.DurationMinutes, &l.Notes, &l.CreatedOn, &l.CreatedBy, &l.CreatedByName)
+}
+
+// estimated1RMExpression is the Epley estimate of the one repetition maximum of a set
+const estimated1RMExpression = `s.weight * (1 + s.reps / 30.0)`
+
+// List a client's logged workouts, newest first
+func (app *App) getClientWorkouts(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseWorkoutPeriod(w, r)
+	if !ok {
+		return
+	}
+	planID := 0
+	if planIDStr := r.URL.Query().Get("plan_id"); planIDStr != "" {
+		planID, err = strconv.Atoi(planIDStr)
+		if err != nil || planID <= 0 {
+			sendErrorResponse(w, "Invalid plan_id parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	workouts, err := app.loadClientWorkouts(clientID, 0, from, to, planID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch workouts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Workouts retrieved successfully", workouts)
+}
+
+// Get one of a client's logged workouts with its sets
+func (app *App) getClientWorkout(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	workoutID, err := strconv.Atoi(vars["workout_id"])
+	if err != nil || workoutID <= 0 {
+		sendErrorResponse(w, "Invalid workout_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	workouts, err := app.loadClientWorkouts(clientID, workoutID, "", "", 0)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch workout: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(workouts) == 0 {
+		sendErrorResponse(w, "Workout not found", http.StatusNotFound)
+		return
+	}
+
+	sendSuccessResponse(w, "Workout retrieved successfully", workouts[0])
+}
+
+// Log a completed workout for a client
+func (app *App) createClientWorkout(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	var req LogWorkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if fieldErrs := validateWorkoutLog(&req); len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	// Check if user has permission for the client and the gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)
+	                      AND EXISTS(SELECT 1 FROM user_gyms WHERE user_id = $1 AND gym_id = $3)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID, req.GymID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Client or gym not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	if req.PlanID != 0 {
+		err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM workout_plans WHERE id = $1 AND client_id = $2)`,
+			req.PlanID, clientID).Scan(&exists)
+		if err != nil {
+			sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			sendValidationErrorResponse(w, ValidationErrors{{Field: "plan_id", Message: "workout plan not found for this client"}})
+			return
+		}
+	}
+
+	machines := make([]workoutMachine, len(req.Sets))
+	for i, set := range req.Sets {
+		machines[i] = workoutMachine{set.ExerciseID, set.MachineID}
+	}
+	fieldErrs, err := app.validateWorkoutMachines(req.GymID, machines, "sets")
+	if err != nil {
+		sendErrorResponse(w, "Database error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrs) > 0 {
+		sendValidationErrorResponse(w, fieldErrs)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var workoutID int
+	err = tx.QueryRow(`INSERT INTO workout_logs (client_id, gym_id, plan_id, day_no, performed_on, duration_minutes,
+	                                             notes, created_by)
+	                   VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	                   RETURNING id`,
+		clientID, req.GymID, nullIfZero(req.PlanID), nullIfZero(req.DayNo), req.PerformedOn,
+		nullIfZero(req.DurationMinutes), nullIfEmpty(req.Notes), claims.UserID).Scan(&workoutID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to log workout: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Sets are numbered per exercise in the order they were sent; without a machine
+	// the set is on the one the plan targets, or else the exercise's usual machine
+	setNumbers := make(map[int]int)
+	for _, set := range req.Sets {
+		setNumbers[set.ExerciseID]++
+		_, err = tx.Exec(`INSERT INTO workout_log_sets (log_id, exercise_id, machine_id, set_no, reps, weight,
+		                                                duration_seconds, notes)
+		                  VALUES ($1, $2,
+		                          COALESCE($3, (SELECT pe.machine_id FROM workout_plan_exercises pe
+		                                        WHERE pe.plan_id = $9 AND pe.exercise_id = $2
+		                                        ORDER BY pe.day_no = $10 DESC, pe.day_no
+		                                        LIMIT 1),
+		                                   (SELECT e.machine_id FROM exercises e WHERE e.id = $2)),
+		                          $4, $5, $6, $7, $8)`,
+			workoutID, set.ExerciseID, nullIfZero(set.MachineID), setNumbers[set.ExerciseID], nullIfZero(set.Reps),
+			set.Weight, nullIfZero(set.DurationSeconds), nullIfEmpty(set.Notes), req.PlanID, req.DayNo)
+		if err != nil {
+			sendErrorResponse(w, "Failed to log workout sets: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	workouts, err := app.loadClientWorkouts(clientID, workoutID, "", "", 0)
+	if err != nil || len(workouts) == 0 {
+		sendSuccessResponse(w, "Workout logged successfully", map[string]interface{}{
+			"status": "OK",
+			"id":     workoutID,
+		})
+		return
+	}
+
+	sendSuccessResponse(w, "Workout logged successfully", workouts[0])
+}
+
+// Delete a workout logged by mistake
+func (app *App) deleteClientWorkout(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	workoutID, err := strconv.Atoi(vars["workout_id"])
+	if err != nil || workoutID <= 0 {
+		sendErrorResponse(w, "Invalid workout_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for the client and the workout's gym
+	var exists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)
+	                      AND EXISTS(SELECT 1 FROM workout_logs l
+	                                 INNER JOIN user_gyms ug ON ug.gym_id = l.gym_id
+	                                 WHERE ug.user_id = $1 AND l.id = $3 AND l.client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID, workoutID).Scan(&exists)
+	if err != nil || !exists {
+		sendErrorResponse(w, "Workout not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	tx, err := app.DB.Begin()
+	if err != nil {
+		sendErrorResponse(w, "Failed to start transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(`DELETE FROM workout_log_sets WHERE log_id = $1`, workoutID)
+	if err == nil {
+		_, err = tx.Exec(`DELETE FROM workout_logs WHERE id = $1`, workoutID)
+	}
+	if err != nil {
+		sendErrorResponse(w, "Failed to delete workout: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		sendErrorResponse(w, "Failed to commit transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sendSuccessResponse(w, "Workout deleted successfully", map[string]interface{}{
+		"status": "OK",
+		"id":     workoutID,
+	})
+}
+
+// Sum up a client's progress on every exercise they logged
+func (app *App) getClientExerciseProgress(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	// One row per exercise and workout first, then the first and last workouts of each exercise
+	rows, err := app.DB.Query(`WITH per_workout AS (
+	                               SELECT s.exercise_id, l.id AS log_id, l.performed_on,
+	                                      MAX(s.weight) AS max_weight,
+	                                      COALESCE(SUM(s.reps * s.weight), 0) AS volume,
+	                                      MAX(`+estimated1RMExpression+`) AS estimated_1rm,
+	                                      (array_agg(m.name ORDER BY s.set_no DESC) FILTER (WHERE m.name IS NOT NULL))[1] AS machine_name,
+	                                      ROW_NUMBER() OVER (PARTITION BY s.exercise_id ORDER BY l.performed_on, l.id) AS first_rank,
+	                                      ROW_NUMBER() OVER (PARTITION BY s.exercise_id ORDER BY l.performed_on DESC, l.id DESC) AS last_rank
+	                               FROM workout_log_sets s
+	                               INNER JOIN workout_logs l ON l.id = s.log_id
+	                               LEFT JOIN machines m ON m.id = s.machine_id
+	                               WHERE l.client_id = $1
+	                               GROUP BY s.exercise_id, l.id, l.performed_on
+	                           )
+	                           SELECT w.exercise_id, COALESCE(e.name, ''), COALESCE(e.muscle_group, ''), COUNT(*),
+	                                  TO_CHAR(MIN(w.performed_on), 'YYYY-MM-DD'), TO_CHAR(MAX(w.performed_on), 'YYYY-MM-DD'),
+	                                  MAX(w.max_weight),
+	                                  MAX(w.max_weight) FILTER (WHERE w.last_rank = 1),
+	                                  ROUND(MAX(w.estimated_1rm), 2),
+	                                  SUM(w.volume),
+	                                  MAX(w.volume) FILTER (WHERE w.last_rank = 1),
+	                                  MAX(w.max_weight) FILTER (WHERE w.last_rank = 1) - MAX(w.max_weight) FILTER (WHERE w.first_rank = 1),
+	                                  COALESCE(MAX(w.machine_name) FILTER (WHERE w.last_rank = 1), ''),
+	                                  MAX(w.log_id) FILTER (WHERE w.last_rank = 1)
+	                           FROM per_workout w
+	                           LEFT JOIN exercises e ON e.id = w.exercise_id
+	                           GROUP BY w.exercise_id, e.name, e.muscle_group
+	                           ORDER BY MAX(w.performed_on) DESC, e.name`, clientID)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch exercise progress: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var progress []ExerciseProgress
+	for rows.Next() {
+		var p ExerciseProgress
+		if err := rows.Scan(&p.ExerciseID, &p.ExerciseName, &p.MuscleGroup, &p.Workouts, &p.FirstOn, &p.LastOn,
+			&p.BestWeight, &p.LastWeight, &p.BestEstimated1RM, &p.TotalVolume, &p.LastVolume, &p.ChangeSinceFirst,
+			&p.LastMachineName, &p.LastWorkoutID); err != nil {
+			sendErrorResponse(w, "Failed to scan exercise progress: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		progress = append(progress, p)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If nothing was logged yet, return empty array instead of null
+	if progress == nil {
+		progress = []ExerciseProgress{}
+	}
+
+	sendSuccessResponse(w, "Exercise progress retrieved successfully", progress)
+}
+
+// The workouts of one exercise, oldest first, to chart a client's progress on it
+func (app *App) getClientExerciseHistory(w http.ResponseWriter, r *http.Request) {
+	// Authenticate user
+	authHeader := r.Header.Get("Authorization")
+	if len(authHeader) < 8 || authHeader[:7] != "Bearer " {
+		sendErrorResponse(w, "Invalid authorization header", http.StatusUnauthorized)
+		return
+	}
+	tokenString := authHeader[7:] // Remove "Bearer "
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(JWT_SECRET), nil
+	})
+
+	if err != nil {
+		sendErrorResponse(w, "Invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	clientID, err := strconv.Atoi(vars["client_id"])
+	if err != nil || clientID <= 0 {
+		sendErrorResponse(w, "Invalid client_id parameter", http.StatusBadRequest)
+		return
+	}
+	exerciseID, err := strconv.Atoi(vars["exercise_id"])
+	if err != nil || exerciseID <= 0 {
+		sendErrorResponse(w, "Invalid exercise_id parameter", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseWorkoutPeriod(w, r)
+	if !ok {
+		return
+	}
+
+	// Check if user has permission for this client
+	var userExists bool
+	permissionQuery := `SELECT EXISTS(SELECT 1 FROM user_clients WHERE user_id = $1 AND client_id = $2)`
+	err = app.DB.QueryRow(permissionQuery, claims.UserID, clientID).Scan(&userExists)
+	if err != nil || !userExists {
+		sendErrorResponse(w, "Client not found or access denied", http.StatusForbidden)
+		return
+	}
+
+	rows, err := app.DB.Query(`SELECT l.id, TO_CHAR(l.performed_on, 'YYYY-MM-DD'),
+	                                  COALESCE(string_agg(DISTINCT m.name, ', '), ''),
+	                                  COUNT(*), COALESCE(SUM(s.reps), 0), MAX(s.weight),
+	                                  COALESCE(SUM(s.reps * s.weight), 0),
+	                                  ROUND(MAX(`+estimated1RMExpression+`), 2),
+	                                  COALESCE(SUM(s.duration_seconds), 0)
+	                           FROM workout_log_sets s
+	                           INNER JOIN workout_logs l ON l.id = s.log_id
+	                           LEFT JOIN machines m ON m.id = s.machine_id
+	                           WHERE l.client_id = $1 AND s.exercise_id = $2
+	                             AND ($3 = '' OR l.performed_on >= $3::date)
+	                             AND ($4 = '' OR l.performed_on <= $4::date)
+	                           GROUP BY l.id, l.performed_on
+	                           ORDER BY l.performed_on, l.id`, clientID, exerciseID, from, to)
+	if err != nil {
+		sendErrorResponse(w, "Failed to fetch exercise history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var history []ExerciseHistoryEntry
+	for rows.Next() {
+		var entry ExerciseHistoryEntry
+		if err := rows.Scan(&entry.WorkoutID, &entry.PerformedOn, &entry.Machines, &entry.Sets, &entry.Reps,
+			&entry.MaxWeight, &entry.Volume, &entry.Estimated1RM, &entry.DurationSeconds); err != nil {
+			sendErrorResponse(w, "Failed to scan exercise history: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		history = append(history, entry)
+	}
+
+	// Check for any row iteration errors
+	if err = rows.Err(); err != nil {
+		sendErrorResponse(w, "Error during row iteration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// If the exercise was never logged, return empty array instead of null
+	if history == nil {
+		history = []ExerciseHistoryEntry{}
+	}
+
+	sendSuccessResponse(w, "Exercise history retrieved successfully", history)
+}
+
+// loadClientWorkouts reads a client's workouts, or only workoutID, with their sets;
+// empty from and to do not limit the period
+func (app *App) loadClientWorkouts(clientID, workoutID int, from, to string, planID int) ([]WorkoutLog, error) {
+	filter := ` WHERE l.client_id = $1 AND ($2 = 0 OR l.id = $2)
+	              AND ($3 = '' OR l.performed_on >= $3::date)
+	              AND ($4 = '' OR l.performed_on <= $4::date)
+	              AND ($5 = 0 OR l.plan_id = $5)`
+
+	rows, err := app.DB.Query(workoutLogQuery+filter+` ORDER BY l.performed_on DESC, l.id DESC LIMIT 100`,
+		clientID, workoutID, from, to, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workouts := []WorkoutLog{}
+	byID := make(map[int]int)
+	for rows.Next() {
+		var workout WorkoutLog
+		if err := scanWorkoutLog(rows, &workout); err != nil {
+			return nil, err
+		}
+		workout.Sets = []WorkoutSet{}
+		byID[workout.ID] = len(workouts)
+		workouts = append(workouts, workout)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	setRows, err := app.DB.Query(`SELECT s.log_id, s.exercise_id, COALESCE(e.name, ''), s.machine_id, COALESCE(m.name, ''),
+	                                     s.set_no, s.reps, s.weight, s.duration_seconds, COALESCE(s.notes, '')
+	                              FROM workout_log_sets s
+	                              LEFT JOIN exercises e ON e.id = s.exercise_id
+	                              LEFT JOIN machines m ON m.id = s.machine_id
+	                              WHERE s.log_id IN (SELECT l.id FROM workout_logs l`+filter+`
+	                                                 ORDER BY l.performed_on DESC, l.id DESC LIMIT 100)
+	                              ORDER BY s.id`, clientID, workoutID, from, to, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer setRows.Close()
+
+	for setRows.Next() {
+		var id int
+		var set WorkoutSet
+		if err := setRows.Scan(&id, &set.ExerciseID, &set.ExerciseName, &set.MachineID, &set.MachineName, &set.SetNo,
+			&set.Reps, &set.Weight, &set.DurationSeconds, &set.Notes); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[id]; ok {
+			workouts[i].Sets = append(workouts[i].Sets, set)
+		}
+	}
+
+	return workouts, setRows.Err()
+}
+
+// parseWorkoutPeriod reads the optional from and to dates of workout history filters
+func parseWorkoutPeriod(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	if from != "" {
+		if _, err := time.Parse("2006-01-02", from); err != nil {
+			sendErrorResponse(w, "Invalid from parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return "", "", false
+		}
+	}
+	if to != "" {
+		if _, err := time.Parse("2006-01-02", to); err != nil {
+			sendErrorResponse(w, "Invalid to parameter (YYYY-MM-DD)", http.StatusBadRequest)
+			return "", "", false
+		}
+	}
+	if from != "" && to != "" && to < from {
+		sendErrorResponse(w, "to cannot be before from", http.StatusBadRequest)
+		return "", "", false
+	}
+	return from, to, true
+}
+
+// validateWorkoutLog checks the request and fills in the defaults
+func validateWorkoutLog(req *LogWorkoutRequest) ValidationErrors {
+	var fieldErrs ValidationErrors
+
+	if req.GymID <= 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "gym_id", Message: "Valid gym_id is required"})
+	}
+	if req.PlanID < 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "plan_id", Message: "invalid plan_id"})
+	}
+	if req.DayNo < 0 || req.DayNo > 7 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "day_no", Message: "day_no must be between 1 and 7"})
+	} else if req.DayNo != 0 && req.PlanID == 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "day_no", Message: "day_no needs a plan_id"})
+	}
+
+	if req.PerformedOn == "" {
+		req.PerformedOn = time.Now().Format("2006-01-02")
+	}
+	if performedOn, err := time.Parse("2006-01-02", req.PerformedOn); err != nil {
+		fieldErrs = append(fieldErrs, FieldError{Field: "performed_on", Message: "date must be in YYYY-MM-DD format"})
+	} else if performedOn.After(time.Now()) {
+		fieldErrs = append(fieldErrs, FieldError{Field: "performed_on", Message: "a workout cannot be logged in advance"})
+	}
+
+	if req.DurationMinutes < 0 || req.DurationMinutes > 600 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "duration_minutes", Message: "duration_minutes must be between 0 and 600"})
+	}
+	req.Notes = strings.TrimSpace(req.Notes)
+	if len(req.Notes) > 512 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "notes", Message: "notes cannot exceed 512 characters"})
+	}
+
+	if len(req.Sets) == 0 {
+		fieldErrs = append(fieldErrs, FieldError{Field: "sets", Message: "a workout needs at least one set"})
+	}
+	for i := range req.Sets {
+		set := &req.Sets[i]
+		field := "sets[" + strconv.Itoa(i) + "]"
+		if set.ExerciseID <= 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".exercise_id", Message: "Valid exercise_id is required"})
+		}
+		if set.MachineID < 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".machine_id", Message: "invalid machine_id"})
+		}
+		if set.Reps < 0 || set.Reps > 1000 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".reps", Message: "reps must be between 0 and 1000"})
+		}
+		if set.DurationSeconds < 0 || set.DurationSeconds > 36000 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".duration_seconds", Message: "duration_seconds must be between 0 and 36000"})
+		}
+		if set.Reps == 0 && set.DurationSeconds == 0 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field, Message: "a set needs reps or duration_seconds"})
+		}
+		if set.Weight != nil && (*set.Weight < 0 || *set.Weight > 1000) {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".weight", Message: "weight must be between 0 and 1000 kg"})
+		}
+		set.Notes = strings.TrimSpace(set.Notes)
+		if len(set.Notes) > 256 {
+			fieldErrs = append(fieldErrs, FieldError{Field: field + ".notes", Message: "notes cannot exceed 256 characters"})
+		}
+	}
+
+	return fieldErrs
+}